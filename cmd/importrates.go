@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/ratesheet"
+	"MortgageAgent/internal/worker"
+)
+
+// rateSheetSettle is how long a rate sheet must go unmodified before it is
+// imported, so files still being copied in are left for the next scan.
+const rateSheetSettle = time.Minute
+
+// importRates runs the import-rates command. Every CSV or XLSX file in a
+// subdirectory of dir named after a lender is read with that lender's rate
+// sheet columns and its rates applied at once. Imported files are moved to
+// the subdirectory's applied/ directory and rejected ones to failed/, next
+// to a .errors.txt file listing their problems.
+func importRates(database *sql.DB, dir string, args []string) error {
+	flags := flag.NewFlagSet("import-rates", flag.ExitOnError)
+	flags.StringVar(&dir, "dir", dir, "directory with one subdirectory of rate sheets per lender")
+	every := flags.Duration("every", 0, "keep watching the directory, scanning it this often")
+	dryRun := flags.Bool("dry-run", false, "print the changes without applying them or moving any files")
+	flags.Parse(args)
+
+	scan := func(ctx context.Context) error {
+		return scanRateSheets(database, dir, *dryRun)
+	}
+	if *every <= 0 {
+		return scan(context.Background())
+	}
+
+	slog.Info("Watching for rate sheets", "dir", dir, "every", *every)
+	workers := worker.NewGroup()
+	workers.Every("rate-import", *every, scan)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	<-ctx.Done()
+	return workers.Stop(context.Background())
+}
+
+// scanRateSheets imports every settled rate sheet under dir. A sheet that
+// cannot be imported because of a database error is left to retry.
+func scanRateSheets(database *sql.DB, dir string, dryRun bool) error {
+	lenders, err := db.GetLenders(database)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		var lender *models.Lender
+		for i := range lenders {
+			if strings.EqualFold(lenders[i].Name, entry.Name()) {
+				lender = &lenders[i]
+			}
+		}
+		if lender == nil {
+			slog.Warn("Skipping rate sheets for an unknown lender", "dir", entry.Name())
+			continue
+		}
+
+		lenderDir := filepath.Join(dir, entry.Name())
+		files, err := os.ReadDir(lenderDir)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			info, err := f.Info()
+			if err != nil || !info.Mode().IsRegular() || !ratesheet.Supported(f.Name()) || time.Since(info.ModTime()) < rateSheetSettle {
+				continue
+			}
+			if err := importRateSheet(database, lender, lenderDir, f.Name(), dryRun); err != nil {
+				return fmt.Errorf("%s: %w", filepath.Join(lenderDir, f.Name()), err)
+			}
+		}
+	}
+	return nil
+}
+
+// importRateSheet applies one lender's rate sheet and files it away.
+func importRateSheet(database *sql.DB, lender *models.Lender, dir, name string, dryRun bool) error {
+	path := filepath.Join(dir, name)
+	mapping, err := db.GetRateSheetMapping(database, lender.ID)
+	if err != nil {
+		return err
+	}
+	var rows []models.RateImportRow
+	if mapping == nil {
+		err = ratesheet.Errors{"The lender's rate sheet columns have not been set up."}
+	} else {
+		rows, err = readRateSheetFile(path, *mapping, lender.Products)
+	}
+	var problems ratesheet.Errors
+	if errors.As(err, &problems) {
+		slog.Warn("Rejected rate sheet", "lender", lender.Name, "sheet", name, "problems", len(problems))
+		if dryRun {
+			fmt.Printf("%s: %s rejected:\n%s\n", lender.Name, name, problems)
+			return nil
+		}
+		dest, err := fileRateSheet(dir, name, "failed")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dest+".errors.txt", []byte(problems.Error()+"\n"), 0o644)
+	}
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		for _, row := range rows {
+			previous, err := db.GetProductRate(database, row.ProductID, row.EffectiveFrom)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: %s: %s %.2f%% -> %.2f%% from %s\n", lender.Name, name, row.ProductName,
+				previous*100, row.Rate*100, row.EffectiveFrom.Format("2006-01-02"))
+		}
+		return nil
+	}
+
+	imp := models.RateImport{LenderID: lender.ID, Filename: name, Source: models.RateSourceDirectory, Rows: rows}
+	id, err := db.CreateRateImport(database, &imp)
+	if err != nil {
+		return err
+	}
+	if err := db.ApplyRateImport(database, id); err != nil {
+		return err
+	}
+	audit.RecordSystem(database, audit.Entry{
+		ActorEmail: "import-rates", Action: audit.RateImportApply, ResourceType: audit.ResourceRateImport,
+		ResourceID: strconv.Itoa(id), Details: fmt.Sprintf("%s: %d rates", name, len(rows)),
+	})
+	slog.Info("Applied rate sheet", "lender", lender.Name, "sheet", name, "rates", len(rows), "import_id", id)
+	_, err = fileRateSheet(dir, name, "applied")
+	return err
+}
+
+func readRateSheetFile(path string, m models.RateSheetMapping, products []models.LenderProduct) ([]models.RateImportRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rows, err := ratesheet.Read(f, filepath.Base(path), m)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return ratesheet.Resolve(rows, products, now, nil, now)
+}
+
+// fileRateSheet moves a processed sheet into the named subdirectory,
+// prefixing the time so repeated file names never collide, and returns its
+// new path.
+func fileRateSheet(dir, name, to string) (string, error) {
+	if err := os.MkdirAll(filepath.Join(dir, to), 0o755); err != nil {
+		return "", err
+	}
+	dest := filepath.Join(dir, to, time.Now().Format("20060102-150405-")+name)
+	return dest, os.Rename(filepath.Join(dir, name), dest)
+}
@@ -1,11 +1,37 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"MortgageAgent/internal/api"
+	"MortgageAgent/internal/auth"
+	"MortgageAgent/internal/calc"
+	"MortgageAgent/internal/clamav"
+	"MortgageAgent/internal/config"
 	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/digest"
+	"MortgageAgent/internal/extract"
 	"MortgageAgent/internal/handlers"
+	"MortgageAgent/internal/jobs"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/mail"
+	"MortgageAgent/internal/metrics"
+	"MortgageAgent/internal/notify"
+	"MortgageAgent/internal/reminders"
+	"MortgageAgent/internal/render"
+	"MortgageAgent/internal/scan"
+	"MortgageAgent/internal/server"
+	"MortgageAgent/internal/storage"
+	"MortgageAgent/internal/templates"
+	"MortgageAgent/internal/worker"
 	//"github.com/gorilla/mux"
 )
 
@@ -50,29 +76,70 @@ import (
 // 	mux.Handle("/view-application", handlers.AuthMiddleware(handlers.ViewApplication(database), database, "admin"))
 // 	// cmd/main.go
 
-// 	mux.Handle("/logout", handlers.Logout())
+// 	mux.Handle("/logout", handlers.Logout(database))
 
 // 	log.Println("Server running on :8080")
 // 	http.ListenAndServe(":8080", mux)
 // }
 
 func main() {
+	cfg := config.Load()
+	logging.Setup(cfg.Dev)
+
 	// Initialize DB
-	database, err := db.InitDB("app.db") // Adjust DSN as needed
+	database, err := db.InitDB(cfg.DatabaseDSN)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		fatal("Failed to connect to database", err)
 	}
 
 	// Migrate DB
 	err = db.MigrateDB(database)
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		fatal("Failed to migrate database", err)
 	}
 
 	// Seed Admin User
 	err = db.SeedAdminUser(database)
 	if err != nil {
-		log.Fatal("Failed to seed admin user:", err)
+		fatal("Failed to seed admin user", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "import-rates" {
+		if err := importRates(database, cfg.RateSheetDir, os.Args[2:]); err != nil {
+			fatal("Rate sheet import failed", err)
+		}
+		return
+	}
+
+	// Parse templates once; in dev mode they are re-read from disk on every request
+	var templateFS fs.FS = templates.FS
+	if cfg.Dev {
+		templateFS = os.DirFS(cfg.TemplateDir)
+	}
+	renderer, err := render.New(templateFS, cfg.Dev)
+	if err != nil {
+		fatal("Failed to load templates", err)
+	}
+	handlers.SetRenderer(renderer)
+	handlers.SetBaseURL(cfg.BaseURL)
+	handlers.SetRateHoldWarning(cfg.RateHoldWarningDays)
+	notify.Configure(cfg.BaseURL)
+	auth.SecureCookies = cfg.SecureCookies
+	calc.BenchmarkRate = cfg.BenchmarkRate
+	if err := auth.InitShareKey(database, cfg.ShareLinkKey); err != nil {
+		fatal("Failed to load share link key", err)
+	}
+	mail.Configure(mail.Config{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.MailFrom,
+		Dev:      cfg.Dev,
+	})
+	clamav.Configure(clamav.Config{Address: cfg.ClamdAddress, Timeout: cfg.ClamdTimeout, Dev: cfg.Dev})
+	if cfg.TesseractPath != "" {
+		extract.Configure(extract.Tesseract{Path: cfg.TesseractPath, PDFToPPM: cfg.PDFToPPMPath})
 	}
 
 	mux := http.NewServeMux()
@@ -83,6 +150,18 @@ func main() {
 
 	// Serve uploaded documents securely
 	mux.Handle("/serve-document", handlers.AuthMiddleware(handlers.ServeDocument(database), database, "admin"))
+	mux.Handle("/documents/package", handlers.AuthMiddleware(handlers.DocumentPackage(database), database, "admin"))
+	mux.Handle("/documents/share", handlers.SessionOnly(handlers.AuthMiddleware(handlers.ShareDocument(database), database, "admin")))
+	mux.Handle("/documents/share/revoke", handlers.SessionOnly(handlers.AuthMiddleware(handlers.RevokeShare(database), database, "admin")))
+
+	// Share links are opened by people without an account
+	mux.HandleFunc("/share", handlers.SharedDocument(database))
+
+	// Liveness and readiness probes, and Prometheus metrics
+	mux.HandleFunc("/healthz", handlers.Healthz())
+	mux.HandleFunc("/readyz", handlers.Readyz(database))
+	metrics.RegisterQueueDepth(func() (map[int]int, error) { return db.GetAdminQueueDepths(database) })
+	mux.Handle("/metrics", metrics.Handler(cfg.MetricsToken))
 
 	// Routes without middleware
 	mux.HandleFunc("/", handlers.LoginPage(database))
@@ -92,9 +171,9 @@ func main() {
 	mux.HandleFunc("/signup-success", handlers.SignUpSuccessPage())
 
 	// Routes with middleware
-	mux.Handle("/broker", handlers.AuthMiddleware(handlers.BrokerLanding(), database, "broker"))
+	mux.Handle("/broker", handlers.AuthMiddleware(handlers.BrokerLanding(database), database, "broker"))
 	mux.Handle("/admin-dashboard", handlers.AuthMiddleware(handlers.AdminDashboard(database), database, "admin"))
-	mux.Handle("/logout", handlers.Logout())
+	mux.Handle("/logout", handlers.Logout(database))
 
 	// Forgot/Reset Password
 	mux.HandleFunc("/forgot-password", handlers.ForgotPasswordPage(database))
@@ -103,13 +182,172 @@ func main() {
 	// Application Routes
 	mux.Handle("/application", handlers.AuthMiddleware(handlers.StartApplication(database), database, "broker"))
 	mux.Handle("/application-form", handlers.AuthMiddleware(handlers.ApplicationFormPage(database), database, "broker"))
+	mux.Handle("/application/invite", handlers.AuthMiddleware(handlers.InviteBorrower(database), database, "broker"))
+	mux.Handle("/application/financials", handlers.AuthMiddleware(handlers.SaveFinancials(database), database, "broker"))
+	mux.Handle("/calculator", handlers.AuthMiddleware(handlers.Calculator(database), database, "broker"))
+	mux.Handle("/schedule", handlers.AuthMiddleware(handlers.PaymentSchedule(database), database, "broker"))
+	mux.Handle("/schedule/attach", handlers.AuthMiddleware(handlers.AttachSchedule(database), database, "broker"))
+	mux.Handle("/application/messages", handlers.AuthMiddleware(handlers.PostBrokerMessage(database), database, "broker"))
+	mux.Handle("/application/messages/attachment", handlers.AuthMiddleware(handlers.MessageAttachment(database), database, "broker"))
+	mux.Handle("/application/conditions/respond", handlers.AuthMiddleware(handlers.RespondToCondition(database), database, "broker"))
+	mux.Handle("/application/holds", handlers.AuthMiddleware(handlers.CreateRateHold(database), database, "broker"))
+	mux.Handle("/application/holds/release", handlers.AuthMiddleware(handlers.ReleaseRateHold(database), database, "broker"))
+	mux.Handle("/application/commitments", handlers.AuthMiddleware(handlers.CreateCommitment(database), database, "broker"))
+	mux.Handle("/application/commitments/conditions", handlers.AuthMiddleware(handlers.AddCommitmentCondition(database), database, "broker"))
+	mux.Handle("/application/commitments/conditions/satisfy", handlers.AuthMiddleware(handlers.SatisfyCommitmentCondition(database), database, "broker"))
+	mux.Handle("/application-progress", handlers.AuthMiddleware(handlers.ApplicationProgress(database), database, "broker"))
+
+	// Borrower portal. Borrowers only ever use a browser session.
+	mux.HandleFunc("/borrower/invite", handlers.AcceptInvitePage(database))
+	mux.Handle("/borrower", handlers.SessionOnly(handlers.AuthMiddleware(handlers.BorrowerPortal(database), database, "borrower")))
+	mux.Handle("/borrower/upload", handlers.SessionOnly(handlers.AuthMiddleware(handlers.BorrowerUpload(database), database, "borrower")))
+	mux.Handle("/borrower/consent", handlers.SessionOnly(handlers.AuthMiddleware(handlers.BorrowerConsent(database), database, "borrower")))
 
 	// Admin Specific Routes
 	mux.Handle("/view-application", handlers.AuthMiddleware(handlers.ViewApplication(database), database, "admin"))
+	mux.Handle("/admin/messages", handlers.AuthMiddleware(handlers.PostAdminMessage(database), database, "admin"))
+	mux.Handle("/admin/conditions", handlers.AuthMiddleware(handlers.AddCondition(database), database, "admin"))
+	mux.Handle("/admin/conditions/clear", handlers.AuthMiddleware(handlers.ClearCondition(database), database, "admin"))
+	mux.Handle("/admin/conditions/return", handlers.AuthMiddleware(handlers.ReturnCondition(database), database, "admin"))
+	mux.Handle("/admin/documents/fields", handlers.AuthMiddleware(handlers.ConfirmExtraction(database), database, "admin"))
+	mux.Handle("/admin/users", handlers.AuthMiddleware(handlers.UsersPage(database), database, "admin"))
+	mux.Handle("/admin/users/role", handlers.AuthMiddleware(handlers.SetUserRole(database), database, "admin"))
+	mux.Handle("/admin/lenders", handlers.AuthMiddleware(handlers.LendersPage(database), database, "admin"))
+	mux.Handle("/admin/lenders/create", handlers.AuthMiddleware(handlers.CreateLender(database), database, "admin"))
+	mux.Handle("/admin/lenders/active", handlers.AuthMiddleware(handlers.SetLenderActive(database), database, "admin"))
+	mux.Handle("/admin/products/edit", handlers.AuthMiddleware(handlers.EditProduct(database), database, "admin"))
+	mux.Handle("/admin/products/active", handlers.AuthMiddleware(handlers.SetProductActive(database), database, "admin"))
+	mux.Handle("/admin/rates", handlers.AuthMiddleware(handlers.RatesPage(database), database, "admin"))
+	mux.Handle("/admin/rates/upload", handlers.AuthMiddleware(handlers.UploadRateSheet(database), database, "admin"))
+	mux.Handle("/admin/rates/import", handlers.AuthMiddleware(handlers.RateImportPage(database), database, "admin"))
+	mux.Handle("/admin/rates/apply", handlers.AuthMiddleware(handlers.ApplyRateImport(database), database, "admin"))
+	mux.Handle("/admin/rates/discard", handlers.AuthMiddleware(handlers.DiscardRateImport(database), database, "admin"))
+	mux.Handle("/admin/rates/mapping", handlers.AuthMiddleware(handlers.RateSheetMapping(database), database, "admin"))
+	mux.Handle("/admin/jobs", handlers.AuthMiddleware(handlers.JobsPage(database), database, "admin"))
+	mux.Handle("/admin/jobs/retry", handlers.AuthMiddleware(handlers.RetryJob(database), database, "admin"))
 
-	log.Println("Server running on :8080")
-	err = http.ListenAndServe(":8080", mux)
-	if err != nil {
-		log.Fatal("ListenAndServe:", err)
+	// Audit log, readable only by auditors
+	mux.Handle("/audit", handlers.AuthMiddleware(handlers.AuditLog(database), database, "auditor"))
+	mux.Handle("/audit/export.csv", handlers.AuthMiddleware(handlers.AuditExport(database), database, "auditor"))
+
+	// Notification inbox, preferences and the live event stream
+	mux.Handle("/notifications", handlers.AuthMiddleware(handlers.NotificationsPage(database), database, ""))
+	mux.Handle("/notifications/open", handlers.AuthMiddleware(handlers.OpenNotification(database), database, ""))
+	mux.Handle("/notifications/read", handlers.AuthMiddleware(handlers.MarkNotificationsRead(database), database, ""))
+	mux.Handle("/notifications/preferences", handlers.AuthMiddleware(handlers.SaveNotificationPreferences(database), database, ""))
+	mux.Handle("/notifications/stream", handlers.SessionOnly(handlers.AuthMiddleware(handlers.NotificationStream(database), database, "")))
+
+	// Settings: personal access tokens and service accounts
+	mux.Handle("/settings", handlers.SessionOnly(handlers.AuthMiddleware(handlers.SettingsPage(database), database, "")))
+	mux.Handle("/settings/tokens", handlers.SessionOnly(handlers.AuthMiddleware(handlers.CreateTokenHandler(database), database, "")))
+	mux.Handle("/settings/tokens/revoke", handlers.SessionOnly(handlers.AuthMiddleware(handlers.RevokeTokenHandler(database), database, "")))
+	mux.Handle("/settings/clients", handlers.SessionOnly(handlers.AuthMiddleware(handlers.CreateClientHandler(database), database, "")))
+	mux.Handle("/settings/clients/revoke", handlers.SessionOnly(handlers.AuthMiddleware(handlers.RevokeClientHandler(database), database, "")))
+
+	// JSON API and the OAuth2 token endpoint for machine clients
+	apiServer := api.New(database)
+	mux.Handle(api.Prefix+"/", apiServer.Handler())
+	mux.Handle(api.TokenPath, apiServer.TokenHandler())
+
+	// Every unsafe request must carry the session's CSRF token. The API
+	// enforces its own check so it can answer in JSON, and the token endpoint
+	// is only used by machine clients.
+	csrf := auth.CSRF(database, http.HandlerFunc(handlers.CSRFFailed), api.Prefix+"/", api.TokenPath)
+
+	// Background maintenance
+	workers := worker.NewGroup()
+	workers.Every("session-cleanup", time.Hour, func(ctx context.Context) error {
+		_, err := db.DeleteExpiredSessions(database, time.Now())
+		return err
+	})
+	workers.Every("upload-temp-cleanup", time.Hour, func(ctx context.Context) error {
+		_, err := storage.RemoveStaleTemp(24 * time.Hour)
+		return err
+	})
+
+	// Job queue: kinds of job, the recurring ones, and the workers that run
+	// them
+	jobs.Register(jobs.KindEmail, jobs.SendEmail)
+	jobs.Register(handlers.KindPasswordResetEmail, handlers.SendPasswordReset(database))
+	jobs.Register(handlers.KindBorrowerInvite, handlers.SendBorrowerInvite(database))
+	jobs.Register(scan.Kind, scan.Document(database))
+	jobs.Register(extract.Kind, extract.Document(database))
+	if n, err := scan.QueuePending(database); err != nil {
+		slog.Error("Error queueing virus scans", "err", err)
+	} else if n > 0 {
+		slog.Info("Queued virus scans of unscanned documents", "count", n)
+	}
+	jobs.Register("rate_hold_reminders", func(ctx context.Context, _ []byte) error {
+		_, err := reminders.RateHolds(database, cfg.RateHoldWarningDays, time.Now())
+		return err
+	})
+	digests := digest.Config{BaseURL: cfg.BaseURL, Hour: cfg.DigestHour, StalledDays: cfg.StalledDays, WarnDays: cfg.RateHoldWarningDays}
+	jobs.Register("digests", func(ctx context.Context, _ []byte) error {
+		_, err := digest.Run(database, digests, time.Now())
+		return err
+	})
+	if err := jobs.Cron("rate-hold-reminders", "0 6 * * *", "rate_hold_reminders"); err != nil {
+		fatal("Invalid job schedule", err)
+	}
+	if err := jobs.Cron("digests", "0 * * * *", "digests"); err != nil {
+		fatal("Invalid job schedule", err)
+	}
+	for i := range cfg.JobWorkers {
+		workers.Every(fmt.Sprintf("jobs-%d", i+1), cfg.JobPollInterval, func(ctx context.Context) error {
+			return jobs.Work(ctx, database)
+		})
 	}
+	workers.Every("job-scheduler", time.Minute, func(ctx context.Context) error {
+		now := time.Now()
+		if err := jobs.Recover(database, now); err != nil {
+			return err
+		}
+		if err := jobs.Prune(database, now); err != nil {
+			return err
+		}
+		return jobs.EnqueueDue(database, now)
+	})
+
+	// Log every request under the pattern that serves it, never the raw path
+	route := func(r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		return pattern
+	}
+
+	srv := server.New(cfg, logging.Middleware(metrics.Middleware(csrf(mux)), route))
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+
+	// Stop on SIGTERM (deploys) or Ctrl-C, letting in-flight requests such
+	// as uploads finish first
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	select {
+	case err := <-serveErr:
+		fatal("ListenAndServe", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, waiting for requests to finish", "timeout", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	// Live notification streams never finish on their own
+	notify.Close()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error shutting down server", "err", err)
+	}
+	if err := workers.Stop(shutdownCtx); err != nil {
+		slog.Error("Error stopping background workers", "err", err)
+	}
+	if err := database.Close(); err != nil {
+		slog.Error("Error closing database", "err", err)
+	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs a startup failure and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
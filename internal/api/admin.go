@@ -0,0 +1,116 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/metrics"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/notify"
+)
+
+type statusRequest struct {
+	Status string `json:"status"`
+}
+
+type assignRequest struct {
+	AdminID int `json:"admin_id"`
+}
+
+// reviewStatuses are the statuses an admin may move a submitted application to.
+var reviewStatuses = []string{models.StatusSubmitted, models.StatusInReview, models.StatusApproved, models.StatusDeclined}
+
+func (a *API) listAdmins(w http.ResponseWriter, r *http.Request) {
+	admins, err := db.GetUsersByType(a.db, "admin")
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	out := []userJSON{}
+	for i := range admins {
+		out = append(out, toUserJSON(&admins[i]))
+	}
+	writeJSON(w, http.StatusOK, dataBody{Data: out, Pagination: newPagination(1, max(len(out), 1), len(out))})
+}
+
+func (a *API) setStatus(w http.ResponseWriter, r *http.Request) {
+	app, ok := a.loadApplication(w, r)
+	if !ok {
+		return
+	}
+	var req statusRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !contains(reviewStatuses, req.Status) {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_status", "status must be one of submitted, in_review, approved or declined")
+		return
+	}
+
+	err := db.SetApplicationStatus(a.db, app.ID, req.Status)
+	if errors.Is(err, db.ErrConditionsOutstanding) {
+		writeError(w, http.StatusConflict, "conditions_outstanding", "every condition must be cleared before the application is approved")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	metrics.StatusChanged(app.Status, req.Status)
+	audit.Record(r, a.db, audit.Entry{
+		Action: audit.StatusChange, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+		Details: app.Status + " -> " + req.Status,
+	})
+	if req.Status != app.Status {
+		if err := notify.StatusChanged(a.db, app, req.Status); err != nil {
+			logging.FromContext(r.Context()).Error("Error sending status notification", "err", err)
+		}
+	}
+	app.Status = req.Status
+	a.writeApplication(w, r, http.StatusOK, app)
+}
+
+func (a *API) assign(w http.ResponseWriter, r *http.Request) {
+	app, ok := a.loadApplication(w, r)
+	if !ok {
+		return
+	}
+	var req assignRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	admin, err := db.GetUserByID(a.db, req.AdminID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && admin.UserType != "admin") {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_admin", "admin_id does not name an admin")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	if err := db.SetApplicationAdmin(a.db, app.ID, admin.ID); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	audit.Record(r, a.db, audit.Entry{
+		Action: audit.Assign, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+		Details: "assigned to admin " + strconv.Itoa(admin.ID),
+	})
+	if previous := app.AssignedAdminID; previous == nil || *previous != admin.ID {
+		if previous != nil {
+			notify.Refresh(*previous)
+		}
+		if err := notify.Assigned(a.db, app, admin.ID); err != nil {
+			logging.FromContext(r.Context()).Error("Error sending assignment notification", "err", err)
+		}
+	}
+	app.AssignedAdminID = &admin.ID
+	a.writeApplication(w, r, http.StatusOK, app)
+}
@@ -0,0 +1,229 @@
+// Package api serves the versioned JSON API under /api/v1. It exposes the same
+// applications, documents and admin actions as the HTML pages for CRM and
+// mobile integrations.
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"MortgageAgent/internal/auth"
+	"MortgageAgent/internal/logging"
+)
+
+// Prefix is the path every API route is mounted under.
+const Prefix = "/api/v1"
+
+// maxBodyBytes caps JSON request bodies; uploads have their own limit.
+const maxBodyBytes = 1 << 20
+
+// API holds the dependencies shared by the JSON handlers.
+type API struct {
+	db     *sql.DB
+	routes []route
+}
+
+// route describes one endpoint. The same table drives the ServeMux, the
+// authorization checks and the generated OpenAPI document, so the spec cannot
+// drift from the handlers.
+type route struct {
+	method  string
+	path    string // relative to Prefix, with {name} path parameters
+	summary string
+	tag     string
+	// public routes skip authentication; otherwise roles, when set, lists
+	// the user types allowed to call the route.
+	public bool
+	roles  []string
+	// query lists the supported query parameters.
+	query []string
+	// request and response are zero values of the JSON body types, used to
+	// generate schemas. list marks responses wrapped in a paginated envelope.
+	request  interface{}
+	response interface{}
+	list     bool
+	// upload marks multipart/form-data requests.
+	upload  bool
+	handler http.HandlerFunc
+}
+
+// scope returns the token scope needed to call the route.
+func (rt route) scope() string {
+	return auth.ScopeFor(rt.method, len(rt.roles) == 1 && rt.roles[0] == "admin")
+}
+
+// New builds the API around an open database.
+func New(database *sql.DB) *API {
+	a := &API{db: database}
+	a.routes = a.routeTable()
+	return a
+}
+
+func (a *API) routeTable() []route {
+	listQuery := []string{"page", "per_page", "status", "type", "broker", "from", "to", "sort", "order"}
+	return []route{
+		{method: "GET", path: "/openapi.json", summary: "OpenAPI description of this API", tag: "meta", public: true, handler: a.openAPI},
+
+		{method: "POST", path: "/auth/login", summary: "Log in and start a session", tag: "auth", public: true, request: loginRequest{}, response: userJSON{}, handler: a.login},
+		{method: "POST", path: "/auth/logout", summary: "End the current session", tag: "auth", handler: a.logout},
+		{method: "GET", path: "/auth/me", summary: "The authenticated user", tag: "auth", response: userJSON{}, handler: a.me},
+
+		{method: "GET", path: "/applications", summary: "List the caller's applications", tag: "applications", query: listQuery, response: applicationJSON{}, list: true, handler: a.listApplications},
+		{method: "POST", path: "/applications", summary: "Create a draft application", tag: "applications", roles: []string{"broker"}, request: applicationRequest{}, response: applicationJSON{}, handler: a.createApplication},
+		{method: "GET", path: "/applications/{id}", summary: "Get an application", tag: "applications", response: applicationJSON{}, handler: a.getApplication},
+		{method: "PATCH", path: "/applications/{id}", summary: "Update a draft application", tag: "applications", roles: []string{"broker"}, request: applicationRequest{}, response: applicationJSON{}, handler: a.updateApplication},
+		{method: "POST", path: "/applications/{id}/submit", summary: "Submit a draft application for review", tag: "applications", roles: []string{"broker"}, response: applicationJSON{}, handler: a.submitApplication},
+
+		{method: "GET", path: "/applications/{id}/documents", summary: "List an application's documents", tag: "documents", response: documentJSON{}, list: true, handler: a.listDocuments},
+		{method: "POST", path: "/applications/{id}/documents", summary: "Upload a document (multipart fields: category, file)", tag: "documents", roles: []string{"broker"}, upload: true, response: documentJSON{}, handler: a.uploadDocument},
+		{method: "GET", path: "/documents/{id}", summary: "Get a document's metadata", tag: "documents", response: documentJSON{}, handler: a.getDocument},
+		{method: "GET", path: "/documents/{id}/download", summary: "Download a document's file", tag: "documents", handler: a.downloadDocument},
+
+		{method: "GET", path: "/admin/admins", summary: "List admins applications can be assigned to", tag: "admin", roles: []string{"admin"}, response: userJSON{}, list: true, handler: a.listAdmins},
+		{method: "POST", path: "/admin/applications/{id}/status", summary: "Change an application's status; approving fails while conditions are not cleared", tag: "admin", roles: []string{"admin"}, request: statusRequest{}, response: applicationJSON{}, handler: a.setStatus},
+		{method: "POST", path: "/admin/applications/{id}/assign", summary: "Reassign an application to another admin", tag: "admin", roles: []string{"admin"}, request: assignRequest{}, response: applicationJSON{}, handler: a.assign},
+	}
+}
+
+// Handler returns the http.Handler serving every route under Prefix.
+// Session-authenticated callers must send the X-CSRF-Token header on unsafe
+// requests; bearer tokens are exempt.
+func (a *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range a.routes {
+		mux.Handle(rt.method+" "+Prefix+rt.path, a.authorize(rt))
+	}
+	mux.HandleFunc(Prefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not_found", "no such endpoint")
+	})
+
+	csrfFailed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusForbidden, "csrf_failed", "missing or invalid "+auth.CSRFHeader+" header")
+	})
+	return auth.CSRF(a.db, csrfFailed, Prefix+"/auth/login")(mux)
+}
+
+// authorize authenticates the caller and enforces the route's roles.
+func (a *API) authorize(rt route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.SetRoute(r.Context(), rt.method+" "+Prefix+rt.path)
+		if rt.public {
+			rt.handler(w, r)
+			return
+		}
+
+		identity, err := auth.Authenticate(r, a.db)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeError(w, http.StatusUnauthorized, "unauthenticated", "authentication required")
+			return
+		}
+		user := identity.User
+		if len(rt.roles) > 0 && !contains(rt.roles, user.UserType) {
+			writeError(w, http.StatusForbidden, "forbidden", "your account cannot perform this action")
+			return
+		}
+		if !identity.Allows(rt.scope()) {
+			writeError(w, http.StatusForbidden, "insufficient_scope", "this token needs the "+rt.scope()+" scope")
+			return
+		}
+
+		logging.SetUser(r.Context(), user.ID)
+		rt.handler(w, r.WithContext(auth.WithUser(r.Context(), user)))
+	})
+}
+
+// errorBody is the envelope every error response uses.
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// dataBody wraps successful responses.
+type dataBody struct {
+	Data       interface{} `json:"data"`
+	Pagination *pagination `json:"pagination,omitempty"`
+}
+
+type pagination struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+func newPagination(page, perPage, total int) *pagination {
+	return &pagination{Page: page, PerPage: perPage, Total: total, TotalPages: (total + perPage - 1) / perPage}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Warn("Error encoding API response", "err", err)
+	}
+}
+
+func writeData(w http.ResponseWriter, status int, data interface{}) {
+	writeJSON(w, status, dataBody{Data: data})
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, errorBody{Error: errorDetail{Code: code, Message: message}})
+}
+
+func writeInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	logging.FromContext(r.Context()).Error("API internal error", "err", err)
+	writeError(w, http.StatusInternalServerError, "internal_error", "internal server error")
+}
+
+// decodeJSON reads a JSON request body into dst, rejecting unknown fields.
+// On failure it writes the error response and returns false. The body must
+// be sent as application/json: a cross-site form can post text/plain that
+// happens to be valid JSON, but not this without a CORS preflight.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "send the request body as application/json")
+		return false
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		msg := "invalid JSON body"
+		if errors.Is(err, io.EOF) {
+			msg = "request body is required"
+		}
+		writeError(w, http.StatusBadRequest, "invalid_request", msg)
+		return false
+	}
+	return true
+}
+
+// pathID parses the {id} path parameter, writing a 404 when it is not a number.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusNotFound, "not_found", "not found")
+		return 0, false
+	}
+	return id, true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
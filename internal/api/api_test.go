@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"MortgageAgent/internal/db"
+)
+
+func TestDecodeJSONContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        int
+	}{
+		{"application/json", http.StatusOK},
+		{"application/json; charset=utf-8", http.StatusOK},
+		{"", http.StatusUnsupportedMediaType},
+		{"text/plain", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"multipart/form-data; boundary=x", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email":"a@example.com"}`))
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		w := httptest.NewRecorder()
+		var dst loginRequest
+		if ok := decodeJSON(w, r, &dst); ok != (tt.want == http.StatusOK) || ok && dst.Email != "a@example.com" {
+			t.Errorf("%q: decoded %v into %+v", tt.contentType, ok, dst)
+		}
+		if tt.want != http.StatusOK && w.Code != tt.want {
+			t.Errorf("%q: status %d, want %d", tt.contentType, w.Code, tt.want)
+		}
+	}
+}
+
+// A cross-site form posting text/plain that reads as JSON must not sign the
+// browser in to the attacker's account.
+func TestLoginRejectsCrossSiteForm(t *testing.T) {
+	database, err := db.InitDB(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := db.MigrateDB(database); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateUser(database, "Eve", "Attacker", "evil@example.com", "", "", "pa=ss"); err != nil {
+		t.Fatal(err)
+	}
+	handler := New(database).Handler()
+
+	// The form field name and value join with "=" into valid JSON, so the
+	// attacker's password has one in it
+	body := `{"email":"evil@example.com","password":"pa` + "=" + `ss"}`
+	login := func(contentType, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, Prefix+"/auth/login", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := login("text/plain", body)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("text/plain login: status %d, want 415", w.Code)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("text/plain login set cookies %v", cookies)
+	}
+
+	w = login("application/json", `{"email":"evil@example.com","password":"pa=ss"}`)
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) == 0 {
+		t.Errorf("JSON login: status %d with cookies %v, want 200 and a session", w.Code, w.Result().Cookies())
+	}
+}
@@ -0,0 +1,299 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/auth"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/metrics"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/notify"
+)
+
+const (
+	defaultPerPage = 25
+	maxPerPage     = 100
+)
+
+type applicationRequest struct {
+	ApplicationType string `json:"application_type"`
+}
+
+type applicationJSON struct {
+	ID              int            `json:"id"`
+	BrokerID        int            `json:"broker_id"`
+	BrokerName      string         `json:"broker_name,omitempty"`
+	ApplicationType string         `json:"application_type"`
+	Status          string         `json:"status"`
+	AssignedAdminID *int           `json:"assigned_admin_id"`
+	BorrowerID      *int           `json:"borrower_id"`
+	ConsentAt       *time.Time     `json:"consent_at"`
+	CreatedAt       time.Time      `json:"created_at"`
+	Documents       []documentJSON `json:"documents"`
+}
+
+func toApplicationJSON(app *models.ApplicationWithDocuments) applicationJSON {
+	out := applicationJSON{
+		ID:              app.ID,
+		BrokerID:        app.BrokerID,
+		BrokerName:      app.BrokerName,
+		ApplicationType: app.ApplicationType,
+		Status:          app.Status,
+		AssignedAdminID: app.AssignedAdminID,
+		CreatedAt:       app.CreatedAt,
+		Documents:       []documentJSON{},
+	}
+	for _, d := range app.Documents {
+		out.Documents = append(out.Documents, toDocumentJSON(app.ID, d))
+	}
+	return out
+}
+
+// canAccess reports whether user may read app: brokers see their own
+// applications and admins the ones assigned to them.
+func canAccess(user *models.User, app *models.Application) bool {
+	switch user.UserType {
+	case "broker":
+		return app.BrokerID == user.ID
+	case "admin":
+		return app.AssignedAdminID != nil && *app.AssignedAdminID == user.ID
+	}
+	return false
+}
+
+// isAdmin reports whether the caller is an admin, who may see files attached
+// to internal notes.
+func isAdmin(r *http.Request) bool {
+	return auth.UserFromContext(r.Context()).UserType == "admin"
+}
+
+// loadApplication fetches the application named by the {id} path parameter
+// and checks the caller may access it. On failure it writes the response and
+// returns false. Inaccessible applications are reported as missing so IDs
+// cannot be probed.
+func (a *API) loadApplication(w http.ResponseWriter, r *http.Request) (*models.Application, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return nil, false
+	}
+	logging.SetApplication(r.Context(), id)
+	app, err := db.GetApplicationByID(a.db, strconv.Itoa(id))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return nil, false
+	}
+	if app == nil || !canAccess(auth.UserFromContext(r.Context()), app) {
+		writeError(w, http.StatusNotFound, "not_found", "application not found")
+		return nil, false
+	}
+	return app, true
+}
+
+// writeApplication responds with the application and its documents.
+func (a *API) writeApplication(w http.ResponseWriter, r *http.Request, status int, app *models.Application) {
+	docs, err := db.GetDocumentsForApplication(a.db, app.ID, isAdmin(r))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	full := models.ApplicationWithDocuments{
+		ID:              app.ID,
+		BrokerID:        app.BrokerID,
+		ApplicationType: app.ApplicationType,
+		AssignedAdminID: app.AssignedAdminID,
+		Status:          app.Status,
+		CreatedAt:       app.CreatedAt,
+	}
+	for i := range docs {
+		full.Documents = append(full.Documents, documentInfo(&docs[i]))
+	}
+	out := toApplicationJSON(&full)
+	out.BorrowerID = app.BorrowerID
+	out.ConsentAt = app.ConsentAt
+	writeData(w, status, out)
+}
+
+func (a *API) listApplications(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	q := r.URL.Query()
+
+	filter := db.ApplicationFilter{
+		Status:   q.Get("status"),
+		Type:     q.Get("type"),
+		Broker:   strings.TrimSpace(q.Get("broker")),
+		DateFrom: q.Get("from"),
+		DateTo:   q.Get("to"),
+		Sort:     q.Get("sort"),
+		Desc:     q.Get("order") != "asc",
+	}
+	filter.Page, _ = strconv.Atoi(q.Get("page"))
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	filter.PerPage, _ = strconv.Atoi(q.Get("per_page"))
+	if filter.PerPage < 1 {
+		filter.PerPage = defaultPerPage
+	}
+	if filter.PerPage > maxPerPage {
+		filter.PerPage = maxPerPage
+	}
+	for _, date := range []string{filter.DateFrom, filter.DateTo} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "dates must use the YYYY-MM-DD format")
+			return
+		}
+	}
+
+	var apps []models.ApplicationWithDocuments
+	var total int
+	var err error
+	switch user.UserType {
+	case "admin":
+		apps, total, err = db.GetApplicationsForAdmin(a.db, user.ID, filter)
+	case "broker":
+		apps, total, err = db.GetApplicationsForBroker(a.db, user.ID, filter)
+	default:
+		writeError(w, http.StatusForbidden, "forbidden", "your account cannot list applications")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	out := []applicationJSON{}
+	for i := range apps {
+		out = append(out, toApplicationJSON(&apps[i]))
+	}
+	writeJSON(w, http.StatusOK, dataBody{Data: out, Pagination: newPagination(filter.Page, filter.PerPage, total)})
+}
+
+func validApplicationType(t string) bool {
+	return t == models.TypeSelf || t == models.TypeSomeoneElse
+}
+
+func (a *API) createApplication(w http.ResponseWriter, r *http.Request) {
+	var req applicationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !validApplicationType(req.ApplicationType) {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_application_type", `application_type must be "self" or "someone_else"`)
+		return
+	}
+
+	user := auth.UserFromContext(r.Context())
+	id, err := db.CreateApplication(a.db, user.ID, req.ApplicationType)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	app, err := db.GetApplicationByID(a.db, strconv.Itoa(id))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	a.writeApplication(w, r, http.StatusCreated, app)
+}
+
+func (a *API) getApplication(w http.ResponseWriter, r *http.Request) {
+	app, ok := a.loadApplication(w, r)
+	if !ok {
+		return
+	}
+	if err := audit.Record(r, a.db, audit.Entry{
+		Action: audit.ApplicationView, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+	}); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	a.writeApplication(w, r, http.StatusOK, app)
+}
+
+func (a *API) updateApplication(w http.ResponseWriter, r *http.Request) {
+	app, ok := a.loadApplication(w, r)
+	if !ok {
+		return
+	}
+	var req applicationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if app.Status != models.StatusDraft {
+		writeError(w, http.StatusConflict, "not_draft", "only draft applications can be changed")
+		return
+	}
+	if !validApplicationType(req.ApplicationType) {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_application_type", `application_type must be "self" or "someone_else"`)
+		return
+	}
+
+	if err := db.SetApplicationType(a.db, app.ID, req.ApplicationType); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	app.ApplicationType = req.ApplicationType
+	a.writeApplication(w, r, http.StatusOK, app)
+}
+
+func (a *API) submitApplication(w http.ResponseWriter, r *http.Request) {
+	app, ok := a.loadApplication(w, r)
+	if !ok {
+		return
+	}
+	if app.Status != models.StatusDraft {
+		writeError(w, http.StatusConflict, "not_draft", "the application has already been submitted")
+		return
+	}
+
+	docs, err := db.GetDocumentsForApplication(a.db, app.ID, false)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	uploaded := map[string]bool{}
+	for _, d := range docs {
+		uploaded[d.Category] = uploaded[d.Category] || !models.ScanRejected(d.ScanStatus)
+	}
+	var missing []string
+	for _, cat := range models.DocumentCategories {
+		if !uploaded[cat] {
+			missing = append(missing, cat)
+		}
+	}
+	if len(missing) > 0 {
+		writeError(w, http.StatusUnprocessableEntity, "missing_documents", "missing documents: "+strings.Join(missing, ", "))
+		return
+	}
+	if app.NeedsConsent() {
+		writeError(w, http.StatusUnprocessableEntity, "consent_required", "the borrower has not given e-consent")
+		return
+	}
+
+	adminID, err := db.SubmitApplication(a.db, app.ID)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	metrics.ApplicationSubmitted(app.Status, models.StatusSubmitted)
+	id := strconv.Itoa(app.ID)
+	audit.Record(r, a.db, audit.Entry{Action: audit.ApplicationSubmit, ResourceType: audit.ResourceApplication, ResourceID: id})
+	audit.Record(r, a.db, audit.Entry{
+		Action: audit.Assign, ResourceType: audit.ResourceApplication, ResourceID: id,
+		Details: "auto-assigned to admin " + strconv.Itoa(adminID),
+	})
+	if err := notify.Assigned(a.db, app, adminID); err != nil {
+		logging.FromContext(r.Context()).Error("Error sending assignment notification", "err", err)
+	}
+	app, err = db.GetApplicationByID(a.db, strconv.Itoa(app.ID))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	a.writeApplication(w, r, http.StatusOK, app)
+}
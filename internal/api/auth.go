@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/auth"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/metrics"
+	"MortgageAgent/internal/models"
+)
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type userJSON struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+}
+
+func toUserJSON(u *models.User) userJSON {
+	return userJSON{ID: u.ID, FirstName: u.FirstName, LastName: u.LastName, Email: u.Email, Role: u.UserType}
+}
+
+// login is exempt from CSRF checks because there is no session yet.
+// decodeJSON requiring an application/json body still keeps cross-site
+// forms out, since browsers cannot send one without a CORS preflight.
+func (a *API) login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	user, err := db.GetUserByEmail(a.db, req.Email)
+	if err != nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		metrics.LoginFailed("api")
+		audit.Record(r, a.db, audit.Entry{Actor: user, ActorEmail: req.Email, Action: audit.LoginFailed, Details: "api"})
+		writeError(w, http.StatusUnauthorized, "invalid_credentials", "invalid email or password")
+		return
+	}
+
+	session, err := auth.StartSession(w, r, a.db, user)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	logging.SetUser(r.Context(), user.ID)
+	audit.Record(r, a.db, audit.Entry{Actor: user, Action: audit.Login, Details: "api"})
+	w.Header().Set(auth.CSRFHeader, session.CSRFToken)
+	writeData(w, http.StatusOK, toUserJSON(user))
+}
+
+func (a *API) logout(w http.ResponseWriter, r *http.Request) {
+	audit.Record(r, a.db, audit.Entry{Action: audit.Logout, Details: "api"})
+	auth.EndSession(w, r, a.db)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// me also returns the session's CSRF token, which cookie-authenticated
+// clients send back in the X-CSRF-Token header on unsafe requests.
+func (a *API) me(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		w.Header().Set(auth.CSRFHeader, auth.CSRFToken(r))
+	}
+	writeData(w, http.StatusOK, toUserJSON(auth.UserFromContext(r.Context())))
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/auth"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/scan"
+	"MortgageAgent/internal/server"
+	"MortgageAgent/internal/storage"
+)
+
+// maxUploadBytes caps a single document upload.
+const maxUploadBytes = 32 << 20
+
+type documentJSON struct {
+	ID            int    `json:"id"`
+	ApplicationID int    `json:"application_id"`
+	Category      string `json:"category"`
+	Filename      string `json:"filename"`
+	UploadedAt    string `json:"uploaded_at"`
+	Generated     bool   `json:"generated"`
+	// ScanStatus is "pending" until the virus scan passes ("clean");
+	// "infected" files, and those "too_large" to scan, are deleted.
+	ScanStatus  string `json:"scan_status"`
+	DownloadURL string `json:"download_url"`
+}
+
+// toDocumentJSON exposes a document without revealing where it is stored.
+func toDocumentJSON(applicationID int, d models.DocumentInfo) documentJSON {
+	return documentJSON{
+		ID:            d.ID,
+		ApplicationID: applicationID,
+		Category:      d.Category,
+		Filename:      filepath.Base(d.FilePath),
+		UploadedAt:    d.UploadedAt,
+		Generated:     d.Generated,
+		ScanStatus:    d.ScanStatus,
+		DownloadURL:   Prefix + "/documents/" + strconv.Itoa(d.ID) + "/download",
+	}
+}
+
+func documentInfo(d *db.Document) models.DocumentInfo {
+	return models.DocumentInfo{ID: d.ID, Category: d.Category, FilePath: d.FilePath, UploadedAt: d.UploadedAt, Generated: d.Generated, ScanStatus: d.ScanStatus}
+}
+
+func (a *API) listDocuments(w http.ResponseWriter, r *http.Request) {
+	app, ok := a.loadApplication(w, r)
+	if !ok {
+		return
+	}
+	docs, err := db.GetDocumentsForApplication(a.db, app.ID, isAdmin(r))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	out := []documentJSON{}
+	for i := range docs {
+		out = append(out, toDocumentJSON(app.ID, documentInfo(&docs[i])))
+	}
+	writeJSON(w, http.StatusOK, dataBody{Data: out, Pagination: newPagination(1, max(len(out), 1), len(out))})
+}
+
+func (a *API) uploadDocument(w http.ResponseWriter, r *http.Request) {
+	app, ok := a.loadApplication(w, r)
+	if !ok {
+		return
+	}
+
+	server.LimitUpload(w, r, maxUploadBytes)
+	if err := r.ParseMultipartForm(maxUploadBytes); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "expected a multipart/form-data body of at most 32 MB")
+		return
+	}
+	category := r.FormValue("category")
+	if !contains(models.DocumentCategories, category) {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_category", "unknown document category")
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "the file field is required")
+		return
+	}
+	defer file.Close()
+
+	filePath, err := storage.SaveUpload(app.ID, category, file, header)
+	if errors.Is(err, storage.ErrInvalidFilename) {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_filename", "the uploaded file needs a name")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if err := db.AddDocument(a.db, app.ID, category, filePath, auth.UserFromContext(r.Context()).ID); err != nil {
+		os.Remove(filePath)
+		writeInternalError(w, r, err)
+		return
+	}
+
+	doc, err := db.GetDocumentByPath(a.db, filePath)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	audit.Record(r, a.db, audit.Entry{
+		Action: audit.DocumentUpload, ResourceType: audit.ResourceDocument, ResourceID: strconv.Itoa(doc.ID),
+		Details: "application " + strconv.Itoa(app.ID) + ", " + category,
+	})
+	if err := scan.Enqueue(a.db, doc.ID); err != nil {
+		logging.FromContext(r.Context()).Error("Error queueing virus scan", "document_id", doc.ID, "err", err)
+	}
+	writeData(w, http.StatusCreated, toDocumentJSON(app.ID, documentInfo(doc)))
+}
+
+// loadDocument fetches the {id} document if the caller may access its
+// application. Files on internal notes are only found by admins.
+func (a *API) loadDocument(w http.ResponseWriter, r *http.Request) (*db.Document, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return nil, false
+	}
+	doc, err := db.GetDocumentByID(a.db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "not_found", "document not found")
+		return nil, false
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return nil, false
+	}
+	if doc.Internal && !isAdmin(r) {
+		writeError(w, http.StatusNotFound, "not_found", "document not found")
+		return nil, false
+	}
+
+	logging.SetApplication(r.Context(), doc.ApplicationID)
+	app, err := db.GetApplicationByID(a.db, strconv.Itoa(doc.ApplicationID))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return nil, false
+	}
+	if app == nil || !canAccess(auth.UserFromContext(r.Context()), app) {
+		writeError(w, http.StatusNotFound, "not_found", "document not found")
+		return nil, false
+	}
+	return doc, true
+}
+
+func (a *API) getDocument(w http.ResponseWriter, r *http.Request) {
+	doc, ok := a.loadDocument(w, r)
+	if !ok {
+		return
+	}
+	writeData(w, http.StatusOK, toDocumentJSON(doc.ApplicationID, documentInfo(doc)))
+}
+
+func (a *API) downloadDocument(w http.ResponseWriter, r *http.Request) {
+	doc, ok := a.loadDocument(w, r)
+	if !ok {
+		return
+	}
+	if !doc.Clean() {
+		writeError(w, http.StatusConflict, "not_scanned", "the document has not passed its virus scan")
+		return
+	}
+	info, err := os.Stat(doc.FilePath)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not_found", "document file is missing")
+		return
+	}
+	if err := audit.Record(r, a.db, audit.Entry{
+		Action: audit.DocumentDownload, ResourceType: audit.ResourceDocument, ResourceID: strconv.Itoa(doc.ID),
+		Details: "application " + strconv.Itoa(doc.ApplicationID) + ", " + doc.Category,
+	}); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filepath.Base(doc.FilePath)+`"`)
+	server.AllowDownload(w, info.Size())
+	http.ServeFile(w, r, doc.FilePath)
+}
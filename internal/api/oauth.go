@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/auth"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/metrics"
+)
+
+// TokenPath is where machine clients exchange their credentials for tokens.
+const TokenPath = "/oauth/token"
+
+// clientTokenTTL is the lifetime of tokens issued to OAuth clients.
+const clientTokenTTL = time.Hour
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// oauthError writes an RFC 6749 section 5.2 error response.
+func oauthError(w http.ResponseWriter, status int, code, description string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+// TokenHandler implements the OAuth2 client-credentials grant. Clients
+// authenticate with HTTP Basic or client_id/client_secret form fields and
+// may request a subset of their scopes.
+func (a *API) TokenHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method != http.MethodPost {
+			oauthError(w, http.StatusMethodNotAllowed, "invalid_request", "use POST")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		if err := r.ParseForm(); err != nil {
+			oauthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+			return
+		}
+		if r.PostForm.Get("grant_type") != "client_credentials" {
+			oauthError(w, http.StatusBadRequest, "unsupported_grant_type", "only client_credentials is supported")
+			return
+		}
+
+		clientID, secret, ok := r.BasicAuth()
+		if !ok {
+			clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+		client, err := auth.VerifyClient(a.db, clientID, secret)
+		if err != nil {
+			metrics.LoginFailed("oauth")
+			audit.Record(r, a.db, audit.Entry{Action: audit.LoginFailed, ResourceType: audit.ResourceClient, ResourceID: clientID, Details: "oauth"})
+			oauthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+			return
+		}
+
+		scopes := client.Scopes
+		if requested := strings.Fields(r.PostForm.Get("scope")); len(requested) > 0 {
+			for _, s := range requested {
+				if !contains(client.Scopes, s) {
+					oauthError(w, http.StatusBadRequest, "invalid_scope", "the client is not allowed the "+s+" scope")
+					return
+				}
+			}
+			scopes = requested
+		}
+
+		token, err := auth.IssueToken(a.db, client.UserID, &client.ID, client.Name, scopes, clientTokenTTL)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		// The client acts as the user who created it
+		owner, _ := db.GetUserByID(a.db, client.UserID)
+		audit.Record(r, a.db, audit.Entry{
+			Actor: owner, Action: audit.ClientToken,
+			ResourceType: audit.ResourceClient, ResourceID: client.ClientID, Details: strings.Join(scopes, " "),
+		})
+		writeJSON(w, http.StatusOK, tokenResponse{
+			AccessToken: token,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(clientTokenTTL.Seconds()),
+			Scope:       strings.Join(scopes, " "),
+		})
+	})
+}
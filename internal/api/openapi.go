@@ -0,0 +1,199 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/auth"
+)
+
+// pathParam matches the {name} wildcards in route paths.
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+func (a *API) openAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.Spec())
+}
+
+// Spec builds the OpenAPI 3 document from the route table.
+func (a *API) Spec() map[string]interface{} {
+	paths := map[string]map[string]interface{}{}
+	for _, rt := range a.routes {
+		p := Prefix + rt.path
+		if paths[p] == nil {
+			paths[p] = map[string]interface{}{}
+		}
+		paths[p][strings.ToLower(rt.method)] = operation(rt)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "MortgageAgent API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"session": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": auth.SessionCookie},
+				"bearer":  map[string]interface{}{"type": "http", "scheme": "bearer", "description": "Personal access token"},
+				"oauth2": map[string]interface{}{
+					"type": "oauth2",
+					"flows": map[string]interface{}{
+						"clientCredentials": map[string]interface{}{
+							"tokenUrl": TokenPath,
+							"scopes": map[string]string{
+								auth.ScopeRead:  "Read applications and documents",
+								auth.ScopeWrite: "Create and change applications and documents",
+								auth.ScopeAdmin: "Admin actions",
+							},
+						},
+					},
+				},
+			},
+			"schemas": map[string]interface{}{
+				"Error":      schemaFor(reflect.TypeOf(errorBody{})),
+				"Pagination": schemaFor(reflect.TypeOf(pagination{})),
+			},
+		},
+	}
+}
+
+func operation(rt route) map[string]interface{} {
+	op := map[string]interface{}{
+		"summary": rt.summary,
+		"tags":    []string{rt.tag},
+	}
+
+	var params []interface{}
+	for _, m := range pathParam.FindAllStringSubmatch(rt.path, -1) {
+		params = append(params, map[string]interface{}{
+			"name": m[1], "in": "path", "required": true,
+			"schema": map[string]interface{}{"type": "integer"},
+		})
+	}
+	for _, name := range rt.query {
+		params = append(params, map[string]interface{}{
+			"name": name, "in": "query",
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if rt.request != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemaFor(reflect.TypeOf(rt.request))},
+			},
+		}
+	}
+	if rt.upload {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"multipart/form-data": map[string]interface{}{
+					"schema": map[string]interface{}{
+						"type":     "object",
+						"required": []string{"category", "file"},
+						"properties": map[string]interface{}{
+							"category": map[string]interface{}{"type": "string"},
+							"file":     map[string]interface{}{"type": "string", "format": "binary"},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	errorRef := map[string]interface{}{"$ref": "#/components/schemas/Error"}
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": errorRef}},
+	}
+	responses := map[string]interface{}{"default": errorResponse}
+	switch {
+	case rt.response != nil:
+		data := schemaFor(reflect.TypeOf(rt.response))
+		body := map[string]interface{}{"data": data}
+		if rt.list {
+			body = map[string]interface{}{
+				"data":       map[string]interface{}{"type": "array", "items": data},
+				"pagination": map[string]interface{}{"$ref": "#/components/schemas/Pagination"},
+			}
+		}
+		responses["2XX"] = map[string]interface{}{
+			"description": "Success",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": map[string]interface{}{"type": "object", "properties": body},
+				},
+			},
+		}
+	default:
+		responses["2XX"] = map[string]interface{}{"description": "Success"}
+	}
+	op["responses"] = responses
+
+	if !rt.public {
+		op["security"] = []interface{}{
+			map[string]interface{}{"session": []string{}},
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"oauth2": []string{rt.scope()}},
+		}
+	}
+	return op
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor derives a JSON schema from a Go type using its json tags.
+func schemaFor(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		s := schemaFor(t.Elem())
+		s["nullable"] = true
+		return s
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem())}
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" || !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			s := schemaFor(f.Type)
+			if strings.Contains(opts, "omitempty") {
+				s["description"] = "omitted when empty"
+			}
+			props[name] = s
+		}
+		return map[string]interface{}{"type": "object", "properties": props}
+	}
+	return map[string]interface{}{}
+}
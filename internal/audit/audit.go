@@ -0,0 +1,179 @@
+// Package audit records who accessed or changed borrower data. Events go to
+// the hash-chained audit_events table, which only auditors can read.
+package audit
+
+import (
+	"database/sql"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"MortgageAgent/internal/auth"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+)
+
+// Actions recorded in the audit log.
+const (
+	Login             = "auth.login"
+	LoginFailed       = "auth.login_failed"
+	Logout            = "auth.logout"
+	ApplicationView   = "application.view"
+	ApplicationSubmit = "application.submit"
+	StatusChange      = "application.status_change"
+	Assign            = "application.assign"
+	DocumentDownload  = "document.download"
+	UserCreate        = "user.create"
+	UserRoleChange    = "user.role_change"
+	PasswordReset     = "user.password_reset"
+	TokenCreate       = "token.create"
+	TokenRevoke       = "token.revoke"
+	ClientCreate      = "oauth_client.create"
+	ClientRevoke      = "oauth_client.revoke"
+	ClientToken       = "oauth_client.token"
+	Export            = "audit.export"
+	BorrowerInvite    = "borrower.invite"
+	BorrowerAccept    = "borrower.accept"
+	Consent           = "application.consent"
+	FinancialsUpdate  = "application.financials"
+	DocumentUpload    = "document.upload"
+	DocumentRejected  = "document.rejected"
+	DocumentFields    = "document.fields_confirm"
+	DocumentPackage   = "document.package"
+	DocumentGenerate  = "document.generate"
+	ShareCreate       = "share.create"
+	ShareRevoke       = "share.revoke"
+	ShareDownload     = "share.download"
+	ShareDenied       = "share.denied"
+	LenderCreate      = "lender.create"
+	LenderUpdate      = "lender.update"
+	ProductCreate     = "lender_product.create"
+	ProductUpdate     = "lender_product.update"
+	RateSheetMapping  = "lender.rate_sheet"
+	RateImportCreate  = "rate_import.create"
+	RateImportApply   = "rate_import.apply"
+	RateImportDiscard = "rate_import.discard"
+	RateHoldCreate    = "rate_hold.create"
+	RateHoldRelease   = "rate_hold.release"
+	CommitmentCreate  = "commitment.create"
+
+	CommitmentConditionAdd     = "commitment.condition_add"
+	CommitmentConditionSatisfy = "commitment.condition_satisfy"
+	ConditionCreate            = "condition.create"
+	ConditionRespond           = "condition.respond"
+	ConditionClear             = "condition.clear"
+	ConditionReturn            = "condition.return"
+	MessagePost                = "message.post"
+	JobRetry                   = "job.retry"
+)
+
+// Actions lists every action, for the search form.
+var Actions = []string{
+	Login, LoginFailed, Logout,
+	ApplicationView, ApplicationSubmit, StatusChange, Assign, Consent, FinancialsUpdate,
+	BorrowerInvite, BorrowerAccept,
+	DocumentUpload, DocumentRejected, DocumentFields, DocumentDownload, DocumentPackage, DocumentGenerate,
+	ShareCreate, ShareRevoke, ShareDownload, ShareDenied,
+	LenderCreate, LenderUpdate, ProductCreate, ProductUpdate,
+	RateSheetMapping, RateImportCreate, RateImportApply, RateImportDiscard,
+	RateHoldCreate, RateHoldRelease, CommitmentCreate, CommitmentConditionAdd, CommitmentConditionSatisfy,
+	ConditionCreate, ConditionRespond, ConditionClear, ConditionReturn,
+	MessagePost,
+	UserCreate, UserRoleChange, PasswordReset,
+	TokenCreate, TokenRevoke, ClientCreate, ClientRevoke, ClientToken,
+	Export, JobRetry,
+}
+
+// Resource types.
+const (
+	ResourceApplication = "application"
+	ResourceDocument    = "document"
+	ResourceUser        = "user"
+	ResourceToken       = "api_token"
+	ResourceClient      = "oauth_client"
+	ResourceShare       = "document_share"
+	ResourceLender      = "lender"
+	ResourceProduct     = "lender_product"
+	ResourceRateImport  = "rate_import"
+	ResourceJob         = "job"
+)
+
+// ResourceTypes lists every resource type, for the search form.
+var ResourceTypes = []string{ResourceApplication, ResourceDocument, ResourceUser, ResourceToken, ResourceClient, ResourceShare,
+	ResourceLender, ResourceProduct, ResourceRateImport, ResourceJob}
+
+// maxUserAgent bounds how much of the User-Agent header is kept.
+const maxUserAgent = 256
+
+// Entry describes one event to record.
+type Entry struct {
+	// Actor defaults to the authenticated user in the request context.
+	Actor *models.User
+	// ActorEmail names the caller when there is no user, e.g. a failed login.
+	ActorEmail   string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Details      string
+}
+
+// Record appends e to the audit log with the request's IP and user agent.
+// Failures are logged and returned so that reads of borrower data can fail
+// closed rather than go unrecorded.
+func Record(r *http.Request, database *sql.DB, e Entry) error {
+	actor := e.Actor
+	if actor == nil {
+		actor = auth.UserFromContext(r.Context())
+	}
+	event := &models.AuditEvent{
+		ActorEmail:   e.ActorEmail,
+		Action:       e.Action,
+		ResourceType: e.ResourceType,
+		ResourceID:   e.ResourceID,
+		IP:           ClientIP(r),
+		UserAgent:    r.UserAgent(),
+		Details:      e.Details,
+	}
+	if actor != nil {
+		id := actor.ID
+		event.ActorID = &id
+		event.ActorEmail = actor.Email
+		event.ActorRole = actor.UserType
+	}
+	if len(event.UserAgent) > maxUserAgent {
+		event.UserAgent = event.UserAgent[:maxUserAgent]
+	}
+
+	if err := db.AppendAuditEvent(database, event); err != nil {
+		logging.FromContext(r.Context()).Error("Error writing audit event", "action", e.Action, "err", err)
+		return err
+	}
+	return nil
+}
+
+// RecordSystem appends e to the audit log for work done outside a request,
+// such as a scheduled import. ActorEmail should name the job.
+func RecordSystem(database *sql.DB, e Entry) error {
+	event := &models.AuditEvent{
+		ActorEmail:   e.ActorEmail,
+		Action:       e.Action,
+		ResourceType: e.ResourceType,
+		ResourceID:   e.ResourceID,
+		Details:      e.Details,
+	}
+	if err := db.AppendAuditEvent(database, event); err != nil {
+		slog.Error("Error writing audit event", "action", e.Action, "err", err)
+		return err
+	}
+	return nil
+}
+
+// ClientIP returns the host part of the connection's remote address.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,53 @@
+// Package auth resolves the user behind a request — from the browser session
+// cookie or a bearer token — for both the HTML pages and the JSON API.
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/models"
+)
+
+// ErrUnauthenticated is returned when a request carries no valid credentials.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+type contextKey string
+
+var userContextKey = contextKey("user")
+
+// Authenticate returns the caller identified by the request's credentials:
+// an "Authorization: Bearer" token if present, otherwise the session cookie.
+func Authenticate(r *http.Request, database *sql.DB) (*Identity, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		return authenticateBearer(header, database)
+	}
+
+	session := loadSession(r, database)
+	if session == nil || session.UserID == nil {
+		return nil, ErrUnauthenticated
+	}
+
+	user, err := db.GetUserByID(database, *session.UserID)
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	return &Identity{User: user}, nil
+}
+
+// WithUser stores the authenticated user in ctx.
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// UserFromContext returns the user stored by WithUser, or nil.
+func UserFromContext(ctx context.Context) *models.User {
+	u, ok := ctx.Value(userContextKey).(*models.User)
+	if !ok {
+		return nil
+	}
+	return u
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+)
+
+// The synchronizer token is accepted from either a form field or a header,
+// the latter for JavaScript and API clients using the session cookie.
+const (
+	CSRFField  = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// formBytes caps the urlencoded forms the token is read from.
+// csrfPrefixBytes is how far into a multipart body the token is looked for;
+// forms put it first, so the rest, files included, is left for the handler
+// to read under its own size limit.
+const (
+	formBytes       = 1 << 20
+	csrfPrefixBytes = 64 << 10
+)
+
+var csrfContextKey = contextKey("csrf")
+
+// csrfState gives handlers and templates lazy access to the request's
+// session, creating an anonymous one the first time a token is needed.
+type csrfState struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	db      *sql.DB
+	session *models.Session
+	loaded  bool
+}
+
+func (s *csrfState) current() *models.Session {
+	if !s.loaded {
+		s.session = loadSession(s.r, s.db)
+		s.loaded = true
+	}
+	return s.session
+}
+
+// CSRF returns middleware that requires every unsafe request to carry the
+// session's synchronizer token. Requests authenticated with a bearer token
+// are exempt, since browsers never attach those automatically, as are the
+// exempt paths (exact matches, or prefixes when they end in "/"). Rejected
+// requests are passed to failed.
+func CSRF(database *sql.DB, failed http.Handler, exempt ...string) func(http.Handler) http.Handler {
+	isExempt := func(r *http.Request) bool {
+		if r.Header.Get("Authorization") != "" {
+			return true
+		}
+		for _, p := range exempt {
+			if r.URL.Path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(r.URL.Path, p)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state := &csrfState{w: w, r: r, db: database}
+			r = r.WithContext(context.WithValue(r.Context(), csrfContextKey, state))
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			default:
+				if !isExempt(r) {
+					token := r.Header.Get(CSRFHeader)
+					if token == "" {
+						token = formToken(w, r)
+					}
+					session := state.current()
+					if session == nil || token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRFToken)) != 1 {
+						failed.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// formToken reads the token from the request body. A multipart body is
+// only read as far as the token and then put back, so parsing it is left to
+// the handler.
+func formToken(w http.ResponseWriter, r *http.Request) string {
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" || params["boundary"] == "" {
+		r.Body = http.MaxBytesReader(w, r.Body, formBytes)
+		return r.PostFormValue(CSRFField)
+	}
+
+	var prefix bytes.Buffer
+	body := r.Body
+	mr := multipart.NewReader(io.TeeReader(io.LimitReader(body, csrfPrefixBytes), &prefix), params["boundary"])
+	token := ""
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		if part.FormName() == CSRFField {
+			b, _ := io.ReadAll(io.LimitReader(part, 256))
+			token = string(b)
+			break
+		}
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(&prefix, body), body}
+	return token
+}
+
+// CSRFToken returns the synchronizer token for the request's session,
+// starting an anonymous session if there is none yet. Pages embed it in
+// their forms. It must be called before the response headers are written.
+func CSRFToken(r *http.Request) string {
+	state, ok := r.Context().Value(csrfContextKey).(*csrfState)
+	if !ok {
+		return ""
+	}
+	if s := state.current(); s != nil {
+		return s.CSRFToken
+	}
+
+	s, err := newSession(state.w, state.db, nil)
+	if err != nil {
+		logging.FromContext(state.r.Context()).Error("Error creating session", "err", err)
+		return ""
+	}
+	state.session = s
+	return s.CSRFToken
+}
+
+// setCSRFSession points the request's CSRF state at a session created
+// mid-request, such as at login.
+func setCSRFSession(r *http.Request, s *models.Session) {
+	if state, ok := r.Context().Value(csrfContextKey).(*csrfState); ok {
+		state.session, state.loaded = s, true
+	}
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// multipartBody builds a form with the given fields, in order, and a file
+// of fileSize bytes.
+func multipartBody(t *testing.T, fields [][2]string, fileSize int) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, f := range fields {
+		if f[0] == "file" {
+			fw, err := mw.CreateFormFile("file", "f.bin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write(bytes.Repeat([]byte("x"), fileSize))
+			continue
+		}
+		mw.WriteField(f[0], f[1])
+	}
+	mw.Close()
+	return &body, mw.FormDataContentType()
+}
+
+func TestFormTokenMultipart(t *testing.T) {
+	tests := []struct {
+		name      string
+		fields    [][2]string
+		fileSize  int
+		wantToken string
+	}{
+		{"token first", [][2]string{{CSRFField, "tok"}, {"a", "1"}, {"file", ""}}, 1 << 20, "tok"},
+		{"token after small fields", [][2]string{{"a", "1"}, {CSRFField, "tok"}, {"file", ""}}, 10, "tok"},
+		{"token after a large file", [][2]string{{"file", ""}, {CSRFField, "tok"}}, csrfPrefixBytes * 2, ""},
+		{"no token", [][2]string{{"a", "1"}, {"file", ""}}, 10, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := multipartBody(t, tt.fields, tt.fileSize)
+			want := body.String()
+			r := httptest.NewRequest(http.MethodPost, "/", body)
+			r.Header.Set("Content-Type", contentType)
+
+			if got := formToken(httptest.NewRecorder(), r); got != tt.wantToken {
+				t.Errorf("token = %q, want %q", got, tt.wantToken)
+			}
+			// The handler must still see the whole body
+			rest, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rest) != want {
+				t.Errorf("body changed: got %d bytes, want %d", len(rest), len(want))
+			}
+		})
+	}
+}
+
+// The token check must leave the handler's own size limit in force.
+func TestFormTokenLeavesHandlerLimit(t *testing.T) {
+	body, contentType := multipartBody(t, [][2]string{{CSRFField, "tok"}, {"file", ""}}, 2<<20)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", body)
+	r.Header.Set("Content-Type", contentType)
+	if got := formToken(w, r); got != "tok" {
+		t.Fatalf("token = %q", got)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err == nil {
+		t.Error("ParseMultipartForm accepted a body over the handler's limit")
+	}
+}
+
+func TestFormTokenURLEncoded(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(CSRFField+"=tok&a=1"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if got := formToken(httptest.NewRecorder(), r); got != "tok" {
+		t.Errorf("token = %q, want tok", got)
+	}
+
+	big := CSRFField + "=tok&a=" + strings.Repeat("x", formBytes)
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(big))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if got := formToken(httptest.NewRecorder(), r); got != "" {
+		t.Errorf("token read from a form over the limit")
+	}
+}
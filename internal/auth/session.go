@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/models"
+)
+
+// SessionCookie is the name of the browser session cookie. Its value is a
+// random ID; only its hash is stored.
+const SessionCookie = "session_id"
+
+// sessionTTL is how long a session lasts from creation.
+const sessionTTL = 24 * time.Hour
+
+// SecureCookies controls the Secure attribute of the cookies set here. It
+// should only be disabled for local development over plain HTTP.
+var SecureCookies = true
+
+func setSessionCookie(w http.ResponseWriter, value string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// newSession creates a session, optionally for a logged-in user, and sets its cookie.
+func newSession(w http.ResponseWriter, database *sql.DB, userID *int) (*models.Session, error) {
+	id, err := randomString("", 32)
+	if err != nil {
+		return nil, err
+	}
+	csrf, err := randomString("", 32)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &models.Session{
+		IDHash:    HashSecret(id),
+		UserID:    userID,
+		CSRFToken: csrf,
+		ExpiresAt: time.Now().Add(sessionTTL),
+	}
+	if err := db.CreateSession(database, s); err != nil {
+		return nil, err
+	}
+	setSessionCookie(w, id, s.ExpiresAt)
+	return s, nil
+}
+
+// loadSession returns the request's unexpired session, or nil.
+func loadSession(r *http.Request, database *sql.DB) *models.Session {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	s, err := db.GetSession(database, HashSecret(cookie.Value))
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+// StartSession logs user in. The previous session, if any, is discarded so a
+// session ID planted before login cannot be reused afterwards.
+func StartSession(w http.ResponseWriter, r *http.Request, database *sql.DB, user *models.User) (*models.Session, error) {
+	if old := loadSession(r, database); old != nil {
+		db.DeleteSession(database, old.IDHash)
+	}
+	s, err := newSession(w, database, &user.ID)
+	if err != nil {
+		return nil, err
+	}
+	setCSRFSession(r, s)
+	return s, nil
+}
+
+// EndSession logs the caller out and clears the session cookie.
+func EndSession(w http.ResponseWriter, r *http.Request, database *sql.DB) {
+	if s := loadSession(r, database); s != nil {
+		db.DeleteSession(database, s.IDHash)
+	}
+	setSessionCookie(w, "", time.Unix(0, 0))
+}
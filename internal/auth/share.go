@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/db"
+)
+
+// shareLinkPrefix marks document share tokens.
+const shareLinkPrefix = "mal_"
+
+// shareKeySetting stores the generated signing key when SHARE_LINK_KEY is unset.
+const shareKeySetting = "share_link_key"
+
+// ErrInvalidShareToken is returned for share tokens that are malformed or
+// were not signed with the current key.
+var ErrInvalidShareToken = errors.New("invalid share token")
+
+var shareKey []byte
+
+// InitShareKey sets the key that signs document share links. Without a
+// configured key, a random one is generated once and kept in the database
+// so links survive restarts. Changing the key invalidates every link.
+func InitShareKey(database *sql.DB, configured string) error {
+	if configured != "" {
+		shareKey = []byte(configured)
+		return nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	stored, err := db.GetOrCreateSetting(database, shareKeySetting, hex.EncodeToString(b))
+	if err != nil {
+		return err
+	}
+	shareKey, err = hex.DecodeString(stored)
+	return err
+}
+
+// ShareToken is what a signed share link refers to.
+type ShareToken struct {
+	ShareID    int
+	DocumentID int
+	ExpiresAt  time.Time
+}
+
+// SignShareToken returns the URL-safe token for a share link.
+func SignShareToken(t ShareToken) string {
+	payload := make([]byte, 24)
+	binary.BigEndian.PutUint64(payload[0:], uint64(t.ShareID))
+	binary.BigEndian.PutUint64(payload[8:], uint64(t.DocumentID))
+	binary.BigEndian.PutUint64(payload[16:], uint64(t.ExpiresAt.Unix()))
+	return shareLinkPrefix + base64.RawURLEncoding.EncodeToString(append(payload, shareMAC(payload)...))
+}
+
+// ParseShareToken checks the token's signature and returns what it refers
+// to. The caller must still check expiry and the share's current state.
+func ParseShareToken(token string) (ShareToken, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, shareLinkPrefix))
+	if err != nil || !strings.HasPrefix(token, shareLinkPrefix) || len(raw) != 24+sha256.Size {
+		return ShareToken{}, ErrInvalidShareToken
+	}
+	payload, mac := raw[:24], raw[24:]
+	if !hmac.Equal(mac, shareMAC(payload)) {
+		return ShareToken{}, ErrInvalidShareToken
+	}
+	return ShareToken{
+		ShareID:    int(binary.BigEndian.Uint64(payload[0:])),
+		DocumentID: int(binary.BigEndian.Uint64(payload[8:])),
+		ExpiresAt:  time.Unix(int64(binary.BigEndian.Uint64(payload[16:])), 0),
+	}, nil
+}
+
+func shareMAC(payload []byte) []byte {
+	if len(shareKey) == 0 {
+		panic("auth: share key not initialised")
+	}
+	m := hmac.New(sha256.New, shareKey)
+	m.Write(payload)
+	return m.Sum(nil)
+}
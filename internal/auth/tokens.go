@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/models"
+)
+
+// Token scopes. Read covers safe methods, write covers changes, and admin is
+// required for anything restricted to admin users.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// Scopes lists every scope a token or client may be granted.
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// Prefixes make leaked credentials easy to recognise in code and logs.
+const (
+	tokenPrefix        = "mat_"
+	clientIDPrefix     = "mac_"
+	clientSecretPrefix = "mas_"
+	inviteTokenPrefix  = "mai_"
+)
+
+// Identity is the authenticated caller: a user plus, for bearer tokens, the
+// scopes the token was granted.
+type Identity struct {
+	User *models.User
+	// Scopes is nil for browser sessions, which may do anything the user can.
+	Scopes []string
+}
+
+// ViaToken reports whether the caller authenticated with a bearer token.
+func (id *Identity) ViaToken() bool {
+	return id.Scopes != nil
+}
+
+// Allows reports whether the identity may act with the given scope.
+func (id *Identity) Allows(scope string) bool {
+	if !id.ViaToken() {
+		return true
+	}
+	for _, s := range id.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopeFor returns the scope needed to call a route with the given method;
+// adminOnly marks routes restricted to admin users.
+func ScopeFor(method string, adminOnly bool) string {
+	if adminOnly {
+		return ScopeAdmin
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ScopeRead
+	}
+	return ScopeWrite
+}
+
+// ValidScopes reports whether every entry is a known scope and there is at
+// least one.
+func ValidScopes(scopes []string) bool {
+	if len(scopes) == 0 {
+		return false
+	}
+	for _, s := range scopes {
+		known := false
+		for _, k := range Scopes {
+			known = known || s == k
+		}
+		if !known {
+			return false
+		}
+	}
+	return true
+}
+
+func randomString(prefix string, n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashSecret returns the hex SHA-256 of a token or client secret. The values
+// are long random strings, so a fast hash is sufficient.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueToken creates a bearer token for userID and returns its plaintext,
+// which is never stored. A zero ttl means the token does not expire.
+func IssueToken(database *sql.DB, userID int, oauthClientID *int, name string, scopes []string, ttl time.Duration) (string, error) {
+	token, err := randomString(tokenPrefix, 32)
+	if err != nil {
+		return "", err
+	}
+	var expiresAt *time.Time
+	if ttl > 0 {
+		t := time.Now().Add(ttl)
+		expiresAt = &t
+	}
+	_, err = db.CreateAPIToken(database, userID, oauthClientID, name, HashSecret(token), token[:len(tokenPrefix)+6], scopes, expiresAt)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// NewInviteToken returns a borrower invite token and the hash to store.
+func NewInviteToken() (string, string, error) {
+	token, err := randomString(inviteTokenPrefix, 32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashSecret(token), nil
+}
+
+// CreateClient registers a client-credentials client acting as userID and
+// returns its client ID and plaintext secret.
+func CreateClient(database *sql.DB, userID int, name string, scopes []string) (string, string, error) {
+	clientID, err := randomString(clientIDPrefix, 12)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := randomString(clientSecretPrefix, 32)
+	if err != nil {
+		return "", "", err
+	}
+	if err := db.CreateOAuthClient(database, userID, name, clientID, HashSecret(secret), scopes); err != nil {
+		return "", "", err
+	}
+	return clientID, secret, nil
+}
+
+// VerifyClient checks a client's credentials and returns the client.
+func VerifyClient(database *sql.DB, clientID, secret string) (*models.OAuthClient, error) {
+	client, secretHash, err := db.GetOAuthClient(database, clientID)
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	if subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(secretHash)) != 1 {
+		return nil, ErrUnauthenticated
+	}
+	return client, nil
+}
+
+// authenticateBearer resolves an "Authorization: Bearer" header.
+func authenticateBearer(header string, database *sql.DB) (*Identity, error) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	t, err := db.GetAPITokenByHash(database, HashSecret(strings.TrimSpace(token)))
+	now := time.Now()
+	if err != nil || !t.Active(now) {
+		return nil, ErrUnauthenticated
+	}
+	user, err := db.GetUserByID(database, t.UserID)
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	db.TouchAPIToken(database, t.ID, now)
+
+	scopes := t.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return &Identity{User: user, Scopes: scopes}, nil
+}
@@ -0,0 +1,117 @@
+// Package calc implements Canadian mortgage qualification math: payments
+// with semi-annual compounding, GDS and TDS ratios, the federal stress test,
+// mortgage default insurance premiums, the maximum affordable price and
+// amortization schedules.
+// Rates are decimal fractions, so 5.25% is 0.0525.
+package calc
+
+import (
+	"errors"
+	"math"
+)
+
+// Qualification limits for insured mortgages.
+const (
+	MaxGDS = 0.39
+	MaxTDS = 0.44
+	// StressBuffer is added to the contract rate for the stress test.
+	StressBuffer = 0.02
+	// CondoFeeShare is the portion of condo fees counted as housing costs.
+	CondoFeeShare = 0.5
+)
+
+// DefaultBenchmarkRate is the minimum qualifying rate set by OSFI.
+const DefaultBenchmarkRate = 0.0525
+
+// BenchmarkRate is the floor used by the stress test. It is set from the
+// configuration at startup.
+var BenchmarkRate = DefaultBenchmarkRate
+
+// ErrInvalidInput is returned for negative amounts, rates or terms.
+var ErrInvalidInput = errors.New("calc: invalid input")
+
+// QualifyingRate is the rate a borrower must qualify at: the greater of the
+// contract rate plus StressBuffer and the benchmark rate.
+func QualifyingRate(contractRate, benchmarkRate float64) float64 {
+	return math.Max(contractRate+StressBuffer, benchmarkRate)
+}
+
+// PeriodicRate converts a nominal annual rate compounded semi-annually, as
+// the Interest Act requires for fixed-rate mortgages, into the effective
+// rate per payment period.
+func PeriodicRate(annualRate float64, periodsPerYear int) float64 {
+	return math.Pow(1+annualRate/2, 2/float64(periodsPerYear)) - 1
+}
+
+// Payment returns the level payment, rounded to the cent, that repays
+// principal over the given number of payment periods at the periodic rate.
+func Payment(principal, periodicRate float64, periods int) float64 {
+	if principal <= 0 || periods <= 0 {
+		return 0
+	}
+	var p float64
+	if periodicRate == 0 {
+		p = principal / float64(periods)
+	} else {
+		p = principal * periodicRate / (1 - math.Pow(1+periodicRate, -float64(periods)))
+	}
+	return roundCents(p)
+}
+
+// MonthlyPayment is Payment for monthly payments over amortization years.
+func MonthlyPayment(principal, annualRate float64, years int) float64 {
+	return Payment(principal, PeriodicRate(annualRate, 12), years*12)
+}
+
+// MaxPrincipal is the largest loan a monthly payment repays over
+// amortization years at annualRate; the inverse of MonthlyPayment.
+func MaxPrincipal(monthlyPayment, annualRate float64, years int) float64 {
+	if monthlyPayment <= 0 || years <= 0 {
+		return 0
+	}
+	n := float64(years * 12)
+	i := PeriodicRate(annualRate, 12)
+	if i == 0 {
+		return monthlyPayment * n
+	}
+	return monthlyPayment * (1 - math.Pow(1+i, -n)) / i
+}
+
+// HousingCosts are the costs other than the mortgage payment that count
+// towards GDS.
+type HousingCosts struct {
+	// PropertyTax is the annual property tax.
+	PropertyTax float64
+	// Heating and CondoFees are monthly.
+	Heating   float64
+	CondoFees float64
+}
+
+// Monthly returns the monthly housing costs counted by lenders, which
+// include half of any condo fees.
+func (h HousingCosts) Monthly() float64 {
+	return h.PropertyTax/12 + h.Heating + CondoFeeShare*h.CondoFees
+}
+
+// GDS is the gross debt service ratio: monthly housing costs, including the
+// mortgage payment, over gross monthly income.
+func GDS(annualIncome, monthlyPayment float64, h HousingCosts) float64 {
+	if annualIncome <= 0 {
+		return math.Inf(1)
+	}
+	return (monthlyPayment + h.Monthly()) / (annualIncome / 12)
+}
+
+// TDS is the total debt service ratio: GDS plus other monthly debt
+// payments over gross monthly income.
+func TDS(annualIncome, monthlyPayment float64, h HousingCosts, monthlyDebts float64) float64 {
+	if annualIncome <= 0 {
+		return math.Inf(1)
+	}
+	return (monthlyPayment + h.Monthly() + monthlyDebts) / (annualIncome / 12)
+}
+
+// roundCents rounds an amount to the nearest cent.
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
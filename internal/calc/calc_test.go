@@ -0,0 +1,120 @@
+package calc
+
+import (
+	"math"
+	"testing"
+)
+
+// near reports whether two rates or ratios agree to within rounding.
+func near(got, want float64) bool {
+	return got == want || math.Abs(got-want) < 1e-12
+}
+
+func TestPeriodicRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    float64
+		periods int
+		want    float64
+	}{
+		{"semi-annual is the nominal half", 0.05, 2, 0.025},
+		{"monthly", 0.05, 12, 0.0041239154651442},
+		{"bi-weekly", 0.05, 26, 0.0019012368008677},
+		{"weekly", 0.05, 52, 0.0009501669917777},
+		{"zero", 0, 12, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PeriodicRate(tt.rate, tt.periods); !near(got, tt.want) {
+				t.Errorf("PeriodicRate(%v, %d) = %.16f, want %.16f", tt.rate, tt.periods, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMonthlyPayment(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal float64
+		rate      float64
+		years     int
+		want      float64
+	}{
+		{"400k at 5% over 25 years", 400_000, 0.05, 25, 2326.42},
+		{"400k at 7.25% over 25 years", 400_000, 0.0725, 25, 2863.67},
+		{"100k at 3% over 30 years", 100_000, 0.03, 30, 420.60},
+		{"no interest", 120_000, 0, 10, 1000},
+		{"no principal", 0, 0.05, 25, 0},
+		{"no term", 400_000, 0.05, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MonthlyPayment(tt.principal, tt.rate, tt.years); got != tt.want {
+				t.Errorf("MonthlyPayment(%v, %v, %d) = %.2f, want %.2f", tt.principal, tt.rate, tt.years, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxPrincipal(t *testing.T) {
+	for _, rate := range []float64{0, 0.03, 0.05, 0.0725} {
+		p := MaxPrincipal(2326.42, rate, 25)
+		if got := MonthlyPayment(p, rate, 25); math.Abs(got-2326.42) > 0.01 {
+			t.Errorf("at %v: MonthlyPayment(MaxPrincipal) = %.2f, want 2326.42", rate, got)
+		}
+	}
+	if got := MaxPrincipal(2326.42, 0.05, 25); math.Abs(got-400_000) > 1 {
+		t.Errorf("MaxPrincipal(2326.42, 5%%, 25) = %.2f, want about 400000", got)
+	}
+}
+
+func TestQualifyingRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		contract  float64
+		benchmark float64
+		want      float64
+	}{
+		{"floor applies", 0.0299, 0.0525, 0.0525},
+		{"buffer equals the floor", 0.0325, 0.0525, 0.0525},
+		{"buffer above the floor", 0.0450, 0.0525, 0.0650},
+		{"high contract rate", 0.0699, 0.0525, 0.0899},
+		{"raised benchmark", 0.0450, 0.0700, 0.0700},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QualifyingRate(tt.contract, tt.benchmark); !near(got, tt.want) {
+				t.Errorf("QualifyingRate(%v, %v) = %v, want %v", tt.contract, tt.benchmark, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRatios(t *testing.T) {
+	h := HousingCosts{PropertyTax: 3600, Heating: 100, CondoFees: 400}
+	tests := []struct {
+		name    string
+		income  float64
+		payment float64
+		debts   float64
+		wantGDS float64
+		wantTDS float64
+	}{
+		// 2000 + 300 tax + 100 heat + 200 of the condo fees over 10000 a month
+		{"housing costs", 120_000, 2000, 0, 0.26, 0.26},
+		{"other debts count only for TDS", 120_000, 2000, 1000, 0.26, 0.36},
+		{"no income", 0, 2000, 0, math.Inf(1), math.Inf(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gds := GDS(tt.income, tt.payment, h)
+			tds := TDS(tt.income, tt.payment, h, tt.debts)
+			if !near(gds, tt.wantGDS) {
+				t.Errorf("GDS = %v, want %v", gds, tt.wantGDS)
+			}
+			if !near(tds, tt.wantTDS) {
+				t.Errorf("TDS = %v, want %v", tds, tt.wantTDS)
+			}
+		})
+	}
+}
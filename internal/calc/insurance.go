@@ -0,0 +1,97 @@
+package calc
+
+import (
+	"errors"
+	"math"
+)
+
+// Insurance is required when the loan exceeds InsuredLTV of the price.
+const InsuredLTV = 0.80
+
+// MaxInsuredLTV is the highest loan-to-value that can be insured.
+const MaxInsuredLTV = 0.95
+
+// MaxInsurablePrice is the purchase price at and above which mortgage
+// default insurance is not available, so at least 20% must be put down.
+const MaxInsurablePrice = 1_500_000
+
+// ErrNotInsurable is returned when a loan needs insurance it cannot get.
+var ErrNotInsurable = errors.New("calc: mortgage cannot be insured")
+
+// premiumTier is the premium, as a share of the loan, charged up to and
+// including an LTV.
+type premiumTier struct {
+	MaxLTV float64
+	Rate   float64
+}
+
+// premiumTiers are CMHC's standard purchase premiums.
+var premiumTiers = []premiumTier{
+	{0.65, 0.0060},
+	{0.75, 0.0170},
+	{0.80, 0.0240},
+	{0.85, 0.0280},
+	{0.90, 0.0310},
+	{0.95, 0.0400},
+}
+
+// PremiumRate returns the insurance premium rate for a loan-to-value ratio.
+// Loans above MaxInsuredLTV cannot be insured.
+func PremiumRate(ltv float64) (float64, error) {
+	if ltv < 0 || math.IsNaN(ltv) {
+		return 0, ErrInvalidInput
+	}
+	// Compare at basis-point precision so 0.80 computed from dollars is
+	// still treated as 80%.
+	ltv = math.Round(ltv*1e4) / 1e4
+	for _, t := range premiumTiers {
+		if ltv <= t.MaxLTV {
+			return t.Rate, nil
+		}
+	}
+	return 0, ErrNotInsurable
+}
+
+// Insurance is the default insurance on a purchase.
+type Insurance struct {
+	// Required is set when the down payment is under 20%.
+	Required bool
+	Rate     float64
+	Premium  float64
+}
+
+// InsuranceFor returns the insurance a purchase needs. Premiums are added to
+// the loan. Loans over MaxInsuredLTV, or insured purchases at
+// MaxInsurablePrice or more, return ErrNotInsurable.
+func InsuranceFor(price, loan float64) (Insurance, error) {
+	if price <= 0 || loan < 0 || loan > price {
+		return Insurance{}, ErrInvalidInput
+	}
+	ltv := loan / price
+	if math.Round(ltv*1e4)/1e4 <= InsuredLTV {
+		return Insurance{}, nil
+	}
+	if price >= MaxInsurablePrice {
+		return Insurance{}, ErrNotInsurable
+	}
+	rate, err := PremiumRate(ltv)
+	if err != nil {
+		return Insurance{}, err
+	}
+	return Insurance{Required: true, Rate: rate, Premium: roundCents(loan * rate)}, nil
+}
+
+// MinimumDownPayment is the smallest down payment allowed on a purchase:
+// 5% of the first $500,000 and 10% of the rest, or 20% of the whole price
+// when insurance is not available.
+func MinimumDownPayment(price float64) float64 {
+	switch {
+	case price <= 0:
+		return 0
+	case price >= MaxInsurablePrice:
+		return roundCents(price * 0.20)
+	case price <= 500_000:
+		return roundCents(price * 0.05)
+	}
+	return roundCents(500_000*0.05 + (price-500_000)*0.10)
+}
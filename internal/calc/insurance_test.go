@@ -0,0 +1,104 @@
+package calc
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestPremiumRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		ltv     float64
+		want    float64
+		wantErr error
+	}{
+		{"no loan", 0, 0.0060, nil},
+		{"65%", 0.65, 0.0060, nil},
+		{"just over 65%", 0.6501, 0.0170, nil},
+		{"75%", 0.75, 0.0170, nil},
+		{"just over 75%", 0.7501, 0.0240, nil},
+		{"80%", 0.80, 0.0240, nil},
+		{"80% from dollars", 0.1 + 0.7, 0.0240, nil},
+		{"just over 80%", 0.8001, 0.0280, nil},
+		{"85%", 0.85, 0.0280, nil},
+		{"85% from dollars", 255_000.0 / 300_000, 0.0280, nil},
+		{"just over 85%", 0.8501, 0.0310, nil},
+		{"90%", 0.90, 0.0310, nil},
+		{"just over 90%", 0.9001, 0.0400, nil},
+		{"95%", 0.95, 0.0400, nil},
+		{"95% from dollars", 475_000.0 / 500_000, 0.0400, nil},
+		{"just over 95%", 0.9501, 0, ErrNotInsurable},
+		{"negative", -0.1, 0, ErrInvalidInput},
+		{"not a number", math.NaN(), 0, ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PremiumRate(tt.ltv)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PremiumRate(%v) error = %v, want %v", tt.ltv, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("PremiumRate(%v) = %v, want %v", tt.ltv, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsuranceFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		price   float64
+		loan    float64
+		want    Insurance
+		wantErr error
+	}{
+		{"20% down", 500_000, 400_000, Insurance{}, nil},
+		{"10% down", 500_000, 450_000, Insurance{Required: true, Rate: 0.0310, Premium: 13_950}, nil},
+		{"5% down", 500_000, 475_000, Insurance{Required: true, Rate: 0.0400, Premium: 19_000}, nil},
+		{"under 5% down", 500_000, 480_000, Insurance{}, ErrNotInsurable},
+		{"just under the price cap", 1_499_999, 1_299_999, Insurance{Required: true, Rate: 0.0310, Premium: 40_299.97}, nil},
+		{"at the price cap", 1_500_000, 1_300_000, Insurance{}, ErrNotInsurable},
+		{"20% down at the price cap", 1_500_000, 1_200_000, Insurance{}, nil},
+		{"loan over the price", 500_000, 500_001, Insurance{}, ErrInvalidInput},
+		{"no price", 0, 0, Insurance{}, ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InsuranceFor(tt.price, tt.loan)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("InsuranceFor(%v, %v) error = %v, want %v", tt.price, tt.loan, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("InsuranceFor(%v, %v) = %+v, want %+v", tt.price, tt.loan, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinimumDownPayment(t *testing.T) {
+	tests := []struct {
+		name  string
+		price float64
+		want  float64
+	}{
+		{"no price", 0, 0},
+		{"small purchase", 300_000, 15_000},
+		{"just under 500k", 499_999.99, 25_000},
+		{"500k", 500_000, 25_000},
+		{"just over 500k", 500_001, 25_000.10},
+		{"just under 1M", 999_999, 74_999.90},
+		{"1M", 1_000_000, 75_000},
+		{"just over 1M", 1_000_001, 75_000.10},
+		{"just under the price cap", 1_499_999, 124_999.90},
+		{"at the price cap", 1_500_000, 300_000},
+		{"over the price cap", 2_000_000, 400_000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MinimumDownPayment(tt.price); got != tt.want {
+				t.Errorf("MinimumDownPayment(%v) = %.2f, want %.2f", tt.price, got, tt.want)
+			}
+		})
+	}
+}
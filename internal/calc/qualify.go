@@ -0,0 +1,187 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// MaxInsuredAmortization is the longest amortization allowed on an insured
+// mortgage, in years.
+const MaxInsuredAmortization = 25
+
+// MaxAmortization is the longest amortization this calculator accepts.
+const MaxAmortization = 40
+
+// Inputs describe a purchase and the borrower's finances.
+type Inputs struct {
+	AnnualIncome float64
+	// MonthlyDebts are payments on car loans, credit cards and other debt.
+	MonthlyDebts      float64
+	PurchasePrice     float64
+	DownPayment       float64
+	Housing           HousingCosts
+	ContractRate      float64
+	AmortizationYears int
+}
+
+func (in Inputs) validate() error {
+	for _, v := range []float64{in.AnnualIncome, in.MonthlyDebts, in.PurchasePrice, in.DownPayment,
+		in.Housing.PropertyTax, in.Housing.Heating, in.Housing.CondoFees, in.ContractRate} {
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return ErrInvalidInput
+		}
+	}
+	switch {
+	case in.ContractRate >= 1:
+		return fmt.Errorf("%w: rate must be a fraction, not a percentage", ErrInvalidInput)
+	case in.AmortizationYears < 1 || in.AmortizationYears > MaxAmortization:
+		return fmt.Errorf("%w: amortization must be 1 to %d years", ErrInvalidInput, MaxAmortization)
+	case in.PurchasePrice <= 0:
+		return fmt.Errorf("%w: purchase price is required", ErrInvalidInput)
+	case in.DownPayment > in.PurchasePrice:
+		return fmt.Errorf("%w: down payment exceeds the purchase price", ErrInvalidInput)
+	}
+	return nil
+}
+
+// Assessment is the result of qualifying a purchase.
+type Assessment struct {
+	Inputs
+	// Loan is the amount borrowed before any insurance premium.
+	Loan float64
+	LTV  float64
+	// Insurance is the default insurance; its premium is added to the loan
+	// to give TotalLoan.
+	Insurance          Insurance
+	TotalLoan          float64
+	MinimumDownPayment float64
+	BenchmarkRate      float64
+	QualifyingRate     float64
+	// Payment is the monthly payment at the contract rate and
+	// QualifyingPayment the one at the qualifying rate, which the ratios use.
+	Payment           float64
+	QualifyingPayment float64
+	GDS               float64
+	TDS               float64
+	// MaxPurchasePrice is the most the borrower qualifies for with the same
+	// down payment, costs and rate.
+	MaxPurchasePrice float64
+	// Problems lists every reason the purchase does not qualify.
+	Problems []string
+}
+
+// Qualifies reports whether the purchase meets every rule.
+func (a Assessment) Qualifies() bool {
+	return len(a.Problems) == 0
+}
+
+// Assess qualifies a purchase at the current BenchmarkRate.
+func Assess(in Inputs) (Assessment, error) {
+	return AssessAt(in, BenchmarkRate)
+}
+
+// AssessAt qualifies a purchase against a given benchmark rate.
+func AssessAt(in Inputs, benchmarkRate float64) (Assessment, error) {
+	return AssessWithin(in, benchmarkRate, Limits{GDS: MaxGDS, TDS: MaxTDS})
+}
+
+// Limits are the highest GDS and TDS ratios a lender accepts.
+type Limits struct {
+	GDS float64
+	TDS float64
+}
+
+// AssessWithin qualifies a purchase against a benchmark rate and a
+// lender's own ratio limits. MaxPurchasePrice always uses the standard
+// limits.
+func AssessWithin(in Inputs, benchmarkRate float64, limits Limits) (Assessment, error) {
+	if err := in.validate(); err != nil {
+		return Assessment{}, err
+	}
+	a := Assessment{
+		Inputs:             in,
+		Loan:               roundCents(in.PurchasePrice - in.DownPayment),
+		MinimumDownPayment: MinimumDownPayment(in.PurchasePrice),
+		BenchmarkRate:      benchmarkRate,
+		QualifyingRate:     QualifyingRate(in.ContractRate, benchmarkRate),
+	}
+	a.LTV = a.Loan / in.PurchasePrice
+
+	if in.DownPayment < a.MinimumDownPayment {
+		a.Problems = append(a.Problems, fmt.Sprintf("Down payment is below the minimum of $%.2f.", a.MinimumDownPayment))
+	}
+	ins, err := InsuranceFor(in.PurchasePrice, a.Loan)
+	switch {
+	case errors.Is(err, ErrNotInsurable):
+		a.Problems = append(a.Problems, "A down payment under 20% needs mortgage insurance, which is not available for this purchase.")
+	case err != nil:
+		return Assessment{}, err
+	}
+	a.Insurance = ins
+	if ins.Required && in.AmortizationYears > MaxInsuredAmortization {
+		a.Problems = append(a.Problems, fmt.Sprintf("Insured mortgages are limited to a %d-year amortization.", MaxInsuredAmortization))
+	}
+	a.TotalLoan = roundCents(a.Loan + ins.Premium)
+
+	a.Payment = MonthlyPayment(a.TotalLoan, in.ContractRate, in.AmortizationYears)
+	a.QualifyingPayment = MonthlyPayment(a.TotalLoan, a.QualifyingRate, in.AmortizationYears)
+	a.GDS = GDS(in.AnnualIncome, a.QualifyingPayment, in.Housing)
+	a.TDS = TDS(in.AnnualIncome, a.QualifyingPayment, in.Housing, in.MonthlyDebts)
+	if a.GDS > limits.GDS {
+		a.Problems = append(a.Problems, fmt.Sprintf("GDS of %.1f%% is above the %.4g%% limit.", a.GDS*100, limits.GDS*100))
+	}
+	if a.TDS > limits.TDS {
+		a.Problems = append(a.Problems, fmt.Sprintf("TDS of %.1f%% is above the %.4g%% limit.", a.TDS*100, limits.TDS*100))
+	}
+	a.MaxPurchasePrice = MaxPurchasePrice(in, benchmarkRate)
+	return a, nil
+}
+
+// affordable reports whether a purchase at price, with the given down
+// payment and costs, passes the stress test and the down payment and
+// insurance rules.
+func affordable(in Inputs, price, qualifyingRate float64) bool {
+	if in.DownPayment < MinimumDownPayment(price) {
+		return false
+	}
+	loan := math.Max(price-in.DownPayment, 0)
+	ins, err := InsuranceFor(price, loan)
+	if err != nil || (ins.Required && in.AmortizationYears > MaxInsuredAmortization) {
+		return false
+	}
+	payment := MonthlyPayment(loan+ins.Premium, qualifyingRate, in.AmortizationYears)
+	return GDS(in.AnnualIncome, payment, in.Housing) <= MaxGDS &&
+		TDS(in.AnnualIncome, payment, in.Housing, in.MonthlyDebts) <= MaxTDS
+}
+
+// MaxPurchasePrice is the highest price, to the dollar, the borrower
+// qualifies for with in's down payment, costs, rate and amortization; the
+// purchase price in in is ignored. It is 0 if nothing is affordable. Every
+// rule only gets stricter as the price rises, so the answer is found by
+// bisection.
+func MaxPurchasePrice(in Inputs, benchmarkRate float64) float64 {
+	rate := QualifyingRate(in.ContractRate, benchmarkRate)
+	lo := in.DownPayment
+	if in.AmortizationYears < 1 || !affordable(in, lo, rate) {
+		return 0
+	}
+	// The minimum down payment is at least 5%, which bounds the price.
+	hi := in.DownPayment / 0.05
+	if affordable(in, hi, rate) {
+		return math.Floor(hi)
+	}
+	for hi-lo > 0.5 {
+		mid := (lo + hi) / 2
+		if affordable(in, mid, rate) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	// A whole dollar may still fit between lo and hi
+	if p := math.Floor(hi); p > lo && affordable(in, p, rate) {
+		return p
+	}
+	return math.Floor(lo)
+}
@@ -0,0 +1,142 @@
+package calc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMaxPurchasePrice(t *testing.T) {
+	// 300 a month of property tax and 100 of heating
+	h := HousingCosts{PropertyTax: 3600, Heating: 100}
+	tests := []struct {
+		name string
+		in   Inputs
+		want float64
+		// wantProblem is why one dollar more does not qualify
+		wantProblem string
+	}{
+		{"GDS limit", Inputs{AnnualIncome: 100_000, DownPayment: 150_000, ContractRate: 0.05, AmortizationYears: 25, Housing: h},
+			556_901, "GDS of"},
+		{"GDS limit at the benchmark rate", Inputs{AnnualIncome: 90_000, DownPayment: 40_000, ContractRate: 0.03, AmortizationYears: 25, Housing: h},
+			447_420, "GDS of"},
+		{"TDS limit", Inputs{AnnualIncome: 100_000, MonthlyDebts: 800, DownPayment: 150_000, ContractRate: 0.05, AmortizationYears: 25, Housing: h},
+			502_171, "TDS of"},
+		// The premium once the loan passes 80% puts GDS over the limit
+		{"insurance premium", Inputs{AnnualIncome: 100_000, DownPayment: 100_000, ContractRate: 0.05, AmortizationYears: 25, Housing: h},
+			500_125, "GDS of"},
+		{"minimum down payment", Inputs{AnnualIncome: 1_000_000, DownPayment: 50_000, ContractRate: 0.05, AmortizationYears: 25},
+			750_000, "Down payment is below"},
+		{"just below the insured price cap", Inputs{AnnualIncome: 1_000_000, DownPayment: 200_000, ContractRate: 0.05, AmortizationYears: 25},
+			1_499_999, "not available"},
+		{"insured amortization limit", Inputs{AnnualIncome: 1_000_000, DownPayment: 200_000, ContractRate: 0.05, AmortizationYears: 30},
+			1_000_250, "25-year amortization"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MaxPurchasePrice(tt.in, DefaultBenchmarkRate)
+			if got != tt.want {
+				t.Fatalf("MaxPurchasePrice = %.0f, want %.0f", got, tt.want)
+			}
+			in := tt.in
+			in.PurchasePrice = got
+			a, err := AssessAt(in, DefaultBenchmarkRate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !a.Qualifies() {
+				t.Errorf("%.0f does not qualify: %v", got, a.Problems)
+			}
+			in.PurchasePrice = got + 1
+			if a, err = AssessAt(in, DefaultBenchmarkRate); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(strings.Join(a.Problems, " "), tt.wantProblem) {
+				t.Errorf("at %.0f got problems %q, want %q", got+1, a.Problems, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestMaxPurchasePriceNothingAffordable(t *testing.T) {
+	in := Inputs{MonthlyDebts: 500, DownPayment: 20_000, ContractRate: 0.05, AmortizationYears: 25}
+	if got := MaxPurchasePrice(in, DefaultBenchmarkRate); got != 0 {
+		t.Errorf("MaxPurchasePrice with no income = %.0f, want 0", got)
+	}
+}
+
+func TestAssessAt(t *testing.T) {
+	in := Inputs{
+		AnnualIncome:      150_000,
+		PurchasePrice:     500_000,
+		DownPayment:       50_000,
+		ContractRate:      0.045,
+		AmortizationYears: 25,
+		Housing:           HousingCosts{PropertyTax: 3600, Heating: 100},
+	}
+	a, err := AssessAt(in, DefaultBenchmarkRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Loan != 450_000 || a.Insurance.Premium != 13_950 || a.TotalLoan != 463_950 {
+		t.Errorf("loan %.2f + premium %.2f = %.2f, want 450000 + 13950 = 463950", a.Loan, a.Insurance.Premium, a.TotalLoan)
+	}
+	if a.QualifyingRate != 0.065 {
+		t.Errorf("QualifyingRate = %v, want 0.065", a.QualifyingRate)
+	}
+	if want := MonthlyPayment(463_950, 0.065, 25); a.QualifyingPayment != want {
+		t.Errorf("QualifyingPayment = %.2f, want %.2f", a.QualifyingPayment, want)
+	}
+	if !a.Qualifies() {
+		t.Errorf("Problems = %v, want none", a.Problems)
+	}
+}
+
+func TestAssessWithinLimits(t *testing.T) {
+	in := Inputs{AnnualIncome: 100_000, MonthlyDebts: 500, PurchasePrice: 500_000, DownPayment: 100_000,
+		ContractRate: 0.03, AmortizationYears: 25, Housing: HousingCosts{PropertyTax: 3600, Heating: 100}}
+	tests := []struct {
+		name   string
+		limits Limits
+		want   []string
+	}{
+		{"standard", Limits{GDS: MaxGDS, TDS: MaxTDS}, nil},
+		{"strict GDS", Limits{GDS: 0.32, TDS: MaxTDS}, []string{"GDS of 33.4% is above the 32% limit."}},
+		{"strict TDS", Limits{GDS: MaxGDS, TDS: 0.35}, []string{"TDS of 39.4% is above the 35% limit."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := AssessWithin(in, DefaultBenchmarkRate, tt.limits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(a.Problems, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Problems = %q, want %q", a.Problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssessInvalid(t *testing.T) {
+	valid := Inputs{AnnualIncome: 100_000, PurchasePrice: 500_000, DownPayment: 100_000, ContractRate: 0.05, AmortizationYears: 25}
+	tests := []struct {
+		name   string
+		change func(*Inputs)
+	}{
+		{"negative income", func(in *Inputs) { in.AnnualIncome = -1 }},
+		{"rate as a percentage", func(in *Inputs) { in.ContractRate = 5 }},
+		{"no amortization", func(in *Inputs) { in.AmortizationYears = 0 }},
+		{"amortization too long", func(in *Inputs) { in.AmortizationYears = MaxAmortization + 1 }},
+		{"no price", func(in *Inputs) { in.PurchasePrice = 0 }},
+		{"down payment over the price", func(in *Inputs) { in.DownPayment = 600_000 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := valid
+			tt.change(&in)
+			if _, err := AssessAt(in, DefaultBenchmarkRate); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("err = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+}
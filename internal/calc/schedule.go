@@ -0,0 +1,261 @@
+package calc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Frequency is how often mortgage payments are made.
+type Frequency string
+
+const (
+	Monthly             Frequency = "monthly"
+	SemiMonthly         Frequency = "semi_monthly"
+	BiWeekly            Frequency = "biweekly"
+	AcceleratedBiWeekly Frequency = "accelerated_biweekly"
+	Weekly              Frequency = "weekly"
+)
+
+// Frequencies lists every payment frequency, for forms.
+var Frequencies = []Frequency{Monthly, SemiMonthly, BiWeekly, AcceleratedBiWeekly, Weekly}
+
+// Label names the frequency for people.
+func (f Frequency) Label() string {
+	switch f {
+	case SemiMonthly:
+		return "Semi-monthly"
+	case BiWeekly:
+		return "Bi-weekly"
+	case AcceleratedBiWeekly:
+		return "Accelerated bi-weekly"
+	case Weekly:
+		return "Weekly"
+	}
+	return "Monthly"
+}
+
+// PeriodsPerYear is the number of payments made each year.
+func (f Frequency) PeriodsPerYear() int {
+	switch f {
+	case SemiMonthly:
+		return 24
+	case BiWeekly, AcceleratedBiWeekly:
+		return 26
+	case Weekly:
+		return 52
+	}
+	return 12
+}
+
+// Valid reports whether f is one of Frequencies.
+func (f Frequency) Valid() bool {
+	for _, v := range Frequencies {
+		if f == v {
+			return true
+		}
+	}
+	return false
+}
+
+// payment is the payment that repays balance over the given number of
+// periods. Accelerated bi-weekly payments are half the monthly payment, so
+// 26 a year repay the loan faster than the contract amortization.
+func (f Frequency) payment(balance, annualRate float64, periods int) float64 {
+	if f == AcceleratedBiWeekly {
+		months := int(math.Ceil(float64(periods) * 12 / 26))
+		return roundCents(Payment(balance, PeriodicRate(annualRate, 12), months) / 2)
+	}
+	return Payment(balance, PeriodicRate(annualRate, f.PeriodsPerYear()), periods)
+}
+
+// date is the date of payment n, counting the first payment as 1.
+// Semi-monthly payments fall on the first payment's day and 15 days later.
+func (f Frequency) date(first time.Time, n int) time.Time {
+	if first.IsZero() {
+		return time.Time{}
+	}
+	n--
+	switch f {
+	case SemiMonthly:
+		return first.AddDate(0, n/2, 15*(n%2))
+	case BiWeekly, AcceleratedBiWeekly:
+		return first.AddDate(0, 0, 14*n)
+	case Weekly:
+		return first.AddDate(0, 0, 7*n)
+	}
+	return first.AddDate(0, n, 0)
+}
+
+// Prepayment is a lump sum paid along with a regular payment.
+type Prepayment struct {
+	// Payment is the number of the payment it is made with, from 1.
+	Payment int
+	Amount  float64
+}
+
+// Renewal changes the rate at the end of a term. The payment is then
+// recalculated to repay the balance over what is left of the amortization.
+type Renewal struct {
+	// Payment is the number of the first payment at the new rate.
+	Payment int
+	Rate    float64
+}
+
+// Plan describes a mortgage to amortize.
+type Plan struct {
+	Principal         float64
+	Rate              float64
+	AmortizationYears int
+	Frequency         Frequency
+	// FirstPayment dates the schedule; rows are undated when it is zero.
+	FirstPayment time.Time
+	// ExtraPayment is added to every regular payment.
+	ExtraPayment float64
+	Prepayments  []Prepayment
+	Renewals     []Renewal
+}
+
+// Row is one payment in an amortization schedule.
+type Row struct {
+	Number    int
+	Date      time.Time
+	Rate      float64
+	Payment   float64
+	Interest  float64
+	Principal float64
+	// Prepayment is any extra amount paid against the principal with this
+	// payment, on top of Principal.
+	Prepayment float64
+	Balance    float64
+}
+
+func (p Plan) validate() error {
+	periods := p.AmortizationYears * p.Frequency.PeriodsPerYear()
+	switch {
+	case !p.Frequency.Valid():
+		return fmt.Errorf("%w: unknown payment frequency %q", ErrInvalidInput, p.Frequency)
+	case p.Principal <= 0 || math.IsNaN(p.Principal) || math.IsInf(p.Principal, 0):
+		return fmt.Errorf("%w: the mortgage amount is required", ErrInvalidInput)
+	case p.Rate < 0 || p.Rate >= 1 || math.IsNaN(p.Rate):
+		return fmt.Errorf("%w: rate must be a fraction, not a percentage", ErrInvalidInput)
+	case p.AmortizationYears < 1 || p.AmortizationYears > MaxAmortization:
+		return fmt.Errorf("%w: amortization must be 1 to %d years", ErrInvalidInput, MaxAmortization)
+	case p.ExtraPayment < 0 || math.IsNaN(p.ExtraPayment):
+		return fmt.Errorf("%w: extra payments cannot be negative", ErrInvalidInput)
+	}
+	for _, pp := range p.Prepayments {
+		if pp.Payment < 1 || pp.Payment > periods || pp.Amount < 0 || math.IsNaN(pp.Amount) {
+			return fmt.Errorf("%w: prepayments must be made with one of the %d payments", ErrInvalidInput, periods)
+		}
+	}
+	for _, r := range p.Renewals {
+		if r.Payment < 2 || r.Payment > periods || r.Rate < 0 || r.Rate >= 1 || math.IsNaN(r.Rate) {
+			return fmt.Errorf("%w: renewals must start within the amortization at a rate below 100%%", ErrInvalidInput)
+		}
+	}
+	return nil
+}
+
+// Amortize lists every payment that repays the plan, with semi-annual
+// compounding. Interest is rounded to the cent each period and the final
+// payment clears whatever balance remains; prepayments shorten the
+// schedule until a renewal recalculates the payment.
+func (p Plan) Amortize() ([]Row, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	ppy := p.Frequency.PeriodsPerYear()
+	periods := p.AmortizationYears * ppy
+
+	lumps := map[int]float64{}
+	for _, pp := range p.Prepayments {
+		lumps[pp.Payment] += pp.Amount
+	}
+	renewals := append([]Renewal(nil), p.Renewals...)
+	sort.Slice(renewals, func(i, j int) bool { return renewals[i].Payment < renewals[j].Payment })
+
+	balance := roundCents(p.Principal)
+	rate := p.Rate
+	periodic := PeriodicRate(rate, ppy)
+	payment := p.Frequency.payment(balance, rate, periods)
+
+	rows := make([]Row, 0, periods)
+	for n := 1; n <= periods && balance > 0; n++ {
+		for len(renewals) > 0 && renewals[0].Payment <= n {
+			rate = renewals[0].Rate
+			renewals = renewals[1:]
+			periodic = PeriodicRate(rate, ppy)
+			payment = p.Frequency.payment(balance, rate, periods-n+1)
+		}
+		interest := roundCents(balance * periodic)
+		pay := payment
+		if n == periods || pay > balance+interest {
+			pay = roundCents(balance + interest)
+		}
+		toPrincipal := roundCents(pay - interest)
+		balance = roundCents(balance - toPrincipal)
+		extra := roundCents(math.Min(p.ExtraPayment+lumps[n], balance))
+		balance = roundCents(balance - extra)
+		rows = append(rows, Row{
+			Number: n, Date: p.Frequency.date(p.FirstPayment, n), Rate: rate,
+			Payment: pay, Interest: interest, Principal: toPrincipal, Prepayment: extra,
+			Balance: math.Max(balance, 0),
+		})
+	}
+	return rows, nil
+}
+
+// Summary totals a schedule.
+type Summary struct {
+	Payments    int
+	TotalPaid   float64
+	Interest    float64
+	Prepayments float64
+	// Years is how long the schedule takes to repay the loan.
+	Years float64
+}
+
+// Summarize totals a schedule with periodsPerYear payments a year.
+func Summarize(rows []Row, periodsPerYear int) Summary {
+	s := Summary{Payments: len(rows)}
+	for _, r := range rows {
+		s.TotalPaid = roundCents(s.TotalPaid + r.Payment + r.Prepayment)
+		s.Interest = roundCents(s.Interest + r.Interest)
+		s.Prepayments = roundCents(s.Prepayments + r.Prepayment)
+	}
+	if periodsPerYear > 0 {
+		s.Years = float64(len(rows)) / float64(periodsPerYear)
+	}
+	return s
+}
+
+// YearTotal sums one year of a schedule.
+type YearTotal struct {
+	Year        int
+	Payments    float64
+	Interest    float64
+	Principal   float64
+	Prepayments float64
+	// Balance is what is owed at the end of the year.
+	Balance float64
+}
+
+// Yearly groups a schedule with periodsPerYear payments a year by year.
+func Yearly(rows []Row, periodsPerYear int) []YearTotal {
+	var years []YearTotal
+	for _, r := range rows {
+		y := (r.Number-1)/periodsPerYear + 1
+		if len(years) < y {
+			years = append(years, YearTotal{Year: y})
+		}
+		t := &years[y-1]
+		t.Payments = roundCents(t.Payments + r.Payment)
+		t.Interest = roundCents(t.Interest + r.Interest)
+		t.Principal = roundCents(t.Principal + r.Principal)
+		t.Prepayments = roundCents(t.Prepayments + r.Prepayment)
+		t.Balance = r.Balance
+	}
+	return years
+}
@@ -0,0 +1,173 @@
+package calc
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAmortize(t *testing.T) {
+	base := Plan{Principal: 400_000, Rate: 0.05, AmortizationYears: 25, Frequency: Monthly}
+	with := func(change func(*Plan)) Plan {
+		p := base
+		change(&p)
+		return p
+	}
+	tests := []struct {
+		name         string
+		plan         Plan
+		wantPayments int
+		wantPayment  float64
+		wantInterest float64
+	}{
+		{"monthly", base, 300, 2326.42, 297_925.98},
+		{"semi-monthly", with(func(p *Plan) { p.Frequency = SemiMonthly }), 600, 1162.01, 297_209.85},
+		{"bi-weekly", with(func(p *Plan) { p.Frequency = BiWeekly }), 650, 1072.54, 297_154.33},
+		// Half the monthly payment, 26 times a year, repays it in 21.5 years
+		{"accelerated bi-weekly", with(func(p *Plan) { p.Frequency = AcceleratedBiWeekly }), 559, 1163.21, 249_577.12},
+		{"weekly", with(func(p *Plan) { p.Frequency = Weekly }), 1300, 536.02, 296_817.68},
+		{"no interest", Plan{Principal: 120_000, AmortizationYears: 10, Frequency: Monthly}, 120, 1000, 0},
+		{"increased payments", with(func(p *Plan) { p.ExtraPayment = 200 }), 258, 2326.42, 249_629.03},
+		{"lump sums", with(func(p *Plan) { p.Prepayments = []Prepayment{{12, 20_000}, {24, 20_000}} }), 251, 2326.42, 222_570.39},
+		// A prepayment over the balance only pays off what is owed
+		{"lump sum over the balance", with(func(p *Plan) { p.Prepayments = []Prepayment{{12, 1_000_000}} }), 12, 2326.42, 19_608},
+		{"renewal", with(func(p *Plan) { p.Renewals = []Renewal{{61, 0.065}} }), 300, 2326.42, 368_768.59},
+		{"renewals out of order", with(func(p *Plan) {
+			p.Frequency = BiWeekly
+			p.Renewals = []Renewal{{261, 0.06}, {131, 0.04}}
+		}), 650, 1072.54, 305_281.83},
+		// The renewal spreads what is left over the rest of the amortization
+		{"lump sum before a renewal", with(func(p *Plan) {
+			p.Prepayments = []Prepayment{{60, 50_000}}
+			p.Renewals = []Renewal{{61, 0.065}}
+		}), 300, 2326.42, 329_908.53},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := tt.plan.Amortize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := Summarize(rows, tt.plan.Frequency.PeriodsPerYear())
+			if s.Payments != tt.wantPayments {
+				t.Errorf("%d payments, want %d", s.Payments, tt.wantPayments)
+			}
+			if rows[0].Payment != tt.wantPayment {
+				t.Errorf("first payment %.2f, want %.2f", rows[0].Payment, tt.wantPayment)
+			}
+			if s.Interest != tt.wantInterest {
+				t.Errorf("interest %.2f, want %.2f", s.Interest, tt.wantInterest)
+			}
+			if last := rows[len(rows)-1]; last.Balance != 0 {
+				t.Errorf("final balance %.2f, want 0", last.Balance)
+			}
+			if paid := roundCents(s.TotalPaid - s.Interest); paid != tt.plan.Principal {
+				t.Errorf("principal repaid %.2f, want %.2f", paid, tt.plan.Principal)
+			}
+			balance := tt.plan.Principal
+			for _, r := range rows {
+				if got := roundCents(r.Interest + r.Principal); got != r.Payment {
+					t.Fatalf("payment %d: interest and principal add to %.2f, not %.2f", r.Number, got, r.Payment)
+				}
+				balance = roundCents(balance - r.Principal - r.Prepayment)
+				if r.Balance != balance {
+					t.Fatalf("payment %d: balance %.2f, want %.2f", r.Number, r.Balance, balance)
+				}
+			}
+		})
+	}
+}
+
+func TestAmortizeRenewalRate(t *testing.T) {
+	p := Plan{Principal: 400_000, Rate: 0.05, AmortizationYears: 25, Frequency: Monthly,
+		Renewals: []Renewal{{61, 0.065}}}
+	rows, err := p.Amortize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, after := rows[59], rows[60]
+	if before.Rate != 0.05 || after.Rate != 0.065 {
+		t.Errorf("rates %v then %v, want 0.05 then 0.065", before.Rate, after.Rate)
+	}
+	// The balance after 60 payments repaid over the remaining 20 years
+	if want := MonthlyPayment(before.Balance, 0.065, 20); after.Payment != want {
+		t.Errorf("payment after renewal %.2f, want %.2f", after.Payment, want)
+	}
+}
+
+func TestAmortizeDates(t *testing.T) {
+	first := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		frequency Frequency
+		n         int
+		want      time.Time
+	}{
+		{Monthly, 13, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{SemiMonthly, 2, time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{SemiMonthly, 3, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{BiWeekly, 27, time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{AcceleratedBiWeekly, 2, time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{Weekly, 53, time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.frequency), func(t *testing.T) {
+			p := Plan{Principal: 100_000, Rate: 0.05, AmortizationYears: 5, Frequency: tt.frequency, FirstPayment: first}
+			rows, err := p.Amortize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rows[tt.n-1].Date; !got.Equal(tt.want) {
+				t.Errorf("payment %d on %s, want %s", tt.n, got.Format("2006-01-02"), tt.want.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestAmortizeInvalid(t *testing.T) {
+	valid := Plan{Principal: 400_000, Rate: 0.05, AmortizationYears: 25, Frequency: Monthly}
+	tests := []struct {
+		name   string
+		change func(*Plan)
+	}{
+		{"unknown frequency", func(p *Plan) { p.Frequency = "daily" }},
+		{"no principal", func(p *Plan) { p.Principal = 0 }},
+		{"infinite principal", func(p *Plan) { p.Principal = math.Inf(1) }},
+		{"rate as a percentage", func(p *Plan) { p.Rate = 5 }},
+		{"amortization too long", func(p *Plan) { p.AmortizationYears = MaxAmortization + 1 }},
+		{"negative extra payment", func(p *Plan) { p.ExtraPayment = -1 }},
+		{"prepayment after the last payment", func(p *Plan) { p.Prepayments = []Prepayment{{301, 1000}} }},
+		{"negative prepayment", func(p *Plan) { p.Prepayments = []Prepayment{{12, -1000}} }},
+		{"renewal at the first payment", func(p *Plan) { p.Renewals = []Renewal{{1, 0.06}} }},
+		{"renewal after the last payment", func(p *Plan) { p.Renewals = []Renewal{{301, 0.06}} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid
+			tt.change(&p)
+			if _, err := p.Amortize(); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("err = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+}
+
+func TestYearly(t *testing.T) {
+	p := Plan{Principal: 400_000, Rate: 0.05, AmortizationYears: 25, Frequency: Monthly,
+		Prepayments: []Prepayment{{12, 20_000}}}
+	rows, err := p.Amortize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	years := Yearly(rows, 12)
+	if len(years) != 23 {
+		t.Fatalf("%d years, want 23", len(years))
+	}
+	first := years[0]
+	if first.Prepayments != 20_000 || first.Balance != rows[11].Balance {
+		t.Errorf("year 1: prepayments %.2f, balance %.2f; want 20000, %.2f", first.Prepayments, first.Balance, rows[11].Balance)
+	}
+	if paid := roundCents(first.Principal + first.Prepayments); paid != roundCents(400_000-first.Balance) {
+		t.Errorf("year 1 repaid %.2f, want %.2f", paid, 400_000-first.Balance)
+	}
+}
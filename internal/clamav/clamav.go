@@ -0,0 +1,187 @@
+// Package clamav scans files for malware with a ClamAV daemon (clamd),
+// streaming them over TCP or a unix socket with the INSTREAM command.
+package clamav
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+// ErrDisabled is returned by Scan when no clamd address is configured.
+var ErrDisabled = errors.New("clamav: clamd is not configured")
+
+// ErrTooLarge is returned when a file is longer than clamd's
+// StreamMaxLength, so clamd refused to scan it. Scanning it again will not
+// help.
+var ErrTooLarge = errors.New("clamav: file is over clamd's stream size limit")
+
+// chunkSize is how much of the file is sent in each INSTREAM chunk.
+const chunkSize = 64 << 10
+
+// Config holds the clamd settings.
+type Config struct {
+	// Address is "tcp://host:port", "unix:///path/to/clamd.sock", a bare
+	// host:port or a socket path starting with /.
+	Address string
+	// Timeout bounds a whole scan, including connecting.
+	Timeout time.Duration
+	// Dev passes every file as clean, with a warning, when Address is
+	// empty.
+	Dev bool
+}
+
+// Result is clamd's verdict on one file.
+type Result struct {
+	Infected bool
+	// Signature names the malware found, such as "Eicar-Signature".
+	Signature string
+}
+
+var config Config
+
+// Configure sets the clamd settings used by Scan. Call it once at startup.
+func Configure(c Config) {
+	config = c
+}
+
+// Scan streams r to clamd and returns its verdict.
+func Scan(ctx context.Context, r io.Reader) (Result, error) {
+	c := config
+	if c.Address == "" {
+		if c.Dev {
+			slog.Warn("File not scanned for malware: clamd is not configured")
+			return Result{}, nil
+		}
+		return Result{}, ErrDisabled
+	}
+	return ScanAt(ctx, c.Address, c.Timeout, r)
+}
+
+// ScanAt is Scan against the clamd at address, for callers such as tests
+// that do not use the configured one. A zero timeout means no limit beyond
+// ctx.
+func ScanAt(ctx context.Context, address string, timeout time.Duration, r io.Reader) (Result, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	conn, err := dial(ctx, address)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Unblock reads and writes if ctx is cancelled without a deadline
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if err := stream(conn, r); err != nil {
+		var fe fileError
+		if errors.As(err, &fe) {
+			return Result{}, fmt.Errorf("clamav: %w", err)
+		}
+		// clamd replies and hangs up as soon as a stream is over its limit
+		if reply, rerr := readReply(conn); rerr == nil {
+			return parseReply(reply)
+		}
+		return Result{}, fmt.Errorf("clamav: sending file: %w", err)
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamav: reading reply: %w", err)
+	}
+	return parseReply(reply)
+}
+
+// readReply reads clamd's null-terminated reply.
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", err
+	}
+	return reply, nil
+}
+
+func dial(ctx context.Context, address string) (net.Conn, error) {
+	network := "tcp"
+	switch {
+	case strings.HasPrefix(address, "tcp://"):
+		address = strings.TrimPrefix(address, "tcp://")
+	case strings.HasPrefix(address, "unix://"):
+		network, address = "unix", strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "/"):
+		network = "unix"
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("clamav: connecting to clamd: %w", err)
+	}
+	return conn, nil
+}
+
+// fileError is an error reading the file being scanned, rather than one
+// sending it to clamd.
+type fileError struct{ err error }
+
+func (e fileError) Error() string { return "reading file: " + e.err.Error() }
+func (e fileError) Unwrap() error { return e.err }
+
+// stream sends the INSTREAM command, then r as length-prefixed chunks
+// ending with an empty one.
+func stream(w io.Writer, r io.Reader) error {
+	bw := bufio.NewWriterSize(w, chunkSize+4)
+	if _, err := bw.WriteString("zINSTREAM\x00"); err != nil {
+		return err
+	}
+	buf := make([]byte, chunkSize)
+	var size [4]byte
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			bw.Write(size[:])
+			if _, werr := bw.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fileError{err}
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	bw.Write(size[:])
+	return bw.Flush()
+}
+
+// parseReply reads a reply such as "stream: OK" or
+// "stream: Eicar-Signature FOUND".
+func parseReply(reply string) (Result, error) {
+	reply = strings.TrimRight(reply, "\x00\n")
+	_, verdict, _ := strings.Cut(reply, ": ")
+	switch {
+	case verdict == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	case strings.HasPrefix(reply, "INSTREAM size limit exceeded"):
+		return Result{}, ErrTooLarge
+	case strings.HasSuffix(reply, " ERROR"):
+		return Result{}, fmt.Errorf("clamav: %s", strings.TrimSuffix(reply, " ERROR"))
+	}
+	return Result{}, fmt.Errorf("clamav: unexpected reply %q", reply)
+}
@@ -0,0 +1,177 @@
+package clamav
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"MortgageAgent/internal/clamav/clamavtest"
+)
+
+func TestScanAt(t *testing.T) {
+	clean := []byte("%PDF-1.4 pay stub")
+	// EICAR past the first chunk is only found if every chunk arrives
+	late := append(bytes.Repeat([]byte{'a'}, chunkSize+10), clamavtest.EICAR...)
+	large := bytes.Repeat([]byte{'a'}, 32<<20)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		reply     string
+		maxLength int64
+		want      Result
+		wantErr   error
+	}{
+		{name: "clean", data: clean},
+		{name: "empty", data: nil},
+		{name: "infected", data: []byte(clamavtest.EICAR), want: Result{Infected: true, Signature: clamavtest.Signature}},
+		{name: "infected after the first chunk", data: late, want: Result{Infected: true, Signature: clamavtest.Signature}},
+		{name: "clamd error", data: clean, reply: "Can't allocate memory ERROR"},
+		{name: "over the size limit", data: clean, maxLength: 8, wantErr: ErrTooLarge},
+		// clamd hangs up while the rest of the file is still being sent
+		{name: "far over the size limit", data: large, maxLength: chunkSize, wantErr: ErrTooLarge},
+		{name: "at the size limit", data: clean, maxLength: int64(len(clean))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := clamavtest.NewServer()
+			defer srv.Close()
+			srv.Reply = tt.reply
+			srv.StreamMaxLength = tt.maxLength
+			var received int
+			verdict := srv.Verdict
+			srv.Verdict = func(data []byte) string {
+				received = len(data)
+				return verdict(data)
+			}
+
+			got, err := ScanAt(context.Background(), srv.Address, 10*time.Second, bytes.NewReader(tt.data))
+			switch {
+			case tt.reply != "":
+				if err == nil || errors.Is(err, ErrTooLarge) || !strings.Contains(err.Error(), "Can't allocate memory") {
+					t.Fatalf("err = %v, want clamd's error", err)
+				}
+				return
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ScanAt = %+v, want %+v", got, tt.want)
+			}
+			if received != len(tt.data) {
+				t.Errorf("clamd received %d bytes, want %d", received, len(tt.data))
+			}
+		})
+	}
+}
+
+func TestScanAtUnixSocket(t *testing.T) {
+	srv := clamavtest.NewUnixServer(filepath.Join(t.TempDir(), "clamd.sock"))
+	defer srv.Close()
+	got, err := ScanAt(context.Background(), srv.Address, 10*time.Second, strings.NewReader(clamavtest.EICAR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Infected || srv.Scans() != 1 {
+		t.Errorf("ScanAt = %+v after %d scans, want infected after 1", got, srv.Scans())
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("disk gone") }
+
+func TestScanAtErrors(t *testing.T) {
+	srv := clamavtest.NewServer()
+	address := srv.Address
+	defer srv.Close()
+
+	// A file that cannot be read fails at once rather than waiting for clamd
+	start := time.Now()
+	if _, err := ScanAt(context.Background(), address, 10*time.Second, failingReader{}); err == nil || !strings.Contains(err.Error(), "disk gone") {
+		t.Errorf("unreadable file: err = %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("unreadable file waited for clamd")
+	}
+
+	unreachable := clamavtest.NewServer()
+	unreachable.Close()
+	if _, err := ScanAt(context.Background(), unreachable.Address, time.Second, strings.NewReader("x")); err == nil || errors.Is(err, ErrTooLarge) {
+		t.Errorf("clamd down: err = %v", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 14_000)
+	var buf bytes.Buffer
+	if err := stream(&buf, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	command, err := buf.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		t.Fatalf("command %q, %v", command, err)
+	}
+	var sizes []int
+	var got []byte
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(&buf, size[:]); err != nil {
+			t.Fatalf("after %v chunks: %v", sizes, err)
+		}
+		n := int(binary.BigEndian.Uint32(size[:]))
+		sizes = append(sizes, n)
+		if n == 0 {
+			break
+		}
+		got = append(got, buf.Next(n)...)
+	}
+	if want := []int{chunkSize, chunkSize, len(data) - 2*chunkSize, 0}; !slices.Equal(sizes, want) {
+		t.Errorf("chunk sizes %v, want %v", sizes, want)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("chunks do not add up to the file")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes after the last chunk", buf.Len())
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		reply   string
+		want    Result
+		wantErr string
+	}{
+		{reply: "stream: OK\x00", want: Result{}},
+		{reply: "stream: Win.Test.EICAR_HDB-1 FOUND\x00", want: Result{Infected: true, Signature: "Win.Test.EICAR_HDB-1"}},
+		{reply: "stream: OK\n", want: Result{}},
+		{reply: "INSTREAM size limit exceeded. ERROR\x00", wantErr: ErrTooLarge.Error()},
+		{reply: "stream: Can't allocate memory ERROR\x00", wantErr: "clamav: stream: Can't allocate memory"},
+		{reply: "UNKNOWN COMMAND\x00", wantErr: `clamav: unexpected reply "UNKNOWN COMMAND"`},
+	}
+	for _, tt := range tests {
+		got, err := parseReply(tt.reply)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("parseReply(%q) err = %v, want %s", tt.reply, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseReply(%q) = %+v, %v; want %+v", tt.reply, got, err, tt.want)
+		}
+	}
+}
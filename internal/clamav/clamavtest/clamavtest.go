@@ -0,0 +1,155 @@
+// Package clamavtest provides a fake clamd for testing code that scans
+// files, in the manner of net/http/httptest.
+package clamavtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// EICAR is the standard antivirus test file. The fake reports it, and any
+// file containing it, as infected with Signature.
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// Signature is the name the fake gives EICAR.
+const Signature = "Eicar-Signature"
+
+// Server is a fake clamd answering INSTREAM and PING on a local TCP port or
+// unix socket.
+type Server struct {
+	// Address is what to pass to clamav.Configure or clamav.ScanAt.
+	Address string
+	// Verdict decides each scan: it returns the signature found in data,
+	// or "" if it is clean. It defaults to finding EICAR. Set it before
+	// scanning.
+	Verdict func(data []byte) string
+	// Reply, if set, is sent instead of a verdict, to test clamd errors
+	// such as "INSTREAM size limit exceeded. ERROR".
+	Reply string
+	// StreamMaxLength, if set, is the most a stream may hold. Past it the
+	// server replies "INSTREAM size limit exceeded. ERROR" and hangs up
+	// without reading the rest, as clamd does.
+	StreamMaxLength int64
+
+	listener net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	scans    int
+}
+
+// NewServer starts a fake clamd on a local TCP port.
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("clamavtest: " + err.Error())
+	}
+	return start(l, "tcp://"+l.Addr().String())
+}
+
+// NewUnixServer starts a fake clamd listening on the unix socket at path.
+func NewUnixServer(path string) *Server {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		panic("clamavtest: " + err.Error())
+	}
+	return start(l, "unix://"+path)
+}
+
+func start(l net.Listener, address string) *Server {
+	s := &Server{Address: address, listener: l}
+	s.Verdict = func(data []byte) string {
+		if bytes.Contains(data, []byte(EICAR)) {
+			return Signature
+		}
+		return ""
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer conn.Close()
+				s.serve(conn)
+			}()
+		}
+	}()
+	return s
+}
+
+// Scans returns how many files the server has scanned.
+func (s *Server) Scans() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scans
+}
+
+// Close stops the server and waits for open connections to finish.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return
+	}
+	delim := byte('\n')
+	if prefix == 'z' {
+		delim = 0
+	}
+	command, err := r.ReadString(delim)
+	if err != nil {
+		return
+	}
+	reply := func(msg string) { conn.Write(append([]byte(msg), delim)) }
+
+	switch strings.TrimSuffix(command, string(delim)) {
+	case "PING":
+		reply("PONG")
+	case "INSTREAM":
+		var data bytes.Buffer
+		var size [4]byte
+		for {
+			if _, err := io.ReadFull(r, size[:]); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size[:])
+			if n == 0 {
+				break
+			}
+			if s.StreamMaxLength > 0 && int64(data.Len())+int64(n) > s.StreamMaxLength {
+				reply("INSTREAM size limit exceeded. ERROR")
+				return
+			}
+			if _, err := io.CopyN(&data, r, int64(n)); err != nil {
+				return
+			}
+		}
+		s.mu.Lock()
+		s.scans++
+		s.mu.Unlock()
+		switch signature := s.Verdict(data.Bytes()); {
+		case s.Reply != "":
+			reply(s.Reply)
+		case signature != "":
+			reply("stream: " + signature + " FOUND")
+		default:
+			reply("stream: OK")
+		}
+	default:
+		reply("UNKNOWN COMMAND")
+	}
+}
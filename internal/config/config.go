@@ -0,0 +1,184 @@
+// Package config loads the server's runtime settings from the environment.
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/calc"
+)
+
+type Config struct {
+	// Addr is the address the HTTP server listens on.
+	Addr string
+	// DatabaseDSN is passed to db.InitDB.
+	DatabaseDSN string
+	// Dev enables development conveniences such as re-reading templates
+	// from disk on every request.
+	Dev bool
+	// TemplateDir is the on-disk template directory used in dev mode.
+	TemplateDir string
+	// SecureCookies marks cookies Secure so browsers only send them over
+	// HTTPS. It defaults to on outside dev mode.
+	SecureCookies bool
+
+	// ReadTimeout, WriteTimeout and IdleTimeout bound how long a client may
+	// take to send a request, receive a response and hold an idle
+	// keep-alive connection. Uploads and downloads get longer in proportion
+	// to their size (see server.LimitUpload and server.AllowDownload).
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownTimeout is how long in-flight requests get to finish after
+	// SIGTERM before the server exits anyway.
+	ShutdownTimeout time.Duration
+
+	// MetricsToken, when set, must be presented as a bearer token to read
+	// /metrics.
+	MetricsToken string
+
+	// TLSCertFile and TLSKeyFile enable HTTPS on Addr when both are set.
+	TLSCertFile string
+	TLSKeyFile  string
+	// RedirectAddr, when TLS is enabled, is a plain-HTTP address that
+	// redirects every request to HTTPS, e.g. ":80".
+	RedirectAddr string
+
+	// BaseURL is the public address used in links sent by email.
+	BaseURL string
+	// SMTPHost, SMTPPort, SMTPUsername and SMTPPassword configure outgoing
+	// email, sent from MailFrom. Email is disabled when SMTPHost is empty.
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+
+	// ClamdAddress is the ClamAV daemon uploads are scanned with:
+	// tcp://host:port or unix:///path. Scans wait for it when empty, except
+	// in Dev where uploads pass unscanned.
+	ClamdAddress string
+	// ClamdTimeout bounds a single scan.
+	ClamdTimeout time.Duration
+
+	// TesseractPath is the tesseract executable income documents are read
+	// with. When empty, extraction finds no text and the admin enters the
+	// figures. PDFToPPMPath rasterises PDFs for it.
+	TesseractPath string
+	PDFToPPMPath  string
+
+	// ShareLinkKey signs document share links. When empty a random key is
+	// generated once and kept in the database.
+	ShareLinkKey string
+
+	// BenchmarkRate is the minimum qualifying rate for the mortgage stress
+	// test, as a fraction.
+	BenchmarkRate float64
+
+	// RateSheetDir is where the import-rates command looks for lender rate
+	// sheets, one subdirectory per lender.
+	RateSheetDir string
+
+	// RateHoldWarningDays is how many days before a rate hold expires its
+	// broker and assigned admin are reminded.
+	RateHoldWarningDays int
+
+	// DigestHour is the local hour from which digests are sent: daily ones
+	// each day and weekly ones from Monday.
+	DigestHour int
+
+	// StalledDays is how long an application under review may go without
+	// activity before digests list it as stalled.
+	StalledDays int
+
+	// JobWorkers is how many background jobs run at once.
+	JobWorkers int
+	// JobPollInterval is how often idle job workers look for new jobs.
+	JobPollInterval time.Duration
+}
+
+// TLS reports whether the server should serve HTTPS.
+func (c Config) TLS() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// Load reads the configuration from environment variables, falling back to
+// defaults suitable for local development.
+func Load() Config {
+	dev := getBool("DEV", false)
+	return Config{
+		Addr:                getEnv("ADDR", ":8080"),
+		DatabaseDSN:         getEnv("DATABASE_DSN", "app.db"),
+		Dev:                 dev,
+		TemplateDir:         getEnv("TEMPLATE_DIR", "internal/templates"),
+		SecureCookies:       getBool("SECURE_COOKIES", !dev),
+		ReadTimeout:         getDuration("READ_TIMEOUT", time.Minute),
+		WriteTimeout:        getDuration("WRITE_TIMEOUT", time.Minute),
+		IdleTimeout:         getDuration("IDLE_TIMEOUT", 2*time.Minute),
+		ShutdownTimeout:     getDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		MetricsToken:        getEnv("METRICS_TOKEN", ""),
+		TLSCertFile:         getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:          getEnv("TLS_KEY_FILE", ""),
+		RedirectAddr:        getEnv("HTTP_REDIRECT_ADDR", ""),
+		BaseURL:             strings.TrimSuffix(getEnv("BASE_URL", "http://localhost:8080"), "/"),
+		SMTPHost:            getEnv("SMTP_HOST", ""),
+		SMTPPort:            getEnv("SMTP_PORT", "587"),
+		SMTPUsername:        getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:        getEnv("SMTP_PASSWORD", ""),
+		MailFrom:            getEnv("MAIL_FROM", ""),
+		ClamdAddress:        getEnv("CLAMD_ADDRESS", ""),
+		ClamdTimeout:        getDuration("CLAMD_TIMEOUT", time.Minute),
+		TesseractPath:       getEnv("TESSERACT_PATH", ""),
+		PDFToPPMPath:        getEnv("PDFTOPPM_PATH", "pdftoppm"),
+		ShareLinkKey:        getEnv("SHARE_LINK_KEY", ""),
+		BenchmarkRate:       getPercent("BENCHMARK_RATE", calc.DefaultBenchmarkRate),
+		RateSheetDir:        getEnv("RATE_SHEET_DIR", "rate_sheets"),
+		RateHoldWarningDays: getInt("RATE_HOLD_WARNING_DAYS", 14),
+		DigestHour:          min(getInt("DIGEST_HOUR", 7), 23),
+		StalledDays:         getInt("STALLED_DAYS", 7),
+		JobWorkers:          max(getInt("JOB_WORKERS", 2), 1),
+		JobPollInterval:     getDuration("JOB_POLL_INTERVAL", time.Second),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getBool(key string, fallback bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func getInt(key string, fallback int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || v < 0 {
+		return fallback
+	}
+	return v
+}
+
+// getPercent reads a percentage such as "5.25" and returns it as a fraction.
+func getPercent(key string, fallback float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || v <= 0 || v >= 100 {
+		return fallback
+	}
+	return v / 100
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+// immediateTx runs fn in a transaction begun with BEGIN IMMEDIATE, which
+// takes SQLite's write lock before fn reads anything, whatever _txlock the
+// DSN sets. Nothing fn reads can then change before it writes, even from
+// another process such as the import-rates command.
+func immediateTx(db *sql.DB, fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	if err = fn(conn); err == nil {
+		_, err = conn.ExecContext(ctx, "COMMIT")
+	}
+	if err != nil {
+		if _, rerr := conn.ExecContext(ctx, "ROLLBACK"); rerr != nil {
+			// Never hand a connection still in the transaction back to the pool
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}
+	return err
+}
+
+// AppendAuditEvent stores e at the end of the audit chain, filling in its ID,
+// timestamp and hashes.
+func AppendAuditEvent(db *sql.DB, e *models.AuditEvent) error {
+	return immediateTx(db, func(conn *sql.Conn) error {
+		return appendAuditEvent(conn, e)
+	})
+}
+
+func appendAuditEvent(conn *sql.Conn, e *models.AuditEvent) error {
+	ctx := context.Background()
+	var lastID int64
+	var lastHash string
+	err := conn.QueryRowContext(ctx, "SELECT id, hash FROM audit_events ORDER BY id DESC LIMIT 1").Scan(&lastID, &lastHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	e.ID = lastID + 1
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+	e.OccurredAt = e.OccurredAt.UTC()
+	e.PrevHash = lastHash
+	e.Hash = e.ChainHash()
+
+	_, err = conn.ExecContext(ctx, `INSERT INTO audit_events (id, occurred_at, actor_id, actor_email, actor_role, action,
+            resource_type, resource_id, ip, user_agent, details, prev_hash, hash)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.OccurredAt.Format(models.AuditTimeFormat), e.ActorID, e.ActorEmail, e.ActorRole, e.Action,
+		e.ResourceType, e.ResourceID, e.IP, e.UserAgent, e.Details, e.PrevHash, e.Hash)
+	return err
+}
+
+// AuditFilter narrows the audit log search. Zero values mean "no filter";
+// DateFrom and DateTo are inclusive YYYY-MM-DD dates in UTC.
+type AuditFilter struct {
+	Actor        string // matched against the actor's email
+	Action       string
+	ResourceType string
+	ResourceID   string
+	DateFrom     string
+	DateTo       string
+	Page         int // 1-based
+	PerPage      int
+}
+
+func (f AuditFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if f.Actor != "" {
+		conds = append(conds, "actor_email LIKE ?")
+		args = append(args, "%"+f.Actor+"%")
+	}
+	if f.Action != "" {
+		conds = append(conds, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.ResourceType != "" {
+		conds = append(conds, "resource_type = ?")
+		args = append(args, f.ResourceType)
+	}
+	if f.ResourceID != "" {
+		conds = append(conds, "resource_id = ?")
+		args = append(args, f.ResourceID)
+	}
+	if _, err := time.Parse("2006-01-02", f.DateFrom); err == nil {
+		conds = append(conds, "occurred_at >= ?")
+		args = append(args, f.DateFrom)
+	}
+	if to, err := time.Parse("2006-01-02", f.DateTo); err == nil {
+		conds = append(conds, "occurred_at < ?")
+		args = append(args, to.AddDate(0, 0, 1).Format("2006-01-02"))
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+const auditColumns = "id, occurred_at, actor_id, actor_email, actor_role, action, resource_type, resource_id, ip, user_agent, details, prev_hash, hash"
+
+func scanAuditEvent(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*models.AuditEvent, error) {
+	var e models.AuditEvent
+	var occurred string
+	var actorID sql.NullInt64
+	dest := []interface{}{&e.ID, &occurred, &actorID, &e.ActorEmail, &e.ActorRole, &e.Action,
+		&e.ResourceType, &e.ResourceID, &e.IP, &e.UserAgent, &e.Details, &e.PrevHash, &e.Hash}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	t, err := time.Parse(models.AuditTimeFormat, occurred)
+	if err != nil {
+		return nil, err
+	}
+	e.OccurredAt = t
+	e.ActorID = nullIntPtr(actorID)
+	return &e, nil
+}
+
+// SearchAuditEvents returns one page of matching events, newest first, and
+// the total number of matches.
+func SearchAuditEvents(db *sql.DB, f AuditFilter) ([]models.AuditEvent, int, error) {
+	where, args := f.where()
+	if f.PerPage <= 0 {
+		f.PerPage = 50
+	}
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	args = append(args, f.PerPage, (f.Page-1)*f.PerPage)
+
+	rows, err := db.Query(`SELECT `+auditColumns+`, COUNT(*) OVER ()
+        FROM audit_events`+where+`
+        ORDER BY id DESC LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	total := 0
+	for rows.Next() {
+		e, err := scanAuditEvent(rows, &total)
+		if err != nil {
+			return nil, 0, err
+		}
+		events = append(events, *e)
+	}
+	return events, total, rows.Err()
+}
+
+// EachAuditEvent calls fn for every event matching f, oldest first, without
+// loading them all into memory.
+func EachAuditEvent(db *sql.DB, f AuditFilter, fn func(*models.AuditEvent) error) error {
+	where, args := f.where()
+	rows, err := db.Query(`SELECT `+auditColumns+` FROM audit_events`+where+` ORDER BY id ASC`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// VerifyAuditChain recomputes every hash in the chain. It returns how many
+// events were checked and the ID of the first one that does not match, or 0
+// if the chain is intact.
+func VerifyAuditChain(db *sql.DB) (int, int64, error) {
+	checked := 0
+	var broken, prevID int64
+	prevHash := ""
+	err := EachAuditEvent(db, AuditFilter{}, func(e *models.AuditEvent) error {
+		checked++
+		if e.ID != prevID+1 || e.PrevHash != prevHash || e.ChainHash() != e.Hash {
+			broken = e.ID
+			return errChainBroken
+		}
+		prevID, prevHash = e.ID, e.Hash
+		return nil
+	})
+	if errors.Is(err, errChainBroken) {
+		err = nil
+	}
+	return checked, broken, err
+}
+
+var errChainBroken = errors.New("audit chain broken")
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+func TestAuditChain(t *testing.T) {
+	database := openTestDB(t)
+	at := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+	var events []models.AuditEvent
+	for i, action := range []string{"user.login", "document.upload", "document.download"} {
+		e := models.AuditEvent{OccurredAt: at.Add(time.Duration(i) * time.Minute), ActorEmail: "ada@example.com", Action: action, Details: "step"}
+		if err := AppendAuditEvent(database, &e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	for i, e := range events {
+		if e.ID != int64(i+1) || e.Hash == "" || e.Hash != e.ChainHash() {
+			t.Errorf("event %d: id %d, hash %q", i, e.ID, e.Hash)
+		}
+		if i > 0 && e.PrevHash != events[i-1].Hash {
+			t.Errorf("event %d does not link to the one before", e.ID)
+		}
+	}
+	if events[0].PrevHash != "" {
+		t.Errorf("first event links to %q", events[0].PrevHash)
+	}
+	if checked, broken, err := VerifyAuditChain(database); err != nil || checked != 3 || broken != 0 {
+		t.Errorf("VerifyAuditChain = %d, %d, %v; want 3 checked, none broken", checked, broken, err)
+	}
+
+	// The triggers keep the log append-only
+	if _, err := database.Exec("UPDATE audit_events SET details = 'x' WHERE id = 2"); err == nil {
+		t.Error("audit event updated")
+	}
+	if _, err := database.Exec("DELETE FROM audit_events WHERE id = 2"); err == nil {
+		t.Error("audit event deleted")
+	}
+}
+
+// Edits made with the triggers dropped are found by verifying the chain.
+func TestVerifyAuditChainTampering(t *testing.T) {
+	tests := []struct {
+		name       string
+		tamper     string
+		wantBroken int64
+	}{
+		{"details edited", "UPDATE audit_events SET details = 'nothing to see' WHERE id = 2", 2},
+		{"actor edited", "UPDATE audit_events SET actor_email = 'someone@example.com' WHERE id = 3", 3},
+		{"time edited", "UPDATE audit_events SET occurred_at = '2020-01-01T00:00:00Z' WHERE id = 1", 1},
+		{"event deleted", "DELETE FROM audit_events WHERE id = 2", 3},
+		{"last event deleted", "DELETE FROM audit_events WHERE id = 4", 0},
+		{"link to the previous event cleared", "UPDATE audit_events SET prev_hash = '' WHERE id = 3", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := openTestDB(t)
+			for i := 0; i < 4; i++ {
+				if err := AppendAuditEvent(database, &models.AuditEvent{ActorEmail: "ada@example.com", Action: "user.login"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := database.Exec(`DROP TRIGGER audit_events_no_update; DROP TRIGGER audit_events_no_delete`); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := database.Exec(tt.tamper); err != nil {
+				t.Fatal(err)
+			}
+			if _, broken, err := VerifyAuditChain(database); err != nil || broken != tt.wantBroken {
+				t.Errorf("VerifyAuditChain broken at %d, %v; want %d", broken, err, tt.wantBroken)
+			}
+		})
+	}
+}
+
+// Appends from separate processes, like the server and the import-rates
+// command, must not fork the chain. Each handle here has its own pool and
+// defers its transactions by default, as a process opening the database
+// another way would.
+func TestAppendAuditEventConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db")
+	first, err := InitDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if err := MigrateDB(first); err != nil {
+		t.Fatal(err)
+	}
+	second, err := InitDB(path + "?_txlock=deferred")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	const perWriter = 25
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*perWriter)
+	for _, database := range []*sql.DB{first, second, first, second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if err := AppendAuditEvent(database, &models.AuditEvent{Action: "rate.import"}); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if checked, broken, err := VerifyAuditChain(first); err != nil || checked != 4*perWriter || broken != 0 {
+		t.Errorf("VerifyAuditChain = %d, %d, %v; want %d checked, none broken", checked, broken, err, 4*perWriter)
+	}
+}
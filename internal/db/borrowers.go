@@ -0,0 +1,162 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"MortgageAgent/internal/models"
+)
+
+// ErrInviteUsed is returned when an invite was accepted or replaced first.
+var ErrInviteUsed = errors.New("invite already used")
+
+// CreateBorrowerInvite stores an invite by the hash of its token, revoking
+// any earlier invites for the application that were not yet accepted, and
+// returns its ID. Expiry times are stored in UTC so they compare correctly
+// as text.
+func CreateBorrowerInvite(db *sql.DB, applicationID int, email, tokenHash string, invitedBy int, expiresAt time.Time) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec("UPDATE borrower_invites SET revoked_at=? WHERE application_id=? AND accepted_at IS NULL AND revoked_at IS NULL",
+		now, applicationID)
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`INSERT INTO borrower_invites (application_id, email, token_hash, invited_by, expires_at, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)`,
+		applicationID, email, tokenHash, invitedBy, expiresAt.UTC(), now)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), tx.Commit()
+}
+
+// SetBorrowerInviteToken replaces the hash of an invite's token. It fails
+// with ErrInviteUsed if the invite was accepted, revoked or has expired.
+func SetBorrowerInviteToken(db *sql.DB, inviteID int, tokenHash string) error {
+	now := time.Now().UTC()
+	res, err := db.Exec(`UPDATE borrower_invites SET token_hash=?
+        WHERE id=? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?`, tokenHash, inviteID, now)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return ErrInviteUsed
+	}
+	return nil
+}
+
+const borrowerInviteColumns = "id, application_id, email, invited_by, expires_at, accepted_at, revoked_at, created_at"
+
+func scanBorrowerInvite(row interface{ Scan(...interface{}) error }) (*models.BorrowerInvite, error) {
+	var i models.BorrowerInvite
+	var accepted, revoked sql.NullTime
+	err := row.Scan(&i.ID, &i.ApplicationID, &i.Email, &i.InvitedBy, &i.ExpiresAt, &accepted, &revoked, &i.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	i.AcceptedAt = nullTimePtr(accepted)
+	i.RevokedAt = nullTimePtr(revoked)
+	return &i, nil
+}
+
+// GetBorrowerInvite fetches a single invite.
+func GetBorrowerInvite(db *sql.DB, id int) (*models.BorrowerInvite, error) {
+	return scanBorrowerInvite(db.QueryRow("SELECT "+borrowerInviteColumns+" FROM borrower_invites WHERE id = ?", id))
+}
+
+// GetBorrowerInviteByHash looks up an invite by the hash of its token.
+func GetBorrowerInviteByHash(db *sql.DB, tokenHash string) (*models.BorrowerInvite, error) {
+	row := db.QueryRow("SELECT "+borrowerInviteColumns+" FROM borrower_invites WHERE token_hash = ?", tokenHash)
+	return scanBorrowerInvite(row)
+}
+
+// GetLatestBorrowerInvite returns the most recent invite for an application,
+// or nil if there is none.
+func GetLatestBorrowerInvite(db *sql.DB, applicationID int) (*models.BorrowerInvite, error) {
+	row := db.QueryRow("SELECT "+borrowerInviteColumns+" FROM borrower_invites WHERE application_id = ? ORDER BY id DESC LIMIT 1", applicationID)
+	i, err := scanBorrowerInvite(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return i, err
+}
+
+// AcceptBorrowerInvite marks the invite accepted and links the borrower to
+// its application. It fails with ErrInviteUsed if the invite is no longer
+// usable, so a link cannot be redeemed twice.
+func AcceptBorrowerInvite(db *sql.DB, inviteID, borrowerID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	res, err := tx.Exec(`UPDATE borrower_invites SET accepted_at=?
+        WHERE id=? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?`, now, inviteID, now)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return ErrInviteUsed
+	}
+	_, err = tx.Exec(`UPDATE applications SET borrower_id=?
+        WHERE id=(SELECT application_id FROM borrower_invites WHERE id=?)`, borrowerID, inviteID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateBorrower creates a borrower account and returns its ID.
+func CreateBorrower(db *sql.DB, firstName, lastName, email, password string) (int, error) {
+	pwHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.Exec("INSERT INTO users (first_name, last_name, email, password_hash, phone, postal_code, user_type) VALUES (?, ?, ?, ?, '', '', 'borrower')",
+		firstName, lastName, email, pwHash)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// GetApplicationsForBorrower lists the applications a borrower was invited
+// to, newest first.
+func GetApplicationsForBorrower(db *sql.DB, borrowerID int) ([]models.Application, error) {
+	rows, err := db.Query("SELECT "+applicationColumns+" FROM applications WHERE borrower_id=? ORDER BY created_at DESC, id DESC", borrowerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var apps []models.Application
+	for rows.Next() {
+		app, err := scanApplication(rows)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, *app)
+	}
+	return apps, rows.Err()
+}
+
+// SetBorrowerConsent records the borrower's e-consent on an application.
+func SetBorrowerConsent(db *sql.DB, applicationID int, name, ip string, at time.Time) error {
+	_, err := db.Exec("UPDATE applications SET consent_at=?, consent_name=?, consent_ip=? WHERE id=?", at, name, ip, applicationID)
+	return err
+}
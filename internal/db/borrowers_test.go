@@ -0,0 +1,52 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetApplicationsForBorrower(t *testing.T) {
+	database := openTestDB(t)
+	exec := func(query string, args ...interface{}) int {
+		res, err := database.Exec(query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		return int(id)
+	}
+	brokerID := exec(`INSERT INTO users (first_name, last_name, email, password_hash, user_type)
+        VALUES ('Bo', 'Broker', 'bo@example.com', '', 'broker')`)
+	borrowerID, err := CreateBorrower(database, "Jane", "Doe", "jane@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	consent := time.Date(2026, 5, 1, 9, 30, 0, 0, time.UTC)
+	older := exec(`INSERT INTO applications (broker_id, application_type, status, created_at, borrower_id, consent_at, consent_name, consent_ip)
+        VALUES (?, 'self', 'submitted', ?, ?, ?, 'Jane Doe', '203.0.113.7')`, brokerID, consent.Add(-time.Hour), borrowerID, consent)
+	newer := exec(`INSERT INTO applications (broker_id, application_type, status, created_at, borrower_id)
+        VALUES (?, 'joint', 'draft', ?, ?)`, brokerID, consent, borrowerID)
+	// Another borrower's application
+	exec(`INSERT INTO applications (broker_id, application_type, created_at) VALUES (?, 'self', ?)`, brokerID, consent)
+
+	apps, err := GetApplicationsForBorrower(database, borrowerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 2 || apps[0].ID != newer || apps[1].ID != older {
+		t.Fatalf("applications %+v, want %d then %d", apps, newer, older)
+	}
+	a := apps[1]
+	if a.BrokerID != brokerID || a.ApplicationType != "self" || a.Status != "submitted" || a.AssignedAdminID != nil ||
+		a.BorrowerID == nil || *a.BorrowerID != borrowerID || a.ConsentAt == nil || !a.ConsentAt.Equal(consent) ||
+		a.ConsentName != "Jane Doe" || a.ConsentIP != "203.0.113.7" {
+		t.Errorf("application %+v", a)
+	}
+	if apps[0].ConsentAt != nil {
+		t.Errorf("consent recorded on %d", newer)
+	}
+
+	if apps, err := GetApplicationsForBorrower(database, brokerID); err != nil || len(apps) != 0 {
+		t.Errorf("broker's applications %v, %v", apps, err)
+	}
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+// CreateRateHold records a rate hold and returns its ID.
+func CreateRateHold(db *sql.DB, h *models.RateHold, createdBy int) (int, error) {
+	res, err := db.Exec(`INSERT INTO rate_holds (application_id, lender_id, product_id, rate, held_on, expires_on, created_by, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, h.ApplicationID, h.LenderID, h.ProductID, h.Rate,
+		h.HeldOn.Format(dayLayout), h.ExpiresOn.Format(dayLayout), createdBy, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// GetRateHolds lists an application's rate holds, soonest to expire first.
+func GetRateHolds(db *sql.DB, applicationID int) ([]models.RateHold, error) {
+	return queryRateHolds(db, "WHERE h.application_id = ? ORDER BY h.expires_on, h.id", applicationID)
+}
+
+// GetHoldsToRemind lists the unreleased holds that expire between from and
+// through and have not been reminded about.
+func GetHoldsToRemind(db *sql.DB, from, through time.Time) ([]models.RateHold, error) {
+	return queryRateHolds(db, `WHERE h.released_at IS NULL AND h.reminded_at IS NULL
+        AND h.expires_on >= ? AND h.expires_on <= ? ORDER BY h.expires_on, h.id`,
+		from.Format(dayLayout), through.Format(dayLayout))
+}
+
+func queryRateHolds(db *sql.DB, where string, args ...interface{}) ([]models.RateHold, error) {
+	rows, err := db.Query(`SELECT h.id, h.application_id, h.lender_id, l.name, h.product_id, COALESCE(p.name, ''),
+            h.rate, h.held_on, h.expires_on, h.reminded_at, h.released_at, h.created_at
+        FROM rate_holds h JOIN lenders l ON l.id = h.lender_id
+        LEFT JOIN lender_products p ON p.id = h.product_id `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []models.RateHold
+	for rows.Next() {
+		var h models.RateHold
+		var heldOn, expiresOn string
+		err := rows.Scan(&h.ID, &h.ApplicationID, &h.LenderID, &h.LenderName, &h.ProductID, &h.ProductName,
+			&h.Rate, &heldOn, &expiresOn, &h.RemindedAt, &h.ReleasedAt, &h.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if h.HeldOn, err = parseDay(heldOn); err != nil {
+			return nil, err
+		}
+		if h.ExpiresOn, err = parseDay(expiresOn); err != nil {
+			return nil, err
+		}
+		holds = append(holds, h)
+	}
+	return holds, rows.Err()
+}
+
+// ReleaseRateHold ends one of the application's holds early. It returns
+// sql.ErrNoRows if there is no such unreleased hold.
+func ReleaseRateHold(db *sql.DB, applicationID, id int) error {
+	return expectOneRow(db.Exec("UPDATE rate_holds SET released_at = ? WHERE id = ? AND application_id = ? AND released_at IS NULL",
+		time.Now(), id, applicationID))
+}
+
+// MarkHoldReminded records that the hold's expiry reminder was sent.
+func MarkHoldReminded(db *sql.DB, id int, at time.Time) error {
+	return expectOneRow(db.Exec("UPDATE rate_holds SET reminded_at = ? WHERE id = ?", at, id))
+}
+
+// CreateCommitment records a commitment letter, without conditions, and
+// returns its ID.
+func CreateCommitment(db *sql.DB, c *models.Commitment, createdBy int) (int, error) {
+	res, err := db.Exec(`INSERT INTO commitments (application_id, lender_id, issued_on, expires_on, created_by, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)`, c.ApplicationID, c.LenderID, c.IssuedOn.Format(dayLayout), c.ExpiresOn.Format(dayLayout),
+		createdBy, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// GetCommitments lists an application's commitments, newest first, each
+// with its conditions in due order.
+func GetCommitments(db *sql.DB, applicationID int) ([]models.Commitment, error) {
+	rows, err := db.Query(`SELECT c.id, c.application_id, c.lender_id, l.name, c.issued_on, c.expires_on, c.created_at
+        FROM commitments c JOIN lenders l ON l.id = c.lender_id
+        WHERE c.application_id = ? ORDER BY c.issued_on DESC, c.id DESC`, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var commitments []models.Commitment
+	index := map[int]int{}
+	for rows.Next() {
+		var c models.Commitment
+		var issuedOn, expiresOn string
+		if err := rows.Scan(&c.ID, &c.ApplicationID, &c.LenderID, &c.LenderName, &issuedOn, &expiresOn, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		if c.IssuedOn, err = parseDay(issuedOn); err != nil {
+			return nil, err
+		}
+		if c.ExpiresOn, err = parseDay(expiresOn); err != nil {
+			return nil, err
+		}
+		index[c.ID] = len(commitments)
+		commitments = append(commitments, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	conds, err := db.Query(`SELECT k.id, k.commitment_id, k.description, k.due_on, k.satisfied_at
+        FROM commitment_conditions k JOIN commitments c ON c.id = k.commitment_id
+        WHERE c.application_id = ? ORDER BY k.due_on, k.id`, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer conds.Close()
+	for conds.Next() {
+		var k models.CommitmentCondition
+		var dueOn string
+		if err := conds.Scan(&k.ID, &k.CommitmentID, &k.Description, &dueOn, &k.SatisfiedAt); err != nil {
+			return nil, err
+		}
+		if k.DueOn, err = parseDay(dueOn); err != nil {
+			return nil, err
+		}
+		c := &commitments[index[k.CommitmentID]]
+		c.Conditions = append(c.Conditions, k)
+	}
+	return commitments, conds.Err()
+}
+
+// AddCommitmentCondition adds a condition to one of the application's
+// commitments. It returns sql.ErrNoRows if there is no such commitment.
+func AddCommitmentCondition(db *sql.DB, applicationID, commitmentID int, description string, dueOn time.Time) error {
+	return expectOneRow(db.Exec(`INSERT INTO commitment_conditions (commitment_id, description, due_on)
+        SELECT id, ?, ? FROM commitments WHERE id = ? AND application_id = ?`,
+		description, dueOn.Format(dayLayout), commitmentID, applicationID))
+}
+
+// SatisfyCommitmentCondition marks a condition of one of the application's
+// commitments satisfied. It returns sql.ErrNoRows if there is no such
+// unsatisfied condition.
+func SatisfyCommitmentCondition(db *sql.DB, applicationID, conditionID, userID int) error {
+	return expectOneRow(db.Exec(`UPDATE commitment_conditions SET satisfied_at = ?, satisfied_by = ?
+        WHERE id = ? AND satisfied_at IS NULL
+            AND commitment_id IN (SELECT id FROM commitments WHERE application_id = ?)`,
+		time.Now(), userID, conditionID, applicationID))
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+// ErrConditionsOutstanding is returned when approving an application whose
+// conditions are not all cleared.
+var ErrConditionsOutstanding = errors.New("application has conditions that are not cleared")
+
+// CreateCondition adds an outstanding condition to an application and
+// returns its ID.
+func CreateCondition(db *sql.DB, c *models.Condition, createdBy int) (int, error) {
+	res, err := db.Exec(`INSERT INTO conditions (application_id, description, category, status, created_by, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)`, c.ApplicationID, c.Description, c.Category, models.ConditionOutstanding, createdBy, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+const conditionColumns = `c.id, c.application_id, c.description, c.category, c.status, c.response, c.document_id,
+        c.review_note, c.created_at, c.responded_at, c.cleared_at`
+
+func scanCondition(rows *sql.Rows, c *models.Condition, extra ...interface{}) error {
+	return rows.Scan(append([]interface{}{&c.ID, &c.ApplicationID, &c.Description, &c.Category, &c.Status, &c.Response,
+		&c.DocumentID, &c.ReviewNote, &c.CreatedAt, &c.RespondedAt, &c.ClearedAt}, extra...)...)
+}
+
+// GetConditions lists an application's conditions in the order they were
+// added.
+func GetConditions(db *sql.DB, applicationID int) ([]models.Condition, error) {
+	rows, err := db.Query("SELECT "+conditionColumns+" FROM conditions c WHERE c.application_id = ? ORDER BY c.id", applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conditions []models.Condition
+	for rows.Next() {
+		var c models.Condition
+		if err := scanCondition(rows, &c); err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions, rows.Err()
+}
+
+// GetOpenConditionsForBroker lists the outstanding conditions on a broker's
+// applications, oldest first.
+func GetOpenConditionsForBroker(db *sql.DB, brokerID int) ([]models.OpenCondition, error) {
+	rows, err := db.Query("SELECT "+conditionColumns+`, a.application_type
+        FROM conditions c JOIN applications a ON a.id = c.application_id
+        WHERE a.broker_id = ? AND c.status = ? ORDER BY c.id`, brokerID, models.ConditionOutstanding)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conditions []models.OpenCondition
+	for rows.Next() {
+		var c models.OpenCondition
+		if err := scanCondition(rows, &c.Condition, &c.ApplicationType); err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions, rows.Err()
+}
+
+// RespondToCondition records the broker's reply and any uploaded document
+// against one of the application's conditions and submits it for review.
+// It returns sql.ErrNoRows if there is no such condition still to clear.
+func RespondToCondition(db *sql.DB, applicationID, id, userID int, response string, documentID *int) error {
+	return expectOneRow(db.Exec(`UPDATE conditions SET status = ?, response = ?, document_id = ?, review_note = '',
+            responded_by = ?, responded_at = ?
+        WHERE id = ? AND application_id = ? AND status <> ?`,
+		models.ConditionSubmitted, response, documentID, userID, time.Now(), id, applicationID, models.ConditionCleared))
+}
+
+// ClearCondition signs off one of the application's conditions. It returns
+// sql.ErrNoRows if there is no such condition still to clear.
+func ClearCondition(db *sql.DB, applicationID, id, adminID int) error {
+	return expectOneRow(db.Exec(`UPDATE conditions SET status = ?, cleared_by = ?, cleared_at = ?
+        WHERE id = ? AND application_id = ? AND status <> ?`,
+		models.ConditionCleared, adminID, time.Now(), id, applicationID, models.ConditionCleared))
+}
+
+// ReturnCondition sends a submitted condition back to the broker with a
+// note saying what is still needed. It returns sql.ErrNoRows if there is no
+// such submitted condition.
+func ReturnCondition(db *sql.DB, applicationID, id int, note string) error {
+	return expectOneRow(db.Exec(`UPDATE conditions SET status = ?, review_note = ?
+        WHERE id = ? AND application_id = ? AND status = ?`,
+		models.ConditionOutstanding, note, id, applicationID, models.ConditionSubmitted))
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+// openTestDB returns a migrated database in a temporary directory.
+func openTestDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	database, err := InitDB(filepath.Join(tb.TempDir(), "app.db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { database.Close() })
+	if err := MigrateDB(database); err != nil {
+		tb.Fatal(err)
+	}
+	return database
+}
+
+// seedDashboard adds an admin with apps applications, from ten brokers,
+// each with docs documents, and returns the admin's ID.
+func seedDashboard(tb testing.TB, database *sql.DB, apps, docs int) int {
+	tb.Helper()
+	tx, err := database.Begin()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer tx.Rollback()
+	exec := func(query string, args ...interface{}) int {
+		res, err := tx.Exec(query, args...)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		return int(id)
+	}
+
+	adminID := exec(`INSERT INTO users (first_name, last_name, email, password_hash, user_type)
+        VALUES ('Ada', 'Admin', 'ada@example.com', '', 'admin')`)
+	var brokers []int
+	for i := 0; i < 10; i++ {
+		brokers = append(brokers, exec(`INSERT INTO users (first_name, last_name, email, password_hash, user_type)
+            VALUES (?, 'Broker', ?, '', 'broker')`, fmt.Sprintf("Broker%d", i), fmt.Sprintf("broker%d@example.com", i)))
+	}
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+	statuses := []string{"submitted", "in_review", "approved"}
+	for i := 0; i < apps; i++ {
+		appID := exec(`INSERT INTO applications (broker_id, application_type, assigned_admin_id, status, created_at)
+            VALUES (?, ?, ?, ?, ?)`, brokers[i%len(brokers)], []string{"self", "someone_else"}[i%2], adminID,
+			statuses[i%len(statuses)], start.Add(time.Duration(i)*time.Hour))
+		for j := 0; j < docs; j++ {
+			exec(`INSERT INTO documents (application_id, category, file_path, scan_status) VALUES (?, ?, ?, 'clean')`,
+				appID, models.DocumentCategories[j%len(models.DocumentCategories)], fmt.Sprintf("uploads/%d/%d.pdf", appID, j))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tb.Fatal(err)
+	}
+	return adminID
+}
+
+// applicationsPerRow is how the dashboard loaded before: one query for the
+// applications, then one more per application for its documents.
+func applicationsPerRow(database *sql.DB, adminID int) ([]models.ApplicationWithDocuments, error) {
+	rows, err := database.Query(`SELECT id, broker_id, application_type, status, created_at
+        FROM applications WHERE assigned_admin_id = ? ORDER BY created_at DESC`, adminID)
+	if err != nil {
+		return nil, err
+	}
+	var apps []models.ApplicationWithDocuments
+	for rows.Next() {
+		var a models.ApplicationWithDocuments
+		if err := rows.Scan(&a.ID, &a.BrokerID, &a.ApplicationType, &a.Status, &a.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		apps = append(apps, a)
+	}
+	rows.Close()
+	for i := range apps {
+		docs, err := GetDocumentsForApplication(database, apps[i].ID, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range docs {
+			apps[i].Documents = append(apps[i].Documents, models.DocumentInfo{ID: d.ID, Category: d.Category, FilePath: d.FilePath})
+		}
+	}
+	return apps, nil
+}
+
+func TestGetApplicationsForAdmin(t *testing.T) {
+	database := openTestDB(t)
+	adminID := seedDashboard(t, database, 60, 3)
+
+	tests := []struct {
+		name      string
+		filter    ApplicationFilter
+		wantTotal int
+		wantLen   int
+		wantErr   bool
+	}{
+		{"first page", ApplicationFilter{Page: 1, PerPage: 25}, 60, 25, false},
+		{"last page", ApplicationFilter{Page: 3, PerPage: 25}, 60, 10, false},
+		{"past the last page", ApplicationFilter{Page: 9, PerPage: 25}, 60, 0, false},
+		{"status", ApplicationFilter{Status: "approved", PerPage: 100}, 20, 20, false},
+		{"type", ApplicationFilter{Type: "self", PerPage: 100}, 30, 30, false},
+		{"broker", ApplicationFilter{Broker: "broker3@", PerPage: 100}, 6, 6, false},
+		{"date range", ApplicationFilter{DateFrom: "2024-01-02", DateTo: "2024-01-02", PerPage: 100}, 24, 24, false},
+		{"bad start date", ApplicationFilter{DateFrom: "2024-01-02' OR 1=1"}, 0, 0, true},
+		{"bad end date", ApplicationFilter{DateTo: "tomorrow"}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apps, total, err := GetApplicationsForAdmin(database, adminID, tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if total != tt.wantTotal || len(apps) != tt.wantLen {
+				t.Errorf("got %d applications of %d, want %d of %d", len(apps), total, tt.wantLen, tt.wantTotal)
+			}
+			for _, a := range apps {
+				if len(a.Documents) != 3 {
+					t.Errorf("application %d has %d documents, want 3", a.ID, len(a.Documents))
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDashboard compares loading the dashboard in one query with the
+// per-application document lookups it replaced, for an admin with 500
+// applications of 8 documents each.
+func BenchmarkDashboard(b *testing.B) {
+	database := openTestDB(b)
+	adminID := seedDashboard(b, database, 500, 8)
+
+	b.Run("PerRow", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := applicationsPerRow(database, adminID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("SingleQuery", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := GetApplicationsForAdmin(database, adminID, ApplicationFilter{Page: 1, PerPage: 25}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	// The whole list in one page, for a like-for-like comparison
+	b.Run("SingleQueryAll", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := GetApplicationsForAdmin(database, adminID, ApplicationFilter{Page: 1, PerPage: 500}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -13,7 +13,21 @@ import (
 )
 
 func InitDB(dsn string) (*sql.DB, error) {
-	// For SQLite, DSN is typically just a file name
+	// For SQLite, DSN is typically just a file name. Background jobs write
+	// alongside requests, so connections wait for each other's writes
+	// instead of failing with SQLITE_BUSY. Transactions take the write lock
+	// when they begin, where they can wait for it, rather than failing when
+	// one that has read tries to write.
+	for setting, param := range map[string]string{"busy_timeout": "_pragma=busy_timeout(5000)", "_txlock": "_txlock=immediate"} {
+		if strings.Contains(dsn, setting) {
+			continue
+		}
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + param
+	}
 	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, err
@@ -63,7 +77,10 @@ func MigrateDB(db *sql.DB) error {
 );
 `
 	_, err := db.Exec(query)
-	return err
+	if err != nil {
+		return err
+	}
+	return applyMigrations(db)
 }
 
 func SeedAdminUser(db *sql.DB) error {
@@ -90,10 +107,6 @@ func SeedAdminUser(db *sql.DB) error {
 func GetUserByEmail(db *sql.DB, email string) (*models.User, error) {
 	email = strings.TrimSpace(email)
 
-	if err := db.Ping(); err != nil {
-		println("Debug: DB ping failed:", err)
-	}
-
 	u := &models.User{}
 	row := db.QueryRow("SELECT id, first_name, last_name, email, password_hash, phone, postal_code, user_type FROM users WHERE email=?", email)
 	err := row.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.PasswordHash, &u.Phone, &u.PostalCode, &u.UserType)
@@ -126,6 +139,22 @@ func SetResetToken(db *sql.DB, email, token string, expires time.Time) error {
 	return err
 }
 
+// GetResetToken returns the email address and password reset token of a
+// user, or sql.ErrNoRows if they have no reset in progress or it expired.
+func GetResetToken(db *sql.DB, userID int) (string, string, error) {
+	var email, token string
+	var expiresAt time.Time
+	err := db.QueryRow("SELECT email, reset_token, reset_token_expires_at FROM users WHERE id=? AND reset_token IS NOT NULL", userID).
+		Scan(&email, &token, &expiresAt)
+	if err != nil {
+		return "", "", err
+	}
+	if time.Now().After(expiresAt) {
+		return "", "", sql.ErrNoRows
+	}
+	return email, token, nil
+}
+
 func GetUserByResetToken(db *sql.DB, token string) (*models.User, error) {
 	u := &models.User{}
 	row := db.QueryRow("SELECT id, first_name, last_name, email, password_hash, phone, postal_code, user_type, reset_token_expires_at FROM users WHERE reset_token=?", token)
@@ -151,15 +180,76 @@ type Document struct {
 	Category      string
 	FilePath      string
 	UploadedAt    string
+	// Generated is set on documents the system produced, such as payment
+	// schedules, rather than ones uploaded.
+	Generated bool
+	// ScanStatus is the virus scan state; ScanResult names the malware
+	// found in an infected file.
+	ScanStatus string
+	ScanResult string
+	// UploadedBy is the uploader's user ID, or 0 if not recorded.
+	UploadedBy int
+	// Internal is set on files attached to internal notes, which only
+	// admins may see.
+	Internal bool
+}
+
+// Clean reports whether the document passed its virus scan and may be
+// opened.
+func (d *Document) Clean() bool {
+	return d.ScanStatus == models.ScanClean
 }
 
-func AddDocument(db *sql.DB, applicationID int, category, filePath string) error {
-	print("upload File path for " + category + filePath)
-	_, err := db.Exec("INSERT INTO documents (application_id, category, file_path, uploaded_at) VALUES (?, ?, ?, ?)",
-		applicationID, category, filePath, time.Now())
+var documentColumns = `id, application_id, category, file_path, uploaded_at, generated, scan_status, scan_result,
+        COALESCE(uploaded_by, 0), ` + internalDocument("documents")
+
+// internalDocument is the SQL condition on table, the documents table or
+// an alias of it, for a document only admins may see: a file attached to
+// an internal note. An attachment not yet linked to its message counts as
+// internal until it is.
+func internalDocument(table string) string {
+	return `(` + table + `.category = '` + models.CategoryMessage + `' AND NOT EXISTS (
+            SELECT 1 FROM messages m WHERE m.id = ` + table + `.message_id AND m.internal = 0))`
+}
+
+func scanDocument(row interface{ Scan(...interface{}) error }) (*Document, error) {
+	var doc Document
+	err := row.Scan(&doc.ID, &doc.ApplicationID, &doc.Category, &doc.FilePath, &doc.UploadedAt, &doc.Generated,
+		&doc.ScanStatus, &doc.ScanResult, &doc.UploadedBy, &doc.Internal)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func AddDocument(db *sql.DB, applicationID int, category, filePath string, uploadedBy int) error {
+	// The new file replaced any earlier one stored under the same name, so
+	// those records wait for its scan too
+	if _, err := db.Exec("UPDATE documents SET scan_status = ?, scan_result = '' WHERE file_path = ? AND generated = 0",
+		models.ScanPending, filePath); err != nil {
+		return err
+	}
+	var uploader interface{}
+	if uploadedBy != 0 {
+		uploader = uploadedBy
+	}
+	_, err := db.Exec("INSERT INTO documents (application_id, category, file_path, uploaded_at, uploaded_by) VALUES (?, ?, ?, ?, ?)",
+		applicationID, category, filePath, time.Now(), uploader)
 	return err
 }
 
+// AddGeneratedDocument records a document the system produced and returns
+// its ID.
+func AddGeneratedDocument(db *sql.DB, applicationID int, category, filePath string) (int, error) {
+	res, err := db.Exec("INSERT INTO documents (application_id, category, file_path, uploaded_at, generated, scan_status) VALUES (?, ?, ?, ?, 1, ?)",
+		applicationID, category, filePath, time.Now(), models.ScanClean)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
 // Round-robin assignment logic
 // internal/db/db.go
 
@@ -212,7 +302,7 @@ func AssignApplicationToAdmin(db *sql.DB, applicationID int) (int, error) {
 	}
 
 	// Assign the application to the next admin
-	_, err = db.Exec("UPDATE applications SET assigned_admin_id=? WHERE id=?", nextAdminID, applicationID)
+	_, err = db.Exec("UPDATE applications SET assigned_admin_id=?, assigned_at=? WHERE id=?", nextAdminID, time.Now(), applicationID)
 	if err != nil {
 		return 0, err
 	}
@@ -231,28 +321,32 @@ func AssignApplicationToAdmin(db *sql.DB, applicationID int) (int, error) {
 }
 
 func GetApplicationByID(db *sql.DB, id string) (*models.Application, error) {
-	a := &models.Application{}
-	row := db.QueryRow("SELECT id, broker_id, application_type, assigned_admin_id, created_at FROM applications WHERE id=?", id)
+	a, err := scanApplication(db.QueryRow("SELECT "+applicationColumns+" FROM applications WHERE id=?", id))
+	if err == sql.ErrNoRows {
+		// No application found with given ID
+		return nil, nil
+	}
+	return a, err
+}
 
-	var assignedAdminID sql.NullInt64
-	err := row.Scan(&a.ID, &a.BrokerID, &a.ApplicationType, &assignedAdminID, &a.CreatedAt)
+const applicationColumns = `id, broker_id, application_type, assigned_admin_id, status, created_at,
+            borrower_id, consent_at, consent_name, consent_ip`
+
+func scanApplication(row interface{ Scan(...interface{}) error }) (*models.Application, error) {
+	a := &models.Application{}
+	var assignedAdminID, borrowerID sql.NullInt64
+	var consentAt sql.NullTime
+	err := row.Scan(&a.ID, &a.BrokerID, &a.ApplicationType, &assignedAdminID, &a.Status, &a.CreatedAt,
+		&borrowerID, &consentAt, &a.ConsentName, &a.ConsentIP)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			// No application found with given ID
-			return nil, nil
-		}
 		return nil, err
 	}
-
-	if assignedAdminID.Valid {
-		val := int(assignedAdminID.Int64)
-		a.AssignedAdminID = &val
-	} else {
-		a.AssignedAdminID = nil
-	}
-
+	a.AssignedAdminID = nullIntPtr(assignedAdminID)
+	a.BorrowerID = nullIntPtr(borrowerID)
+	a.ConsentAt = nullTimePtr(consentAt)
 	return a, nil
 }
+
 func CreateApplication(db *sql.DB, brokerID int, appType string) (int, error) {
 	res, err := db.Exec("INSERT INTO applications (broker_id, application_type, created_at) VALUES (?, ?, ?)",
 		brokerID, appType, time.Now())
@@ -268,61 +362,236 @@ func CreateApplication(db *sql.DB, brokerID int, appType string) (int, error) {
 	return int(lastID), nil
 }
 
-// GetApplicationsForAdmin fetches all applications assigned to a specific admin.
-// internal/db/db.go
+// SubmitApplication assigns a draft application to the next admin in the
+// round-robin rotation and marks it submitted. It returns the admin's ID.
+func SubmitApplication(db *sql.DB, applicationID int) (int, error) {
+	adminID, err := AssignApplicationToAdmin(db, applicationID)
+	if err != nil {
+		return 0, err
+	}
+	if err := SetApplicationStatus(db, applicationID, models.StatusSubmitted); err != nil {
+		return 0, err
+	}
+	return adminID, nil
+}
+
+// GetAdminQueueDepths counts, for every admin, the applications assigned to
+// them that are submitted or in review. Admins with an empty queue map to 0.
+func GetAdminQueueDepths(db *sql.DB) (map[int]int, error) {
+	rows, err := db.Query(`SELECT u.id, COUNT(a.id)
+        FROM users u
+        LEFT JOIN applications a ON a.assigned_admin_id = u.id AND a.status IN (?, ?)
+        WHERE u.user_type = 'admin'
+        GROUP BY u.id`, models.StatusSubmitted, models.StatusInReview)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	depths := map[int]int{}
+	for rows.Next() {
+		var adminID, n int
+		if err := rows.Scan(&adminID, &n); err != nil {
+			return nil, err
+		}
+		depths[adminID] = n
+	}
+	return depths, rows.Err()
+}
+
+// SetApplicationStatus moves an application to the given status. It
+// returns ErrConditionsOutstanding, leaving the status unchanged, when the
+// application is to be approved but has conditions that are not cleared.
+func SetApplicationStatus(db *sql.DB, applicationID int, status string) error {
+	res, err := db.Exec(`UPDATE applications SET status=?, status_changed_at=? WHERE id=?
+        AND (? <> ? OR NOT EXISTS (SELECT 1 FROM conditions WHERE application_id = ? AND status <> ?))`,
+		status, time.Now(), applicationID, status, models.StatusApproved, applicationID, models.ConditionCleared)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 && status == models.StatusApproved {
+		err = ErrConditionsOutstanding
+	}
+	return err
+}
+
+// ApplicationFilter narrows and orders the admin dashboard listing. Zero
+// values mean "no filter"; DateFrom and DateTo are inclusive YYYY-MM-DD dates.
+type ApplicationFilter struct {
+	Status   string
+	Type     string
+	Broker   string // matched against the broker's name or email
+	DateFrom string
+	DateTo   string
+	Sort     string // one of the keys in applicationSortColumns
+	Desc     bool
+	Page     int // 1-based
+	PerPage  int
+}
 
-func GetApplicationsForAdmin(db *sql.DB, adminID int) ([]models.ApplicationWithDocuments, error) {
+// applicationSortColumns whitelists the columns the dashboard may sort by.
+// Names are relative to the page CTE in GetApplicationsForAdmin.
+var applicationSortColumns = map[string]string{
+	"id":         "id",
+	"created_at": "created_at",
+	"status":     "status",
+	"type":       "application_type",
+	"broker":     "broker_name",
+}
+
+func applicationOrderBy(col, dir, prefix string) string {
+	return prefix + col + " " + dir + ", " + prefix + "id " + dir
+}
+
+// GetApplicationsForAdmin fetches one page of the applications assigned to a
+// specific admin, together with their documents, in a single query. It also
+// counts the applications matching the filter, whichever page is asked for.
+func GetApplicationsForAdmin(db *sql.DB, adminID int, f ApplicationFilter) ([]models.ApplicationWithDocuments, int, error) {
+	return listApplications(db, "a.assigned_admin_id = ?", adminID, true, f)
+}
+
+// GetApplicationsForBroker is GetApplicationsForAdmin for the applications a
+// broker has created, without files attached to internal notes.
+func GetApplicationsForBroker(db *sql.DB, brokerID int, f ApplicationFilter) ([]models.ApplicationWithDocuments, int, error) {
+	return listApplications(db, "a.broker_id = ?", brokerID, false, f)
+}
+
+// listApplications implements the paginated listing; scope is a trusted SQL
+// condition with a single placeholder bound to scopeID.
+func listApplications(db *sql.DB, scope string, scopeID int, includeInternal bool, f ApplicationFilter) ([]models.ApplicationWithDocuments, int, error) {
+	where := []string{scope}
+	args := []interface{}{scopeID}
+
+	if f.Status != "" {
+		where = append(where, "a.status = ?")
+		args = append(args, f.Status)
+	}
+	if f.Type != "" {
+		where = append(where, "a.application_type = ?")
+		args = append(args, f.Type)
+	}
+	if f.Broker != "" {
+		where = append(where, "(u.first_name || ' ' || u.last_name LIKE ? OR u.email LIKE ?)")
+		like := "%" + f.Broker + "%"
+		args = append(args, like, like)
+	}
+	if f.DateFrom != "" {
+		if _, err := time.Parse("2006-01-02", f.DateFrom); err != nil {
+			return nil, 0, fmt.Errorf("invalid start date %q", f.DateFrom)
+		}
+		where = append(where, "a.created_at >= ?")
+		args = append(args, f.DateFrom)
+	}
+	if f.DateTo != "" {
+		// created_at carries a time of day, so compare against the start of the next day.
+		to, err := time.Parse("2006-01-02", f.DateTo)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid end date %q", f.DateTo)
+		}
+		where = append(where, "a.created_at < ?")
+		args = append(args, to.AddDate(0, 0, 1).Format("2006-01-02"))
+	}
+
+	sortCol, ok := applicationSortColumns[f.Sort]
+	if !ok {
+		sortCol = "created_at"
+	}
+	dir := "ASC"
+	if f.Desc {
+		dir = "DESC"
+	}
+
+	if f.PerPage <= 0 {
+		f.PerPage = 25
+	}
+	if f.Page <= 0 {
+		f.Page = 1
+	}
+
+	// Counted separately so a page past the end still reports the total
+	from := `FROM applications a
+            JOIN users u ON u.id = a.broker_id
+            WHERE ` + strings.Join(where, " AND ")
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) "+from, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	args = append(args, f.PerPage, (f.Page-1)*f.PerPage, includeInternal)
+
+	// The page CTE applies filtering, sorting and pagination to applications
+	// only; documents are joined afterwards so they never skew LIMIT/OFFSET.
 	query := `
-        SELECT id, broker_id, application_type, created_at
-        FROM applications
-        WHERE assigned_admin_id = ?
-        ORDER BY created_at DESC
+        WITH matched AS (
+            SELECT a.id, a.broker_id, a.application_type, a.status, a.created_at,
+                   a.assigned_admin_id, u.first_name || ' ' || u.last_name AS broker_name
+            ` + from + `
+        ),
+        page AS (
+            SELECT m.*
+            FROM matched m
+            ORDER BY ` + applicationOrderBy(sortCol, dir, "m.") + `
+            LIMIT ? OFFSET ?
+        )
+        SELECT p.id, p.broker_id, p.application_type, p.status, p.created_at, p.assigned_admin_id, p.broker_name,
+               d.id, d.category, d.file_path, d.uploaded_at, d.scan_status
+        FROM page p
+        LEFT JOIN documents d ON d.application_id = p.id AND (? OR NOT ` + internalDocument("d") + `)
+        ORDER BY ` + applicationOrderBy(sortCol, dir, "p.") + `, d.id
     `
-	rows, err := db.Query(query, adminID)
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	var applications []models.ApplicationWithDocuments
-
 	for rows.Next() {
 		var app models.ApplicationWithDocuments
-		err := rows.Scan(&app.ID, &app.BrokerID, &app.ApplicationType, &app.CreatedAt)
+		var adminID, docID sql.NullInt64
+		var category, filePath, uploadedAt, scanStatus sql.NullString
+		err := rows.Scan(&app.ID, &app.BrokerID, &app.ApplicationType, &app.Status, &app.CreatedAt, &adminID, &app.BrokerName,
+			&docID, &category, &filePath, &uploadedAt, &scanStatus)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
-
-		// Fetch associated documents for each application
-		docs, err := GetDocumentsForApplication(db, app.ID)
-		if err != nil {
-			return nil, err
+		if adminID.Valid {
+			id := int(adminID.Int64)
+			app.AssignedAdminID = &id
 		}
 
-		// Map []Document to []models.DocumentInfo
-		var documentInfos []models.DocumentInfo
-		for _, d := range docs {
-			documentInfos = append(documentInfos, models.DocumentInfo{
-				Category: d.Category,
-				FilePath: d.FilePath,
+		// Rows arrive grouped by application, so a new ID starts a new entry.
+		if n := len(applications); n == 0 || applications[n-1].ID != app.ID {
+			applications = append(applications, app)
+		}
+		if docID.Valid {
+			last := &applications[len(applications)-1]
+			last.Documents = append(last.Documents, models.DocumentInfo{
+				ID:         int(docID.Int64),
+				Category:   category.String,
+				FilePath:   filePath.String,
+				UploadedAt: uploadedAt.String,
+				ScanStatus: scanStatus.String,
 			})
 		}
-		app.Documents = documentInfos
-
-		applications = append(applications, app)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
 	}
 
-	return applications, nil
+	return applications, total, nil
 }
 
-// GetDocumentsForApplication fetches all documents for a given application.
-func GetDocumentsForApplication(db *sql.DB, applicationID int) ([]Document, error) {
+// GetDocumentsForApplication fetches the documents of a given application.
+// Files attached to internal notes are left out unless includeInternal is
+// set.
+func GetDocumentsForApplication(db *sql.DB, applicationID int, includeInternal bool) ([]Document, error) {
 	query := `
-        SELECT id, application_id, category, file_path, uploaded_at
+        SELECT ` + documentColumns + `
         FROM documents
-        WHERE application_id = ?
+        WHERE application_id = ? AND (? OR NOT ` + internalDocument("documents") + `)
     `
-	rows, err := db.Query(query, applicationID)
+	rows, err := db.Query(query, applicationID, includeInternal)
 	if err != nil {
 		return nil, err
 	}
@@ -331,34 +600,105 @@ func GetDocumentsForApplication(db *sql.DB, applicationID int) ([]Document, erro
 	var documents []Document
 
 	for rows.Next() {
-		var doc Document
-		err := rows.Scan(&doc.ID, &doc.ApplicationID, &doc.Category, &doc.FilePath, &doc.UploadedAt)
+		doc, err := scanDocument(rows)
 		if err != nil {
 			return nil, err
 		}
-		documents = append(documents, doc)
+		documents = append(documents, *doc)
 	}
 
-	fmt.Printf("Fetched %d documents for application ID %d\n", len(documents), applicationID)
-	return documents, nil
+	return documents, rows.Err()
 }
 
 // GetDocumentByPath fetches a document by its file path.
 // internal/db/db.go
 
 func GetDocumentByPath(db *sql.DB, filePath string) (*Document, error) {
-    var doc Document
+    // The newest record, as earlier uploads may share the path
     query := `
-        SELECT id, application_id, category, file_path, uploaded_at
+        SELECT ` + documentColumns + `
         FROM documents
         WHERE file_path = ?
+        ORDER BY id DESC LIMIT 1
     `
-    row := db.QueryRow(query, filePath)
-    err := row.Scan(&doc.ID, &doc.ApplicationID, &doc.Category, &doc.FilePath, &doc.UploadedAt)
-    if err != nil {
-        return nil, err
-    }
-    return &doc, nil
+    return scanDocument(db.QueryRow(query, filePath))
+}
+
+// GetDocumentByID fetches a single document.
+func GetDocumentByID(db *sql.DB, id int) (*Document, error) {
+	return scanDocument(db.QueryRow("SELECT "+documentColumns+" FROM documents WHERE id = ?", id))
 }
 
+// SetApplicationAdmin assigns an application to a specific admin, bypassing
+// the round-robin rotation.
+func SetApplicationAdmin(db *sql.DB, applicationID, adminID int) error {
+	_, err := db.Exec("UPDATE applications SET assigned_admin_id=?, assigned_at=? WHERE id=?", adminID, time.Now(), applicationID)
+	return err
+}
+
+// SetApplicationType changes whether an application is for the broker or a client.
+func SetApplicationType(db *sql.DB, applicationID int, appType string) error {
+	_, err := db.Exec("UPDATE applications SET application_type=? WHERE id=?", appType, applicationID)
+	return err
+}
+
+// GetUsersByType lists users of the given type ordered by ID.
+func GetUsersByType(db *sql.DB, userType string) ([]models.User, error) {
+	rows, err := db.Query("SELECT id, first_name, last_name, email, phone, postal_code, user_type FROM users WHERE user_type=? ORDER BY id ASC", userType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		var phone, postalCode sql.NullString
+		if err := rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &phone, &postalCode, &u.UserType); err != nil {
+			return nil, err
+		}
+		u.Phone, u.PostalCode = phone.String, postalCode.String
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// GetUserByID fetches a user by ID.
+func GetUserByID(db *sql.DB, id int) (*models.User, error) {
+	u := &models.User{}
+	var phone, postalCode sql.NullString
+	row := db.QueryRow("SELECT id, first_name, last_name, email, password_hash, phone, postal_code, user_type FROM users WHERE id=?", id)
+	err := row.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.PasswordHash, &phone, &postalCode, &u.UserType)
+	if err != nil {
+		return nil, err
+	}
+	u.Phone, u.PostalCode = phone.String, postalCode.String
+	return u, nil
+}
+
+// GetAllUsers lists every user ordered by ID.
+func GetAllUsers(db *sql.DB) ([]models.User, error) {
+	rows, err := db.Query("SELECT id, first_name, last_name, email, phone, postal_code, user_type FROM users ORDER BY id ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		var phone, postalCode sql.NullString
+		if err := rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &phone, &postalCode, &u.UserType); err != nil {
+			return nil, err
+		}
+		u.Phone, u.PostalCode = phone.String, postalCode.String
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// SetUserType changes a user's role.
+func SetUserType(db *sql.DB, userID int, userType string) error {
+	_, err := db.Exec("UPDATE users SET user_type=? WHERE id=?", userType, userID)
+	return err
+}
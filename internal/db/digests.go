@@ -0,0 +1,199 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+// digestScope limits a digest query to the applications assigned to an
+// admin, or owned by a broker.
+func digestScope(admin bool) string {
+	if admin {
+		return "a.assigned_admin_id = ?"
+	}
+	return "a.broker_id = ?"
+}
+
+// GetDigestFrequency returns how often the user wants a digest.
+func GetDigestFrequency(db *sql.DB, userID int) (string, error) {
+	var frequency string
+	err := db.QueryRow("SELECT frequency FROM digest_preferences WHERE user_id = ?", userID).Scan(&frequency)
+	if err == sql.ErrNoRows {
+		return models.DigestDaily, nil
+	}
+	return frequency, err
+}
+
+// SetDigestFrequency records how often the user wants a digest.
+func SetDigestFrequency(db *sql.DB, userID int, frequency string) error {
+	_, err := db.Exec(`INSERT INTO digest_preferences (user_id, frequency) VALUES (?, ?)
+        ON CONFLICT(user_id) DO UPDATE SET frequency = excluded.frequency`, userID, frequency)
+	return err
+}
+
+// GetDigestRecipients lists the admins and brokers who want a digest at
+// the given frequency.
+func GetDigestRecipients(db *sql.DB, frequency string) ([]models.User, error) {
+	rows, err := db.Query(`SELECT u.id, u.first_name, u.last_name, u.email, u.user_type
+        FROM users u LEFT JOIN digest_preferences p ON p.user_id = u.id
+        WHERE u.user_type IN ('admin', 'broker') AND COALESCE(p.frequency, ?) = ?
+        ORDER BY u.id`, models.DigestDaily, frequency)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.UserType); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// ClaimDigest records that the user's digest for period is being sent. It
+// returns false if it already was, so each digest goes out at most once.
+func ClaimDigest(db *sql.DB, userID int, frequency, period string, now time.Time) (bool, error) {
+	res, err := db.Exec(`INSERT OR IGNORE INTO digest_sends (user_id, frequency, period, sent_at) VALUES (?, ?, ?, ?)`,
+		userID, frequency, period, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ReleaseDigest gives up a claim whose digest could not be sent, so the
+// next run tries again.
+func ReleaseDigest(db *sql.DB, userID int, frequency, period string) error {
+	_, err := db.Exec("DELETE FROM digest_sends WHERE user_id = ? AND frequency = ? AND period = ?", userID, frequency, period)
+	return err
+}
+
+// GetLastDigest returns when the user's latest digest at frequency other
+// than for period was sent, or the zero time if there was none.
+func GetLastDigest(db *sql.DB, userID int, frequency, period string) (time.Time, error) {
+	var sentAt time.Time
+	err := db.QueryRow(`SELECT sent_at FROM digest_sends WHERE user_id = ? AND frequency = ? AND period <> ?
+        ORDER BY id DESC LIMIT 1`, userID, frequency, period).Scan(&sentAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return sentAt, err
+}
+
+func queryDigestApplications(db *sql.DB, query string, args ...interface{}) ([]models.DigestApplication, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var apps []models.DigestApplication
+	for rows.Next() {
+		var a models.DigestApplication
+		if err := rows.Scan(&a.ID, &a.ApplicationType, &a.Status, &a.BrokerName); err != nil {
+			return nil, err
+		}
+		apps = append(apps, a)
+	}
+	return apps, rows.Err()
+}
+
+// GetDigestAssignments lists the user's applications assigned to an admin
+// since the given time.
+func GetDigestAssignments(db *sql.DB, userID int, admin bool, since time.Time) ([]models.DigestApplication, error) {
+	return queryDigestApplications(db, `SELECT a.id, a.application_type, a.status, u.first_name || ' ' || u.last_name
+        FROM applications a JOIN users u ON u.id = a.broker_id
+        WHERE `+digestScope(admin)+` AND a.assigned_at > ?
+        ORDER BY a.id`, userID, since)
+}
+
+// GetStalledApplications lists the user's applications under review that
+// have had no status change, assignment, message, condition activity or
+// upload since before.
+func GetStalledApplications(db *sql.DB, userID int, admin bool, before time.Time) ([]models.DigestApplication, error) {
+	return queryDigestApplications(db, `SELECT a.id, a.application_type, a.status, u.first_name || ' ' || u.last_name
+        FROM applications a JOIN users u ON u.id = a.broker_id
+        WHERE `+digestScope(admin)+` AND a.status IN (?, ?)
+        AND COALESCE(a.status_changed_at, a.created_at) < ?
+        AND COALESCE(a.assigned_at, a.created_at) < ?
+        AND NOT EXISTS (SELECT 1 FROM messages m WHERE m.application_id = a.id AND m.created_at >= ?)
+        AND NOT EXISTS (SELECT 1 FROM conditions c WHERE c.application_id = a.id
+            AND (c.created_at >= ? OR c.responded_at >= ? OR c.cleared_at >= ?))
+        AND NOT EXISTS (SELECT 1 FROM documents d WHERE d.application_id = a.id AND d.uploaded_at >= ?)
+        ORDER BY a.id`,
+		userID, models.StatusSubmitted, models.StatusInReview, before, before, before, before, before, before, before)
+}
+
+// GetOverdueCommitmentConditions lists the unsatisfied commitment
+// conditions on the user's applications that were due before today.
+func GetOverdueCommitmentConditions(db *sql.DB, userID int, admin bool, today time.Time) ([]models.DigestCondition, error) {
+	rows, err := db.Query(`SELECT a.id, l.name, cc.description, cc.due_on
+        FROM commitment_conditions cc
+        JOIN commitments c ON c.id = cc.commitment_id
+        JOIN lenders l ON l.id = c.lender_id
+        JOIN applications a ON a.id = c.application_id
+        WHERE `+digestScope(admin)+` AND cc.satisfied_at IS NULL AND cc.due_on < ?
+        ORDER BY cc.due_on, cc.id`, userID, today.Format(dayLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conditions []models.DigestCondition
+	for rows.Next() {
+		var c models.DigestCondition
+		var dueOn string
+		if err := rows.Scan(&c.ApplicationID, &c.LenderName, &c.Description, &dueOn); err != nil {
+			return nil, err
+		}
+		if c.DueOn, err = parseDay(dueOn); err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions, rows.Err()
+}
+
+// GetExpiringRateHolds lists the unreleased rate holds on the user's
+// applications that expire between from and through, inclusive.
+func GetExpiringRateHolds(db *sql.DB, userID int, admin bool, from, through time.Time) ([]models.RateHold, error) {
+	return queryRateHolds(db, `JOIN applications a ON a.id = h.application_id
+        WHERE `+digestScope(admin)+` AND h.released_at IS NULL AND h.expires_on >= ? AND h.expires_on <= ?
+        ORDER BY h.expires_on, h.id`, userID, from.Format(dayLayout), through.Format(dayLayout))
+}
+
+// GetDigestNotifications lists, oldest first, the notifications kept for
+// the user's digest that have not been in one yet.
+func GetDigestNotifications(db *sql.DB, userID int) ([]models.Notification, error) {
+	rows, err := db.Query(`SELECT `+notificationColumns+` FROM notifications
+        WHERE user_id = ? AND digest = 1 AND digested_at IS NULL ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []models.Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// MarkNotificationsDigested records that the user's digest notifications
+// up to and including throughID have been sent.
+func MarkNotificationsDigested(db *sql.DB, userID, throughID int, now time.Time) error {
+	_, err := db.Exec(`UPDATE notifications SET digested_at = ?
+        WHERE user_id = ? AND digest = 1 AND digested_at IS NULL AND id <= ?`, now, userID, throughID)
+	return err
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"database/sql"
+	"slices"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+// SaveExtraction records what extraction found in a document, replacing
+// any earlier result. Fields an admin already confirmed are kept.
+func SaveExtraction(db *sql.DB, e *models.DocumentExtraction) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO document_extractions (document_id, doc_type, status, error, engine, extracted_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+        ON CONFLICT (document_id) DO UPDATE SET doc_type = excluded.doc_type, status = excluded.status,
+            error = excluded.error, engine = excluded.engine, extracted_at = excluded.extracted_at`,
+		e.DocumentID, e.DocType, e.Status, e.Error, e.Engine, e.ExtractedAt); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM document_fields WHERE document_id = ? AND confirmed_at IS NULL", e.DocumentID); err != nil {
+		return err
+	}
+	for _, f := range e.Fields {
+		if _, err := tx.Exec(`INSERT INTO document_fields (document_id, name, value, extracted_value, confidence)
+            VALUES (?, ?, ?, ?, ?) ON CONFLICT (document_id, name) DO NOTHING`,
+			e.DocumentID, f.Name, f.Value, f.ExtractedValue, f.Confidence); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetExtractionsForApplication returns the extractions of an application's
+// documents by document ID. Their fields are in display order and include
+// every field of the document type, empty if not found or entered.
+func GetExtractionsForApplication(db *sql.DB, applicationID int) (map[int]*models.DocumentExtraction, error) {
+	rows, err := db.Query(`SELECT e.document_id, d.application_id, e.doc_type, e.status, e.error, e.engine, e.extracted_at
+        FROM document_extractions e JOIN documents d ON d.id = e.document_id
+        WHERE d.application_id = ?`, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	extractions := map[int]*models.DocumentExtraction{}
+	for rows.Next() {
+		var e models.DocumentExtraction
+		if err := rows.Scan(&e.DocumentID, &e.ApplicationID, &e.DocType, &e.Status, &e.Error, &e.Engine, &e.ExtractedAt); err != nil {
+			return nil, err
+		}
+		extractions[e.DocumentID] = &e
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	fields, err := db.Query(`SELECT f.document_id, f.name, f.value, f.extracted_value, f.confidence, f.confirmed_by, f.confirmed_at
+        FROM document_fields f JOIN documents d ON d.id = f.document_id
+        WHERE d.application_id = ? ORDER BY f.document_id, f.name`, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer fields.Close()
+	for fields.Next() {
+		var documentID int
+		var f models.ExtractedField
+		if err := fields.Scan(&documentID, &f.Name, &f.Value, &f.ExtractedValue, &f.Confidence, &f.ConfirmedBy, &f.ConfirmedAt); err != nil {
+			return nil, err
+		}
+		if e := extractions[documentID]; e != nil {
+			e.Fields = append(e.Fields, f)
+		}
+	}
+	if err := fields.Err(); err != nil {
+		return nil, err
+	}
+	for _, e := range extractions {
+		order := models.ExtractionFields[e.DocType]
+		for _, name := range order {
+			if !slices.ContainsFunc(e.Fields, func(f models.ExtractedField) bool { return f.Name == name }) {
+				e.Fields = append(e.Fields, models.ExtractedField{Name: name})
+			}
+		}
+		slices.SortStableFunc(e.Fields, func(a, b models.ExtractedField) int {
+			return fieldRank(order, a.Name) - fieldRank(order, b.Name)
+		})
+	}
+	return extractions, nil
+}
+
+// fieldRank is name's position in order, with unlisted fields last.
+func fieldRank(order []string, name string) int {
+	if i := slices.Index(order, name); i >= 0 {
+		return i
+	}
+	return len(order)
+}
+
+// ConfirmExtractedFields stores the values an admin confirmed for a
+// document's fields, by name. It returns sql.ErrNoRows if the document was
+// never extracted.
+func ConfirmExtractedFields(db *sql.DB, documentID int, values map[string]string, confirmedBy int, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow("SELECT 1 FROM document_extractions WHERE document_id = ?", documentID).Scan(&exists); err != nil {
+		return err
+	}
+	for name, value := range values {
+		if _, err := tx.Exec(`INSERT INTO document_fields (document_id, name, value, confirmed_by, confirmed_at)
+            VALUES (?, ?, ?, ?, ?)
+            ON CONFLICT (document_id, name) DO UPDATE SET value = excluded.value,
+                confirmed_by = excluded.confirmed_by, confirmed_at = excluded.confirmed_at`,
+			documentID, name, value, confirmedBy, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
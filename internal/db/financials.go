@@ -0,0 +1,46 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+// GetApplicationFinancials returns the application's finances, or nil if
+// none were entered.
+func GetApplicationFinancials(db *sql.DB, applicationID int) (*models.ApplicationFinancials, error) {
+	f := &models.ApplicationFinancials{ApplicationID: applicationID}
+	err := db.QueryRow(`SELECT annual_income, monthly_debts, purchase_price, down_payment, property_tax,
+            heating, condo_fees, contract_rate, amortization_years, province, property_type, credit_score, updated_at
+        FROM application_financials WHERE application_id = ?`, applicationID).
+		Scan(&f.AnnualIncome, &f.MonthlyDebts, &f.PurchasePrice, &f.DownPayment, &f.PropertyTax,
+			&f.Heating, &f.CondoFees, &f.ContractRate, &f.AmortizationYears,
+			&f.Province, &f.PropertyType, &f.CreditScore, &f.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SaveApplicationFinancials creates or replaces the application's finances.
+func SaveApplicationFinancials(db *sql.DB, f *models.ApplicationFinancials) error {
+	_, err := db.Exec(`INSERT INTO application_financials (application_id, annual_income, monthly_debts,
+            purchase_price, down_payment, property_tax, heating, condo_fees, contract_rate, amortization_years,
+            province, property_type, credit_score, updated_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT(application_id) DO UPDATE SET annual_income=excluded.annual_income,
+            monthly_debts=excluded.monthly_debts, purchase_price=excluded.purchase_price,
+            down_payment=excluded.down_payment, property_tax=excluded.property_tax, heating=excluded.heating,
+            condo_fees=excluded.condo_fees, contract_rate=excluded.contract_rate,
+            amortization_years=excluded.amortization_years, province=excluded.province,
+            property_type=excluded.property_type, credit_score=excluded.credit_score, updated_at=excluded.updated_at`,
+		f.ApplicationID, f.AnnualIncome, f.MonthlyDebts, f.PurchasePrice, f.DownPayment, f.PropertyTax,
+		f.Heating, f.CondoFees, f.ContractRate, f.AmortizationYears,
+		f.Province, f.PropertyType, f.CreditScore, time.Now())
+	return err
+}
@@ -0,0 +1,235 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+const jobColumns = `id, kind, payload, status, COALESCE(unique_key, ''), attempts, max_attempts, run_at,
+        locked_at, last_error, created_at, finished_at`
+
+func scanJob(row interface{ Scan(...interface{}) error }) (*models.Job, error) {
+	var j models.Job
+	err := row.Scan(&j.ID, &j.Kind, &j.Payload, &j.Status, &j.UniqueKey, &j.Attempts, &j.MaxAttempts, &j.RunAt,
+		&j.LockedAt, &j.LastError, &j.CreatedAt, &j.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// EnqueueJob queues a job and returns its ID. It returns 0, and queues
+// nothing, when a job with the same unique key is already queued or
+// running.
+func EnqueueJob(db *sql.DB, j *models.Job, now time.Time) (int, error) {
+	return enqueueJob(db, j, now)
+}
+
+// enqueueJob is EnqueueJob on a database or within a transaction.
+func enqueueJob(db interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, j *models.Job, now time.Time) (int, error) {
+	var uniqueKey interface{}
+	if j.UniqueKey != "" {
+		uniqueKey = j.UniqueKey
+	}
+	res, err := db.Exec(`INSERT OR IGNORE INTO jobs (kind, payload, status, unique_key, max_attempts, run_at, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		j.Kind, j.Payload, models.JobQueued, uniqueKey, j.MaxAttempts, j.RunAt.UTC(), now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// ClaimJob marks the next job due at now running, counts the attempt and
+// returns it, or returns nil if no job is due. Idle workers only read, so
+// polling does not hold up writes.
+func ClaimJob(db *sql.DB, now time.Time) (*models.Job, error) {
+	for {
+		var id int
+		err := db.QueryRow("SELECT id FROM jobs WHERE status = ? AND run_at <= ? ORDER BY run_at, id LIMIT 1",
+			models.JobQueued, now.UTC()).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		j, err := scanJob(db.QueryRow(`UPDATE jobs SET status = ?, locked_at = ?, attempts = attempts + 1
+            WHERE id = ? AND status = ? RETURNING `+jobColumns, models.JobRunning, now.UTC(), id, models.JobQueued))
+		// Another worker claimed it first
+		if err == sql.ErrNoRows {
+			continue
+		}
+		return j, err
+	}
+}
+
+// CompleteJob marks a running job done.
+func CompleteJob(db *sql.DB, id int, now time.Time) error {
+	_, err := db.Exec("UPDATE jobs SET status = ?, finished_at = ?, locked_at = NULL WHERE id = ?",
+		models.JobDone, now.UTC(), id)
+	return err
+}
+
+// RescheduleJob queues a failed job to run again at runAt.
+func RescheduleJob(db *sql.DB, id int, runAt time.Time, lastError string) error {
+	_, err := db.Exec("UPDATE jobs SET status = ?, run_at = ?, locked_at = NULL, last_error = ? WHERE id = ?",
+		models.JobQueued, runAt.UTC(), lastError, id)
+	return err
+}
+
+// ReleaseJob queues a job interrupted by shutdown again, without counting
+// the attempt.
+func ReleaseJob(db *sql.DB, id int) error {
+	_, err := db.Exec("UPDATE jobs SET status = ?, locked_at = NULL, attempts = attempts - 1 WHERE id = ? AND status = ?",
+		models.JobQueued, id, models.JobRunning)
+	return err
+}
+
+// BuryJob moves a job that has failed for good to the dead letters.
+func BuryJob(db *sql.DB, id int, now time.Time, lastError string) error {
+	_, err := db.Exec("UPDATE jobs SET status = ?, finished_at = ?, locked_at = NULL, last_error = ? WHERE id = ?",
+		models.JobDead, now.UTC(), lastError, id)
+	return err
+}
+
+// RequeueStaleJobs queues again the jobs claimed before the given time that
+// never finished, such as those running when the server crashed.
+func RequeueStaleJobs(db *sql.DB, lockedBefore time.Time) (int64, error) {
+	res, err := db.Exec("UPDATE jobs SET status = ?, locked_at = NULL, last_error = ? WHERE status = ? AND locked_at < ?",
+		models.JobQueued, "interrupted", models.JobRunning, lockedBefore.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ErrJobDuplicate is returned when a dead job cannot be retried because a
+// newer job with the same unique key is queued or running.
+var ErrJobDuplicate = errors.New("a job with the same unique key is queued or running")
+
+// RetryJob queues a dead job to run again now with a fresh set of
+// attempts. It returns sql.ErrNoRows if the job is not dead, and
+// ErrJobDuplicate if a newer job already does the same work.
+func RetryJob(db *sql.DB, id int, now time.Time) error {
+	res, err := db.Exec(`UPDATE jobs SET status = ?, attempts = 0, run_at = ?, finished_at = NULL
+        WHERE id = ? AND status = ? AND NOT EXISTS (
+            SELECT 1 FROM jobs o WHERE o.unique_key = jobs.unique_key AND o.status IN (?, ?))`,
+		models.JobQueued, now.UTC(), id, models.JobDead, models.JobQueued, models.JobRunning)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return err
+	}
+	var status string
+	if err := db.QueryRow("SELECT status FROM jobs WHERE id = ?", id).Scan(&status); err != nil {
+		return err
+	}
+	if status == models.JobDead {
+		return ErrJobDuplicate
+	}
+	return sql.ErrNoRows
+}
+
+// GetJobs lists the newest limit jobs with the given status, or of any
+// status if it is empty.
+func GetJobs(db *sql.DB, status string, limit int) ([]models.Job, error) {
+	rows, err := db.Query(`SELECT `+jobColumns+` FROM jobs WHERE (? = '' OR status = ?)
+        ORDER BY id DESC LIMIT ?`, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []models.Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *j)
+	}
+	return jobs, rows.Err()
+}
+
+// CountJobsByStatus counts the jobs in each status.
+func CountJobsByStatus(db *sql.DB) (map[string]int, error) {
+	rows, err := db.Query("SELECT status, COUNT(*) FROM jobs GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// GetJobSchedule returns when the named recurring job was last queued, or
+// false if it never was.
+func GetJobSchedule(db *sql.DB, name string) (time.Time, bool, error) {
+	var lastRun time.Time
+	err := db.QueryRow("SELECT last_run_at FROM job_schedules WHERE name = ?", name).Scan(&lastRun)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	return lastRun, err == nil, err
+}
+
+// StartJobSchedule records a recurring job as last queued at the given
+// time, unless it is already recorded.
+func StartJobSchedule(db *sql.DB, name string, at time.Time) error {
+	_, err := db.Exec("INSERT OR IGNORE INTO job_schedules (name, last_run_at) VALUES (?, ?)", name, at.UTC())
+	return err
+}
+
+// AdvanceJobSchedule moves a recurring job's last run from last to next and
+// queues j for the run, both or neither. It returns false, queueing
+// nothing, if another server advanced it first.
+func AdvanceJobSchedule(db *sql.DB, name string, last, next time.Time, j *models.Job, now time.Time) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE job_schedules SET last_run_at = ? WHERE name = ? AND last_run_at = ?",
+		next.UTC(), name, last.UTC())
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := enqueueJob(tx, j, now); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// DeleteFinishedJobs deletes the jobs that finished successfully before the
+// given time. Dead jobs are kept until they are retried.
+func DeleteFinishedJobs(db *sql.DB, before time.Time) (int64, error) {
+	res, err := db.Exec("DELETE FROM jobs WHERE status = ? AND finished_at < ?", models.JobDone, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
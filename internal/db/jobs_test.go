@@ -0,0 +1,76 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+func TestRetryJob(t *testing.T) {
+	database := openTestDB(t)
+	now := time.Now()
+	enqueue := func(key string) int {
+		id, err := EnqueueJob(database, &models.Job{Kind: "test", Payload: "{}", UniqueKey: key, MaxAttempts: 1, RunAt: now}, now)
+		if err != nil || id == 0 {
+			t.Fatalf("EnqueueJob(%q) = %d, %v", key, id, err)
+		}
+		return id
+	}
+	bury := func(id int) {
+		if err := BuryJob(database, id, now, "failed"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dead := enqueue("scan:1")
+	bury(dead)
+	newer := enqueue("scan:1")
+	deadAlone := enqueue("scan:2")
+	bury(deadAlone)
+	deadNoKey := enqueue("")
+	bury(deadNoKey)
+	otherNoKey := enqueue("")
+
+	tests := []struct {
+		name    string
+		id      int
+		wantErr error
+	}{
+		{"newer job with the key queued", dead, ErrJobDuplicate},
+		{"not dead", newer, sql.ErrNoRows},
+		{"missing", 999, sql.ErrNoRows},
+		{"no newer job", deadAlone, nil},
+		{"no unique key", deadNoKey, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RetryJob(database, tt.id, now); !errors.Is(err, tt.wantErr) {
+				t.Errorf("RetryJob(%d) = %v, want %v", tt.id, err, tt.wantErr)
+			}
+		})
+	}
+
+	// Once the newer job is done the dead one can run again
+	if err := CompleteJob(database, newer, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := RetryJob(database, dead, now); err != nil {
+		t.Fatalf("RetryJob after the newer job finished: %v", err)
+	}
+	jobs, err := GetJobs(database, models.JobQueued, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued := map[int]bool{}
+	for _, j := range jobs {
+		queued[j.ID] = true
+	}
+	for _, id := range []int{dead, deadAlone, deadNoKey, otherNoKey} {
+		if !queued[id] {
+			t.Errorf("job %d is not queued", id)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+// CreateLender adds an active lender and returns its ID.
+func CreateLender(db *sql.DB, name string) (int, error) {
+	res, err := db.Exec("INSERT INTO lenders (name, created_at) VALUES (?, ?)", name, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// SetLenderActive hides or restores a lender and all of its products.
+func SetLenderActive(db *sql.DB, id int, active bool) error {
+	return expectOneRow(db.Exec("UPDATE lenders SET active = ? WHERE id = ?", active, id))
+}
+
+// GetLenders lists every lender by name with all of its products and
+// today's rates, best rate first.
+func GetLenders(db *sql.DB) ([]models.Lender, error) {
+	rows, err := db.Query("SELECT id, name, active, created_at FROM lenders ORDER BY name COLLATE NOCASE")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lenders []models.Lender
+	index := map[int]int{}
+	for rows.Next() {
+		var l models.Lender
+		if err := rows.Scan(&l.ID, &l.Name, &l.Active, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		index[l.ID] = len(lenders)
+		lenders = append(lenders, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	products, err := queryLenderProducts(db, time.Now(), "ORDER BY current_rate, p.id")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range products {
+		l := &lenders[index[p.LenderID]]
+		l.Products = append(l.Products, p)
+	}
+	return lenders, nil
+}
+
+// GetActiveLenderProducts lists the products of active lenders that are
+// themselves active and had a rate in effect on day.
+func GetActiveLenderProducts(db *sql.DB, day time.Time) ([]models.LenderProduct, error) {
+	products, err := queryLenderProducts(db, day, "WHERE p.active = 1 AND l.active = 1 ORDER BY current_rate, p.id")
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(products, func(p models.LenderProduct) bool { return p.Rate == 0 }), nil
+}
+
+// GetLenderProduct fetches one product with today's rate.
+func GetLenderProduct(db *sql.DB, id int) (*models.LenderProduct, error) {
+	products, err := queryLenderProducts(db, time.Now(), "WHERE p.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(products) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &products[0], nil
+}
+
+// queryLenderProducts loads products with the rate in effect on day.
+func queryLenderProducts(db *sql.DB, day time.Time, where string, args ...interface{}) ([]models.LenderProduct, error) {
+	d := day.Format(dayLayout)
+	rows, err := db.Query(`SELECT p.id, p.lender_id, l.name, p.name,
+            COALESCE((SELECT r.rate FROM product_rates r WHERE r.product_id = p.id AND r.effective_from <= ?
+                AND (r.effective_to IS NULL OR r.effective_to >= ?) ORDER BY r.effective_from DESC LIMIT 1), 0) AS current_rate,
+            p.term_months, p.rate_type, p.max_ltv, p.min_credit_score, p.max_gds, p.max_tds, p.property_types,
+            p.provinces, p.prepayment_privileges, p.active, p.updated_at
+        FROM lender_products p JOIN lenders l ON l.id = p.lender_id `+where, append([]interface{}{d, d}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []models.LenderProduct
+	for rows.Next() {
+		var p models.LenderProduct
+		var propertyTypes, provinces string
+		err := rows.Scan(&p.ID, &p.LenderID, &p.LenderName, &p.Name, &p.Rate, &p.TermMonths, &p.RateType, &p.MaxLTV,
+			&p.MinCreditScore, &p.MaxGDS, &p.MaxTDS, &propertyTypes, &provinces, &p.PrepaymentPrivileges,
+			&p.Active, &p.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		p.PropertyTypes = splitList(propertyTypes)
+		p.Provinces = splitList(provinces)
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+// SaveLenderProduct creates the product when its ID is 0 and updates it
+// otherwise, returning its ID. A rate that differs from today's takes
+// effect today.
+func SaveLenderProduct(db *sql.DB, p *models.LenderProduct) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	args := []interface{}{p.LenderID, p.Name, p.TermMonths, p.RateType, p.MaxLTV, p.MinCreditScore,
+		p.MaxGDS, p.MaxTDS, strings.Join(p.PropertyTypes, ","), strings.Join(p.Provinces, ","),
+		p.PrepaymentPrivileges, now}
+	id := p.ID
+	if id != 0 {
+		err := expectOneRow(tx.Exec(`UPDATE lender_products SET lender_id=?, name=?, term_months=?, rate_type=?,
+            max_ltv=?, min_credit_score=?, max_gds=?, max_tds=?, property_types=?, provinces=?,
+            prepayment_privileges=?, updated_at=? WHERE id=?`, append(args, id)...))
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		res, err := tx.Exec(`INSERT INTO lender_products (lender_id, name, term_months, rate_type, max_ltv,
+                min_credit_score, max_gds, max_tds, property_types, provinces, prepayment_privileges, updated_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, args...)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		id = int(n)
+	}
+
+	current, err := productRateOn(tx, id, now)
+	if err != nil {
+		return 0, err
+	}
+	if current != p.Rate {
+		if err := setProductRate(tx, id, p.Rate, now, nil, nil); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// SetLenderProductActive withdraws or restores a product.
+func SetLenderProductActive(db *sql.DB, id int, active bool) error {
+	return expectOneRow(db.Exec("UPDATE lender_products SET active = ?, updated_at = ? WHERE id = ?", active, time.Now(), id))
+}
+
+// expectOneRow turns an update that matched nothing into sql.ErrNoRows.
+func expectOneRow(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// splitList parses a comma-separated column; empty means no entries.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
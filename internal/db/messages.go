@@ -0,0 +1,138 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+// CreateMessage adds a message, and the users it mentions, to an
+// application's thread, links any attachment to it and returns its ID.
+func CreateMessage(db *sql.DB, m *models.Message, mentions []int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO messages (application_id, author_id, body, internal, document_id, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)`, m.ApplicationID, m.AuthorID, m.Body, m.Internal, m.DocumentID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if m.DocumentID != nil {
+		if _, err := tx.Exec("UPDATE documents SET message_id = ? WHERE id = ?", id, *m.DocumentID); err != nil {
+			return 0, err
+		}
+	}
+	for _, userID := range mentions {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO message_mentions (message_id, user_id) VALUES (?, ?)", id, userID); err != nil {
+			return 0, err
+		}
+	}
+	return int(id), tx.Commit()
+}
+
+// GetMessages lists an application's thread, oldest first. Internal notes
+// are left out unless includeInternal is set.
+func GetMessages(db *sql.DB, applicationID int, includeInternal bool) ([]models.Message, error) {
+	rows, err := db.Query(`SELECT m.id, m.application_id, m.author_id, u.first_name || ' ' || u.last_name, u.user_type,
+            m.body, m.internal, m.document_id, COALESCE(d.file_path, ''), m.created_at,
+            COALESCE((SELECT GROUP_CONCAT(mu.first_name || ' ' || mu.last_name, ',')
+                FROM message_mentions mm JOIN users mu ON mu.id = mm.user_id WHERE mm.message_id = m.id), '')
+        FROM messages m
+        JOIN users u ON u.id = m.author_id
+        LEFT JOIN documents d ON d.id = m.document_id
+        WHERE m.application_id = ? AND (? OR m.internal = 0)
+        ORDER BY m.id`, applicationID, includeInternal)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.Message
+	for rows.Next() {
+		var m models.Message
+		var filePath, mentions string
+		err := rows.Scan(&m.ID, &m.ApplicationID, &m.AuthorID, &m.AuthorName, &m.AuthorType,
+			&m.Body, &m.Internal, &m.DocumentID, &filePath, &m.CreatedAt, &mentions)
+		if err != nil {
+			return nil, err
+		}
+		if filePath != "" {
+			m.Attachment = filepath.Base(filePath)
+		}
+		m.Mentions = splitList(mentions)
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// GetMessage fetches a single message, or returns sql.ErrNoRows.
+func GetMessage(db *sql.DB, id int) (*models.Message, error) {
+	var m models.Message
+	err := db.QueryRow(`SELECT id, application_id, author_id, body, internal, document_id, created_at
+        FROM messages WHERE id = ?`, id).
+		Scan(&m.ID, &m.ApplicationID, &m.AuthorID, &m.Body, &m.Internal, &m.DocumentID, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// GetLastReadMessage returns the ID of the newest message the user has read
+// on the application, or 0.
+func GetLastReadMessage(db *sql.DB, applicationID, userID int) (int, error) {
+	var id int
+	err := db.QueryRow("SELECT last_read_id FROM message_reads WHERE application_id = ? AND user_id = ?",
+		applicationID, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// MarkMessagesRead records that the user has read the application's thread
+// up to and including the given message.
+func MarkMessagesRead(db *sql.DB, applicationID, userID, lastID int) error {
+	_, err := db.Exec(`INSERT INTO message_reads (application_id, user_id, last_read_id) VALUES (?, ?, ?)
+        ON CONFLICT(application_id, user_id) DO UPDATE SET last_read_id = MAX(last_read_id, excluded.last_read_id)`,
+		applicationID, userID, lastID)
+	return err
+}
+
+// GetUnreadMessageCounts counts, by application, the messages other people
+// posted that the user has not read. Admins count the applications assigned
+// to them, including internal notes; brokers count their own applications.
+func GetUnreadMessageCounts(db *sql.DB, userID int, admin bool) (map[int]int, error) {
+	scope := "a.broker_id = ? AND m.internal = 0"
+	if admin {
+		scope = "a.assigned_admin_id = ?"
+	}
+	rows, err := db.Query(`SELECT m.application_id, COUNT(*)
+        FROM messages m
+        JOIN applications a ON a.id = m.application_id
+        LEFT JOIN message_reads r ON r.application_id = m.application_id AND r.user_id = ?
+        WHERE `+scope+` AND m.author_id <> ? AND m.id > COALESCE(r.last_read_id, 0)
+        GROUP BY m.application_id`, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var appID, n int
+		if err := rows.Scan(&appID, &n); err != nil {
+			return nil, err
+		}
+		counts[appID] = n
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"MortgageAgent/internal/models"
+)
+
+// Files on internal notes, or not yet linked to a message, are only listed
+// for admins.
+func TestInternalAttachments(t *testing.T) {
+	database := openTestDB(t)
+	exec := func(query string, args ...interface{}) int {
+		res, err := database.Exec(query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		return int(id)
+	}
+	adminID := exec(`INSERT INTO users (first_name, last_name, email, password_hash, user_type)
+        VALUES ('Ada', 'Admin', 'ada@example.com', '', 'admin')`)
+	brokerID := exec(`INSERT INTO users (first_name, last_name, email, password_hash, user_type)
+        VALUES ('Bo', 'Broker', 'bo@example.com', '', 'broker')`)
+	appID := exec(`INSERT INTO applications (broker_id, application_type, assigned_admin_id, status)
+        VALUES (?, 'self', ?, 'submitted')`, brokerID, adminID)
+	addDocument := func(category, name string) int {
+		return exec(`INSERT INTO documents (application_id, category, file_path, scan_status) VALUES (?, ?, ?, 'clean')`,
+			appID, category, filepath.Join("uploads", name))
+	}
+	post := func(authorID int, internal bool, docID int) {
+		m := models.Message{ApplicationID: appID, AuthorID: authorID, Body: "See attached", Internal: internal, DocumentID: &docID}
+		if _, err := CreateMessage(database, &m, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	addDocument("Proof_of_income", "stub.pdf")
+	post(brokerID, false, addDocument(models.CategoryMessage, "broker.pdf"))
+	post(adminID, false, addDocument(models.CategoryMessage, "reply.pdf"))
+	internalID := addDocument(models.CategoryMessage, "note.pdf")
+	post(adminID, true, internalID)
+	// Saved, but its message was never posted
+	orphanID := addDocument(models.CategoryMessage, "orphan.pdf")
+
+	names := func(docs []Document) []string {
+		var out []string
+		for _, d := range docs {
+			out = append(out, filepath.Base(d.FilePath))
+		}
+		sort.Strings(out)
+		return out
+	}
+	tests := []struct {
+		name            string
+		includeInternal bool
+		want            []string
+	}{
+		{"broker", false, []string{"broker.pdf", "reply.pdf", "stub.pdf"}},
+		{"admin", true, []string{"broker.pdf", "note.pdf", "orphan.pdf", "reply.pdf", "stub.pdf"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := GetDocumentsForApplication(database, appID, tt.includeInternal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(docs); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("documents = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, id := range []int{internalID, orphanID} {
+		doc, err := GetDocumentByID(database, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !doc.Internal {
+			t.Errorf("%s is not marked internal", doc.FilePath)
+		}
+	}
+
+	apps, _, err := GetApplicationsForBroker(database, brokerID, ApplicationFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 1 || len(apps[0].Documents) != 3 {
+		t.Fatalf("broker listing has %v, want 3 documents", apps)
+	}
+	for _, d := range apps[0].Documents {
+		if d.ID == internalID || d.ID == orphanID {
+			t.Errorf("broker listing includes %s", d.FilePath)
+		}
+	}
+	if apps, _, err = GetApplicationsForAdmin(database, adminID, ApplicationFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 1 || len(apps[0].Documents) != 5 {
+		t.Errorf("admin listing has %v, want 5 documents", apps)
+	}
+}
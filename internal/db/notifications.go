@@ -0,0 +1,140 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+// CreateNotification stores a notification and returns its ID. It is shown
+// in the user's inbox when inApp is set and collected for their digest when
+// digest is.
+func CreateNotification(db *sql.DB, n *models.Notification, inApp, digest bool) (int, error) {
+	res, err := db.Exec(`INSERT INTO notifications (user_id, kind, application_id, title, body, link, in_app, digest, created_at)
+        VALUES (?, ?, NULLIF(?, 0), ?, ?, ?, ?, ?, ?)`,
+		n.UserID, n.Kind, n.ApplicationID, n.Title, n.Body, n.Link, inApp, digest, n.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+const notificationColumns = `id, user_id, kind, COALESCE(application_id, 0), title, body, link, read_at, created_at`
+
+func scanNotification(row interface{ Scan(...interface{}) error }) (models.Notification, error) {
+	var n models.Notification
+	err := row.Scan(&n.ID, &n.UserID, &n.Kind, &n.ApplicationID, &n.Title, &n.Body, &n.Link, &n.ReadAt, &n.CreatedAt)
+	return n, err
+}
+
+// GetNotifications lists the newest limit notifications in the user's
+// inbox, newest first.
+func GetNotifications(db *sql.DB, userID, limit int) ([]models.Notification, error) {
+	rows, err := db.Query(`SELECT `+notificationColumns+` FROM notifications
+        WHERE user_id = ? AND in_app = 1 ORDER BY id DESC LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []models.Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// GetNotification fetches one of the user's notifications, or returns
+// sql.ErrNoRows.
+func GetNotification(db *sql.DB, userID, id int) (*models.Notification, error) {
+	n, err := scanNotification(db.QueryRow(`SELECT `+notificationColumns+` FROM notifications
+        WHERE id = ? AND user_id = ? AND in_app = 1`, id, userID))
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// CountUnreadNotifications counts the unread notifications in the user's
+// inbox.
+func CountUnreadNotifications(db *sql.DB, userID int) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND in_app = 1 AND read_at IS NULL",
+		userID).Scan(&n)
+	return n, err
+}
+
+// MarkNotificationRead marks one of the user's notifications read.
+func MarkNotificationRead(db *sql.DB, userID, id int, now time.Time) error {
+	_, err := db.Exec("UPDATE notifications SET read_at = ? WHERE id = ? AND user_id = ? AND read_at IS NULL",
+		now, id, userID)
+	return err
+}
+
+// MarkAllNotificationsRead marks every notification in the user's inbox
+// read.
+func MarkAllNotificationsRead(db *sql.DB, userID int, now time.Time) error {
+	_, err := db.Exec("UPDATE notifications SET read_at = ? WHERE user_id = ? AND in_app = 1 AND read_at IS NULL",
+		now, userID)
+	return err
+}
+
+// GetNotificationPreference returns how the user wants to hear about kind,
+// falling back to the default for users who have not chosen.
+func GetNotificationPreference(db *sql.DB, userID int, kind string) (models.NotificationPreference, error) {
+	p := models.NotificationPreference{Kind: kind}
+	err := db.QueryRow("SELECT in_app, email, digest FROM notification_preferences WHERE user_id = ? AND kind = ?",
+		userID, kind).Scan(&p.InApp, &p.Email, &p.Digest)
+	if err == sql.ErrNoRows {
+		return models.DefaultNotificationPreference(kind), nil
+	}
+	return p, err
+}
+
+// GetNotificationPreferences returns the user's preference for every kind
+// of notification, including defaults for those not chosen.
+func GetNotificationPreferences(db *sql.DB, userID int) (map[string]models.NotificationPreference, error) {
+	prefs := map[string]models.NotificationPreference{}
+	for _, k := range models.NotificationKinds {
+		prefs[k.Kind] = models.DefaultNotificationPreference(k.Kind)
+	}
+	rows, err := db.Query("SELECT kind, in_app, email, digest FROM notification_preferences WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p models.NotificationPreference
+		if err := rows.Scan(&p.Kind, &p.InApp, &p.Email, &p.Digest); err != nil {
+			return nil, err
+		}
+		prefs[p.Kind] = p
+	}
+	return prefs, rows.Err()
+}
+
+// SaveNotificationPreferences replaces the user's choices for the given
+// kinds.
+func SaveNotificationPreferences(db *sql.DB, userID int, prefs []models.NotificationPreference) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range prefs {
+		_, err := tx.Exec(`INSERT INTO notification_preferences (user_id, kind, in_app, email, digest) VALUES (?, ?, ?, ?, ?)
+            ON CONFLICT(user_id, kind) DO UPDATE SET in_app = excluded.in_app, email = excluded.email, digest = excluded.digest`,
+			userID, p.Kind, p.InApp, p.Email, p.Digest)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,312 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+// dayLayout formats the effective dates of product rates.
+const dayLayout = "2006-01-02"
+
+// rowQuerier is satisfied by both *sql.DB and *sql.Tx.
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// GetProductRate returns the product's rate in effect on day, or 0.
+func GetProductRate(db *sql.DB, productID int, day time.Time) (float64, error) {
+	return productRateOn(db, productID, day)
+}
+
+func productRateOn(q rowQuerier, productID int, day time.Time) (float64, error) {
+	d := day.Format(dayLayout)
+	var rate float64
+	err := q.QueryRow(`SELECT rate FROM product_rates WHERE product_id = ? AND effective_from <= ?
+        AND (effective_to IS NULL OR effective_to >= ?) ORDER BY effective_from DESC LIMIT 1`, productID, d, d).Scan(&rate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return rate, err
+}
+
+// setProductRate puts rate in effect from from through to. When to is nil
+// the rate runs until the next one already scheduled after from, or until
+// replaced if there is none, so a change made today keeps next month's
+// rate. Rates scheduled within the period are dropped; the one in effect
+// before it ends the day before, and one running past its end resumes the
+// day after. History before from is never rewritten.
+func setProductRate(tx *sql.Tx, productID int, rate float64, from time.Time, to *time.Time, importID *int) error {
+	f := from.Format(dayLayout)
+	if to == nil {
+		var next sql.NullString
+		err := tx.QueryRow("SELECT MIN(effective_from) FROM product_rates WHERE product_id = ? AND effective_from > ?",
+			productID, f).Scan(&next)
+		if err != nil {
+			return err
+		}
+		if next.Valid {
+			day, err := parseDay(next.String)
+			if err != nil {
+				return err
+			}
+			end := day.AddDate(0, 0, -1)
+			to = &end
+		}
+	}
+
+	if to != nil {
+		t := to.Format(dayLayout)
+		_, err := tx.Exec(`INSERT INTO product_rates (product_id, rate, effective_from, effective_to, import_id)
+            SELECT product_id, rate, ?, effective_to, import_id FROM product_rates
+            WHERE product_id = ? AND effective_from <= ? AND (effective_to IS NULL OR effective_to > ?)`,
+			to.AddDate(0, 0, 1).Format(dayLayout), productID, t, t)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM product_rates WHERE product_id = ? AND effective_from >= ? AND effective_from <= ?", productID, f, t)
+		if err != nil {
+			return err
+		}
+	} else if _, err := tx.Exec("DELETE FROM product_rates WHERE product_id = ? AND effective_from >= ?", productID, f); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`UPDATE product_rates SET effective_to = ?
+        WHERE product_id = ? AND effective_from < ? AND (effective_to IS NULL OR effective_to >= ?)`,
+		from.AddDate(0, 0, -1).Format(dayLayout), productID, f, f)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO product_rates (product_id, rate, effective_from, effective_to, import_id) VALUES (?, ?, ?, ?, ?)",
+		productID, rate, f, formatDay(to), importID)
+	return err
+}
+
+// parseDay reads a date column as midnight local time.
+func parseDay(s string) (time.Time, error) {
+	return time.ParseInLocation(dayLayout, s, time.Local)
+}
+
+// parseOptionalDay reads a nullable date column.
+func parseOptionalDay(s sql.NullString) (*time.Time, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	t, err := parseDay(s.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func formatDay(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Format(dayLayout)
+}
+
+// GetRateSheetMapping returns the lender's rate sheet columns, or nil if
+// they have not been set up.
+func GetRateSheetMapping(db *sql.DB, lenderID int) (*models.RateSheetMapping, error) {
+	m := models.RateSheetMapping{LenderID: lenderID}
+	err := db.QueryRow(`SELECT sheet, product_column, rate_column, effective_from_column, effective_to_column
+        FROM rate_sheet_mappings WHERE lender_id = ?`, lenderID).
+		Scan(&m.Sheet, &m.ProductColumn, &m.RateColumn, &m.EffectiveFromColumn, &m.EffectiveToColumn)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// SaveRateSheetMapping creates or replaces a lender's rate sheet columns.
+func SaveRateSheetMapping(db *sql.DB, m *models.RateSheetMapping) error {
+	_, err := db.Exec(`INSERT INTO rate_sheet_mappings (lender_id, sheet, product_column, rate_column,
+            effective_from_column, effective_to_column, updated_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT(lender_id) DO UPDATE SET sheet = excluded.sheet, product_column = excluded.product_column,
+            rate_column = excluded.rate_column, effective_from_column = excluded.effective_from_column,
+            effective_to_column = excluded.effective_to_column, updated_at = excluded.updated_at`,
+		m.LenderID, m.Sheet, m.ProductColumn, m.RateColumn, m.EffectiveFromColumn, m.EffectiveToColumn, time.Now())
+	return err
+}
+
+// CreateRateImport stores a pending import and its rows, returning its ID.
+func CreateRateImport(db *sql.DB, imp *models.RateImport) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO rate_imports (lender_id, filename, source, status, created_by, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)`, imp.LenderID, imp.Filename, imp.Source, models.RateImportPending, imp.CreatedBy, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range imp.Rows {
+		_, err := tx.Exec(`INSERT INTO rate_import_rows (import_id, line, product_id, rate, effective_from, effective_to)
+            VALUES (?, ?, ?, ?, ?, ?)`, id, row.Line, row.ProductID, row.Rate, row.EffectiveFrom.Format(dayLayout), formatDay(row.EffectiveTo))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int(id), tx.Commit()
+}
+
+// GetRateImport fetches an import with its rows in sheet order. Rows not yet
+// applied are compared with the rates currently in effect on their start
+// dates.
+func GetRateImport(db *sql.DB, id int) (*models.RateImport, error) {
+	var imp models.RateImport
+	err := db.QueryRow(`SELECT i.id, i.lender_id, l.name, i.filename, i.source, i.status, i.created_by, i.created_at, i.applied_at
+        FROM rate_imports i JOIN lenders l ON l.id = i.lender_id WHERE i.id = ?`, id).
+		Scan(&imp.ID, &imp.LenderID, &imp.LenderName, &imp.Filename, &imp.Source, &imp.Status, &imp.CreatedBy,
+			&imp.CreatedAt, &imp.AppliedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT r.line, r.product_id, p.name, r.rate, r.effective_from, r.effective_to, r.previous_rate
+        FROM rate_import_rows r JOIN lender_products p ON p.id = r.product_id WHERE r.import_id = ? ORDER BY r.line`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row models.RateImportRow
+		var from string
+		var to sql.NullString
+		var previous sql.NullFloat64
+		if err := rows.Scan(&row.Line, &row.ProductID, &row.ProductName, &row.Rate, &from, &to, &previous); err != nil {
+			return nil, err
+		}
+		if row.EffectiveFrom, err = parseDay(from); err != nil {
+			return nil, err
+		}
+		if row.EffectiveTo, err = parseOptionalDay(to); err != nil {
+			return nil, err
+		}
+		row.PreviousRate = previous.Float64
+		imp.Rows = append(imp.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if imp.Status != models.RateImportApplied {
+		for i := range imp.Rows {
+			row := &imp.Rows[i]
+			if row.PreviousRate, err = productRateOn(db, row.ProductID, row.EffectiveFrom); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &imp, nil
+}
+
+// GetRateImports lists the most recent imports, newest first, without
+// their rows.
+func GetRateImports(db *sql.DB, limit int) ([]models.RateImport, error) {
+	rows, err := db.Query(`SELECT i.id, i.lender_id, l.name, i.filename, i.source, i.status, i.created_by, i.created_at, i.applied_at
+        FROM rate_imports i JOIN lenders l ON l.id = i.lender_id ORDER BY i.id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var imports []models.RateImport
+	for rows.Next() {
+		var imp models.RateImport
+		err := rows.Scan(&imp.ID, &imp.LenderID, &imp.LenderName, &imp.Filename, &imp.Source, &imp.Status,
+			&imp.CreatedBy, &imp.CreatedAt, &imp.AppliedAt)
+		if err != nil {
+			return nil, err
+		}
+		imports = append(imports, imp)
+	}
+	return imports, rows.Err()
+}
+
+// ApplyRateImport puts every rate of a pending import into effect, keeping
+// the rates they replace. It returns sql.ErrNoRows if the import is not
+// pending.
+func ApplyRateImport(db *sql.DB, id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	err = expectOneRow(tx.Exec("UPDATE rate_imports SET status = ?, applied_at = ? WHERE id = ? AND status = ?",
+		models.RateImportApplied, now, id, models.RateImportPending))
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT id, product_id, rate, effective_from, effective_to FROM rate_import_rows
+        WHERE import_id = ? ORDER BY line`, id)
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		rowID, productID int
+		rate             float64
+		from             time.Time
+		to               *time.Time
+	}
+	var all []pending
+	for rows.Next() {
+		var p pending
+		var from string
+		var to sql.NullString
+		if err := rows.Scan(&p.rowID, &p.productID, &p.rate, &from, &to); err != nil {
+			rows.Close()
+			return err
+		}
+		p.from, err = parseDay(from)
+		if err == nil {
+			p.to, err = parseOptionalDay(to)
+		}
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		all = append(all, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range all {
+		previous, err := productRateOn(tx, p.productID, p.from)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE rate_import_rows SET previous_rate = ? WHERE id = ?", previous, p.rowID); err != nil {
+			return err
+		}
+		if err := setProductRate(tx, p.productID, p.rate, p.from, p.to, &id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DiscardRateImport abandons a pending import. It returns sql.ErrNoRows if
+// the import is not pending.
+func DiscardRateImport(db *sql.DB, id int) error {
+	return expectOneRow(db.Exec("UPDATE rate_imports SET status = ? WHERE id = ? AND status = ?",
+		models.RateImportDiscarded, id, models.RateImportPending))
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// period is a product rate from one day to another, as offsets from a base
+// day; to is -1 while the rate runs until replaced.
+type period struct {
+	from, to int
+	rate     float64
+}
+
+func (p period) String() string { return fmt.Sprintf("%d..%d@%v", p.from, p.to, p.rate) }
+
+// productRates lists the product's rates in date order as periods from base.
+func productRates(t *testing.T, database *sql.DB, productID int, base time.Time) []period {
+	t.Helper()
+	rows, err := database.Query("SELECT rate, effective_from, effective_to FROM product_rates WHERE product_id = ? ORDER BY effective_from", productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	offset := func(s string) int {
+		d, err := parseDay(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return int(d.Sub(base).Hours()+12) / 24
+	}
+	var out []period
+	for rows.Next() {
+		var p period
+		var from string
+		var to sql.NullString
+		if err := rows.Scan(&p.rate, &from, &to); err != nil {
+			t.Fatal(err)
+		}
+		p.from, p.to = offset(from), -1
+		if to.Valid {
+			p.to = offset(to.String)
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func createTestProduct(t *testing.T, database *sql.DB) int {
+	t.Helper()
+	lenderID, err := CreateLender(database, "Northwind Bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := database.Exec(`INSERT INTO lender_products (lender_id, name, term_months, rate_type, max_ltv, max_gds, max_tds)
+        VALUES (?, '5 year fixed', 60, 'fixed', 0.95, 0.39, 0.44)`, lenderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id)
+}
+
+func TestSetProductRate(t *testing.T) {
+	base := time.Date(2026, 6, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		name     string
+		existing []period
+		set      period
+		want     []period
+	}{
+		{"first rate", nil,
+			period{5, -1, 2}, []period{{5, -1, 2}}},
+		{"replaces the current rate", []period{{0, -1, 1}},
+			period{5, -1, 2}, []period{{0, 4, 1}, {5, -1, 2}}},
+		{"runs until the next scheduled rate", []period{{0, 9, 1}, {10, -1, 3}},
+			period{5, -1, 2}, []period{{0, 4, 1}, {5, 9, 2}, {10, -1, 3}}},
+		{"replaces a rate starting the same day", []period{{0, 4, 1}, {5, 9, 3}, {10, -1, 4}},
+			period{5, -1, 2}, []period{{0, 4, 1}, {5, 9, 2}, {10, -1, 4}}},
+		{"within the current rate", []period{{0, -1, 1}},
+			period{5, 7, 2}, []period{{0, 4, 1}, {5, 7, 2}, {8, -1, 1}}},
+		{"over part of a scheduled rate", []period{{0, 9, 1}, {10, 19, 3}, {20, -1, 4}},
+			period{5, 12, 2}, []period{{0, 4, 1}, {5, 12, 2}, {13, 19, 3}, {20, -1, 4}}},
+		{"over a whole scheduled rate", []period{{0, 9, 1}, {10, 11, 3}, {12, -1, 4}},
+			period{5, 15, 2}, []period{{0, 4, 1}, {5, 15, 2}, {16, -1, 4}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := openTestDB(t)
+			productID := createTestProduct(t, database)
+			day := func(offset int) *time.Time {
+				if offset < 0 {
+					return nil
+				}
+				d := base.AddDate(0, 0, offset)
+				return &d
+			}
+			for _, p := range tt.existing {
+				_, err := database.Exec("INSERT INTO product_rates (product_id, rate, effective_from, effective_to) VALUES (?, ?, ?, ?)",
+					productID, p.rate, day(p.from).Format(dayLayout), formatDay(day(p.to)))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tx, err := database.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+			if err := setProductRate(tx, productID, tt.set.rate, *day(tt.set.from), day(tt.set.to), nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if got := productRates(t, database, productID, base); !slices.Equal(got, tt.want) {
+				t.Errorf("rates %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Editing a product's rate changes it from today without dropping rates a
+// sheet has scheduled for later.
+func TestSaveLenderProductKeepsScheduledRates(t *testing.T) {
+	database := openTestDB(t)
+	productID := createTestProduct(t, database)
+	now := time.Now()
+	// Offsets count from 30 days ago
+	base := time.Date(now.Year(), now.Month(), now.Day()-30, 0, 0, 0, 0, time.Local)
+	_, err := database.Exec(`INSERT INTO product_rates (product_id, rate, effective_from, effective_to) VALUES (?, 0.05, ?, ?), (?, 0.045, ?, NULL)`,
+		productID, base.Format(dayLayout), base.AddDate(0, 0, 39).Format(dayLayout), productID, base.AddDate(0, 0, 40).Format(dayLayout))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := GetLenderProduct(database, productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Rate = 0.055
+	if _, err := SaveLenderProduct(database, p); err != nil {
+		t.Fatal(err)
+	}
+	want := []period{{0, 29, 0.05}, {30, 39, 0.055}, {40, -1, 0.045}}
+	if got := productRates(t, database, productID, base); !slices.Equal(got, want) {
+		t.Errorf("rates %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+// GetPendingDocuments lists the IDs of the documents waiting for a virus
+// scan.
+func GetPendingDocuments(db *sql.DB) ([]int, error) {
+	rows, err := db.Query("SELECT id FROM documents WHERE scan_status = ? ORDER BY id", models.ScanPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SetDocumentScan records the scan of the file at filePath as uploaded with
+// document upToID. Earlier records of the same file share the result;
+// later ones are for a newer upload that replaced it and keep waiting for
+// their own scan.
+func SetDocumentScan(db *sql.DB, filePath string, upToID int, status, result string, now time.Time) error {
+	_, err := db.Exec(`UPDATE documents SET scan_status = ?, scan_result = ?, scanned_at = ?
+        WHERE file_path = ? AND id <= ? AND generated = 0`, status, result, now, filePath, upToID)
+	return err
+}
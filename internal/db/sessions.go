@@ -0,0 +1,49 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+// CreateSession stores a session keyed by the hash of its cookie value.
+// Expiry times are stored in UTC so they compare correctly as text.
+func CreateSession(db *sql.DB, s *models.Session) error {
+	_, err := db.Exec("INSERT INTO sessions (id_hash, user_id, csrf_token, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		s.IDHash, s.UserID, s.CSRFToken, s.ExpiresAt.UTC(), time.Now().UTC())
+	return err
+}
+
+// GetSession fetches an unexpired session by the hash of its cookie value.
+func GetSession(db *sql.DB, idHash string) (*models.Session, error) {
+	var s models.Session
+	var userID sql.NullInt64
+	row := db.QueryRow("SELECT id_hash, user_id, csrf_token, expires_at FROM sessions WHERE id_hash=? AND expires_at > ?", idHash, time.Now().UTC())
+	if err := row.Scan(&s.IDHash, &userID, &s.CSRFToken, &s.ExpiresAt); err != nil {
+		return nil, err
+	}
+	s.UserID = nullIntPtr(userID)
+	return &s, nil
+}
+
+// DeleteSession removes a single session.
+func DeleteSession(db *sql.DB, idHash string) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE id_hash=?", idHash)
+	return err
+}
+
+// DeleteUserSessions logs a user out everywhere, e.g. after a password reset.
+func DeleteUserSessions(db *sql.DB, userID int) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE user_id=?", userID)
+	return err
+}
+
+// DeleteExpiredSessions purges sessions past their expiry and returns how many were removed.
+func DeleteExpiredSessions(db *sql.DB, now time.Time) (int64, error) {
+	res, err := db.Exec("DELETE FROM sessions WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
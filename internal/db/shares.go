@@ -0,0 +1,133 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"MortgageAgent/internal/models"
+)
+
+// ErrShareUnavailable is returned when a share link can no longer be used.
+var ErrShareUnavailable = errors.New("share link unavailable")
+
+// CreateDocumentShare stores a share link and returns its ID. An empty
+// password leaves the link unprotected; a nil maxDownloads leaves it
+// unlimited. Expiry times are stored in UTC so they compare correctly as text.
+func CreateDocumentShare(db *sql.DB, documentID, createdBy int, recipient, password string, maxDownloads *int, expiresAt time.Time) (int, error) {
+	var passwordHash string
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return 0, err
+		}
+		passwordHash = string(hash)
+	}
+	res, err := db.Exec(`INSERT INTO document_shares (document_id, created_by, recipient, password_hash, max_downloads, expires_at, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		documentID, createdBy, recipient, passwordHash, maxDownloads, expiresAt.UTC(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+const documentShareColumns = `s.id, s.document_id, d.application_id, d.category, s.created_by, s.recipient, s.password_hash != '',
+        s.max_downloads, s.download_count, s.failed_attempts, s.expires_at, s.revoked_at, s.created_at`
+
+func scanDocumentShare(row interface{ Scan(...interface{}) error }) (*models.DocumentShare, error) {
+	var s models.DocumentShare
+	var maxDownloads sql.NullInt64
+	var revoked sql.NullTime
+	err := row.Scan(&s.ID, &s.DocumentID, &s.ApplicationID, &s.Category, &s.CreatedBy, &s.Recipient, &s.HasPassword,
+		&maxDownloads, &s.Downloads, &s.FailedAttempts, &s.ExpiresAt, &revoked, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.MaxDownloads = nullIntPtr(maxDownloads)
+	s.RevokedAt = nullTimePtr(revoked)
+	return &s, nil
+}
+
+// GetDocumentShare fetches a share link with its document's application.
+func GetDocumentShare(db *sql.DB, id int) (*models.DocumentShare, error) {
+	row := db.QueryRow("SELECT "+documentShareColumns+" FROM document_shares s JOIN documents d ON d.id = s.document_id WHERE s.id = ?", id)
+	return scanDocumentShare(row)
+}
+
+// GetSharesForApplication lists the share links for an application's
+// documents, newest first.
+func GetSharesForApplication(db *sql.DB, applicationID int) ([]models.DocumentShare, error) {
+	rows, err := db.Query("SELECT "+documentShareColumns+` FROM document_shares s JOIN documents d ON d.id = s.document_id
+        WHERE d.application_id = ? ORDER BY s.id DESC`, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []models.DocumentShare
+	for rows.Next() {
+		s, err := scanDocumentShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, *s)
+	}
+	return shares, rows.Err()
+}
+
+// RevokeDocumentShare stops a share link from being used again.
+func RevokeDocumentShare(db *sql.DB, id int) error {
+	_, err := db.Exec("UPDATE document_shares SET revoked_at=? WHERE id=? AND revoked_at IS NULL", time.Now(), id)
+	return err
+}
+
+// CheckSharePassword reports whether password opens the share link. Each
+// wrong password is counted, and the link locks after
+// models.MaxShareFailures of them.
+func CheckSharePassword(db *sql.DB, id int, password string) (bool, error) {
+	var hash string
+	if err := db.QueryRow("SELECT password_hash FROM document_shares WHERE id=?", id).Scan(&hash); err != nil {
+		return false, err
+	}
+	if hash == "" || bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+		return true, nil
+	}
+	_, err := db.Exec("UPDATE document_shares SET failed_attempts = failed_attempts + 1 WHERE id=?", id)
+	return false, err
+}
+
+// ClaimShareDownload counts one download against the share link. It fails
+// with ErrShareUnavailable if the link was revoked, expired, locked or used
+// up first, so concurrent requests cannot exceed the download limit.
+func ClaimShareDownload(db *sql.DB, id int, now time.Time) error {
+	res, err := db.Exec(`UPDATE document_shares SET download_count = download_count + 1
+        WHERE id=? AND revoked_at IS NULL AND expires_at > ? AND failed_attempts < ?
+        AND (max_downloads IS NULL OR download_count < max_downloads)`,
+		id, now.UTC(), models.MaxShareFailures)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return ErrShareUnavailable
+	}
+	return nil
+}
+
+// GetOrCreateSetting returns the value stored under key, first storing value
+// if the key is not set yet.
+func GetOrCreateSetting(db *sql.DB, key, value string) (string, error) {
+	if _, err := db.Exec("INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO NOTHING", key, value); err != nil {
+		return "", err
+	}
+	var stored string
+	err := db.QueryRow("SELECT value FROM settings WHERE key=?", key).Scan(&stored)
+	return stored, err
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func nullIntPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int64)
+	return &v
+}
+
+// CreateAPIToken stores a token by its hash and returns the new row's ID.
+// oauthClientID is nil for personal access tokens.
+func CreateAPIToken(db *sql.DB, userID int, oauthClientID *int, name, tokenHash, prefix string, scopes []string, expiresAt *time.Time) (int, error) {
+	res, err := db.Exec(`INSERT INTO api_tokens (user_id, oauth_client_id, name, token_hash, prefix, scopes, expires_at, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, oauthClientID, name, tokenHash, prefix, strings.Join(scopes, " "), expiresAt, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+const apiTokenColumns = "t.id, t.user_id, t.oauth_client_id, t.name, t.prefix, t.scopes, t.expires_at, t.last_used_at, t.revoked_at, t.created_at"
+
+func scanAPIToken(row interface{ Scan(...interface{}) error }) (*models.APIToken, error) {
+	var t models.APIToken
+	var clientID sql.NullInt64
+	var scopes string
+	var expires, lastUsed, revoked sql.NullTime
+	err := row.Scan(&t.ID, &t.UserID, &clientID, &t.Name, &t.Prefix, &scopes, &expires, &lastUsed, &revoked, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	t.OAuthClientID = nullIntPtr(clientID)
+	t.Scopes = strings.Fields(scopes)
+	t.ExpiresAt = nullTimePtr(expires)
+	t.LastUsedAt = nullTimePtr(lastUsed)
+	t.RevokedAt = nullTimePtr(revoked)
+	return &t, nil
+}
+
+// GetAPITokenByHash looks up a token by the hash of its secret. Tokens issued
+// to a revoked OAuth client are treated as missing.
+func GetAPITokenByHash(db *sql.DB, tokenHash string) (*models.APIToken, error) {
+	row := db.QueryRow(`SELECT `+apiTokenColumns+`
+        FROM api_tokens t
+        LEFT JOIN oauth_clients c ON c.id = t.oauth_client_id
+        WHERE t.token_hash = ? AND c.revoked_at IS NULL`, tokenHash)
+	return scanAPIToken(row)
+}
+
+// GetPersonalAPITokens lists the personal access tokens a user has created.
+func GetPersonalAPITokens(db *sql.DB, userID int) ([]models.APIToken, error) {
+	rows, err := db.Query(`SELECT `+apiTokenColumns+`
+        FROM api_tokens t
+        WHERE t.user_id = ? AND t.oauth_client_id IS NULL
+        ORDER BY t.created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+// TouchAPIToken records that a token was used. To avoid a write on every
+// request it only updates tokens not already marked within the last minute.
+func TouchAPIToken(db *sql.DB, id int, now time.Time) error {
+	_, err := db.Exec("UPDATE api_tokens SET last_used_at=? WHERE id=? AND (last_used_at IS NULL OR last_used_at < ?)",
+		now, id, now.Add(-time.Minute))
+	return err
+}
+
+// RevokeAPIToken revokes one of the user's personal access tokens.
+func RevokeAPIToken(db *sql.DB, userID, tokenID int) error {
+	_, err := db.Exec("UPDATE api_tokens SET revoked_at=? WHERE id=? AND user_id=? AND revoked_at IS NULL", time.Now(), tokenID, userID)
+	return err
+}
+
+// CreateOAuthClient stores a client-credentials client by the hash of its secret.
+func CreateOAuthClient(db *sql.DB, userID int, name, clientID, secretHash string, scopes []string) error {
+	_, err := db.Exec(`INSERT INTO oauth_clients (user_id, name, client_id, secret_hash, scopes, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, name, clientID, secretHash, strings.Join(scopes, " "), time.Now())
+	return err
+}
+
+// GetOAuthClient fetches an active client and its secret hash by client ID.
+func GetOAuthClient(db *sql.DB, clientID string) (*models.OAuthClient, string, error) {
+	var c models.OAuthClient
+	var scopes, secretHash string
+	row := db.QueryRow(`SELECT id, user_id, name, client_id, secret_hash, scopes, created_at
+        FROM oauth_clients WHERE client_id = ? AND revoked_at IS NULL`, clientID)
+	err := row.Scan(&c.ID, &c.UserID, &c.Name, &c.ClientID, &secretHash, &scopes, &c.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+	c.Scopes = strings.Fields(scopes)
+	return &c, secretHash, nil
+}
+
+// GetOAuthClientsForUser lists the service accounts a user has created.
+func GetOAuthClientsForUser(db *sql.DB, userID int) ([]models.OAuthClient, error) {
+	rows, err := db.Query(`SELECT id, user_id, name, client_id, scopes, revoked_at, created_at
+        FROM oauth_clients WHERE user_id = ? ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []models.OAuthClient
+	for rows.Next() {
+		var c models.OAuthClient
+		var scopes string
+		var revoked sql.NullTime
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.ClientID, &scopes, &revoked, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		c.Scopes = strings.Fields(scopes)
+		c.RevokedAt = nullTimePtr(revoked)
+		clients = append(clients, c)
+	}
+	return clients, rows.Err()
+}
+
+// RevokeOAuthClient revokes one of the user's clients. Tokens it was issued
+// stop working immediately because GetAPITokenByHash checks the client.
+func RevokeOAuthClient(db *sql.DB, userID, id int) error {
+	_, err := db.Exec("UPDATE oauth_clients SET revoked_at=? WHERE id=? AND user_id=? AND revoked_at IS NULL", time.Now(), id, userID)
+	return err
+}
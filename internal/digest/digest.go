@@ -0,0 +1,168 @@
+// Package digest emails admins and brokers a daily or weekly summary of
+// their applications in place of many separate emails.
+package digest
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"text/template"
+	"time"
+
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/mail"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/notify"
+	"MortgageAgent/internal/render"
+	"MortgageAgent/internal/templates"
+)
+
+var emailTemplate = template.Must(template.New("digest.txt").
+	Funcs(template.FuncMap(render.Funcs)).ParseFS(templates.FS, "email/digest.txt"))
+
+// Config controls when digests are sent and what they include.
+type Config struct {
+	// BaseURL starts the links in each digest.
+	BaseURL string
+	// Hour is the local hour from which the day's digests are sent.
+	Hour int
+	// StalledDays is how long an application under review may go without
+	// activity before it is listed as stalled.
+	StalledDays int
+	// WarnDays is how close to expiry rate holds are listed.
+	WarnDays int
+}
+
+// Digest is one user's summary, as rendered by email/digest.txt.
+type Digest struct {
+	User          models.User
+	Admin         bool
+	Frequency     string
+	Since         time.Time
+	BaseURL       string
+	WarnDays      int
+	StalledDays   int
+	Assignments   []models.DigestApplication
+	Overdue       []models.DigestCondition
+	ExpiringHolds []models.RateHold
+	Stalled       []models.DigestApplication
+	Notifications []models.Notification
+}
+
+// Empty reports whether the digest has nothing to say, in which case it is
+// not sent.
+func (d *Digest) Empty() bool {
+	return len(d.Assignments)+len(d.Overdue)+len(d.ExpiringHolds)+len(d.Stalled)+len(d.Notifications) == 0
+}
+
+// Link is the address of an application's page for the digest's user.
+func (d *Digest) Link(applicationID int) string {
+	return d.BaseURL + notify.ApplicationLink(d.User.UserType, applicationID)
+}
+
+// Run sends every digest due at now and returns how many were emailed.
+// Daily digests cover each day and weekly ones each ISO week; a
+// digest_sends row is claimed before each is built, so restarts and
+// overlapping runs never send one twice. A digest that fails to send is
+// released and retried on the next run. Nothing is claimed while email is
+// disabled, so the digests go out once it is set up.
+func Run(database *sql.DB, cfg Config, now time.Time) (int, error) {
+	if now.Hour() < cfg.Hour || !mail.Enabled() {
+		return 0, nil
+	}
+	year, week := now.ISOWeek()
+	due := []struct {
+		frequency, period string
+		span              time.Duration
+	}{
+		{models.DigestDaily, now.Format("2006-01-02"), 24 * time.Hour},
+		{models.DigestWeekly, fmt.Sprintf("%d-W%02d", year, week), 7 * 24 * time.Hour},
+	}
+
+	sent := 0
+	for _, d := range due {
+		users, err := db.GetDigestRecipients(database, d.frequency)
+		if err != nil {
+			return sent, err
+		}
+		for _, u := range users {
+			claimed, err := db.ClaimDigest(database, u.ID, d.frequency, d.period, now)
+			if err != nil {
+				return sent, err
+			}
+			if !claimed {
+				continue
+			}
+			since, err := db.GetLastDigest(database, u.ID, d.frequency, d.period)
+			if err != nil {
+				return sent, err
+			}
+			if since.IsZero() {
+				since = now.Add(-d.span)
+			}
+
+			digest, err := build(database, cfg, u, d.frequency, since, now)
+			if err == nil && !digest.Empty() {
+				err = send(digest)
+			}
+			if err != nil {
+				slog.Error("Error sending digest", "user_id", u.ID, "frequency", d.frequency, "err", err)
+				if err := db.ReleaseDigest(database, u.ID, d.frequency, d.period); err != nil {
+					return sent, err
+				}
+				continue
+			}
+			if n := len(digest.Notifications); n > 0 {
+				if err := db.MarkNotificationsDigested(database, u.ID, digest.Notifications[n-1].ID, now); err != nil {
+					return sent, err
+				}
+			}
+			if !digest.Empty() {
+				sent++
+			}
+		}
+	}
+	return sent, nil
+}
+
+// build gathers what goes into user's digest covering since to now.
+func build(database *sql.DB, cfg Config, user models.User, frequency string, since, now time.Time) (*Digest, error) {
+	admin := user.UserType == "admin"
+	d := &Digest{
+		User: user, Admin: admin, Frequency: frequency, Since: since, BaseURL: cfg.BaseURL,
+		WarnDays: cfg.WarnDays, StalledDays: cfg.StalledDays,
+	}
+	y, m, day := now.Date()
+	today := time.Date(y, m, day, 0, 0, 0, 0, time.Local)
+
+	var err error
+	if d.Assignments, err = db.GetDigestAssignments(database, user.ID, admin, since); err != nil {
+		return nil, err
+	}
+	if d.Overdue, err = db.GetOverdueCommitmentConditions(database, user.ID, admin, today); err != nil {
+		return nil, err
+	}
+	if d.ExpiringHolds, err = db.GetExpiringRateHolds(database, user.ID, admin, today, today.AddDate(0, 0, cfg.WarnDays)); err != nil {
+		return nil, err
+	}
+	if d.Stalled, err = db.GetStalledApplications(database, user.ID, admin, now.AddDate(0, 0, -cfg.StalledDays)); err != nil {
+		return nil, err
+	}
+	if d.Notifications, err = db.GetDigestNotifications(database, user.ID); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// send renders the digest and emails it.
+func send(d *Digest) error {
+	var subject, body bytes.Buffer
+	if err := emailTemplate.ExecuteTemplate(&subject, "subject", d); err != nil {
+		return err
+	}
+	if err := emailTemplate.ExecuteTemplate(&body, "digest", d); err != nil {
+		return err
+	}
+	return mail.Send(d.User.Email, subject.String(), body.String())
+}
@@ -0,0 +1,206 @@
+package digest
+
+import (
+	"bufio"
+	"database/sql"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/mail"
+	"MortgageAgent/internal/models"
+)
+
+// smtpServer accepts mail on a local port, or refuses every recipient while
+// reject is set, and counts the messages delivered.
+type smtpServer struct {
+	addr string
+
+	mu       sync.Mutex
+	reject   bool
+	messages int
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := &smtpServer{addr: l.Addr().String()}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.Fields(line + " x")[0]); cmd {
+		case "RCPT":
+			s.mu.Lock()
+			reject := s.reject
+			s.mu.Unlock()
+			if reject {
+				reply("550 mailbox unavailable")
+			} else {
+				reply("250 ok")
+			}
+		case "DATA":
+			reply("354 end with .")
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+			}
+			s.mu.Lock()
+			s.messages++
+			s.mu.Unlock()
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *smtpServer) sent() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messages
+}
+
+func (s *smtpServer) setReject(reject bool) {
+	s.mu.Lock()
+	s.reject = reject
+	s.mu.Unlock()
+}
+
+func (s *smtpServer) configure(t *testing.T) {
+	host, port, _ := net.SplitHostPort(s.addr)
+	mail.Configure(mail.Config{Host: host, Port: port, From: "noreply@example.com"})
+	t.Cleanup(func() { mail.Configure(mail.Config{}) })
+}
+
+// newDigestDB returns a database with one broker, who takes the daily
+// digest, and a notification kept for it.
+func newDigestDB(t *testing.T) (*sql.DB, int) {
+	t.Helper()
+	database, err := db.InitDB(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := db.MigrateDB(database); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateUser(database, "Bo", "Broker", "bo@example.com", "", "", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.GetUserByEmail(database, "bo@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := models.Notification{UserID: user.ID, Kind: models.NotifyRateHold, Title: "Rate hold expiring", Link: "/"}
+	if _, err := db.CreateNotification(database, &n, false, true); err != nil {
+		t.Fatal(err)
+	}
+	return database, user.ID
+}
+
+func undigested(t *testing.T, database *sql.DB, userID int) int {
+	t.Helper()
+	notifications, err := db.GetDigestNotifications(database, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(notifications)
+}
+
+func TestRunSendsEachDigestOnce(t *testing.T) {
+	smtp := newSMTPServer(t)
+	smtp.configure(t)
+	database, userID := newDigestDB(t)
+	cfg := Config{BaseURL: "https://example.com", Hour: 7, StalledDays: 14, WarnDays: 5}
+	day := time.Date(2026, 6, 15, 0, 0, 0, 0, time.Local)
+	run := func(at time.Time) int {
+		t.Helper()
+		n, err := Run(database, cfg, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if n := run(day.Add(6 * time.Hour)); n != 0 || smtp.sent() != 0 {
+		t.Errorf("before the hour: %d sent, %d delivered", n, smtp.sent())
+	}
+
+	// A digest that fails to send is released and its notifications kept
+	smtp.setReject(true)
+	if n := run(day.Add(7 * time.Hour)); n != 0 || undigested(t, database, userID) != 1 {
+		t.Errorf("rejected: %d sent, %d notifications left", n, undigested(t, database, userID))
+	}
+
+	smtp.setReject(false)
+	if n := run(day.Add(8 * time.Hour)); n != 1 || smtp.sent() != 1 || undigested(t, database, userID) != 0 {
+		t.Errorf("retried: %d sent, %d delivered, %d notifications left", n, smtp.sent(), undigested(t, database, userID))
+	}
+
+	// Later runs that day, as after a restart, find the digest claimed
+	for _, at := range []time.Time{day.Add(8 * time.Hour), day.Add(9 * time.Hour), day.Add(23 * time.Hour)} {
+		if n := run(at); n != 0 {
+			t.Errorf("%v: sent %d again", at, n)
+		}
+	}
+	if smtp.sent() != 1 {
+		t.Errorf("%d delivered, want 1", smtp.sent())
+	}
+}
+
+// While email is disabled nothing is claimed or marked sent, so the digest
+// goes out once it is set up.
+func TestRunWithEmailDisabled(t *testing.T) {
+	mail.Configure(mail.Config{})
+	database, userID := newDigestDB(t)
+	cfg := Config{BaseURL: "https://example.com", Hour: 7, StalledDays: 14, WarnDays: 5}
+	at := time.Date(2026, 6, 15, 8, 0, 0, 0, time.Local)
+
+	if n, err := Run(database, cfg, at); err != nil || n != 0 {
+		t.Fatalf("Run = %d, %v", n, err)
+	}
+	if left := undigested(t, database, userID); left != 1 {
+		t.Errorf("%d notifications left, want 1", left)
+	}
+
+	smtp := newSMTPServer(t)
+	smtp.configure(t)
+	if n, err := Run(database, cfg, at.Add(time.Hour)); err != nil || n != 1 || smtp.sent() != 1 {
+		t.Errorf("Run once enabled = %d, %v with %d delivered", n, err, smtp.sent())
+	}
+}
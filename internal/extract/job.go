@@ -0,0 +1,76 @@
+package extract
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/jobs"
+	"MortgageAgent/internal/models"
+)
+
+// Kind is the kind of job that extracts one document.
+const Kind = "document_extract"
+
+type payload struct {
+	DocumentID int `json:"document_id"`
+}
+
+// Supports reports whether documents in category are extracted.
+func Supports(category string) bool {
+	return category == "Proof_of_income"
+}
+
+// Enqueue queues extraction of the document.
+func Enqueue(database *sql.DB, documentID int) error {
+	_, err := jobs.Enqueue(database, Kind, payload{DocumentID: documentID},
+		jobs.Options{UniqueKey: "extract:document:" + strconv.Itoa(documentID)})
+	return err
+}
+
+// Document is the handler for Kind jobs. Only documents that passed their
+// virus scan are read. A failure is recorded so the admin knows to enter
+// the figures by hand, and retried unless the file type is unsupported.
+func Document(database *sql.DB) jobs.Handler {
+	return func(ctx context.Context, data []byte) error {
+		var p payload
+		if err := json.Unmarshal(data, &p); err != nil {
+			return jobs.Permanent(err)
+		}
+		doc, err := db.GetDocumentByID(database, p.DocumentID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !doc.Clean() {
+			return nil
+		}
+
+		e := &models.DocumentExtraction{DocumentID: doc.ID, ExtractedAt: time.Now()}
+		lines, engine, err := Read(ctx, doc.FilePath)
+		e.Engine = engine
+		if err != nil {
+			// The job's last error keeps the details
+			e.DocType, e.Status, e.Error = models.DocUnknown, models.ExtractionFailed, "The text could not be recognised."
+			if errors.Is(err, ErrUnsupported) {
+				e.Error = "The file type cannot be read."
+			}
+			if serr := db.SaveExtraction(database, e); serr != nil {
+				return serr
+			}
+			if errors.Is(err, ErrUnsupported) {
+				return nil
+			}
+			return err
+		}
+		e.Status = models.ExtractionDone
+		e.DocType, e.Fields = Parse(lines)
+		return db.SaveExtraction(database, e)
+	}
+}
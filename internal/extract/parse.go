@@ -0,0 +1,276 @@
+package extract
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/models"
+)
+
+// months matches the names of the months and their abbreviations.
+const months = `(?:jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)`
+
+var (
+	moneyRe = regexp.MustCompile(`(\$\s*)?\b(\d{1,3}(?:,\d{3})+(?:\.\d{2})?|\d+(?:\.\d{2})?)\b`)
+	yearRe  = regexp.MustCompile(`\b(19[89]\d|20\d\d)\b`)
+	// A year follows a word such as "year" or a month, or is part of a date
+	// such as 2024-01-15 or 15/01/2024
+	yearBeforeRe = regexp.MustCompile(`(?i)(?:\b(?:tax year|year|yr|period|ending|ended|as of|as at|` + months + `\.?(?:\s+\d{1,2},?)?)[\s:,]*|\d[-/.])$`)
+	yearAfterRe  = regexp.MustCompile(`(?i)^(?:[-/.]\d|\s*(?:tax year|notice of assessment|t4)\b)`)
+	// payWordRe matches the words on a pay stub's lines of figures, which are
+	// never the employer's name
+	payWordRe = regexp.MustCompile(`(?i)\b(?:pay\w*|paid|earnings?|statement|stub|employee|gross|net|ytd|year[- ]to[- ]date|period|hours?|rate|deductions?|salary|wages?|income|total|amount)\b`)
+	labelRe   = regexp.MustCompile(`(?i)^(?:employer(?:'s)?(?: name)?|company(?: name)?)\s*[:\-]?\s*`)
+	t4NameRe  = regexp.MustCompile(`(?i)employer'?s? name\s*(?:[-/]\s*nom de l'employeur)?\s*[:\-]?\s*`)
+	isoRe     = regexp.MustCompile(`\b(\d{4}-\d{2}-\d{2})\b`)
+	t4Re      = regexp.MustCompile(`(?i)\bT4\b`)
+	box14Re   = regexp.MustCompile(`(?i)\b(?:box\s*)?14\b`)
+	noaLineRe = regexp.MustCompile(`\b15000\b|\bline 150\b`)
+)
+
+// frequencies maps the words a pay stub uses for how often it is paid to
+// the pay period shown, most specific first.
+var frequencies = []struct{ word, period string }{
+	{"semi-monthly", "Semi-monthly"},
+	{"semimonthly", "Semi-monthly"},
+	{"bi-weekly", "Bi-weekly"},
+	{"biweekly", "Bi-weekly"},
+	{"every two weeks", "Bi-weekly"},
+	{"weekly", "Weekly"},
+	{"monthly", "Monthly"},
+}
+
+// Classify tells which kind of income document the text is from.
+func Classify(lines []Line) string {
+	text := strings.ToLower(joinText(lines))
+	switch {
+	case strings.Contains(text, "notice of assessment") || strings.Contains(text, "avis de cotisation"):
+		return models.DocNOA
+	case strings.Contains(text, "statement of remuneration paid") ||
+		t4Re.MatchString(text) && strings.Contains(text, "employment income"):
+		return models.DocT4
+	case strings.Contains(text, "gross") && containsAny(text, "net pay", "pay period", "pay date", "earnings statement", "pay stub", "ytd", "year to date"):
+		return models.DocPayStub
+	}
+	return models.DocUnknown
+}
+
+// Parse classifies the text and reads the fields of its document type.
+// Every field of the type is returned, with no value and no confidence if
+// it was not found, so the admin can fill it in.
+func Parse(lines []Line) (string, []models.ExtractedField) {
+	docType := Classify(lines)
+	found := fields{}
+	switch docType {
+	case models.DocPayStub:
+		parsePayStub(lines, found, 1)
+	case models.DocT4:
+		parseT4(lines, found)
+	case models.DocNOA:
+		parseNOA(lines, found)
+	default:
+		// Guess, but flag everything for checking
+		parsePayStub(lines, found, 0.5)
+		taxYear(lines, found, 0.5)
+	}
+
+	var out []models.ExtractedField
+	for _, name := range models.ExtractionFields[docType] {
+		f := found[name]
+		f.Name = name
+		f.ExtractedValue = f.Value
+		out = append(out, f)
+	}
+	return docType, out
+}
+
+// fields holds the best candidate found for each field.
+type fields map[string]models.ExtractedField
+
+// offer keeps value for the field if it is more confident than what was
+// found before.
+func (fs fields) offer(name, value string, confidence float64) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	if f, ok := fs[name]; ok && f.Confidence >= confidence {
+		return
+	}
+	fs[name] = models.ExtractedField{Name: name, Value: value, Confidence: confidence}
+}
+
+func parsePayStub(lines []Line, found fields, weight float64) {
+	for i, l := range lines {
+		lower := strings.ToLower(l.Text)
+		amounts := money(l.Text)
+		ytd := containsAny(lower, "ytd", "year to date", "year-to-date")
+
+		if m := labelRe.FindStringIndex(l.Text); m != nil && m[1] < len(l.Text) {
+			found.offer(models.FieldEmployer, l.Text[m[1]:], l.Confidence*weight)
+		} else if i < 3 && !strings.ContainsAny(l.Text, "0123456789") && !payWordRe.MatchString(l.Text) && hasLetters(l.Text) {
+			// Pay stubs usually open with the employer's name
+			found.offer(models.FieldEmployer, l.Text, l.Confidence*0.5*weight)
+		}
+
+		if strings.Contains(lower, "gross") && len(amounts) > 0 {
+			if ytd && len(amounts) == 1 {
+				found.offer(models.FieldYTDGross, amounts[0], l.Confidence*weight)
+			} else {
+				found.offer(models.FieldGrossPay, amounts[0], l.Confidence*weight)
+				// A current column followed by a year-to-date one
+				if len(amounts) > 1 {
+					found.offer(models.FieldYTDGross, amounts[len(amounts)-1], l.Confidence*0.8*weight)
+				}
+			}
+		}
+
+		label := containsAny(lower, "pay period", "pay frequency", "frequency")
+		for _, f := range frequencies {
+			if strings.Contains(lower, f.word) {
+				c := 0.7
+				if label {
+					c = 1
+				}
+				found.offer(models.FieldPayPeriod, f.period, l.Confidence*c*weight)
+				break
+			}
+		}
+		if label {
+			if period := periodFromDates(l.Text); period != "" {
+				found.offer(models.FieldPayPeriod, period, l.Confidence*0.6*weight)
+			}
+		}
+	}
+}
+
+func parseT4(lines []Line, found fields) {
+	found.offer(models.FieldPayPeriod, "Annual", 1)
+	for i, l := range lines {
+		lower := strings.ToLower(l.Text)
+		// The name follows the box label, on the same line or the next
+		if m := t4NameRe.FindStringIndex(l.Text); m != nil {
+			if m[1] < len(l.Text) {
+				found.offer(models.FieldEmployer, l.Text[m[1]:], l.Confidence)
+			} else if i+1 < len(lines) {
+				found.offer(models.FieldEmployer, lines[i+1].Text, lines[i+1].Confidence*0.8)
+			}
+		}
+		if amounts := money(l.Text); len(amounts) > 0 {
+			switch {
+			case strings.Contains(lower, "employment income"):
+				found.offer(models.FieldGrossPay, amounts[len(amounts)-1], l.Confidence)
+			case box14Re.MatchString(l.Text):
+				found.offer(models.FieldGrossPay, amounts[len(amounts)-1], l.Confidence*0.8)
+			}
+		}
+	}
+	taxYear(lines, found, 1)
+}
+
+func parseNOA(lines []Line, found fields) {
+	found.offer(models.FieldPayPeriod, "Annual", 1)
+	for _, l := range lines {
+		lower := strings.ToLower(l.Text)
+		if !strings.Contains(lower, "total income") && !noaLineRe.MatchString(lower) {
+			continue
+		}
+		// Skip the line number itself when reading the amount
+		var amounts []string
+		for _, a := range money(l.Text) {
+			if a != "15000" {
+				amounts = append(amounts, a)
+			}
+		}
+		if len(amounts) > 0 {
+			found.offer(models.FieldGrossPay, amounts[len(amounts)-1], l.Confidence)
+		}
+	}
+	taxYear(lines, found, 1)
+}
+
+// taxYear finds the year a T4 or NOA is for: the year on a line that says
+// so, or failing that the first year mentioned.
+func taxYear(lines []Line, found fields, weight float64) {
+	for _, l := range lines {
+		year := yearRe.FindString(l.Text)
+		if year == "" {
+			continue
+		}
+		lower := strings.ToLower(l.Text)
+		if containsAny(lower, "tax year", "year", "notice of assessment", "for the") {
+			found.offer(models.FieldTaxYear, year, l.Confidence*weight)
+		} else {
+			found.offer(models.FieldTaxYear, year, l.Confidence*0.5*weight)
+		}
+	}
+}
+
+// money returns the amounts on a line, without dollar signs or commas. A
+// number with no dollar sign, comma or cents needs at least four digits to
+// count, and is taken for a year instead if it is one in a date or after a
+// word such as "year".
+func money(text string) []string {
+	var out []string
+	for _, m := range moneyRe.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[4], m[5]
+		amount := text[start:end]
+		if m[2] < 0 && !strings.ContainsAny(amount, ",.") {
+			if len(amount) < 4 {
+				continue
+			}
+			if yearRe.MatchString(amount) && (yearBeforeRe.MatchString(text[:start]) || yearAfterRe.MatchString(text[end:])) {
+				continue
+			}
+		}
+		out = append(out, strings.ReplaceAll(amount, ",", ""))
+	}
+	return out
+}
+
+// periodFromDates names the pay period between the first two dates on a
+// line, such as "2024-01-01 to 2024-01-14".
+func periodFromDates(text string) string {
+	dates := isoRe.FindAllString(text, 2)
+	if len(dates) < 2 {
+		return ""
+	}
+	from, err1 := time.Parse("2006-01-02", dates[0])
+	to, err2 := time.Parse("2006-01-02", dates[1])
+	if err1 != nil || err2 != nil {
+		return ""
+	}
+	switch days := int(to.Sub(from).Hours()/24) + 1; {
+	case days >= 6 && days <= 7:
+		return "Weekly"
+	case days >= 13 && days <= 14:
+		return "Bi-weekly"
+	case days >= 15 && days <= 16:
+		return "Semi-monthly"
+	case days >= 28 && days <= 31:
+		return "Monthly"
+	}
+	return ""
+}
+
+func joinText(lines []Line) string {
+	texts := make([]string, len(lines))
+	for i, l := range lines {
+		texts[i] = l.Text
+	}
+	return strings.Join(texts, "\n")
+}
+
+func containsAny(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasLetters(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' }) >= 0
+}
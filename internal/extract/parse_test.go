@@ -0,0 +1,201 @@
+package extract
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"MortgageAgent/internal/models"
+)
+
+// ocr splits text into lines as the recogniser returns them.
+func ocr(text string) []Line {
+	var lines []Line
+	for _, t := range strings.Split(strings.TrimSpace(text), "\n") {
+		lines = append(lines, Line{Text: strings.TrimSpace(t), Confidence: 0.9})
+	}
+	return lines
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		wantType string
+		want     map[string]string
+	}{
+		{
+			name: "pay stub",
+			text: `
+				ACME WIDGETS LTD
+				Earnings Statement
+				Employee: Jane Doe
+				Pay Period: 2024-01-01 to 2024-01-14
+				Pay Date: 2024-01-19
+				Gross Pay $3,200.00 YTD $6,400.00
+				Net Pay $2,450.10`,
+			wantType: models.DocPayStub,
+			want: map[string]string{
+				models.FieldEmployer: "ACME WIDGETS LTD", models.FieldGrossPay: "3200.00",
+				models.FieldPayPeriod: "Bi-weekly", models.FieldYTDGross: "6400.00",
+			},
+		},
+		{
+			name: "labelled employer and year-to-date line",
+			text: `
+				Statement of Earnings
+				Employer: Northwind Traders Inc.
+				Pay frequency: Semi-monthly
+				Gross earnings 2,750.00 4,125.50
+				Gross year to date 5,500.00`,
+			wantType: models.DocPayStub,
+			want: map[string]string{
+				models.FieldEmployer: "Northwind Traders Inc.", models.FieldGrossPay: "2750.00",
+				models.FieldPayPeriod: "Semi-monthly", models.FieldYTDGross: "5500.00",
+			},
+		},
+		{
+			// Amounts that look like years, with no employer to be found
+			name: "whole-dollar amounts like years",
+			text: `
+				Pay Stub
+				Gross 2000 YTD 2000
+				Net pay 1650
+				Paid weekly`,
+			wantType: models.DocPayStub,
+			want: map[string]string{
+				models.FieldGrossPay: "2000", models.FieldPayPeriod: "Weekly", models.FieldYTDGross: "2000",
+			},
+		},
+		{
+			name: "whole dollars under a thousand",
+			text: `
+				Corner Cafe
+				Pay date Jan 15, 2024
+				Gross pay $950 YTD $1,900
+				Net pay $812`,
+			wantType: models.DocPayStub,
+			want: map[string]string{
+				models.FieldEmployer: "Corner Cafe", models.FieldGrossPay: "950", models.FieldYTDGross: "1900",
+			},
+		},
+		{
+			name: "year in the gross line",
+			text: `
+				Fabrikam Foods
+				Gross pay, period ending 2024-03-15: 1,500.00 YTD 9,000.00
+				Net pay 1,100.00`,
+			wantType: models.DocPayStub,
+			want: map[string]string{
+				models.FieldEmployer: "Fabrikam Foods", models.FieldGrossPay: "1500.00", models.FieldYTDGross: "9000.00",
+			},
+		},
+		{
+			name: "T4",
+			text: `
+				Canada Revenue Agency
+				T4 Statement of Remuneration Paid
+				Year 2023
+				Employer's name - Nom de l'employeur
+				Contoso Manufacturing Inc.
+				14 Employment income 58,250.75
+				22 Income tax deducted 9,120.33`,
+			wantType: models.DocT4,
+			want: map[string]string{
+				models.FieldEmployer: "Contoso Manufacturing Inc.", models.FieldGrossPay: "58250.75",
+				models.FieldPayPeriod: "Annual", models.FieldTaxYear: "2023",
+			},
+		},
+		{
+			name: "T4 in whole dollars",
+			text: `
+				T4 2022
+				Employer's name: Tailspin Toys
+				Box 14 Employment income 2000`,
+			wantType: models.DocT4,
+			want: map[string]string{
+				models.FieldEmployer: "Tailspin Toys", models.FieldGrossPay: "2000",
+				models.FieldPayPeriod: "Annual", models.FieldTaxYear: "2022",
+			},
+		},
+		{
+			name: "notice of assessment",
+			text: `
+				Notice of Assessment
+				Tax year 2023
+				Date issued: April 30, 2024
+				Line 15000 Total income 85,000.00
+				Line 26000 Taxable income 80,500.00`,
+			wantType: models.DocNOA,
+			want: map[string]string{
+				models.FieldGrossPay: "85000.00", models.FieldPayPeriod: "Annual", models.FieldTaxYear: "2023",
+			},
+		},
+		{
+			name: "notice of assessment in whole dollars",
+			text: `
+				2022 Notice of Assessment
+				Total income 15000 $72,000`,
+			wantType: models.DocNOA,
+			want: map[string]string{
+				models.FieldGrossPay: "72000", models.FieldPayPeriod: "Annual", models.FieldTaxYear: "2022",
+			},
+		},
+		{
+			name:     "unknown",
+			text:     "Dear customer,\nThank you for your order.",
+			wantType: models.DocUnknown,
+			want:     map[string]string{models.FieldEmployer: "Dear customer,"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docType, fields := Parse(ocr(tt.text))
+			if docType != tt.wantType {
+				t.Fatalf("type %q, want %q", docType, tt.wantType)
+			}
+			var names []string
+			for _, f := range fields {
+				names = append(names, f.Name)
+				if f.Value != tt.want[f.Name] {
+					t.Errorf("%s = %q, want %q", f.Name, f.Value, tt.want[f.Name])
+				}
+				if f.ExtractedValue != f.Value || (f.Value == "") != (f.Confidence == 0) {
+					t.Errorf("%s: extracted %q with confidence %v", f.Name, f.ExtractedValue, f.Confidence)
+				}
+			}
+			if !slices.Equal(names, models.ExtractionFields[docType]) {
+				t.Errorf("fields %v, want %v", names, models.ExtractionFields[docType])
+			}
+		})
+	}
+}
+
+func TestMoney(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Gross 2000 YTD 2000", []string{"2000", "2000"}},
+		{"Gross pay $950", []string{"950"}},
+		{"$ 1,234.56 and 3,000", []string{"1234.56", "3000"}},
+		{"Net 812.40", []string{"812.40"}},
+		{"Year to date 2000", []string{"2000"}},
+		{"Hours 80 Rate 25", nil},
+		{"Box 14, page 1 of 2", nil},
+		{"Line 15000 total 52000", []string{"15000", "52000"}},
+		{"Period 2024-01-01 to 2024-01-14 1,500.00", []string{"1500.00"}},
+		{"Paid 01/15/2024 $2,024", []string{"2024"}},
+		{"Tax year 2023 income 2023", []string{"2023"}},
+		{"For January 2024: 2024", []string{"2024"}},
+		{"Issued March 3, 2024", nil},
+		{"2023 T4 slip", nil},
+		{"Gross 19,990 Bonus 1990", []string{"19990", "1990"}},
+		{"Account 12345X", nil},
+	}
+	for _, tt := range tests {
+		if got := money(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("money(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
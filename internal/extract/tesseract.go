@@ -0,0 +1,122 @@
+package extract
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// imageTypes are the file extensions Tesseract reads directly.
+var imageTypes = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".tif": true, ".tiff": true, ".bmp": true, ".gif": true, ".webp": true,
+}
+
+// Tesseract recognises text with the tesseract command, rasterising PDFs
+// with pdftoppm from poppler first.
+type Tesseract struct {
+	// Path is the tesseract executable.
+	Path string
+	// PDFToPPM is the pdftoppm executable; PDFs are unsupported without it.
+	PDFToPPM string
+	// Language is the tesseract language, "eng" if empty.
+	Language string
+}
+
+func (t Tesseract) Name() string { return "tesseract" }
+
+func (t Tesseract) Lines(ctx context.Context, path string) ([]Line, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if imageTypes[ext] {
+		return t.image(ctx, path)
+	}
+	if ext != ".pdf" || t.PDFToPPM == "" {
+		return nil, ErrUnsupported
+	}
+
+	dir, err := os.MkdirTemp("", "extract-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if out, err := exec.CommandContext(ctx, t.PDFToPPM, "-r", "300", "-png", path, filepath.Join(dir, "page")).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("extract: pdftoppm: %w: %s", err, bytes.TrimSpace(out))
+	}
+	pages, err := filepath.Glob(filepath.Join(dir, "page-*.png"))
+	if err != nil {
+		return nil, err
+	}
+	// pdftoppm pads page numbers to the same width, so names sort in order
+	sort.Strings(pages)
+	var lines []Line
+	for _, page := range pages {
+		pageLines, err := t.image(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, pageLines...)
+	}
+	return lines, nil
+}
+
+// image runs tesseract on one image and groups the words of its TSV output
+// into lines, each as confident as the mean of its words.
+func (t Tesseract) image(ctx context.Context, path string) ([]Line, error) {
+	lang := t.Language
+	if lang == "" {
+		lang = "eng"
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.Path, path, "stdout", "-l", lang, "tsv")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("extract: tesseract: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	type word struct {
+		text string
+		conf float64
+	}
+	var keys []string
+	words := map[string][]word{}
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		// level page block par line word left top width height conf text
+		cols := strings.Split(s.Text(), "\t")
+		if len(cols) < 12 || cols[0] != "5" {
+			continue
+		}
+		conf, err := strconv.ParseFloat(cols[10], 64)
+		text := strings.TrimSpace(cols[11])
+		if err != nil || conf < 0 || text == "" {
+			continue
+		}
+		key := strings.Join(cols[1:5], ".")
+		if _, ok := words[key]; !ok {
+			keys = append(keys, key)
+		}
+		words[key] = append(words[key], word{text, conf / 100})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	lines := make([]Line, 0, len(keys))
+	for _, key := range keys {
+		var texts []string
+		var total float64
+		for _, w := range words[key] {
+			texts = append(texts, w.text)
+			total += w.conf
+		}
+		lines = append(lines, Line{Text: strings.Join(texts, " "), Confidence: total / float64(len(texts))})
+	}
+	return lines, nil
+}
@@ -2,14 +2,17 @@ package handlers
 
 import (
 	"database/sql"
-	"html/template"
-	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/calc"
 	"MortgageAgent/internal/db"
-
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/match"
 	"MortgageAgent/internal/models"
 )
 
@@ -43,101 +46,263 @@ type ViewApplicationData struct {
 	ID              int
 	BrokerID        int
 	ApplicationType string
+	Status          string
 	CreatedAt       time.Time
 	Documents       []models.DocumentInfo
+	// ConsentAt and ConsentName are set once the borrower gave e-consent.
+	ConsentAt   *time.Time
+	ConsentName string
+	// Qualification assesses the financial details the broker entered, if
+	// any.
+	Qualification *calc.Assessment
+	// Matches ranks the lender products offered on RatesOn, today unless a
+	// past quote is being reproduced, against those details.
+	Matches []match.Result
+	RatesOn time.Time
+
+	Conditions ConditionsData
+	// Commitments lists the rate holds and commitments the broker recorded.
+	Commitments CommitmentsData
+	Messages    MessagesData
+
+	Shares         []ShareLink
+	ShareExpiries  []ShareExpiry
+	ErrorMessage   string
+	SuccessMessage string
 }
 
-// internal/handlers/admin.go
+// assignedApplication loads the application with the given ID if it is
+// assigned to the current admin, rendering an error and returning nil
+// otherwise.
+func assignedApplication(w http.ResponseWriter, r *http.Request, database *sql.DB, idStr string) *models.Application {
+	user := GetUserFromContext(r)
+	if idStr == "" {
+		renderError(w, r, http.StatusBadRequest, "Missing application ID")
+		return nil
+	}
 
-func ViewApplication(database *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Retrieve the current admin user from the context
-		user := GetUserFromContext(r)
-		if user == nil || user.UserType != "admin" {
-			log.Printf("Unauthorized access attempt by user: %v\n", user)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+	appID, err := strconv.Atoi(idStr)
+	if err != nil {
+		renderError(w, r, http.StatusBadRequest, "Invalid application ID")
+		return nil
+	}
 
-		// Get application ID from query parameters
-		idStr := r.URL.Query().Get("id")
-		if idStr == "" {
-			log.Println("Missing application ID in request")
-			http.Error(w, "Missing application ID", http.StatusBadRequest)
-			return
-		}
+	logging.SetApplication(r.Context(), appID)
+	logger := logging.FromContext(r.Context())
 
-		appID, err := strconv.Atoi(idStr)
-		if err != nil {
-			log.Printf("Invalid application ID format: %s, error: %v\n", idStr, err)
-			http.Error(w, "Invalid application ID", http.StatusBadRequest)
-			return
-		}
+	// Fetch application details from the database
+	app, err := db.GetApplicationByID(database, idStr)
+	if err != nil || app == nil {
+		logger.Info("Application not found", "err", err)
+		renderError(w, r, http.StatusNotFound, "Application not found")
+		return nil
+	}
 
-		log.Printf("Admin ID %d is viewing application ID %d\n", user.ID, appID)
+	if app.AssignedAdminID == nil || *app.AssignedAdminID != user.ID {
+		logger.Warn("Admin not assigned to application")
+		renderError(w, r, http.StatusForbidden, "Forbidden")
+		return nil
+	}
+	return app
+}
 
-		// Fetch application details from the database
-		app, err := db.GetApplicationByID(database, idStr)
-		if err != nil {
-			log.Printf("Error fetching application ID %d: %v\n", appID, err)
-			http.Error(w, "Application not found", http.StatusNotFound)
-			return
-		}
+// renderViewApplication shows the application with its documents and share
+// links, keeping any message already set on data.
+func renderViewApplication(w http.ResponseWriter, r *http.Request, database *sql.DB, app *models.Application, data ViewApplicationData) {
+	logger := logging.FromContext(r.Context())
 
-		if app.AssignedAdminID == nil || *app.AssignedAdminID != user.ID {
-			log.Printf("Admin ID %d not authorized to view application ID %d\n", user.ID, app.ID)
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
+	// Fetch documents associated with the application
+	documents, err := db.GetDocumentsForApplication(database, app.ID, true)
+	if err != nil {
+		logger.Error("Error fetching documents", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Error fetching documents")
+		return
+	}
+	shares, err := db.GetSharesForApplication(database, app.ID)
+	if err != nil {
+		logger.Error("Error fetching share links", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Error fetching share links")
+		return
+	}
+	extractions, err := db.GetExtractionsForApplication(database, app.ID)
+	if err != nil {
+		logger.Error("Error fetching extractions", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Error fetching extracted figures")
+		return
+	}
+	fin, err := db.GetApplicationFinancials(database, app.ID)
+	if err != nil {
+		logger.Error("Error fetching financials", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Error fetching financials")
+		return
+	}
+	if data.Conditions, err = loadConditions(database, app, true); err != nil {
+		logger.Error("Error fetching conditions", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Error fetching conditions")
+		return
+	}
+	if data.Commitments, err = loadCommitments(database, app.ID, false); err != nil {
+		logger.Error("Error fetching rate holds and commitments", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Error fetching rate holds and commitments")
+		return
+	}
+	if data.Messages, err = loadMessages(database, app, GetUserFromContext(r), true); err != nil {
+		logger.Error("Error fetching messages", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Error fetching messages")
+		return
+	}
+	if fin != nil {
+		data.Qualification, _ = assess(*fin)
+		if data.RatesOn.IsZero() {
+			data.RatesOn = time.Now()
 		}
-
-		// Fetch documents associated with the application
-		documents, err := db.GetDocumentsForApplication(database, app.ID)
+		products, err := db.GetActiveLenderProducts(database, data.RatesOn)
 		if err != nil {
-			log.Printf("Error fetching documents for application ID %d: %v\n", app.ID, err)
-			http.Error(w, "Error fetching documents", http.StatusInternalServerError)
+			logger.Error("Error fetching lender products", "err", err)
+			renderError(w, r, http.StatusInternalServerError, "Error fetching lender products")
 			return
 		}
+		data.Matches = match.Rank(products, match.Borrower{
+			Inputs: financialsInputs(*fin), Province: fin.Province, PropertyType: fin.PropertyType, CreditScore: fin.CreditScore,
+		}, calc.BenchmarkRate)
+	}
 
-		// Map documents to the view data
-		var documentInfos []models.DocumentInfo
-		for _, doc := range documents {
-			documentInfos = append(documentInfos, models.DocumentInfo{
-				Category: doc.Category,
-				FilePath: doc.FilePath,
-			})
-		}
+	// Every view of borrower data is recorded; refuse to show it otherwise
+	if err := audit.Record(r, database, audit.Entry{
+		Action: audit.ApplicationView, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+	}); err != nil {
+		renderError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
 
-		// Prepare data for the template
-		data := ViewApplicationData{
-			ID:              app.ID,
-			BrokerID:        app.BrokerID,
-			ApplicationType: app.ApplicationType,
-			CreatedAt:       app.CreatedAt,
-			Documents:       documentInfos,
-		}
+	// Map documents to the view data
+	for _, doc := range documents {
+		data.Documents = append(data.Documents, models.DocumentInfo{
+			ID:         doc.ID,
+			Category:   doc.Category,
+			Generated:  doc.Generated,
+			ScanStatus: doc.ScanStatus,
+			Extraction: extractions[doc.ID],
+		})
+	}
 
-		// Render the view_application template
-		tmpl, err := template.ParseFiles("internal/templates/view_application.html")
-		if err != nil {
-			log.Printf("Error parsing template: %v\n", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+	data.ID = app.ID
+	data.BrokerID = app.BrokerID
+	data.ApplicationType = app.ApplicationType
+	data.Status = app.Status
+	data.CreatedAt = app.CreatedAt
+	data.ConsentAt = app.ConsentAt
+	data.ConsentName = app.ConsentName
+	data.Shares = shareLinks(shares, time.Now())
+	data.ShareExpiries = shareExpiries
+
+	// Render the view_application template
+	renderPage(w, r, "view_application", data)
+}
+
+// internal/handlers/admin.go
+
+func ViewApplication(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve the current admin user from the context
+		user := GetUserFromContext(r)
+		if user == nil || user.UserType != "admin" {
+			logging.FromContext(r.Context()).Warn("Non-admin attempted to view an application")
+			renderError(w, r, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		err = tmpl.Execute(w, data)
-		if err != nil {
-			log.Printf("Error executing template: %v\n", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		// Get application ID from query parameters
+		app := assignedApplication(w, r, database, r.URL.Query().Get("id"))
+		if app == nil {
 			return
 		}
 
-		log.Printf("Successfully rendered view for application ID %d\n", app.ID)
+		var data ViewApplicationData
+		switch {
+		case r.URL.Query().Get("shared") != "":
+			data.SuccessMessage = "Share link created. Copy it from the list below and send it to the recipient."
+		case r.URL.Query().Get("revoked") != "":
+			data.SuccessMessage = "Share link revoked."
+		case r.URL.Query().Get("condition_added") != "":
+			data.SuccessMessage = "Condition added."
+		case r.URL.Query().Get("condition_cleared") != "":
+			data.SuccessMessage = "Condition cleared."
+		case r.URL.Query().Get("condition_returned") != "":
+			data.SuccessMessage = "Condition returned to the broker."
+		case r.URL.Query().Get("fields_confirmed") != "":
+			data.SuccessMessage = "Extracted figures confirmed."
+		}
+		if asOf, err := time.ParseInLocation("2006-01-02", r.URL.Query().Get("as_of"), time.Local); err == nil {
+			data.RatesOn = asOf
+		}
+		renderViewApplication(w, r, database, app, data)
 	}
 }
 
+// dashboardPerPage is the number of applications shown per dashboard page.
+const dashboardPerPage = 25
+
 type AdminDashboardData struct {
 	ErrorMessage string
 	Applications []models.ApplicationWithDocuments
+	Statuses     []string
+	Filter       db.ApplicationFilter
+	Total        int
+	Page         int
+	TotalPages   int
+	PrevURL      string
+	NextURL      string
+	SortURLs     map[string]string
+	// Unread counts the unread messages on each application, by ID.
+	Unread map[int]int
+}
+
+// parseApplicationFilter reads the dashboard's filter, sort and page parameters.
+func parseApplicationFilter(q url.Values) db.ApplicationFilter {
+	f := db.ApplicationFilter{
+		Status:   q.Get("status"),
+		Type:     q.Get("type"),
+		Broker:   strings.TrimSpace(q.Get("broker")),
+		DateFrom: q.Get("from"),
+		DateTo:   q.Get("to"),
+		Sort:     q.Get("sort"),
+		Desc:     q.Get("order") != "asc",
+		PerPage:  dashboardPerPage,
+	}
+	// Dates that do not parse are ignored rather than sent to the query
+	for _, d := range []*string{&f.DateFrom, &f.DateTo} {
+		if _, err := time.Parse("2006-01-02", *d); err != nil {
+			*d = ""
+		}
+	}
+	f.Page, _ = strconv.Atoi(q.Get("page"))
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	return f
+}
+
+// dashboardURL returns the dashboard URL for q with the given parameters overridden.
+func dashboardURL(q url.Values, overrides ...string) string {
+	return pageURL("/admin-dashboard", q, overrides...)
+}
+
+// pageURL returns path with the query q, with the given parameters overridden.
+// An empty override removes the parameter.
+func pageURL(path string, q url.Values, overrides ...string) string {
+	v := url.Values{}
+	for k, vals := range q {
+		v[k] = vals
+	}
+	for i := 0; i+1 < len(overrides); i += 2 {
+		if overrides[i+1] == "" {
+			v.Del(overrides[i])
+		} else {
+			v.Set(overrides[i], overrides[i+1])
+		}
+	}
+	return path + "?" + v.Encode()
 }
 
 // internal/handlers/admin.go
@@ -147,43 +312,49 @@ func AdminDashboard(database *sql.DB) http.HandlerFunc {
 		// Retrieve the current admin user from the context
 		user := GetUserFromContext(r)
 		if user == nil || user.UserType != "admin" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			renderError(w, r, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		// Fetch applications assigned to this admin
-		applications, err := db.GetApplicationsForAdmin(database, user.ID)
+		q := r.URL.Query()
+		filter := parseApplicationFilter(q)
+		data := AdminDashboardData{
+			Statuses: models.ApplicationStatuses,
+			Filter:   filter,
+			Page:     filter.Page,
+			SortURLs: map[string]string{},
+		}
+
+		// Fetch one page of the applications assigned to this admin
+		applications, total, err := db.GetApplicationsForAdmin(database, user.ID, filter)
 		if err != nil {
-			log.Println("Error fetching applications:", err)
-			data := AdminDashboardData{
-				ErrorMessage: "Error fetching applications. Please try again later.",
-				Applications: nil,
-			}
-			tmpl := template.Must(template.ParseFiles("internal/templates/admin_dashboard.html"))
-			tmpl.Execute(w, data)
+			logging.FromContext(r.Context()).Error("Error fetching applications", "err", err)
+			data.ErrorMessage = "Error fetching applications. Please try again later."
+			renderPage(w, r, "admin_dashboard", data)
 			return
 		}
 
-		// Check if any applications are assigned
-		if len(applications) == 0 {
-			log.Printf("No applications assigned to admin ID %d\n", user.ID)
-		} else {
-			log.Printf("Admin ID %d has %d applications\n", user.ID, len(applications))
+		data.Applications = applications
+		data.Total = total
+		if data.Unread, err = db.GetUnreadMessageCounts(database, user.ID, true); err != nil {
+			logging.FromContext(r.Context()).Error("Error counting unread messages", "err", err)
 		}
-
-		// Prepare data for the template
-		data := AdminDashboardData{
-			ErrorMessage: "",
-			Applications: applications,
+		data.TotalPages = (total + dashboardPerPage - 1) / dashboardPerPage
+		if filter.Page > 1 {
+			data.PrevURL = dashboardURL(q, "page", strconv.Itoa(filter.Page-1))
+		}
+		if filter.Page < data.TotalPages {
+			data.NextURL = dashboardURL(q, "page", strconv.Itoa(filter.Page+1))
+		}
+		for _, key := range []string{"id", "created_at", "status", "type", "broker"} {
+			order := "asc"
+			if key == filter.Sort && !filter.Desc {
+				order = "desc"
+			}
+			data.SortURLs[key] = dashboardURL(q, "sort", key, "order", order, "page", "1")
 		}
 
 		// Render the admin dashboard template
-		tmpl := template.Must(template.ParseFiles("internal/templates/admin_dashboard.html"))
-		err = tmpl.Execute(w, data)
-		if err != nil {
-			log.Println("Error rendering template:", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
+		renderPage(w, r, "admin_dashboard", data)
 	}
 }
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+)
+
+// auditPerPage is the number of events shown per audit log page.
+const auditPerPage = 50
+
+type AuditLogData struct {
+	ErrorMessage  string
+	Events        []models.AuditEvent
+	Actions       []string
+	ResourceTypes []string
+	Filter        db.AuditFilter
+	Total         int
+	Page          int
+	TotalPages    int
+	PrevURL       string
+	NextURL       string
+	ExportURL     string
+	// Verified is set when the auditor asked for the hash chain to be checked.
+	Verified  bool
+	Checked   int
+	BrokenAt  int64
+	VerifyURL string
+}
+
+// parseAuditFilter reads the audit log's filter and page parameters.
+func parseAuditFilter(q url.Values) db.AuditFilter {
+	f := db.AuditFilter{
+		Actor:        strings.TrimSpace(q.Get("actor")),
+		Action:       q.Get("action"),
+		ResourceType: q.Get("resource_type"),
+		ResourceID:   strings.TrimSpace(q.Get("resource_id")),
+		DateFrom:     q.Get("from"),
+		DateTo:       q.Get("to"),
+		PerPage:      auditPerPage,
+	}
+	f.Page, _ = strconv.Atoi(q.Get("page"))
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	return f
+}
+
+// AuditLog lets auditors search the audit trail and check its hash chain.
+func AuditLog(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		filter := parseAuditFilter(q)
+		data := AuditLogData{
+			Actions:       audit.Actions,
+			ResourceTypes: audit.ResourceTypes,
+			Filter:        filter,
+			Page:          filter.Page,
+			ExportURL:     pageURL("/audit/export.csv", q, "page", ""),
+			VerifyURL:     pageURL("/audit", q, "verify", "1"),
+		}
+		logger := logging.FromContext(r.Context())
+
+		if q.Get("verify") != "" {
+			checked, broken, err := db.VerifyAuditChain(database)
+			if err != nil {
+				logger.Error("Error verifying audit chain", "err", err)
+				data.ErrorMessage = "Could not verify the audit chain. Please try again later."
+			} else {
+				data.Verified, data.Checked, data.BrokenAt = true, checked, broken
+				if broken != 0 {
+					logger.Error("Audit chain verification failed", "event_id", broken)
+				}
+			}
+		}
+
+		events, total, err := db.SearchAuditEvents(database, filter)
+		if err != nil {
+			logger.Error("Error searching audit events", "err", err)
+			data.ErrorMessage = "Error searching the audit log. Please try again later."
+			renderPage(w, r, "audit", data)
+			return
+		}
+
+		data.Events = events
+		data.Total = total
+		data.TotalPages = (total + auditPerPage - 1) / auditPerPage
+		if filter.Page > 1 {
+			data.PrevURL = pageURL("/audit", q, "page", strconv.Itoa(filter.Page-1), "verify", "")
+		}
+		if filter.Page < data.TotalPages {
+			data.NextURL = pageURL("/audit", q, "page", strconv.Itoa(filter.Page+1), "verify", "")
+		}
+		renderPage(w, r, "audit", data)
+	}
+}
+
+// csvSafe stops spreadsheet programs from treating a field as a formula.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// AuditExport streams the events matching the audit log filters as CSV. The
+// export itself is recorded first.
+func AuditExport(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		filter := parseAuditFilter(r.URL.Query())
+		if err := audit.Record(r, database, audit.Entry{Action: audit.Export, Details: r.URL.RawQuery}); err != nil {
+			renderError(w, r, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit-log.csv"`)
+		w.Header().Set("Cache-Control", "no-store")
+
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "occurred_at", "actor_id", "actor_email", "actor_role", "action",
+			"resource_type", "resource_id", "ip", "user_agent", "details", "prev_hash", "hash"})
+		err := db.EachAuditEvent(database, filter, func(e *models.AuditEvent) error {
+			actor := ""
+			if e.ActorID != nil {
+				actor = strconv.Itoa(*e.ActorID)
+			}
+			return cw.Write([]string{
+				strconv.FormatInt(e.ID, 10), e.OccurredAt.Format(models.AuditTimeFormat), actor,
+				csvSafe(e.ActorEmail), e.ActorRole, e.Action, e.ResourceType, csvSafe(e.ResourceID),
+				e.IP, csvSafe(e.UserAgent), csvSafe(e.Details), e.PrevHash, e.Hash,
+			})
+		})
+		cw.Flush()
+		if err == nil {
+			err = cw.Error()
+		}
+		if err != nil {
+			// The headers are already sent, so the file is simply cut short
+			logging.FromContext(r.Context()).Error("Error exporting audit events", "err", err)
+		}
+	}
+}
@@ -4,18 +4,19 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
-	"html/template"
-	"log"
 	"net/http"
-	"time"
-
-	"net/smtp"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/auth"
 	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/metrics"
 )
 
 var emailRegex = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
@@ -62,8 +63,7 @@ func SignUpPage(database *sql.DB) http.HandlerFunc {
 			return
 		}
 		data := SignupPageData{ErrorMessage: ""}
-		tmpl := template.Must(template.ParseFiles("internal/templates/signup.html"))
-		tmpl.Execute(w, data)
+		renderPage(w, r, "signup", data)
 	}
 }
 
@@ -74,8 +74,7 @@ func LoginPage(database *sql.DB) http.HandlerFunc {
 			return
 		}
 		data := LoginPageData{ErrorMessage: ""}
-		tmpl := template.Must(template.ParseFiles("internal/templates/login.html"))
-		tmpl.Execute(w, data)
+		renderPage(w, r, "login", data)
 	}
 }
 
@@ -91,38 +90,46 @@ func Login(database *sql.DB) http.HandlerFunc {
 		user, err := db.GetUserByEmail(database, email)
 		if err != nil {
 			// User not found or DB error. Show error on same page.
-			renderLoginWithError(w, "Invalid credentials.")
+			metrics.LoginFailed("web")
+			audit.Record(r, database, audit.Entry{ActorEmail: email, Action: audit.LoginFailed, Details: "web"})
+			renderLoginWithError(w, r, "Invalid credentials.")
 			return
 		}
 
 		err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 		if err != nil {
 			// Password mismatch. Show error on same page.
-			renderLoginWithError(w, "Invalid credentials. Please try again.")
+			metrics.LoginFailed("web")
+			audit.Record(r, database, audit.Entry{Actor: user, Action: audit.LoginFailed, Details: "web"})
+			renderLoginWithError(w, r, "Invalid credentials. Please try again.")
 			return
 		}
 
 		// Successful login
-		cookie := &http.Cookie{
-			Name:     "session_email",
-			Value:    user.Email,
-			Expires:  time.Now().Add(24 * time.Hour),
-			HttpOnly: true,
+		if _, err := auth.StartSession(w, r, database, user); err != nil {
+			logging.FromContext(r.Context()).Error("Error starting session", "err", err)
+			renderLoginWithError(w, r, "Internal server error. Please try again later.")
+			return
 		}
-		http.SetCookie(w, cookie)
+		logging.SetUser(r.Context(), user.ID)
+		audit.Record(r, database, audit.Entry{Actor: user, Action: audit.Login, Details: "web"})
 
-		if user.UserType == "admin" {
+		switch user.UserType {
+		case "admin":
 			http.Redirect(w, r, "/admin-dashboard", http.StatusFound)
-		} else {
+		case "auditor":
+			http.Redirect(w, r, "/audit", http.StatusFound)
+		case "borrower":
+			http.Redirect(w, r, "/borrower", http.StatusFound)
+		default:
 			http.Redirect(w, r, "/broker", http.StatusFound)
 		}
 	}
 }
 
-func renderLoginWithError(w http.ResponseWriter, errorMsg string) {
+func renderLoginWithError(w http.ResponseWriter, r *http.Request, errorMsg string) {
 	data := LoginPageData{ErrorMessage: errorMsg}
-	tmpl := template.Must(template.ParseFiles("internal/templates/login.html"))
-	tmpl.Execute(w, data)
+	renderPage(w, r, "login", data)
 }
 
 func Register(database *sql.DB) http.HandlerFunc {
@@ -145,8 +152,7 @@ func Register(database *sql.DB) http.HandlerFunc {
 		if user != nil {
 			// User already exists, show error on same page
 			data := SignupPageData{ErrorMessage: "User already exists. Please try a different email."}
-			tmpl := template.Must(template.ParseFiles("internal/templates/signup.html"))
-			tmpl.Execute(w, data)
+			renderPage(w, r, "signup", data)
 			return
 		}
 
@@ -155,27 +161,39 @@ func Register(database *sql.DB) http.HandlerFunc {
 		if err != nil {
 			// Some other error occurred while creating user
 			data := SignupPageData{ErrorMessage: "Error creating user: " + err.Error()}
-			tmpl := template.Must(template.ParseFiles("internal/templates/signup.html"))
-			tmpl.Execute(w, data)
+			renderPage(w, r, "signup", data)
 			return
 		}
 
+		if created, err := db.GetUserByEmail(database, email); err == nil {
+			audit.Record(r, database, audit.Entry{
+				Actor: created, Action: audit.UserCreate,
+				ResourceType: audit.ResourceUser, ResourceID: strconv.Itoa(created.ID),
+				Details: "self sign-up",
+			})
+		}
+
 		// If successful, redirect to signup-success or login
 		http.Redirect(w, r, "/signup-success", http.StatusFound)
 	}
 }
 
-func Logout() http.HandlerFunc {
+// Logout ends the session on POST. A GET, e.g. from an old bookmark, only
+// shows a confirmation form so another site cannot log the user out.
+func Logout(database *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Clear the session cookie
-		cookie := &http.Cookie{
-			Name:    "session_email",
-			Value:   "",
-			Expires: time.Unix(0, 0),
-			MaxAge:  -1,
+		switch r.Method {
+		case http.MethodGet:
+			renderPage(w, r, "logout", nil)
+		case http.MethodPost:
+			if identity, err := auth.Authenticate(r, database); err == nil {
+				audit.Record(r, database, audit.Entry{Actor: identity.User, Action: audit.Logout, Details: "web"})
+			}
+			auth.EndSession(w, r, database)
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		default:
+			http.NotFound(w, r)
 		}
-		http.SetCookie(w, cookie)
-		http.Redirect(w, r, "/", http.StatusFound)
 	}
 }
 
@@ -192,8 +210,7 @@ func ForgotPasswordPage(database *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			data := ForgotPasswordData{}
-			tmpl := template.Must(template.ParseFiles("internal/templates/forgot_password.html"))
-			tmpl.Execute(w, data)
+			renderPage(w, r, "forgot_password", data)
 		} else if r.Method == http.MethodPost {
 			firstName := r.FormValue("first_name")
 			lastName := r.FormValue("last_name")
@@ -202,50 +219,42 @@ func ForgotPasswordPage(database *sql.DB) http.HandlerFunc {
 			user, err := db.GetUserByEmail(database, email)
 			if err != nil || user == nil {
 				data := ForgotPasswordData{ErrorMessage: "No user found with the provided details."}
-				tmpl := template.Must(template.ParseFiles("internal/templates/forgot_password.html"))
-				tmpl.Execute(w, data)
+				renderPage(w, r, "forgot_password", data)
 				return
 			}
 
 			if user.FirstName != firstName || user.LastName != lastName {
 				data := ForgotPasswordData{ErrorMessage: "Provided details do not match any user."}
-				tmpl := template.Must(template.ParseFiles("internal/templates/forgot_password.html"))
-				tmpl.Execute(w, data)
+				renderPage(w, r, "forgot_password", data)
 				return
 			}
 
 			token, err := generateResetToken()
 			if err != nil {
-				log.Println("Error generating reset token:", err)
+				logging.FromContext(r.Context()).Error("Error generating reset token", "err", err)
 				data := ForgotPasswordData{ErrorMessage: "Internal server error. Please try again later."}
-				tmpl := template.Must(template.ParseFiles("internal/templates/forgot_password.html"))
-				tmpl.Execute(w, data)
+				renderPage(w, r, "forgot_password", data)
 				return
 			}
 
 			err = db.SetResetToken(database, user.Email, token, time.Now().Add(1*time.Hour))
 			if err != nil {
-				log.Println("Error setting reset token:", err)
+				logging.FromContext(r.Context()).Error("Error setting reset token", "err", err)
 				data := ForgotPasswordData{ErrorMessage: "Internal server error. Please try again later."}
-				tmpl := template.Must(template.ParseFiles("internal/templates/forgot_password.html"))
-				tmpl.Execute(w, data)
+				renderPage(w, r, "forgot_password", data)
 				return
 			}
 
-			resetLink := "http://localhost:8080/reset-password?token=" + token
-			emailBody := "Click the link below to reset your password:\n\n" + resetLink
-
-			err = SendEmail(user.Email, "Password Reset", emailBody)
+			err = queuePasswordReset(database, user.ID)
 			if err != nil {
+				logging.FromContext(r.Context()).Error("Error queueing password reset email", "err", err)
 				data := ForgotPasswordData{ErrorMessage: "Failed to send email. Please try again later."}
-				tmpl := template.Must(template.ParseFiles("internal/templates/forgot_password.html"))
-				tmpl.Execute(w, data)
+				renderPage(w, r, "forgot_password", data)
 				return
 			}
 
 			data := ForgotPasswordData{SuccessMessage: "A password reset link has been sent to " + user.Email}
-			tmpl := template.Must(template.ParseFiles("internal/templates/forgot_password.html"))
-			tmpl.Execute(w, data)
+			renderPage(w, r, "forgot_password", data)
 		} else {
 			http.NotFound(w, r)
 		}
@@ -267,8 +276,7 @@ func ResetPasswordPage(database *sql.DB) http.HandlerFunc {
 				data.ErrorMessage = "Invalid or expired reset token."
 			}
 
-			tmpl := template.Must(template.ParseFiles("internal/templates/reset_password.html"))
-			tmpl.Execute(w, data)
+			renderPage(w, r, "reset_password", data)
 
 		} else if r.Method == http.MethodPost {
 			token := r.FormValue("token")
@@ -278,73 +286,46 @@ func ResetPasswordPage(database *sql.DB) http.HandlerFunc {
 			data := ResetPasswordData{Token: token}
 			if newPassword != confirmPassword {
 				data.ErrorMessage = "Passwords do not match."
-				tmpl := template.Must(template.ParseFiles("internal/templates/reset_password.html"))
-				tmpl.Execute(w, data)
+				renderPage(w, r, "reset_password", data)
 				return
 			}
 
 			user, err := db.GetUserByResetToken(database, token)
 			if err != nil || user == nil {
 				data.ErrorMessage = "Invalid or expired reset token."
-				tmpl := template.Must(template.ParseFiles("internal/templates/reset_password.html"))
-				tmpl.Execute(w, data)
+				renderPage(w, r, "reset_password", data)
 				return
 			}
 
 			pwHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 			if err != nil {
 				data.ErrorMessage = "Internal error. Try again."
-				tmpl := template.Must(template.ParseFiles("internal/templates/reset_password.html"))
-				tmpl.Execute(w, data)
+				renderPage(w, r, "reset_password", data)
 				return
 			}
 
 			err = db.UpdateUserPassword(database, user.ID, string(pwHash))
 			if err != nil {
 				data.ErrorMessage = "Internal error. Try again."
-				tmpl := template.Must(template.ParseFiles("internal/templates/reset_password.html"))
-				tmpl.Execute(w, data)
+				renderPage(w, r, "reset_password", data)
 				return
 			}
 
+			audit.Record(r, database, audit.Entry{
+				Actor: user, Action: audit.PasswordReset,
+				ResourceType: audit.ResourceUser, ResourceID: strconv.Itoa(user.ID),
+			})
+
+			// Sign out every existing session in case the account was compromised
+			if err := db.DeleteUserSessions(database, user.ID); err != nil {
+				logging.FromContext(r.Context()).Error("Error deleting sessions", "user_id", user.ID, "err", err)
+			}
+
 			data.SuccessMessage = "Your password has been successfully reset!"
-			tmpl := template.Must(template.ParseFiles("internal/templates/reset_password.html"))
-			tmpl.Execute(w, data)
+			renderPage(w, r, "reset_password", data)
 
 		} else {
 			http.NotFound(w, r)
 		}
 	}
 }
-
-func SendEmail(to, subject, body string) error {
-	// SMTP server configuration.
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
-
-	// Authentication - use your credentials.
-	auth := smtp.PlainAuth("", "kingsmansoftwaresolution@gmail.com", "hhsy drzs yajh csej", smtpHost)
-
-	from := "kingsmansoftwaresolutions@gmail.com"
-	message := []byte("Subject: " + subject + "\r\n" +
-		"From: " + from + "\r\n" +
-		"To: " + to + "\r\n" +
-		"Content-Type: text/plain; charset=UTF-8\r\n" +
-		"\r\n" +
-		body + "\r\n")
-
-	// The 'to' parameter in SendMail is a list of recipients.
-	recipients := []string{to}
-
-	print("Subject :" + subject + "To" + to + "body" + body)
-
-	// Connect to the SMTP server and send the email.
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, from, recipients, message)
-
-	if err != nil {
-		print(" ")
-		log.Printf("smtp error: %s", err)
-		return err
-	}
-	return nil
-}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/auth"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/server"
+)
+
+// borrowerUploadBytes caps a single document uploaded through the portal.
+const borrowerUploadBytes = 32 << 20
+
+// minBorrowerPassword is the shortest password a borrower may choose.
+const minBorrowerPassword = 8
+
+// ChecklistItem is one required document and how many files were uploaded for it.
+type ChecklistItem struct {
+	Category    string
+	Description string
+	Count       int
+}
+
+// buildChecklist lists every required document for the application and
+// returns the categories still outstanding.
+func buildChecklist(database *sql.DB, appID int) ([]ChecklistItem, []string, error) {
+	docs, err := db.GetDocumentsForApplication(database, appID, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Files rejected by the virus scan have to be uploaded again
+	counts := map[string]int{}
+	for _, d := range docs {
+		if !models.ScanRejected(d.ScanStatus) {
+			counts[d.Category]++
+		}
+	}
+
+	var items []ChecklistItem
+	var missing []string
+	for _, cat := range models.DocumentCategories {
+		items = append(items, ChecklistItem{Category: cat, Description: models.DocumentDescriptions[cat], Count: counts[cat]})
+		if counts[cat] == 0 {
+			missing = append(missing, cat)
+		}
+	}
+	return items, missing, nil
+}
+
+type BorrowerInviteData struct {
+	ErrorMessage string
+	Token        string
+	Email        string
+	// Existing is set when the invited email already has a borrower account,
+	// which only needs to confirm.
+	Existing bool
+}
+
+// lookupInvite returns the usable invite for token, or nil.
+func lookupInvite(database *sql.DB, token string) *models.BorrowerInvite {
+	if token == "" {
+		return nil
+	}
+	invite, err := db.GetBorrowerInviteByHash(database, auth.HashSecret(token))
+	if err != nil || !invite.Usable(time.Now()) {
+		return nil
+	}
+	return invite
+}
+
+// AcceptInvitePage is the magic link emailed to a borrower. The GET only
+// shows a form, so link scanners cannot use up the invite; the POST creates
+// the borrower account, or links an existing one, and logs the borrower in.
+func AcceptInvitePage(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		token := r.FormValue("token")
+		invite := lookupInvite(database, token)
+		if invite == nil {
+			renderPage(w, r, "borrower_invite", BorrowerInviteData{
+				ErrorMessage: "This invitation link is invalid, has expired or was already used. Ask your broker to send a new one.",
+			})
+			return
+		}
+
+		data := BorrowerInviteData{Token: token, Email: invite.Email}
+		existing, err := db.GetUserByEmail(database, invite.Email)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			logging.FromContext(r.Context()).Error("Error looking up invited borrower", "err", err)
+			renderError(w, r, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if existing != nil && existing.UserType != "borrower" {
+			data.Token = ""
+			data.ErrorMessage = "This email address already has a staff or broker account. Ask your broker to invite a different address."
+			renderPage(w, r, "borrower_invite", data)
+			return
+		}
+		data.Existing = existing != nil
+
+		if r.Method == http.MethodGet {
+			renderPage(w, r, "borrower_invite", data)
+			return
+		}
+
+		user := existing
+		if user == nil {
+			firstName := strings.TrimSpace(r.FormValue("first_name"))
+			lastName := strings.TrimSpace(r.FormValue("last_name"))
+			password := r.FormValue("password")
+			switch {
+			case firstName == "" || lastName == "":
+				data.ErrorMessage = "Enter your first and last name."
+			case len(password) < minBorrowerPassword:
+				data.ErrorMessage = "Choose a password of at least " + strconv.Itoa(minBorrowerPassword) + " characters."
+			case password != r.FormValue("confirm_password"):
+				data.ErrorMessage = "Passwords do not match."
+			}
+			if data.ErrorMessage != "" {
+				renderPage(w, r, "borrower_invite", data)
+				return
+			}
+
+			id, err := db.CreateBorrower(database, firstName, lastName, invite.Email, password)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("Error creating borrower", "err", err)
+				data.ErrorMessage = "Could not create your account. Please try again."
+				renderPage(w, r, "borrower_invite", data)
+				return
+			}
+			if user, err = db.GetUserByID(database, id); err != nil {
+				logging.FromContext(r.Context()).Error("Error loading new borrower", "err", err)
+				renderError(w, r, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			audit.Record(r, database, audit.Entry{
+				Actor: user, Action: audit.UserCreate,
+				ResourceType: audit.ResourceUser, ResourceID: strconv.Itoa(user.ID),
+				Details: "borrower invite",
+			})
+		}
+
+		if err := db.AcceptBorrowerInvite(database, invite.ID, user.ID); err != nil {
+			if !errors.Is(err, db.ErrInviteUsed) {
+				logging.FromContext(r.Context()).Error("Error accepting borrower invite", "err", err)
+			}
+			renderPage(w, r, "borrower_invite", BorrowerInviteData{
+				ErrorMessage: "This invitation was already used. Log in with your email and password instead.",
+			})
+			return
+		}
+		logging.SetApplication(r.Context(), invite.ApplicationID)
+		audit.Record(r, database, audit.Entry{
+			Actor: user, Action: audit.BorrowerAccept,
+			ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(invite.ApplicationID),
+		})
+
+		if _, err := auth.StartSession(w, r, database, user); err != nil {
+			logging.FromContext(r.Context()).Error("Error starting session", "err", err)
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		logging.SetUser(r.Context(), user.ID)
+		http.Redirect(w, r, "/borrower", http.StatusSeeOther)
+	}
+}
+
+// BorrowerApplication is one application on the borrower's portal.
+type BorrowerApplication struct {
+	models.Application
+	BrokerName  string
+	Checklist   []ChecklistItem
+	Outstanding int
+}
+
+type BorrowerPortalData struct {
+	FirstName      string
+	Applications   []BorrowerApplication
+	ErrorMessage   string
+	SuccessMessage string
+}
+
+func renderBorrowerPortal(w http.ResponseWriter, r *http.Request, database *sql.DB, data BorrowerPortalData) {
+	user := GetUserFromContext(r)
+	data.FirstName = user.FirstName
+
+	apps, err := db.GetApplicationsForBorrower(database, user.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching borrower applications", "err", err)
+		data.ErrorMessage = "Error fetching your application. Please try again later."
+		renderPage(w, r, "borrower_portal", data)
+		return
+	}
+	for _, app := range apps {
+		items, missing, err := buildChecklist(database, app.ID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error fetching documents", "application_id", app.ID, "err", err)
+			data.ErrorMessage = "Error fetching your documents. Please try again later."
+			break
+		}
+		ba := BorrowerApplication{Application: app, Checklist: items, Outstanding: len(missing)}
+		if broker, err := db.GetUserByID(database, app.BrokerID); err == nil {
+			ba.BrokerName = broker.FirstName + " " + broker.LastName
+		}
+		data.Applications = append(data.Applications, ba)
+	}
+	renderPage(w, r, "borrower_portal", data)
+}
+
+// BorrowerPortal shows borrowers the applications they were invited to, the
+// documents still outstanding and the e-consent form.
+func BorrowerPortal(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		var data BorrowerPortalData
+		switch {
+		case r.URL.Query().Get("uploaded") != "":
+			data.SuccessMessage = "Thank you, your document was uploaded."
+		case r.URL.Query().Get("consented") != "":
+			data.SuccessMessage = "Thank you, your consent was recorded."
+		}
+		renderBorrowerPortal(w, r, database, data)
+	}
+}
+
+// borrowerApplication loads the application named by the form's
+// application_id if the borrower may still change it, rendering an error and
+// returning nil otherwise.
+func borrowerApplication(w http.ResponseWriter, r *http.Request, database *sql.DB) *models.Application {
+	user := GetUserFromContext(r)
+	app, err := db.GetApplicationByID(database, r.FormValue("application_id"))
+	if err != nil || app == nil || app.BorrowerID == nil || *app.BorrowerID != user.ID {
+		renderError(w, r, http.StatusNotFound, "Application not found")
+		return nil
+	}
+	logging.SetApplication(r.Context(), app.ID)
+	if app.Status != models.StatusDraft {
+		renderBorrowerPortal(w, r, database, BorrowerPortalData{ErrorMessage: "This application has already been submitted and can no longer be changed."})
+		return nil
+	}
+	return app
+}
+
+// BorrowerUpload stores one document uploaded by the borrower.
+func BorrowerUpload(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/borrower", http.StatusFound)
+			return
+		}
+		server.LimitUpload(w, r, borrowerUploadBytes)
+		if err := r.ParseMultipartForm(borrowerUploadBytes); err != nil {
+			renderBorrowerPortal(w, r, database, BorrowerPortalData{ErrorMessage: "Choose a file of at most 32 MB."})
+			return
+		}
+		app := borrowerApplication(w, r, database)
+		if app == nil {
+			return
+		}
+
+		cat := r.FormValue("category")
+		valid := false
+		for _, c := range models.DocumentCategories {
+			valid = valid || c == cat
+		}
+		if !valid {
+			renderBorrowerPortal(w, r, database, BorrowerPortalData{ErrorMessage: "Choose which document you are uploading."})
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			renderBorrowerPortal(w, r, database, BorrowerPortalData{ErrorMessage: "Choose a file to upload."})
+			return
+		}
+		defer file.Close()
+
+		if _, err := saveDocument(r, database, app.ID, cat, file, header); err != nil {
+			logging.FromContext(r.Context()).Error("Error saving borrower document", "category", cat, "err", err)
+			renderBorrowerPortal(w, r, database, BorrowerPortalData{ErrorMessage: "Could not save the file. Please try again."})
+			return
+		}
+		http.Redirect(w, r, "/borrower?uploaded=1", http.StatusSeeOther)
+	}
+}
+
+// BorrowerConsent records the borrower's electronic consent to the
+// application being submitted on their behalf.
+func BorrowerConsent(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/borrower", http.StatusFound)
+			return
+		}
+		app := borrowerApplication(w, r, database)
+		if app == nil {
+			return
+		}
+		if app.ConsentAt != nil {
+			http.Redirect(w, r, "/borrower", http.StatusSeeOther)
+			return
+		}
+
+		name := strings.TrimSpace(r.FormValue("full_name"))
+		if r.FormValue("agree") == "" || name == "" {
+			renderBorrowerPortal(w, r, database, BorrowerPortalData{ErrorMessage: "Tick the consent box and type your full name to sign."})
+			return
+		}
+
+		ip := audit.ClientIP(r)
+		if err := db.SetBorrowerConsent(database, app.ID, name, ip, time.Now()); err != nil {
+			logging.FromContext(r.Context()).Error("Error recording consent", "err", err)
+			renderBorrowerPortal(w, r, database, BorrowerPortalData{ErrorMessage: "Could not record your consent. Please try again."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.Consent, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+			Details: "signed as " + name,
+		})
+		http.Redirect(w, r, "/borrower?consented=1", http.StatusSeeOther)
+	}
+}
@@ -2,15 +2,27 @@ package handlers
 
 import (
 	"database/sql"
-	"fmt"
-	"html/template"
-	"io"
+	"encoding/json"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/auth"
+	"MortgageAgent/internal/calc"
 	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/metrics"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/notify"
+	"MortgageAgent/internal/render"
+	"MortgageAgent/internal/scan"
+	"MortgageAgent/internal/server"
+	"MortgageAgent/internal/storage"
 )
 
 func StartApplication(database *sql.DB) http.HandlerFunc {
@@ -22,132 +34,249 @@ func StartApplication(database *sql.DB) http.HandlerFunc {
 
 		user := GetUserFromContext(r)
 		if user == nil || user.UserType != "broker" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			renderError(w, r, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
 		appType := r.FormValue("application_type")
 		if appType != "self" && appType != "someone_else" {
-			http.Error(w, "Invalid application type", http.StatusBadRequest)
+			renderError(w, r, http.StatusBadRequest, "Invalid application type")
 			return
 		}
 
 		appID, err := db.CreateApplication(database, user.ID, appType)
 		if err != nil {
-			http.Error(w, "Could not create application", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).Error("Error creating application", "err", err)
+			renderError(w, r, http.StatusInternalServerError, "Could not create application")
 			return
 		}
+		logging.SetApplication(r.Context(), appID)
 
 		http.Redirect(w, r, "/application-form?id="+strconv.Itoa(appID), http.StatusFound)
 
 	}
 }
 
+type ApplicationFormData struct {
+	ApplicationID  string
+	Application    *models.Application
+	Checklist      []ChecklistItem
+	ErrorMessage   string
+	SuccessMessage string
+	// Borrower and Consent describe the invited borrower's progress on
+	// someone_else applications.
+	Borrower string
+	Consent  string
+	// Financials fills the financial details form, and Assessment qualifies
+	// the saved figures.
+	Financials url.Values
+	Assessment *calc.Assessment
+	// Provinces and PropertyTypes are the choices lenders match on.
+	Provinces     []choice
+	PropertyTypes []choice
+	Conditions    ConditionsData
+	Commitments   CommitmentsData
+	Messages      MessagesData
+}
+
+// borrowerStatus describes who the application's borrower is, or the state
+// of their invite.
+func borrowerStatus(database *sql.DB, app *models.Application) (string, error) {
+	if app.BorrowerID != nil {
+		borrower, err := db.GetUserByID(database, *app.BorrowerID)
+		if err != nil {
+			return "", err
+		}
+		return borrower.FirstName + " " + borrower.LastName + " (" + borrower.Email + ") has joined", nil
+	}
+	invite, err := db.GetLatestBorrowerInvite(database, app.ID)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case invite == nil:
+		return "Not invited yet", nil
+	case invite.Usable(time.Now()):
+		return "Invited " + invite.Email + ", waiting for them to accept", nil
+	}
+	return "The invite to " + invite.Email + " has expired", nil
+}
+
+// consentStatus describes whether the borrower has given e-consent.
+func consentStatus(app *models.Application) string {
+	switch {
+	case app.ConsentAt != nil:
+		return "Signed by " + app.ConsentName + " on " + render.DateTime(*app.ConsentAt)
+	case app.BorrowerID != nil:
+		return "Waiting for the borrower"
+	}
+	return "Not requested"
+}
+
+func renderApplicationForm(w http.ResponseWriter, r *http.Request, database *sql.DB, app *models.Application, data ApplicationFormData) {
+	data.ApplicationID = strconv.Itoa(app.ID)
+	data.Application = app
+	items, _, err := buildChecklist(database, app.ID)
+	if err == nil && app.ApplicationType == models.TypeSomeoneElse {
+		data.Borrower, err = borrowerStatus(database, app)
+		data.Consent = consentStatus(app)
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error loading application progress", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	data.Checklist = items
+
+	fin, err := db.GetApplicationFinancials(database, app.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error loading financials", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if fin != nil {
+		data.Assessment, _ = assess(*fin)
+		if data.Financials == nil {
+			data.Financials = financialsForm(fin)
+		}
+	}
+	data.Provinces = choices(models.Provinces, provinceName, data.Financials["province"])
+	data.PropertyTypes = choices(models.PropertyTypes, render.Humanize, data.Financials["property_type"])
+	if data.Conditions, err = loadConditions(database, app, false); err != nil {
+		logging.FromContext(r.Context()).Error("Error loading conditions", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if data.Commitments, err = loadCommitments(database, app.ID, true); err != nil {
+		logging.FromContext(r.Context()).Error("Error loading rate holds and commitments", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if data.Messages, err = loadMessages(database, app, GetUserFromContext(r), false); err != nil {
+		logging.FromContext(r.Context()).Error("Error loading messages", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	renderPage(w, r, "application_form", data)
+}
+
+// brokerApplication loads the application with the given ID if it belongs to
+// the broker, rendering an error and returning nil otherwise.
+func brokerApplication(w http.ResponseWriter, r *http.Request, database *sql.DB, id string) *models.Application {
+	app, err := db.GetApplicationByID(database, id)
+	if err != nil || app == nil {
+		renderError(w, r, http.StatusNotFound, "Application not found")
+		return nil
+	}
+	logging.SetApplication(r.Context(), app.ID)
+	if app.BrokerID != GetUserFromContext(r).ID {
+		renderError(w, r, http.StatusForbidden, "Unauthorized to view this application")
+		return nil
+	}
+	return app
+}
+
+// applicationUploadBytes caps the documents uploaded with the application
+// form at once; up to 32 MB of them are held in memory while saving.
+const applicationUploadBytes = 160 << 20
+
 func ApplicationFormPage(database *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := GetUserFromContext(r)
 		if user == nil || user.UserType != "broker" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			renderError(w, r, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
 		if r.Method == http.MethodGet {
-			id := r.URL.Query().Get("id")
-			app, err := db.GetApplicationByID(database, id)
-			if err != nil || app == nil {
-				http.Error(w, "Application not found", http.StatusNotFound)
-				return
-			}
-			if app.BrokerID != user.ID {
-				http.Error(w, "Unauthorized to view this application", http.StatusForbidden)
+			app := brokerApplication(w, r, database, r.URL.Query().Get("id"))
+			if app == nil {
 				return
 			}
-
-			data := struct {
-				ApplicationID string
-			}{
-				ApplicationID: id,
+			var data ApplicationFormData
+			switch {
+			case r.URL.Query().Get("invited") != "":
+				data.SuccessMessage = "Invitation sent."
+			case r.URL.Query().Get("saved") != "":
+				data.SuccessMessage = "Financial details saved."
+			case r.URL.Query().Get("attached") != "":
+				data.SuccessMessage = "Payment schedule attached."
+			case r.URL.Query().Get("held") != "":
+				data.SuccessMessage = "Rate hold recorded."
+			case r.URL.Query().Get("released") != "":
+				data.SuccessMessage = "Rate hold released."
+			case r.URL.Query().Get("committed") != "":
+				data.SuccessMessage = "Commitment recorded. Add its conditions below."
+			case r.URL.Query().Get("condition") != "":
+				data.SuccessMessage = "Condition added."
+			case r.URL.Query().Get("satisfied") != "":
+				data.SuccessMessage = "Condition satisfied."
+			case r.URL.Query().Get("responded") != "":
+				data.SuccessMessage = "Your answer was sent for review."
 			}
-
-			tmpl := template.Must(template.ParseFiles("internal/templates/application_form.html"))
-			tmpl.Execute(w, data)
+			renderApplicationForm(w, r, database, app, data)
 
 		} else if r.Method == http.MethodPost {
-			appID := r.FormValue("application_id")
-			app, err := db.GetApplicationByID(database, appID)
-			if err != nil || app == nil {
-				http.Error(w, "Application not found", http.StatusNotFound)
+			server.LimitUpload(w, r, applicationUploadBytes)
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				renderError(w, r, http.StatusRequestEntityTooLarge, "Upload at most 160 MB of documents at a time.")
 				return
 			}
-			if app.BrokerID != user.ID {
-				http.Error(w, "Unauthorized", http.StatusForbidden)
+			app := brokerApplication(w, r, database, r.FormValue("application_id"))
+			if app == nil {
 				return
 			}
-
-			// Categories to upload
-			categories := []string{
-				"Proof_of_income",
-				"Identification",
-				"Basic_financial_information",
-				"Down_payment_confirmation",
-				"Property_details",
+			if app.Status != models.StatusDraft {
+				renderApplicationForm(w, r, database, app, ApplicationFormData{ErrorMessage: "This application has already been submitted."})
+				return
 			}
 
-			// Directory to store uploads (ensure this directory exists and is writable)
-			baseDir := "uploads"
-			os.MkdirAll(baseDir, 0777)
+			for _, cat := range models.DocumentCategories {
+				if err := processFile(cat, r, database, app.ID); err != nil {
+					logging.FromContext(r.Context()).Error("Error saving document", "category", cat, "err", err)
+					renderError(w, r, http.StatusInternalServerError, "File saving error")
+					return
+				}
+			}
 
-			for _, cat := range categories {
-				processFile(baseDir, cat, r, database, w, appID)
+			// Documents may come from the broker or the borrower, so check
+			// the stored set rather than this form
+			_, missing, err := buildChecklist(database, app.ID)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("Error fetching documents", "err", err)
+				renderError(w, r, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if len(missing) > 0 {
+				for i, cat := range missing {
+					missing[i] = render.Humanize(cat)
+				}
+				renderApplicationForm(w, r, database, app, ApplicationFormData{
+					ErrorMessage: "Still missing: " + strings.Join(missing, ", ") + ".",
+				})
+				return
+			}
+			if app.NeedsConsent() {
+				renderApplicationForm(w, r, database, app, ApplicationFormData{
+					ErrorMessage: "The borrower must give e-consent before the application can be submitted.",
+				})
+				return
 			}
-			// for _, cat := range categories {
-
-			// 	fmt.Println("category ::" + cat)
-
-			// 	file, header, err := r.FormFile(cat)
-
-			// 	fmt.Println(header)
-
-			// 	if err == nil && header != nil {
-			// 		defer file.Close()
-
-			// 		// Create a unique file path
-			// 		filePath := filepath.Join(uploadDir, header.Filename)
-			// 		out, err := os.Create(filePath)
-			// 		fmt.Println("output " + out.Name())
-
-			// 		if err != nil {
-			// 			print(err)
-			// 			http.Error(w, "File saving error", http.StatusInternalServerError)
-			// 			return
-			// 		}
-			// 		defer out.Close()
-			// 		_, err = io.Copy(out, file)
-			// 		if err != nil {
-			// 			print(err)
-			// 			http.Error(w, "File saving error", http.StatusInternalServerError)
-			// 			return
-			// 		}
-
-			// 		// Add document record in DB
-			// 		err = db.AddDocument(database, app.ID, cat, filePath)
-			// 		if err != nil {
-			// 			print(err)
-			// 			http.Error(w, "Error recording document", http.StatusInternalServerError)
-			// 			return
-			// 		}
-			// 	}
-			// }
 
 			// Assign application to admin (round robin)
 
-			adminID, err := db.AssignApplicationToAdmin(database, app.ID)
+			adminID, err := db.SubmitApplication(database, app.ID)
 			if err != nil {
-				http.Error(w, "Failed to assign admin", http.StatusInternalServerError)
+				renderError(w, r, http.StatusInternalServerError, "Failed to assign admin")
 				return
 			}
 
-			fmt.Printf("Application %s assigned to admin %d\n", appID, adminID)
+			metrics.ApplicationSubmitted(app.Status, models.StatusSubmitted)
+			logging.FromContext(r.Context()).Info("Application submitted", "assigned_admin_id", adminID)
+			recordSubmission(r, database, app.ID, adminID)
+			if err := notify.Assigned(database, app, adminID); err != nil {
+				logging.FromContext(r.Context()).Error("Error sending assignment notification", "err", err)
+			}
 
 			http.Redirect(w, r, "/broker?submitted=true", http.StatusFound)
 
@@ -157,49 +286,171 @@ func ApplicationFormPage(database *sql.DB) http.HandlerFunc {
 	}
 }
 
-func processFile(baseDir string, cat string, r *http.Request, database *sql.DB, w http.ResponseWriter, appID string) {
-
-	uploadDir := baseDir + "/" + appID + "/" + cat
-	os.MkdirAll(uploadDir, 0777)
-
-	fmt.Println("category ::" + cat)
-
-	file, header, err := r.FormFile(cat)
+// inviteTTL is how long a borrower invite link stays valid.
+const inviteTTL = 7 * 24 * time.Hour
 
-	if err == nil && header != nil {
-		defer file.Close()
+// InviteBorrower emails the person a someone_else application is for a link
+// to upload their own documents. A new invite replaces any pending one.
+func InviteBorrower(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/broker", http.StatusFound)
+			return
+		}
+		user := GetUserFromContext(r)
+		app := brokerApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		fail := func(msg string) {
+			renderApplicationForm(w, r, database, app, ApplicationFormData{ErrorMessage: msg})
+		}
+		switch {
+		case app.ApplicationType != models.TypeSomeoneElse:
+			fail("Only applications for someone else can have a borrower.")
+			return
+		case app.Status != models.StatusDraft:
+			fail("This application has already been submitted.")
+			return
+		case app.BorrowerID != nil:
+			fail("The borrower has already joined this application.")
+			return
+		}
 
-		// Create a unique file path
-		filePath := filepath.Join(uploadDir, header.Filename)
-		out, err := os.Create(filePath)
-		fmt.Println("output " + out.Name())
+		email := strings.TrimSpace(r.FormValue("email"))
+		if !ValidateEmail(email) {
+			fail("Enter the borrower's email address.")
+			return
+		}
+		if existing, err := db.GetUserByEmail(database, email); err == nil && existing.UserType != "borrower" {
+			fail("That email address belongs to a staff or broker account.")
+			return
+		}
 
+		// The token for the link is made when the email is sent; this one
+		// is never given out
+		_, tokenHash, err := auth.NewInviteToken()
+		var inviteID int
+		if err == nil {
+			inviteID, err = db.CreateBorrowerInvite(database, app.ID, email, tokenHash, user.ID, time.Now().Add(inviteTTL))
+		}
 		if err != nil {
-			print(err)
-			http.Error(w, "File saving error", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).Error("Error creating borrower invite", "err", err)
+			fail("Could not create the invitation. Please try again.")
 			return
 		}
-		defer out.Close()
-		_, err = io.Copy(out, file)
-		if err != nil {
-			print(err)
-			http.Error(w, "File saving error", http.StatusInternalServerError)
+		audit.Record(r, database, audit.Entry{
+			Action: audit.BorrowerInvite, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+			Details: email,
+		})
+
+		if err := queueBorrowerInvite(database, inviteID); err != nil {
+			logging.FromContext(r.Context()).Error("Error queueing borrower invite email", "err", err)
+			fail("The invitation could not be emailed. Please try again later.")
 			return
 		}
+		http.Redirect(w, r, "/application-form?id="+strconv.Itoa(app.ID)+"&invited=1", http.StatusSeeOther)
+	}
+}
 
-		// Add document record in DB
-		app, err := db.GetApplicationByID(database, appID)
-		if err != nil {
-			print(err)
-			http.Error(w, "Error Getting ApplicationID", http.StatusInternalServerError)
+// applicationProgress is polled by the application form to show the
+// borrower's uploads and consent as they happen.
+type applicationProgress struct {
+	Documents map[string]int `json:"documents"`
+	Borrower  string         `json:"borrower"`
+	Consent   string         `json:"consent"`
+}
+
+// ApplicationProgress returns the document counts and borrower status of one
+// of the broker's applications as JSON.
+func ApplicationProgress(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		app, err := db.GetApplicationByID(database, r.URL.Query().Get("id"))
+		if err != nil || app == nil || app.BrokerID != GetUserFromContext(r).ID {
+			http.NotFound(w, r)
 			return
 		}
+		logging.SetApplication(r.Context(), app.ID)
 
-		err = db.AddDocument(database, app.ID, cat, filePath)
+		items, _, err := buildChecklist(database, app.ID)
+		progress := applicationProgress{Documents: map[string]int{}}
+		if err == nil && app.ApplicationType == models.TypeSomeoneElse {
+			progress.Borrower, err = borrowerStatus(database, app)
+			progress.Consent = consentStatus(app)
+		}
 		if err != nil {
-			print(err)
-			http.Error(w, "Error recording document", http.StatusInternalServerError)
+			logging.FromContext(r.Context()).Error("Error loading application progress", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+		for _, item := range items {
+			progress.Documents[item.Category] = item.Count
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(progress)
+	}
+}
+
+// recordSubmission audits a submission and the assignment it triggered.
+func recordSubmission(r *http.Request, database *sql.DB, appID, adminID int) {
+	id := strconv.Itoa(appID)
+	audit.Record(r, database, audit.Entry{Action: audit.ApplicationSubmit, ResourceType: audit.ResourceApplication, ResourceID: id})
+	audit.Record(r, database, audit.Entry{
+		Action: audit.Assign, ResourceType: audit.ResourceApplication, ResourceID: id,
+		Details: "auto-assigned to admin " + strconv.Itoa(adminID),
+	})
+}
+
+// processFile stores the upload for one category, if the form included it,
+// and records it against the application.
+func processFile(cat string, r *http.Request, database *sql.DB, appID int) error {
+	file, header, err := r.FormFile(cat)
+	if err != nil || header == nil {
+		return nil
+	}
+	defer file.Close()
+	_, err = saveDocument(r, database, appID, cat, file, header)
+	return err
+}
+
+// saveDocument stores an uploaded file, records it against the application
+// and queues its virus scan. It returns the document ID.
+func saveDocument(r *http.Request, database *sql.DB, appID int, cat string, file multipart.File, header *multipart.FileHeader) (int, error) {
+	// Message attachments never replace one another, as internal notes
+	// share the category with the broker's messages
+	save := storage.SaveUpload
+	if cat == models.CategoryMessage {
+		save = storage.SaveAttachment
+	}
+	filePath, err := save(appID, cat, file, header)
+	if err != nil {
+		return 0, err
+	}
+
+	// Add document record in DB, removing the file if that fails so it is
+	// not left orphaned on disk
+	if err := db.AddDocument(database, appID, cat, filePath, GetUserFromContext(r).ID); err != nil {
+		os.Remove(filePath)
+		return 0, err
+	}
+	doc, err := db.GetDocumentByPath(database, filePath)
+	if err != nil {
+		return 0, err
+	}
+	audit.Record(r, database, audit.Entry{
+		Action: audit.DocumentUpload, ResourceType: audit.ResourceDocument, ResourceID: strconv.Itoa(doc.ID),
+		Details: "application " + strconv.Itoa(appID) + ", " + cat,
+	})
+	// The document stays quarantined until scanned; one whose scan could
+	// not be queued is picked up at the next start
+	if err := scan.Enqueue(database, doc.ID); err != nil {
+		logging.FromContext(r.Context()).Error("Error queueing virus scan", "document_id", doc.ID, "err", err)
 	}
+	return doc.ID, nil
 }
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/calc"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/render"
+)
+
+type CalculatorData struct {
+	// Form holds the values entered, so they are shown again with the result.
+	Form          url.Values
+	Assessment    *calc.Assessment
+	Years         []calc.YearTotal
+	BenchmarkRate float64
+	ErrorMessage  string
+}
+
+// Calculator shows brokers what a borrower can afford and how a purchase
+// scores against the GDS and TDS limits. The form submits with GET, so a
+// calculation can be bookmarked or shared.
+func Calculator(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		data := CalculatorData{Form: r.URL.Query(), BenchmarkRate: calc.BenchmarkRate}
+		if data.Form.Get("purchase_price") != "" {
+			f, err := parseFinancials(data.Form)
+			if err != nil {
+				data.ErrorMessage = err.Error()
+			} else {
+				data.Assessment, data.ErrorMessage = assess(f)
+			}
+			if a := data.Assessment; a != nil {
+				plan := calc.Plan{Principal: a.TotalLoan, Rate: a.ContractRate, AmortizationYears: a.AmortizationYears, Frequency: calc.Monthly}
+				if rows, err := plan.Amortize(); err == nil {
+					data.Years = calc.Yearly(rows, 12)
+				}
+			}
+		}
+		renderPage(w, r, "calculator", data)
+	}
+}
+
+// SaveFinancials stores the purchase details and finances of one of the
+// broker's draft applications, which admins then see qualified on the
+// application.
+func SaveFinancials(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/broker", http.StatusFound)
+			return
+		}
+		app := brokerApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		fail := func(msg string) {
+			renderApplicationForm(w, r, database, app, ApplicationFormData{ErrorMessage: msg, Financials: r.PostForm})
+		}
+		if app.Status != models.StatusDraft {
+			fail("This application has already been submitted.")
+			return
+		}
+		f, err := parseFinancials(r.PostForm)
+		if err != nil {
+			fail(err.Error())
+			return
+		}
+		if _, msg := assess(f); msg != "" {
+			fail(msg)
+			return
+		}
+		f.ApplicationID = app.ID
+		if err := db.SaveApplicationFinancials(database, &f); err != nil {
+			logging.FromContext(r.Context()).Error("Error saving financials", "err", err)
+			fail("Could not save the financial details. Please try again.")
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.FinancialsUpdate, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+		})
+		http.Redirect(w, r, "/application-form?id="+strconv.Itoa(app.ID)+"&saved=1", http.StatusSeeOther)
+	}
+}
+
+// parseAmount reads a non-negative amount such as "$1,250.50"; blank is 0.
+func parseAmount(s string) (float64, bool) {
+	s = strings.NewReplacer("$", "", ",", "", "%", "", " ", "").Replace(s)
+	if s == "" {
+		return 0, true
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, false
+	}
+	return v, true
+}
+
+// percentValue formats a fraction as a percentage for a form field.
+func percentValue(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e6)/1e4, 'f', -1, 64)
+}
+
+// parseFinancials reads the fields of the financial_fields form. The
+// interest rate is entered as a percentage.
+func parseFinancials(form url.Values) (models.ApplicationFinancials, error) {
+	var f models.ApplicationFinancials
+	fields := []struct {
+		name, label string
+		dst         *float64
+	}{
+		{"annual_income", "Annual income", &f.AnnualIncome},
+		{"monthly_debts", "Monthly debt payments", &f.MonthlyDebts},
+		{"purchase_price", "Purchase price", &f.PurchasePrice},
+		{"down_payment", "Down payment", &f.DownPayment},
+		{"property_tax", "Property tax", &f.PropertyTax},
+		{"heating", "Heating", &f.Heating},
+		{"condo_fees", "Condo fees", &f.CondoFees},
+		{"contract_rate", "Interest rate", &f.ContractRate},
+	}
+	for _, field := range fields {
+		v, ok := parseAmount(form.Get(field.name))
+		if !ok {
+			return f, fmt.Errorf("%s must be a number of zero or more.", field.label)
+		}
+		*field.dst = v
+	}
+	f.ContractRate /= 100
+	if f.AnnualIncome == 0 {
+		return f, errors.New("Enter the borrower's annual income.")
+	}
+	years, err := strconv.Atoi(strings.TrimSpace(form.Get("amortization_years")))
+	if err != nil {
+		return f, errors.New("Amortization must be a whole number of years.")
+	}
+	f.AmortizationYears = years
+
+	f.Province = form.Get("province")
+	if f.Province != "" && models.ProvinceNames[f.Province] == "" {
+		return f, errors.New("Choose a province.")
+	}
+	f.PropertyType = form.Get("property_type")
+	if f.PropertyType != "" && !slices.Contains(models.PropertyTypes, f.PropertyType) {
+		return f, errors.New("Choose a property type.")
+	}
+	if s := strings.TrimSpace(form.Get("credit_score")); s != "" {
+		f.CreditScore, err = strconv.Atoi(s)
+		if err != nil || f.CreditScore < 300 || f.CreditScore > 900 {
+			return f, errors.New("Credit score must be between 300 and 900.")
+		}
+	}
+	return f, nil
+}
+
+// financialsForm fills the financial_fields form with saved values.
+func financialsForm(f *models.ApplicationFinancials) url.Values {
+	amount := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	creditScore := ""
+	if f.CreditScore != 0 {
+		creditScore = strconv.Itoa(f.CreditScore)
+	}
+	return url.Values{
+		"annual_income":      {amount(f.AnnualIncome)},
+		"monthly_debts":      {amount(f.MonthlyDebts)},
+		"purchase_price":     {amount(f.PurchasePrice)},
+		"down_payment":       {amount(f.DownPayment)},
+		"property_tax":       {amount(f.PropertyTax)},
+		"heating":            {amount(f.Heating)},
+		"condo_fees":         {amount(f.CondoFees)},
+		"contract_rate":      {percentValue(f.ContractRate)},
+		"amortization_years": {strconv.Itoa(f.AmortizationYears)},
+		"province":           {f.Province},
+		"property_type":      {f.PropertyType},
+		"credit_score":       {creditScore},
+	}
+}
+
+// assess qualifies a purchase, returning a message for the form instead
+// when the figures cannot be assessed.
+func assess(f models.ApplicationFinancials) (*calc.Assessment, string) {
+	a, err := calc.Assess(financialsInputs(f))
+	if err != nil {
+		return nil, inputError(err)
+	}
+	return &a, ""
+}
+
+// financialsInputs converts saved financials for calc.
+func financialsInputs(f models.ApplicationFinancials) calc.Inputs {
+	return calc.Inputs{
+		AnnualIncome:  f.AnnualIncome,
+		MonthlyDebts:  f.MonthlyDebts,
+		PurchasePrice: f.PurchasePrice,
+		DownPayment:   f.DownPayment,
+		Housing: calc.HousingCosts{
+			PropertyTax: f.PropertyTax,
+			Heating:     f.Heating,
+			CondoFees:   f.CondoFees,
+		},
+		ContractRate:      f.ContractRate,
+		AmortizationYears: f.AmortizationYears,
+	}
+}
+
+// inputError turns an error from calc into a sentence for a form.
+func inputError(err error) string {
+	msg := strings.TrimPrefix(strings.TrimPrefix(err.Error(), calc.ErrInvalidInput.Error()), ": ")
+	if msg == "" || !errors.Is(err, calc.ErrInvalidInput) {
+		return "These figures cannot be used."
+	}
+	return render.Humanize(msg) + "."
+}
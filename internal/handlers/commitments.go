@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/render"
+)
+
+// rateHoldWarningDays is how close to expiry a rate hold is flagged.
+var rateHoldWarningDays = 14
+
+// SetRateHoldWarning sets how many days before expiry rate holds are
+// flagged as expiring.
+func SetRateHoldWarning(days int) {
+	rateHoldWarningDays = days
+}
+
+// CommitmentsData lists an application's rate holds and commitment letters,
+// with the forms to record them when Editable.
+type CommitmentsData struct {
+	ApplicationID int
+	Editable      bool
+	Today         time.Time
+	WarnDays      int
+	Holds         []models.RateHold
+	Commitments   []models.Commitment
+	Lenders       []choice
+	Products      []choice
+}
+
+func loadCommitments(database *sql.DB, appID int, editable bool) (CommitmentsData, error) {
+	y, m, d := time.Now().Date()
+	data := CommitmentsData{
+		ApplicationID: appID, Editable: editable,
+		Today: time.Date(y, m, d, 0, 0, 0, 0, time.Local), WarnDays: rateHoldWarningDays,
+	}
+	var err error
+	if data.Holds, err = db.GetRateHolds(database, appID); err != nil {
+		return data, err
+	}
+	if data.Commitments, err = db.GetCommitments(database, appID); err != nil {
+		return data, err
+	}
+	if !editable {
+		return data, nil
+	}
+
+	lenders, err := db.GetLenders(database)
+	if err != nil {
+		return data, err
+	}
+	for _, l := range lenders {
+		if l.Active {
+			data.Lenders = append(data.Lenders, choice{Value: strconv.Itoa(l.ID), Label: l.Name})
+		}
+	}
+	products, err := db.GetActiveLenderProducts(database, data.Today)
+	if err != nil {
+		return data, err
+	}
+	for _, p := range products {
+		data.Products = append(data.Products, choice{
+			Value: strconv.Itoa(p.ID), Label: fmt.Sprintf("%s — %s (%s)", p.LenderName, p.Name, render.Percent(p.Rate)),
+		})
+	}
+	return data, nil
+}
+
+// parseDay reads a date field in the form's YYYY-MM-DD format.
+func parseDay(s string) (time.Time, bool) {
+	t, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(s), time.Local)
+	return t, err == nil
+}
+
+// commitmentsRedirect returns the broker to the application form with the
+// given success flag.
+func commitmentsRedirect(w http.ResponseWriter, r *http.Request, appID int, flag string) {
+	http.Redirect(w, r, "/application-form?id="+strconv.Itoa(appID)+"&"+flag+"=1#commitments", http.StatusSeeOther)
+}
+
+// parseRateHold reads the rate hold form. The product is optional; when it
+// is given it must be one of the lender's.
+func parseRateHold(database *sql.DB, r *http.Request) (models.RateHold, error) {
+	var h models.RateHold
+	var err error
+	if h.LenderID, err = strconv.Atoi(r.FormValue("lender_id")); err != nil {
+		return h, errors.New("Choose the lender holding the rate.")
+	}
+	if s := r.FormValue("product_id"); s != "" {
+		id, _ := strconv.Atoi(s)
+		p, err := db.GetLenderProduct(database, id)
+		if err != nil || p.LenderID != h.LenderID {
+			return h, errors.New("Choose one of the lender's products, or leave the product blank.")
+		}
+		h.ProductID = &p.ID
+	}
+	rate, ok := parseAmount(r.FormValue("rate"))
+	if !ok || rate <= 0 || rate >= 100 {
+		return h, errors.New("Rate must be a percentage above 0 and below 100.")
+	}
+	h.Rate = rate / 100
+	if h.HeldOn, ok = parseDay(r.FormValue("held_on")); !ok {
+		return h, errors.New("Enter the date the rate was held.")
+	}
+	if h.ExpiresOn, ok = parseDay(r.FormValue("expires_on")); !ok || h.ExpiresOn.Before(h.HeldOn) {
+		return h, errors.New("Enter an expiry date on or after the hold date.")
+	}
+	return h, nil
+}
+
+// CreateRateHold records a rate held for one of the broker's applications.
+func CreateRateHold(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/broker", http.StatusFound)
+			return
+		}
+		app := brokerApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		h, err := parseRateHold(database, r)
+		if err != nil {
+			renderApplicationForm(w, r, database, app, ApplicationFormData{ErrorMessage: err.Error()})
+			return
+		}
+		h.ApplicationID = app.ID
+		id, err := db.CreateRateHold(database, &h, GetUserFromContext(r).ID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error saving rate hold", "err", err)
+			renderApplicationForm(w, r, database, app, ApplicationFormData{ErrorMessage: "Could not save the rate hold. Please try again."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.RateHoldCreate, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+			Details: fmt.Sprintf("hold %d at %s until %s", id, render.Percent(h.Rate), render.Date(h.ExpiresOn)),
+		})
+		commitmentsRedirect(w, r, app.ID, "held")
+	}
+}
+
+// ReleaseRateHold ends a rate hold that is no longer needed, so no more
+// reminders are sent about it.
+func ReleaseRateHold(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/broker", http.StatusFound)
+			return
+		}
+		app := brokerApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		if err := db.ReleaseRateHold(database, app.ID, id); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logging.FromContext(r.Context()).Error("Error releasing rate hold", "err", err)
+			}
+			renderApplicationForm(w, r, database, app, ApplicationFormData{ErrorMessage: "Could not release the rate hold."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.RateHoldRelease, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+			Details: "hold " + strconv.Itoa(id),
+		})
+		commitmentsRedirect(w, r, app.ID, "released")
+	}
+}
+
+// CreateCommitment records a lender's commitment letter for one of the
+// broker's applications. Its conditions are added one at a time.
+func CreateCommitment(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/broker", http.StatusFound)
+			return
+		}
+		app := brokerApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		fail := func(msg string) {
+			renderApplicationForm(w, r, database, app, ApplicationFormData{ErrorMessage: msg})
+		}
+		c := models.Commitment{ApplicationID: app.ID}
+		var err error
+		var ok bool
+		if c.LenderID, err = strconv.Atoi(r.FormValue("lender_id")); err != nil {
+			fail("Choose the lender that issued the commitment.")
+			return
+		}
+		if c.IssuedOn, ok = parseDay(r.FormValue("issued_on")); !ok {
+			fail("Enter the date the commitment was issued.")
+			return
+		}
+		if c.ExpiresOn, ok = parseDay(r.FormValue("expires_on")); !ok || c.ExpiresOn.Before(c.IssuedOn) {
+			fail("Enter an expiry date on or after the issue date.")
+			return
+		}
+		id, err := db.CreateCommitment(database, &c, GetUserFromContext(r).ID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error saving commitment", "err", err)
+			fail("Could not save the commitment. Check that the lender still exists.")
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.CommitmentCreate, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+			Details: fmt.Sprintf("commitment %d expiring %s", id, render.Date(c.ExpiresOn)),
+		})
+		commitmentsRedirect(w, r, app.ID, "committed")
+	}
+}
+
+// AddCommitmentCondition adds a condition, and the date it must be met
+// by, to a commitment.
+func AddCommitmentCondition(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/broker", http.StatusFound)
+			return
+		}
+		app := brokerApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		fail := func(msg string) {
+			renderApplicationForm(w, r, database, app, ApplicationFormData{ErrorMessage: msg})
+		}
+		description := strings.TrimSpace(r.FormValue("description"))
+		if description == "" || len(description) > 500 {
+			fail("Describe the condition in 500 characters or less.")
+			return
+		}
+		dueOn, ok := parseDay(r.FormValue("due_on"))
+		if !ok {
+			fail("Enter the date the condition must be satisfied by.")
+			return
+		}
+		commitmentID, _ := strconv.Atoi(r.FormValue("commitment_id"))
+		if err := db.AddCommitmentCondition(database, app.ID, commitmentID, description, dueOn); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logging.FromContext(r.Context()).Error("Error adding commitment condition", "err", err)
+			}
+			fail("Could not add the condition.")
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.CommitmentConditionAdd, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+			Details: fmt.Sprintf("commitment %d: %s", commitmentID, description),
+		})
+		commitmentsRedirect(w, r, app.ID, "condition")
+	}
+}
+
+// SatisfyCommitmentCondition marks a commitment condition met.
+func SatisfyCommitmentCondition(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/broker", http.StatusFound)
+			return
+		}
+		app := brokerApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		if err := db.SatisfyCommitmentCondition(database, app.ID, id, GetUserFromContext(r).ID); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logging.FromContext(r.Context()).Error("Error satisfying commitment condition", "err", err)
+			}
+			renderApplicationForm(w, r, database, app, ApplicationFormData{ErrorMessage: "Could not update the condition."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.CommitmentConditionSatisfy, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+			Details: "condition " + strconv.Itoa(id),
+		})
+		commitmentsRedirect(w, r, app.ID, "satisfied")
+	}
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/notify"
+	"MortgageAgent/internal/render"
+	"MortgageAgent/internal/server"
+)
+
+// conditionUploadBytes caps a request answering a condition.
+const conditionUploadBytes = 32 << 20
+
+// ConditionsData lists an application's approval conditions. Admin shows the
+// forms to add, clear and return them; otherwise the broker's reply forms
+// are shown.
+type ConditionsData struct {
+	ApplicationID int
+	Admin         bool
+	// Open is set while the application is under review, the only time
+	// conditions can be added or answered.
+	Open       bool
+	Conditions []models.Condition
+	// Uncleared counts the conditions that still block approval.
+	Uncleared  int
+	Categories []choice
+}
+
+func loadConditions(database *sql.DB, app *models.Application, admin bool) (ConditionsData, error) {
+	data := ConditionsData{ApplicationID: app.ID, Admin: admin, Open: conditionsOpen(app)}
+	var err error
+	if data.Conditions, err = db.GetConditions(database, app.ID); err != nil {
+		return data, err
+	}
+	for _, c := range data.Conditions {
+		if c.Status != models.ConditionCleared {
+			data.Uncleared++
+		}
+	}
+	if admin {
+		data.Categories = choices(models.DocumentCategories, render.Humanize, nil)
+	}
+	return data, nil
+}
+
+// conditionsOpen reports whether the application is under review.
+func conditionsOpen(app *models.Application) bool {
+	return app.Status == models.StatusSubmitted || app.Status == models.StatusInReview
+}
+
+// conditionsRedirect returns the admin to the application with the given
+// success flag.
+func conditionsRedirect(w http.ResponseWriter, r *http.Request, appID int, flag string) {
+	http.Redirect(w, r, "/view-application?id="+strconv.Itoa(appID)+"&"+flag+"=1#conditions", http.StatusSeeOther)
+}
+
+// AddCondition adds a condition to an application the admin is reviewing,
+// optionally naming the document category that satisfies it.
+func AddCondition(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin-dashboard", http.StatusFound)
+			return
+		}
+		app := assignedApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		fail := func(msg string) {
+			renderViewApplication(w, r, database, app, ViewApplicationData{ErrorMessage: msg})
+		}
+		if !conditionsOpen(app) {
+			fail("Conditions can only be added while the application is under review.")
+			return
+		}
+		c := models.Condition{
+			ApplicationID: app.ID,
+			Description:   strings.TrimSpace(r.FormValue("description")),
+			Category:      r.FormValue("category"),
+		}
+		if c.Description == "" || len(c.Description) > 500 {
+			fail("Describe the condition in 500 characters or less.")
+			return
+		}
+		if c.Category != "" && !slices.Contains(models.DocumentCategories, c.Category) {
+			fail("Choose a valid document category.")
+			return
+		}
+		id, err := db.CreateCondition(database, &c, GetUserFromContext(r).ID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error adding condition", "err", err)
+			fail("Could not add the condition. Please try again.")
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.ConditionCreate, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+			Details: fmt.Sprintf("condition %d: %s", id, c.Description),
+		})
+		if err := notify.ConditionAdded(database, app, c.Description); err != nil {
+			logging.FromContext(r.Context()).Error("Error sending condition notification", "err", err)
+		}
+		conditionsRedirect(w, r, app.ID, "condition_added")
+	}
+}
+
+// ClearCondition signs off a condition, whether or not the broker has
+// answered it.
+func ClearCondition(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin-dashboard", http.StatusFound)
+			return
+		}
+		app := assignedApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		if err := db.ClearCondition(database, app.ID, id, GetUserFromContext(r).ID); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logging.FromContext(r.Context()).Error("Error clearing condition", "err", err)
+			}
+			renderViewApplication(w, r, database, app, ViewApplicationData{ErrorMessage: "Could not clear the condition."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.ConditionClear, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+			Details: "condition " + strconv.Itoa(id),
+		})
+		conditionsRedirect(w, r, app.ID, "condition_cleared")
+	}
+}
+
+// ReturnCondition sends the broker's answer to a condition back with a note
+// saying what is still needed.
+func ReturnCondition(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin-dashboard", http.StatusFound)
+			return
+		}
+		app := assignedApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		fail := func(msg string) {
+			renderViewApplication(w, r, database, app, ViewApplicationData{ErrorMessage: msg})
+		}
+		note := strings.TrimSpace(r.FormValue("note"))
+		if note == "" || len(note) > 1000 {
+			fail("Say what is still needed, in 1000 characters or less.")
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		if err := db.ReturnCondition(database, app.ID, id, note); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logging.FromContext(r.Context()).Error("Error returning condition", "err", err)
+			}
+			fail("Only answered conditions can be returned.")
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.ConditionReturn, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+			Details: "condition " + strconv.Itoa(id) + ": " + note,
+		})
+		if err := notify.ConditionReturned(database, app, note); err != nil {
+			logging.FromContext(r.Context()).Error("Error sending condition notification", "err", err)
+		}
+		conditionsRedirect(w, r, app.ID, "condition_returned")
+	}
+}
+
+// RespondToCondition answers a condition on one of the broker's
+// applications with a reply, an uploaded document or both, and submits it
+// for the admin to clear. The upload is filed under the condition's
+// document category, if it has one.
+func RespondToCondition(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/broker", http.StatusFound)
+			return
+		}
+		server.LimitUpload(w, r, conditionUploadBytes)
+		if err := r.ParseMultipartForm(conditionUploadBytes); err != nil {
+			renderError(w, r, http.StatusRequestEntityTooLarge, "Choose a file of at most 32 MB.")
+			return
+		}
+		app := brokerApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		fail := func(msg string) {
+			renderApplicationForm(w, r, database, app, ApplicationFormData{ErrorMessage: msg})
+		}
+		if !conditionsOpen(app) {
+			fail("Conditions can only be answered while the application is under review.")
+			return
+		}
+
+		conditions, err := db.GetConditions(database, app.ID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error fetching conditions", "err", err)
+			renderError(w, r, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		i := slices.IndexFunc(conditions, func(c models.Condition) bool { return c.ID == id })
+		if i < 0 || conditions[i].Status == models.ConditionCleared {
+			fail("That condition has already been cleared.")
+			return
+		}
+		c := conditions[i]
+
+		response := strings.TrimSpace(r.FormValue("response"))
+		if len(response) > 2000 {
+			fail("Keep your reply to 2000 characters or less.")
+			return
+		}
+		var documentID *int
+		if file, header, err := r.FormFile("file"); err == nil {
+			defer file.Close()
+			cat := c.Category
+			if cat == "" {
+				cat = models.CategoryCondition
+			}
+			docID, err := saveDocument(r, database, app.ID, cat, file, header)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("Error saving condition document", "category", cat, "err", err)
+				fail("Could not save the file. Please try again.")
+				return
+			}
+			documentID = &docID
+		}
+		if response == "" && documentID == nil {
+			fail("Reply to the condition or upload a document for it.")
+			return
+		}
+
+		if err := db.RespondToCondition(database, app.ID, c.ID, GetUserFromContext(r).ID, response, documentID); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logging.FromContext(r.Context()).Error("Error answering condition", "err", err)
+			}
+			fail("Could not answer the condition.")
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.ConditionRespond, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+			Details: "condition " + strconv.Itoa(c.ID),
+		})
+		if err := notify.ConditionAnswered(database, app, c.Description); err != nil {
+			logging.FromContext(r.Context()).Error("Error sending condition notification", "err", err)
+		}
+		http.Redirect(w, r, "/application-form?id="+strconv.Itoa(app.ID)+"&responded=1#conditions", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"MortgageAgent/internal/auth"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/jobs"
+)
+
+// Emails that carry a link to sign in or reset a password are queued with
+// only the IDs they are about. The link is put together when the email is
+// sent, so it is never stored in the job queue.
+const (
+	KindPasswordResetEmail = "password_reset_email"
+	KindBorrowerInvite     = "borrower_invite_email"
+)
+
+type passwordResetPayload struct {
+	UserID int `json:"user_id"`
+}
+
+type borrowerInvitePayload struct {
+	InviteID int `json:"invite_id"`
+}
+
+// queuePasswordReset queues the email with the user's current reset link.
+// A reset requested again before it is sent goes out once, with the newest
+// link.
+func queuePasswordReset(database *sql.DB, userID int) error {
+	_, err := jobs.Enqueue(database, KindPasswordResetEmail, passwordResetPayload{UserID: userID},
+		jobs.Options{UniqueKey: "password_reset:" + strconv.Itoa(userID)})
+	return err
+}
+
+// SendPasswordReset is the handler for KindPasswordResetEmail jobs. Nothing
+// is sent once the reset was used or has expired.
+func SendPasswordReset(database *sql.DB) jobs.Handler {
+	return func(_ context.Context, data []byte) error {
+		var p passwordResetPayload
+		if err := json.Unmarshal(data, &p); err != nil {
+			return jobs.Permanent(err)
+		}
+		email, token, err := db.GetResetToken(database, p.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		body := "Click the link below to reset your password:\n\n" + baseURL + "/reset-password?token=" + token
+		return jobs.Deliver(email, "Password Reset", body)
+	}
+}
+
+// queueBorrowerInvite queues the email inviting a borrower.
+func queueBorrowerInvite(database *sql.DB, inviteID int) error {
+	_, err := jobs.Enqueue(database, KindBorrowerInvite, borrowerInvitePayload{InviteID: inviteID}, jobs.Options{})
+	return err
+}
+
+// SendBorrowerInvite is the handler for KindBorrowerInvite jobs. Only the
+// hash of an invite's token is stored, so each attempt gives the invite a
+// new token for its link. Nothing is sent once the invite was used,
+// replaced or has expired.
+func SendBorrowerInvite(database *sql.DB) jobs.Handler {
+	return func(_ context.Context, data []byte) error {
+		var p borrowerInvitePayload
+		if err := json.Unmarshal(data, &p); err != nil {
+			return jobs.Permanent(err)
+		}
+		invite, err := db.GetBorrowerInvite(database, p.InviteID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		inviter, err := db.GetUserByID(database, invite.InvitedBy)
+		if err != nil {
+			return err
+		}
+		token, tokenHash, err := auth.NewInviteToken()
+		if err != nil {
+			return err
+		}
+		err = db.SetBorrowerInviteToken(database, invite.ID, tokenHash)
+		if errors.Is(err, db.ErrInviteUsed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		body := inviter.FirstName + " " + inviter.LastName + " has invited you to upload the documents for your mortgage application.\n\n" +
+			"Open this link within 7 days to create your account:\n\n" +
+			baseURL + "/borrower/invite?token=" + token + "\n\n" +
+			"If you were not expecting this email you can ignore it."
+		return jobs.Deliver(invite.Email, "Upload your mortgage documents", body)
+	}
+}
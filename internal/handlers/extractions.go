@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+)
+
+var taxYearRe = regexp.MustCompile(`^(19|20)\d\d$`)
+
+// cleanField checks a value the admin entered for an extracted field,
+// returning it in the form extraction stores and whether it is valid.
+// Amounts lose their dollar signs and commas.
+func cleanField(name, value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", true
+	}
+	if len(value) > 200 {
+		return "", false
+	}
+	switch name {
+	case models.FieldGrossPay, models.FieldYTDGross:
+		value = strings.NewReplacer("$", "", ",", "", " ", "").Replace(value)
+		amount, err := strconv.ParseFloat(value, 64)
+		return value, err == nil && amount >= 0
+	case models.FieldTaxYear:
+		return value, taxYearRe.MatchString(value)
+	}
+	return value, true
+}
+
+// ConfirmExtraction saves the figures an admin checked, and corrected
+// where needed, against an income document.
+func ConfirmExtraction(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin-dashboard", http.StatusFound)
+			return
+		}
+		app := assignedApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		logger := logging.FromContext(r.Context())
+		fail := func(msg string) {
+			renderViewApplication(w, r, database, app, ViewApplicationData{ErrorMessage: msg})
+		}
+		documentID, _ := strconv.Atoi(r.FormValue("document_id"))
+		extractions, err := db.GetExtractionsForApplication(database, app.ID)
+		if err != nil {
+			logger.Error("Error fetching extractions", "err", err)
+			fail("Could not save the figures. Please try again.")
+			return
+		}
+		e := extractions[documentID]
+		if e == nil {
+			fail("That document has no extracted figures.")
+			return
+		}
+
+		values := map[string]string{}
+		var corrected []string
+		for _, name := range models.ExtractionFields[e.DocType] {
+			value, ok := cleanField(name, r.FormValue("field_"+name))
+			if !ok {
+				fail("Enter a valid " + strings.ToLower(models.FieldLabels[name]) + ".")
+				return
+			}
+			values[name] = value
+			for _, f := range e.Fields {
+				if f.Name == name && f.ExtractedValue != value {
+					corrected = append(corrected, name)
+				}
+			}
+		}
+		if err := db.ConfirmExtractedFields(database, documentID, values, GetUserFromContext(r).ID, time.Now()); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logger.Error("Error confirming extracted fields", "err", err)
+			}
+			fail("Could not save the figures. Please try again.")
+			return
+		}
+		details := "application " + strconv.Itoa(app.ID)
+		if len(corrected) > 0 {
+			details += ", corrected " + strings.Join(corrected, ", ")
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.DocumentFields, ResourceType: audit.ResourceDocument, ResourceID: strconv.Itoa(documentID),
+			Details: details,
+		})
+		http.Redirect(w, r, "/view-application?id="+strconv.Itoa(app.ID)+"&fields_confirmed=1#document-"+strconv.Itoa(documentID), http.StatusSeeOther)
+	}
+}
@@ -4,13 +4,17 @@ package handlers
 
 import (
 	"database/sql"
-	"log"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 
+	"MortgageAgent/internal/audit"
 	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/server"
 )
 
 // internal/handlers/file.go
@@ -23,48 +27,88 @@ func ServeDocument(database *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		filePath := r.URL.Query().Get("path")
-		if filePath == "" {
+		// Documents are addressed by ID so storage paths never appear in URLs
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
 			http.NotFound(w, r)
 			return
 		}
 
-		log.Printf("Admin ID %d requesting document with path: %s\n", user.ID, filePath)
+		logger := logging.FromContext(r.Context())
 
 		// Fetch the document details from the database to verify access
-		document, err := db.GetDocumentByPath(database, filePath)
+		document, err := db.GetDocumentByID(database, id)
 		if err != nil || document == nil {
-			log.Printf("Document not found for path: %s, error: %v\n", filePath, err)
+			logger.Info("Document not found", "document_id", id, "err", err)
 			http.NotFound(w, r)
 			return
 		}
 
+		logging.SetApplication(r.Context(), document.ApplicationID)
+		logger = logging.FromContext(r.Context())
+
 		// Verify that the document belongs to an application assigned to this admin
 		app, err := db.GetApplicationByID(database, strconv.Itoa(document.ApplicationID))
 		if err != nil || app == nil {
-			log.Printf("Application not found for ID: %d, error: %v\n", document.ApplicationID, err)
+			logger.Warn("Application not found for document", "err", err)
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
 		if app.AssignedAdminID == nil || *app.AssignedAdminID != user.ID {
-			log.Printf("Admin ID %d not authorized to access application ID %d\n", user.ID, app.ID)
+			logger.Warn("Admin not assigned to the document's application")
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
-		// Construct the full file path
-		fullPath := filepath.Join("", document.FilePath)
-		log.Printf("Serving file: %s to admin ID %d\n", fullPath, user.ID)
+		// Uploads are quarantined until the virus scan passes
+		if !document.Clean() {
+			logger.Warn("Refused document that has not passed the virus scan", "document_id", document.ID, "scan_status", document.ScanStatus)
+			renderError(w, r, http.StatusConflict, scanRefusal(document))
+			return
+		}
 
-		// Check if the file exists
-		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-			log.Printf("File does not exist: %s\n", fullPath)
+		if _, err := os.Stat(document.FilePath); os.IsNotExist(err) {
+			logger.Error("Document file missing from storage", "document_id", document.ID, "path", document.FilePath)
 			http.NotFound(w, r)
 			return
 		}
+		logger.Info("Serving document", "document_id", document.ID, "category", document.Category)
 
-		// Serve the file
-		http.ServeFile(w, r, fullPath)
+		if err := audit.Record(r, database, audit.Entry{
+			Action: audit.DocumentDownload, ResourceType: audit.ResourceDocument, ResourceID: strconv.Itoa(document.ID),
+			Details: "application " + strconv.Itoa(document.ApplicationID) + ", " + document.Category,
+		}); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		sendDocument(w, r, document, false)
+	}
+}
+
+// scanRefusal explains why a document that has not passed its virus scan
+// cannot be opened.
+func scanRefusal(document *db.Document) string {
+	switch document.ScanStatus {
+	case models.ScanInfected:
+		return "This file was found to contain malware (" + document.ScanResult + ") and has been deleted."
+	case models.ScanTooLarge:
+		return "This file was too large to scan for viruses and has been deleted."
+	}
+	return "This file is still being scanned for viruses. Please try again in a moment."
+}
+
+// sendDocument writes the document's file. Identity documents must never be
+// kept in shared or browser caches. Attachments are offered for download
+// under their stored name rather than displayed.
+func sendDocument(w http.ResponseWriter, r *http.Request, document *db.Document, attachment bool) {
+	w.Header().Set("Cache-Control", "no-store")
+	if attachment {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(document.FilePath)}))
+	}
+	if info, err := os.Stat(document.FilePath); err == nil {
+		server.AllowDownload(w, info.Size())
 	}
+	http.ServeFile(w, r, document.FilePath)
 }
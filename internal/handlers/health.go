@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/storage"
+)
+
+// readyTimeout bounds how long the readiness checks may take together.
+const readyTimeout = 2 * time.Second
+
+// Healthz reports that the process is up. It checks nothing else, so a
+// failing dependency does not get the process restarted.
+func Healthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("ok\n"))
+	}
+}
+
+// Readyz reports whether the server can take traffic: the database answers,
+// its migrations are current and upload storage is writable. It responds
+// 503 with the failing checks otherwise.
+func Readyz(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+
+		checks := map[string]string{
+			"database":   "ok",
+			"migrations": "ok",
+			"storage":    "ok",
+		}
+		ready := true
+		fail := func(name string, err error) {
+			logging.FromContext(r.Context()).Warn("Readiness check failed", "check", name, "err", err)
+			checks[name] = err.Error()
+			ready = false
+		}
+
+		if err := database.PingContext(ctx); err != nil {
+			fail("database", err)
+		} else if version, err := db.SchemaVersion(database); err != nil {
+			fail("migrations", err)
+		} else if version != db.LatestSchemaVersion() {
+			fail("migrations", fmt.Errorf("schema version %d, want %d", version, db.LatestSchemaVersion()))
+		}
+		if err := storage.CheckWritable(); err != nil {
+			fail("storage", err)
+		}
+
+		status := http.StatusOK
+		if !ready {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ready": ready, "checks": checks})
+	}
+}
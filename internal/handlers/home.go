@@ -1,21 +1,38 @@
 package handlers
 
 import (
-	"html/template"
+	"database/sql"
 	"net/http"
+
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
 )
 
-func BrokerLanding() http.Handler {
+func BrokerLanding(database *sql.DB) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := GetUserFromContext(r)
+		logger := logging.FromContext(r.Context())
+		conditions, err := db.GetOpenConditionsForBroker(database, user.ID)
+		if err != nil {
+			logger.Error("Error fetching open conditions", "err", err)
+		}
+		unread, err := db.GetUnreadMessageCounts(database, user.ID, false)
+		if err != nil {
+			logger.Error("Error counting unread messages", "err", err)
+		}
 		data := struct {
 			FirstName string
+			// Conditions are waiting on the broker's answer.
+			Conditions []models.OpenCondition
+			// Unread counts unread messages by application ID.
+			Unread map[int]int
 		}{
-			FirstName: user.FirstName,
+			FirstName:  user.FirstName,
+			Conditions: conditions,
+			Unread:     unread,
 		}
-		println(data.FirstName)
-		tmpl := template.Must(template.ParseFiles("internal/templates/broker.html"))
-		tmpl.Execute(w, data)
+		renderPage(w, r, "broker", data)
 	})
 }
 
@@ -27,15 +44,12 @@ func AdminLanding() http.Handler {
 		}{
 			FirstName: user.FirstName,
 		}
-		println(data.FirstName)
-		tmpl := template.Must(template.ParseFiles("internal/templates/admin_dashboard.html"))
-		tmpl.Execute(w, data)
+		renderPage(w, r, "admin", data)
 	})
 }
 
 func SignUpSuccessPage() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tmpl := template.Must(template.ParseFiles("internal/templates/signup_success.html"))
-		tmpl.Execute(w, nil)
+		renderPage(w, r, "signup_success", nil)
 	}
 }
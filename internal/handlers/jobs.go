@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+)
+
+// jobsShown is how many jobs the jobs page lists.
+const jobsShown = 100
+
+type JobsPageData struct {
+	ErrorMessage   string
+	SuccessMessage string
+	Jobs           []models.Job
+	Statuses       []string
+	// Status filters the list; empty shows every job.
+	Status string
+	Counts map[string]int
+}
+
+func renderJobs(w http.ResponseWriter, r *http.Request, database *sql.DB, status string, data JobsPageData) {
+	logger := logging.FromContext(r.Context())
+	if !slices.Contains(models.JobStatuses, status) {
+		status = ""
+	}
+	data.Status = status
+	data.Statuses = models.JobStatuses
+	var err error
+	if data.Jobs, err = db.GetJobs(database, status, jobsShown); err != nil {
+		logger.Error("Error fetching jobs", "err", err)
+		data.ErrorMessage = "Error fetching jobs. Please try again later."
+	}
+	if data.Counts, err = db.CountJobsByStatus(database); err != nil {
+		logger.Error("Error counting jobs", "err", err)
+		data.ErrorMessage = "Error fetching jobs. Please try again later."
+	}
+	renderPage(w, r, "jobs", data)
+}
+
+// JobsPage lists the background jobs so admins can see what is queued and
+// what has failed.
+func JobsPage(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		renderJobs(w, r, database, r.URL.Query().Get("status"), JobsPageData{})
+	}
+}
+
+// RetryJob queues a dead job to run again.
+func RetryJob(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin/jobs", http.StatusFound)
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		status := r.FormValue("status")
+		err := db.RetryJob(database, id, time.Now())
+		if err == sql.ErrNoRows {
+			renderJobs(w, r, database, status, JobsPageData{ErrorMessage: "Only dead jobs can be retried."})
+			return
+		}
+		if errors.Is(err, db.ErrJobDuplicate) {
+			renderJobs(w, r, database, status, JobsPageData{ErrorMessage: "Job " + strconv.Itoa(id) +
+				" was not retried because a newer job doing the same work is already queued or running."})
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error retrying job", "job_id", id, "err", err)
+			renderJobs(w, r, database, status, JobsPageData{ErrorMessage: "Could not retry the job. Please try again."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.JobRetry, ResourceType: audit.ResourceJob, ResourceID: strconv.Itoa(id),
+		})
+		renderJobs(w, r, database, status, JobsPageData{SuccessMessage: "Job " + strconv.Itoa(id) + " has been queued again."})
+	}
+}
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/calc"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/render"
+)
+
+type LendersPageData struct {
+	ErrorMessage   string
+	SuccessMessage string
+	Lenders        []models.Lender
+}
+
+func renderLenders(w http.ResponseWriter, r *http.Request, database *sql.DB, data LendersPageData) {
+	lenders, err := db.GetLenders(database)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching lenders", "err", err)
+		data.ErrorMessage = "Error fetching lenders. Please try again later."
+	}
+	data.Lenders = lenders
+	renderPage(w, r, "lenders", data)
+}
+
+// LendersPage lists the lender catalogue for admins to manage.
+func LendersPage(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		var data LendersPageData
+		if r.URL.Query().Get("saved") != "" {
+			data.SuccessMessage = "Product saved."
+		}
+		renderLenders(w, r, database, data)
+	}
+}
+
+// CreateLender adds a lender to the catalogue.
+func CreateLender(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin/lenders", http.StatusFound)
+			return
+		}
+		name := strings.TrimSpace(r.FormValue("name"))
+		if name == "" || len(name) > 100 {
+			renderLenders(w, r, database, LendersPageData{ErrorMessage: "Enter the lender's name."})
+			return
+		}
+		id, err := db.CreateLender(database, name)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error creating lender", "err", err)
+			renderLenders(w, r, database, LendersPageData{ErrorMessage: "Could not add the lender. Lender names must be unique."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.LenderCreate, ResourceType: audit.ResourceLender, ResourceID: strconv.Itoa(id), Details: name,
+		})
+		renderLenders(w, r, database, LendersPageData{SuccessMessage: name + " added."})
+	}
+}
+
+// SetLenderActive withdraws a lender, and so all of its products, from
+// matching, or restores it.
+func SetLenderActive(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin/lenders", http.StatusFound)
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		active := r.FormValue("active") == "1"
+		if err := db.SetLenderActive(database, id, active); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logging.FromContext(r.Context()).Error("Error updating lender", "err", err)
+			}
+			renderLenders(w, r, database, LendersPageData{ErrorMessage: "Could not update the lender."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.LenderUpdate, ResourceType: audit.ResourceLender, ResourceID: strconv.Itoa(id),
+			Details: activeLabel(active),
+		})
+		renderLenders(w, r, database, LendersPageData{SuccessMessage: "Lender " + activeLabel(active) + "."})
+	}
+}
+
+// SetProductActive withdraws a product from matching, or restores it.
+func SetProductActive(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin/lenders", http.StatusFound)
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		active := r.FormValue("active") == "1"
+		if err := db.SetLenderProductActive(database, id, active); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logging.FromContext(r.Context()).Error("Error updating product", "err", err)
+			}
+			renderLenders(w, r, database, LendersPageData{ErrorMessage: "Could not update the product."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.ProductUpdate, ResourceType: audit.ResourceProduct, ResourceID: strconv.Itoa(id),
+			Details: activeLabel(active),
+		})
+		renderLenders(w, r, database, LendersPageData{SuccessMessage: "Product " + activeLabel(active) + "."})
+	}
+}
+
+func activeLabel(active bool) string {
+	if active {
+		return "reactivated"
+	}
+	return "withdrawn"
+}
+
+// choice is one option of a select or set of checkboxes.
+type choice struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+func choices(values []string, label func(string) string, selected []string) []choice {
+	out := make([]choice, len(values))
+	for i, v := range values {
+		out[i] = choice{Value: v, Label: label(v), Selected: slices.Contains(selected, v)}
+	}
+	return out
+}
+
+type ProductFormData struct {
+	ErrorMessage string
+	// ProductID is empty for a new product.
+	ProductID     string
+	Form          url.Values
+	Lenders       []choice
+	RateTypes     []choice
+	PropertyTypes []choice
+	Provinces     []choice
+}
+
+func provinceName(code string) string {
+	return models.ProvinceNames[code]
+}
+
+func renderProductForm(w http.ResponseWriter, r *http.Request, database *sql.DB, data ProductFormData) {
+	lenders, err := db.GetLenders(database)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching lenders", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	form := data.Form
+	for _, l := range lenders {
+		id := strconv.Itoa(l.ID)
+		name := l.Name
+		if !l.Active {
+			name += " (withdrawn)"
+		}
+		data.Lenders = append(data.Lenders, choice{Value: id, Label: name, Selected: form.Get("lender_id") == id})
+	}
+	data.RateTypes = choices(models.RateTypes, render.Humanize, form["rate_type"])
+	data.PropertyTypes = choices(models.PropertyTypes, render.Humanize, form["property_types"])
+	data.Provinces = choices(models.Provinces, provinceName, form["provinces"])
+	renderPage(w, r, "lender_product", data)
+}
+
+// EditProduct shows and saves the form for a new product, or for the one
+// given by id.
+func EditProduct(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			data := ProductFormData{Form: url.Values{
+				"max_ltv": {"80"}, "max_gds": {percentValue(calc.MaxGDS)}, "max_tds": {percentValue(calc.MaxTDS)},
+				"term_months": {"60"}, "lender_id": {r.URL.Query().Get("lender_id")},
+			}}
+			if id := r.URL.Query().Get("id"); id != "" {
+				n, _ := strconv.Atoi(id)
+				p, err := db.GetLenderProduct(database, n)
+				if err != nil {
+					renderError(w, r, http.StatusNotFound, "Product not found")
+					return
+				}
+				data.ProductID = strconv.Itoa(p.ID)
+				data.Form = productForm(p)
+			}
+			renderProductForm(w, r, database, data)
+
+		case http.MethodPost:
+			data := ProductFormData{ProductID: r.FormValue("id"), Form: r.PostForm}
+			p, err := parseProduct(r.PostForm)
+			if err != nil {
+				data.ErrorMessage = err.Error()
+				renderProductForm(w, r, database, data)
+				return
+			}
+			if data.ProductID != "" {
+				if p.ID, err = strconv.Atoi(data.ProductID); err != nil {
+					renderError(w, r, http.StatusNotFound, "Product not found")
+					return
+				}
+			}
+			id, err := db.SaveLenderProduct(database, &p)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("Error saving product", "err", err)
+				data.ErrorMessage = "Could not save the product. Check that the lender still exists."
+				renderProductForm(w, r, database, data)
+				return
+			}
+			action := audit.ProductUpdate
+			if p.ID == 0 {
+				action = audit.ProductCreate
+			}
+			audit.Record(r, database, audit.Entry{
+				Action: action, ResourceType: audit.ResourceProduct, ResourceID: strconv.Itoa(id),
+				Details: fmt.Sprintf("%s at %s", p.Name, render.Percent(p.Rate)),
+			})
+			http.Redirect(w, r, "/admin/lenders?saved=1", http.StatusSeeOther)
+
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+// productForm fills the product form with a saved product.
+func productForm(p *models.LenderProduct) url.Values {
+	rate, minScore := "", ""
+	if p.Rate > 0 {
+		rate = percentValue(p.Rate)
+	}
+	if p.MinCreditScore > 0 {
+		minScore = strconv.Itoa(p.MinCreditScore)
+	}
+	return url.Values{
+		"lender_id":             {strconv.Itoa(p.LenderID)},
+		"name":                  {p.Name},
+		"rate":                  {rate},
+		"term_months":           {strconv.Itoa(p.TermMonths)},
+		"rate_type":             {p.RateType},
+		"max_ltv":               {percentValue(p.MaxLTV)},
+		"min_credit_score":      {minScore},
+		"max_gds":               {percentValue(p.MaxGDS)},
+		"max_tds":               {percentValue(p.MaxTDS)},
+		"property_types":        p.PropertyTypes,
+		"provinces":             p.Provinces,
+		"prepayment_privileges": {p.PrepaymentPrivileges},
+	}
+}
+
+// parseProduct reads the product form. Rates and ratios are entered as
+// percentages.
+func parseProduct(form url.Values) (models.LenderProduct, error) {
+	p := models.LenderProduct{
+		Name:                 strings.TrimSpace(form.Get("name")),
+		RateType:             form.Get("rate_type"),
+		PrepaymentPrivileges: strings.TrimSpace(form.Get("prepayment_privileges")),
+	}
+	var err error
+	if p.LenderID, err = strconv.Atoi(form.Get("lender_id")); err != nil {
+		return p, errors.New("Choose a lender.")
+	}
+	if p.Name == "" || len(p.Name) > 100 {
+		return p, errors.New("Enter the product's name.")
+	}
+	if !slices.Contains(models.RateTypes, p.RateType) {
+		return p, errors.New("Choose fixed or variable.")
+	}
+	if p.TermMonths, err = strconv.Atoi(strings.TrimSpace(form.Get("term_months"))); err != nil || p.TermMonths < 1 || p.TermMonths > 120 {
+		return p, errors.New("Term must be 1 to 120 months.")
+	}
+	if s := strings.TrimSpace(form.Get("min_credit_score")); s != "" {
+		if p.MinCreditScore, err = strconv.Atoi(s); err != nil || p.MinCreditScore < 0 || p.MinCreditScore > 900 {
+			return p, errors.New("Minimum credit score must be 900 or less.")
+		}
+	}
+	percents := []struct {
+		name, label string
+		dst         *float64
+	}{
+		{"rate", "Rate", &p.Rate},
+		{"max_ltv", "Maximum LTV", &p.MaxLTV},
+		{"max_gds", "Maximum GDS", &p.MaxGDS},
+		{"max_tds", "Maximum TDS", &p.MaxTDS},
+	}
+	for _, f := range percents {
+		v, ok := parseAmount(form.Get(f.name))
+		if !ok || v <= 0 || v >= 100 {
+			return p, fmt.Errorf("%s must be a percentage above 0 and below 100.", f.label)
+		}
+		*f.dst = v / 100
+	}
+	for _, t := range form["property_types"] {
+		if !slices.Contains(models.PropertyTypes, t) {
+			return p, errors.New("Choose valid property types.")
+		}
+		p.PropertyTypes = append(p.PropertyTypes, t)
+	}
+	for _, pr := range form["provinces"] {
+		if models.ProvinceNames[pr] == "" {
+			return p, errors.New("Choose valid provinces.")
+		}
+		p.Provinces = append(p.Provinces, pr)
+	}
+	return p, nil
+}
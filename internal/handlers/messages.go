@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/notify"
+	"MortgageAgent/internal/server"
+)
+
+// messageUploadBytes caps a message and its attachment.
+const messageUploadBytes = 32 << 20
+
+// MessagesData is an application's message thread as one user sees it.
+// Admin shows internal notes and the option to post them.
+type MessagesData struct {
+	ApplicationID int
+	Admin         bool
+	Messages      []models.Message
+	// LastRead is the newest message the user had read before this view;
+	// Unread counts the newer ones from other people.
+	LastRead int
+	Unread   int
+}
+
+// loadMessages loads the thread for user and marks it read.
+func loadMessages(database *sql.DB, app *models.Application, user *models.User, admin bool) (MessagesData, error) {
+	data := MessagesData{ApplicationID: app.ID, Admin: admin}
+	var err error
+	if data.Messages, err = db.GetMessages(database, app.ID, admin); err != nil {
+		return data, err
+	}
+	if data.LastRead, err = db.GetLastReadMessage(database, app.ID, user.ID); err != nil {
+		return data, err
+	}
+	for _, m := range data.Messages {
+		if m.ID > data.LastRead && m.AuthorID != user.ID {
+			data.Unread++
+		}
+	}
+	if n := len(data.Messages); n > 0 && data.Messages[n-1].ID > data.LastRead {
+		err = db.MarkMessagesRead(database, app.ID, user.ID, data.Messages[n-1].ID)
+	}
+	return data, err
+}
+
+// mentionPattern matches @name or @name@example.com.
+var mentionPattern = regexp.MustCompile(`(?:^|\s)@([\w.+-]+(?:@[\w-]+(?:\.[\w-]+)+)?)`)
+
+// mentionedUsers returns the admins, and unless the message is internal the
+// application's broker, mentioned in body by email address or by the part
+// of it before the @.
+func mentionedUsers(database *sql.DB, app *models.Application, body string, internal bool) ([]models.User, error) {
+	matches := mentionPattern.FindAllStringSubmatch(body, -1)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	candidates, err := db.GetUsersByType(database, "admin")
+	if err != nil {
+		return nil, err
+	}
+	if !internal {
+		broker, err := db.GetUserByID(database, app.BrokerID)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, *broker)
+	}
+
+	var users []models.User
+	for _, u := range candidates {
+		local, _, _ := strings.Cut(u.Email, "@")
+		for _, m := range matches {
+			if strings.EqualFold(m[1], u.Email) || strings.EqualFold(m[1], local) {
+				users = append(users, u)
+				break
+			}
+		}
+	}
+	return users, nil
+}
+
+// notifyMessage tells the other side of the thread, and everyone mentioned,
+// about a new message. Internal notes only go to the assigned admin and
+// those mentioned.
+func notifyMessage(r *http.Request, database *sql.DB, app *models.Application, m models.Message, author *models.User, mentioned []models.User) {
+	logger := logging.FromContext(r.Context())
+	recipients := map[int]bool{}
+	if app.AssignedAdminID != nil {
+		recipients[*app.AssignedAdminID] = true
+	}
+	if !m.Internal {
+		recipients[app.BrokerID] = true
+	}
+	for _, u := range mentioned {
+		recipients[u.ID] = true
+	}
+	delete(recipients, author.ID)
+
+	kind := "message"
+	if m.Internal {
+		kind = "internal note"
+	}
+	body := fmt.Sprintf("%s %s posted a new %s on application #%d:\n\n%s", author.FirstName, author.LastName, kind, app.ID, m.Body)
+	if m.DocumentID != nil {
+		body += "\n\nA file is attached."
+	}
+	for id := range recipients {
+		notify.Refresh(id)
+		user, err := db.GetUserByID(database, id)
+		if err != nil {
+			logger.Error("Error loading message recipient", "user_id", id, "err", err)
+			continue
+		}
+		err = notify.Send(database, models.Notification{
+			UserID: id, Kind: models.NotifyMessage, ApplicationID: app.ID,
+			Title: fmt.Sprintf("New %s on application #%d", kind, app.ID),
+			Body:  body,
+			Link:  notify.ApplicationLink(user.UserType, app.ID) + "#messages",
+		})
+		if err != nil {
+			logger.Error("Error sending message notification", "user_id", id, "err", err)
+		}
+	}
+}
+
+// postMessage adds the posted message, with any attachment, to app's
+// thread. It returns an error message for the user if it was refused.
+func postMessage(r *http.Request, database *sql.DB, app *models.Application, admin bool) string {
+	user := GetUserFromContext(r)
+	m := models.Message{
+		ApplicationID: app.ID,
+		AuthorID:      user.ID,
+		Body:          strings.TrimSpace(r.FormValue("body")),
+		Internal:      admin && r.FormValue("internal") == "1",
+	}
+	if len(m.Body) > 5000 {
+		return "Keep messages to 5000 characters or less."
+	}
+	file, header, err := r.FormFile("file")
+	attached := err == nil
+	if attached {
+		defer file.Close()
+	} else if m.Body == "" {
+		return "Write a message or attach a file."
+	}
+	logger := logging.FromContext(r.Context())
+	mentioned, err := mentionedUsers(database, app, m.Body, m.Internal)
+	if err != nil {
+		logger.Error("Error resolving mentions", "err", err)
+		return "Could not post the message. Please try again."
+	}
+	if attached {
+		docID, err := saveDocument(r, database, app.ID, models.CategoryMessage, file, header)
+		if err != nil {
+			logger.Error("Error saving message attachment", "err", err)
+			return "Could not save the attachment. Please try again."
+		}
+		m.DocumentID = &docID
+	}
+
+	ids := make([]int, len(mentioned))
+	for i, u := range mentioned {
+		ids[i] = u.ID
+	}
+	id, err := db.CreateMessage(database, &m, ids)
+	if err != nil {
+		logger.Error("Error posting message", "err", err)
+		return "Could not post the message. Please try again."
+	}
+	details := "message " + strconv.Itoa(id)
+	if m.Internal {
+		details = "internal note " + strconv.Itoa(id)
+	}
+	audit.Record(r, database, audit.Entry{
+		Action: audit.MessagePost, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+		Details: details,
+	})
+	notifyMessage(r, database, app, m, user, mentioned)
+	return ""
+}
+
+// PostBrokerMessage adds a message to the thread of one of the broker's
+// applications.
+func PostBrokerMessage(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/broker", http.StatusFound)
+			return
+		}
+		server.LimitUpload(w, r, messageUploadBytes)
+		if err := r.ParseMultipartForm(messageUploadBytes); err != nil {
+			renderError(w, r, http.StatusRequestEntityTooLarge, "Attach a file of at most 32 MB.")
+			return
+		}
+		app := brokerApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		if msg := postMessage(r, database, app, false); msg != "" {
+			renderApplicationForm(w, r, database, app, ApplicationFormData{ErrorMessage: msg})
+			return
+		}
+		http.Redirect(w, r, "/application-form?id="+strconv.Itoa(app.ID)+"#messages", http.StatusSeeOther)
+	}
+}
+
+// PostAdminMessage adds a message or internal note to the thread of an
+// application assigned to the admin.
+func PostAdminMessage(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin-dashboard", http.StatusFound)
+			return
+		}
+		server.LimitUpload(w, r, messageUploadBytes)
+		if err := r.ParseMultipartForm(messageUploadBytes); err != nil {
+			renderError(w, r, http.StatusRequestEntityTooLarge, "Attach a file of at most 32 MB.")
+			return
+		}
+		app := assignedApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		if msg := postMessage(r, database, app, true); msg != "" {
+			renderViewApplication(w, r, database, app, ViewApplicationData{ErrorMessage: msg})
+			return
+		}
+		http.Redirect(w, r, "/view-application?id="+strconv.Itoa(app.ID)+"#messages", http.StatusSeeOther)
+	}
+}
+
+// MessageAttachment downloads the file attached to a message on one of the
+// broker's applications. Admins open attachments as documents.
+func MessageAttachment(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+		m, err := db.GetMessage(database, id)
+		if err != nil || m.Internal || m.DocumentID == nil {
+			http.NotFound(w, r)
+			return
+		}
+		app := brokerApplication(w, r, database, strconv.Itoa(m.ApplicationID))
+		if app == nil {
+			return
+		}
+		document, err := db.GetDocumentByID(database, *m.DocumentID)
+		if err != nil || document == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if !document.Clean() {
+			renderError(w, r, http.StatusConflict, scanRefusal(document))
+			return
+		}
+		if err := audit.Record(r, database, audit.Entry{
+			Action: audit.DocumentDownload, ResourceType: audit.ResourceDocument, ResourceID: strconv.Itoa(document.ID),
+			Details: "application " + strconv.Itoa(document.ApplicationID) + ", " + document.Category,
+		}); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		sendDocument(w, r, document, true)
+	}
+}
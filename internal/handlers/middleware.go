@@ -1,40 +1,37 @@
 package handlers
 
 import (
-	"context"
 	"database/sql"
 	"net/http"
 
-	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/auth"
+	"MortgageAgent/internal/logging"
 	"MortgageAgent/internal/models"
 )
 
-type contextKey string
-
-var userContextKey = contextKey("user")
-
 func AuthMiddleware(next http.Handler, database *sql.DB, requiredRole string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("session_email")
-		if err != nil || cookie.Value == "" {
+		identity, err := auth.Authenticate(r, database)
+		if err != nil {
 			http.Redirect(w, r, "/", http.StatusFound)
 			return
 		}
+		user := identity.User
 
-		user, err := db.GetUserByEmail(database, cookie.Value)
-		if err != nil || user == nil {
-			http.Redirect(w, r, "/", http.StatusFound)
+		if requiredRole != "" && user.UserType != requiredRole {
+			http.Error(w, "Unauthorized Access", http.StatusForbidden)
 			return
 		}
 
-		if requiredRole != "" && user.UserType != requiredRole {
-			http.Error(w, "Unauthorized Access", http.StatusForbidden)
+		// Bearer tokens are limited to the scopes they were granted
+		if !identity.Allows(auth.ScopeFor(r.Method, requiredRole == "admin")) {
+			http.Error(w, "Token scope does not allow this request", http.StatusForbidden)
 			return
 		}
 
 		// Store user in context
-		ctx := context.WithValue(r.Context(), userContextKey, user)
-		r = r.WithContext(ctx)
+		logging.SetUser(r.Context(), user.ID)
+		r = r.WithContext(auth.WithUser(r.Context(), user))
 
 		next.ServeHTTP(w, r)
 	})
@@ -42,11 +39,17 @@ func AuthMiddleware(next http.Handler, database *sql.DB, requiredRole string) ht
 
 // Helper function to retrieve user from context
 func GetUserFromContext(r *http.Request) *models.User {
-	u, ok := r.Context().Value(userContextKey).(*models.User)
-	if !ok {
-		return nil
-	}
-	return u
+	return auth.UserFromContext(r.Context())
 }
 
-// GetUserFromContext retrieves the user from the request context.
+// SessionOnly rejects bearer-token requests, for pages such as token
+// management that must only be used from a logged-in browser.
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			http.Error(w, "This page cannot be used with an API token", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/notify"
+)
+
+// notificationsShown is how many notifications the inbox lists.
+const notificationsShown = 50
+
+// streamHeartbeat is how often an idle event stream sends a comment, so
+// proxies do not close it.
+const streamHeartbeat = 30 * time.Second
+
+// NotificationPreferenceRow is one kind of notification on the preferences
+// form.
+type NotificationPreferenceRow struct {
+	Label string
+	models.NotificationPreference
+}
+
+type NotificationsPageData struct {
+	User          *models.User
+	Notifications []models.Notification
+	Unread        int
+	Preferences   []NotificationPreferenceRow
+	// DigestFrequency is how often the user's digest is emailed.
+	DigestFrequency   string
+	DigestFrequencies []string
+	ErrorMessage      string
+	SuccessMessage    string
+}
+
+// notificationKinds lists the kinds of notification sent to the user.
+func notificationKinds(user *models.User) []models.NotificationKind {
+	var kinds []models.NotificationKind
+	for _, k := range models.NotificationKinds {
+		if slices.Contains(k.UserTypes, user.UserType) {
+			kinds = append(kinds, k)
+		}
+	}
+	return kinds
+}
+
+// notificationUser returns the signed-in user if they are an admin or
+// broker, the only users notifications are sent to.
+func notificationUser(w http.ResponseWriter, r *http.Request) *models.User {
+	user := GetUserFromContext(r)
+	if user.UserType != "admin" && user.UserType != "broker" {
+		http.Error(w, "Unauthorized Access", http.StatusForbidden)
+		return nil
+	}
+	return user
+}
+
+// publishUnread updates the unread count on the user's open pages.
+func publishUnread(database *sql.DB, userID int) error {
+	unread, err := db.CountUnreadNotifications(database, userID)
+	if err != nil {
+		return err
+	}
+	notify.Publish(userID, notify.Event{Name: notify.EventUnread, Data: map[string]int{"unread": unread}})
+	return nil
+}
+
+// NotificationsPage shows the user's inbox and how they want to be
+// notified.
+func NotificationsPage(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		user := notificationUser(w, r)
+		if user == nil {
+			return
+		}
+		logger := logging.FromContext(r.Context())
+		data := NotificationsPageData{User: user}
+		var err error
+		if data.Notifications, err = db.GetNotifications(database, user.ID, notificationsShown); err != nil {
+			logger.Error("Error fetching notifications", "err", err)
+			renderError(w, r, http.StatusInternalServerError, "Could not load your notifications")
+			return
+		}
+		if data.Unread, err = db.CountUnreadNotifications(database, user.ID); err != nil {
+			logger.Error("Error counting notifications", "err", err)
+			renderError(w, r, http.StatusInternalServerError, "Could not load your notifications")
+			return
+		}
+		prefs, err := db.GetNotificationPreferences(database, user.ID)
+		if err != nil {
+			logger.Error("Error fetching notification preferences", "err", err)
+			renderError(w, r, http.StatusInternalServerError, "Could not load your notifications")
+			return
+		}
+		for _, k := range notificationKinds(user) {
+			data.Preferences = append(data.Preferences, NotificationPreferenceRow{Label: k.Label, NotificationPreference: prefs[k.Kind]})
+		}
+		if data.DigestFrequency, err = db.GetDigestFrequency(database, user.ID); err != nil {
+			logger.Error("Error fetching digest frequency", "err", err)
+			renderError(w, r, http.StatusInternalServerError, "Could not load your notifications")
+			return
+		}
+		data.DigestFrequencies = models.DigestFrequencies
+		if r.URL.Query().Get("saved") == "1" {
+			data.SuccessMessage = "Your notification preferences have been saved."
+		}
+		renderPage(w, r, "notifications", data)
+	}
+}
+
+// OpenNotification marks a notification read and goes to the page it is
+// about.
+func OpenNotification(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := notificationUser(w, r)
+		if user == nil {
+			return
+		}
+		id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+		n, err := db.GetNotification(database, user.ID, id)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		logger := logging.FromContext(r.Context())
+		if n.ReadAt == nil {
+			if err := db.MarkNotificationRead(database, user.ID, n.ID, time.Now()); err != nil {
+				logger.Error("Error marking notification read", "err", err)
+			} else if err := publishUnread(database, user.ID); err != nil {
+				logger.Error("Error counting notifications", "err", err)
+			}
+		}
+		link := n.Link
+		if !strings.HasPrefix(link, "/") || strings.HasPrefix(link, "//") {
+			link = "/notifications"
+		}
+		http.Redirect(w, r, link, http.StatusFound)
+	}
+}
+
+// MarkNotificationsRead marks every notification in the user's inbox read.
+func MarkNotificationsRead(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/notifications", http.StatusFound)
+			return
+		}
+		user := notificationUser(w, r)
+		if user == nil {
+			return
+		}
+		logger := logging.FromContext(r.Context())
+		if err := db.MarkAllNotificationsRead(database, user.ID, time.Now()); err != nil {
+			logger.Error("Error marking notifications read", "err", err)
+		} else if err := publishUnread(database, user.ID); err != nil {
+			logger.Error("Error counting notifications", "err", err)
+		}
+		http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+	}
+}
+
+// SaveNotificationPreferences records, for every kind of notification the
+// user receives, whether it is shown in the app, emailed and included in
+// the digest, and how often the digest is sent.
+func SaveNotificationPreferences(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/notifications", http.StatusFound)
+			return
+		}
+		user := notificationUser(w, r)
+		if user == nil {
+			return
+		}
+		frequency := r.FormValue("digest_frequency")
+		if !slices.Contains(models.DigestFrequencies, frequency) {
+			http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+			return
+		}
+		var prefs []models.NotificationPreference
+		for _, k := range notificationKinds(user) {
+			prefs = append(prefs, models.NotificationPreference{
+				Kind:   k.Kind,
+				InApp:  r.FormValue("in_app_"+k.Kind) == "1",
+				Email:  r.FormValue("email_"+k.Kind) == "1",
+				Digest: r.FormValue("digest_"+k.Kind) == "1",
+			})
+		}
+		err := db.SaveNotificationPreferences(database, user.ID, prefs)
+		if err == nil {
+			err = db.SetDigestFrequency(database, user.ID, frequency)
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error saving notification preferences", "err", err)
+			renderError(w, r, http.StatusInternalServerError, "Could not save your preferences. Please try again.")
+			return
+		}
+		http.Redirect(w, r, "/notifications?saved=1", http.StatusSeeOther)
+	}
+}
+
+// NotificationStream sends the user's new notifications, unread count and
+// dashboard updates as server-sent events for as long as the page is open.
+func NotificationStream(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := notificationUser(w, r)
+		if user == nil {
+			return
+		}
+		logger := logging.FromContext(r.Context())
+		events, stop := notify.Subscribe(user.ID)
+		defer stop()
+
+		// The stream outlives the server's write timeout
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			logger.Error("Event stream not supported", "err", err)
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		unread, err := db.CountUnreadNotifications(database, user.ID)
+		if err != nil {
+			logger.Error("Error counting notifications", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Accel-Buffering", "no")
+		send := func(e notify.Event) error {
+			data, err := json.Marshal(e.Data)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Name, data); err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+		if err := send(notify.Event{Name: notify.EventUnread, Data: map[string]int{"unread": unread}}); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				if err := send(e); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+					return
+				}
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
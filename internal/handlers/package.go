@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/pdf"
+	"MortgageAgent/internal/render"
+	"MortgageAgent/internal/server"
+)
+
+// packageDocuments returns the application's current documents ordered by
+// category, then upload. A file re-uploaded under the same name replaces
+// the earlier one on disk, so only the latest row per file is kept. Files on
+// internal notes are left out, as packages are sent on to lenders.
+func packageDocuments(database *sql.DB, appID int) ([]db.Document, error) {
+	docs, err := db.GetDocumentsForApplication(database, appID, false)
+	if err != nil {
+		return nil, err
+	}
+	latest := map[string]db.Document{}
+	for _, d := range docs {
+		if cur, ok := latest[d.FilePath]; !ok || d.ID > cur.ID {
+			latest[d.FilePath] = d
+		}
+	}
+	order := map[string]int{}
+	for i, c := range models.DocumentCategories {
+		order[c] = i
+	}
+	var out []db.Document
+	for _, d := range latest {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		oi, iok := order[out[i].Category]
+		oj, jok := order[out[j].Category]
+		if !iok {
+			oi = len(order)
+		}
+		if !jok {
+			oj = len(order)
+		}
+		if oi != oj {
+			return oi < oj
+		}
+		if out[i].Category != out[j].Category {
+			return out[i].Category < out[j].Category
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+// DocumentPackage streams every current document of an application assigned
+// to the admin, either as a ZIP organised by category with a manifest or as
+// one PDF with a cover page and a bookmark per category. Files are read one
+// at a time, so the package is never held in memory.
+func DocumentPackage(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		app := assignedApplication(w, r, database, r.URL.Query().Get("id"))
+		if app == nil {
+			return
+		}
+		format := r.URL.Query().Get("format")
+		if format != "zip" && format != "pdf" {
+			renderError(w, r, http.StatusBadRequest, "Choose the zip or pdf format")
+			return
+		}
+
+		logger := logging.FromContext(r.Context())
+		docs, err := packageDocuments(database, app.ID)
+		if err != nil {
+			logger.Error("Error fetching documents", "err", err)
+			renderError(w, r, http.StatusInternalServerError, "Error fetching documents")
+			return
+		}
+		if len(docs) == 0 {
+			renderViewApplication(w, r, database, app, ViewApplicationData{ErrorMessage: "This application has no documents to download."})
+			return
+		}
+
+		if err := audit.Record(r, database, audit.Entry{
+			Action: audit.DocumentPackage, ResourceType: audit.ResourceApplication, ResourceID: strconv.Itoa(app.ID),
+			Details: format + ", " + strconv.Itoa(len(docs)) + " documents",
+		}); err != nil {
+			renderError(w, r, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		filename := "application-" + strconv.Itoa(app.ID) + "-documents." + format
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+		// A package of large scans takes longer to send than WRITE_TIMEOUT.
+		// Once streaming starts the status is sent, so failures can only be
+		// logged; the client sees a truncated download.
+		server.AllowDownload(w, packageSize(docs))
+		if format == "zip" {
+			w.Header().Set("Content-Type", "application/zip")
+			err = writeZipPackage(w, docs)
+		} else {
+			w.Header().Set("Content-Type", "application/pdf")
+			err = writePDFPackage(w, database, app, docs)
+		}
+		if err != nil {
+			logger.Error("Error streaming document package", "format", format, "err", err)
+		}
+	}
+}
+
+// packageSize adds up the sizes of the files a package will include.
+func packageSize(docs []db.Document) int64 {
+	var size int64
+	for _, d := range docs {
+		if info, err := os.Stat(d.FilePath); err == nil && d.Clean() {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// packageName is the name a document goes by in a package. Message
+// attachments can share a base name, so it leads with the document's ID.
+func packageName(d db.Document) string {
+	return strconv.Itoa(d.ID) + "-" + filepath.Base(d.FilePath)
+}
+
+// writeZipPackage writes each document under a folder named for its
+// category, then manifest.csv with each file's size and SHA-256.
+func writeZipPackage(w io.Writer, docs []db.Document) error {
+	zw := zip.NewWriter(w)
+	var manifest [][]string
+	for _, d := range docs {
+		name := d.Category + "/" + packageName(d)
+		row := []string{strconv.Itoa(d.ID), d.Category, name, d.UploadedAt}
+		if !d.Clean() {
+			manifest = append(manifest, append(row, "", "", "virus scan "+d.ScanStatus))
+			continue
+		}
+
+		f, err := os.Open(d.FilePath)
+		if err != nil {
+			manifest = append(manifest, append(row, "", "", "missing"))
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		entry, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: info.ModTime()})
+		if err != nil {
+			f.Close()
+			return err
+		}
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(entry, h), f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		manifest = append(manifest, append(row, strconv.FormatInt(n, 10), hex.EncodeToString(h.Sum(nil)), "included"))
+	}
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{Name: "manifest.csv", Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(entry)
+	cw.Write([]string{"document_id", "category", "file", "uploaded_at", "size", "sha256", "status"})
+	cw.WriteAll(manifest)
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writePDFPackage writes a cover page listing the package, then every
+// document: PDFs page by page, images one per page, and a note for files
+// that cannot be shown.
+func writePDFPackage(w io.Writer, database *sql.DB, app *models.Application, docs []db.Document) error {
+	pw := pdf.NewWriter(w)
+	pw.Title = "Application " + strconv.Itoa(app.ID) + " documents"
+
+	cover := []pdf.Line{
+		{Text: "Document Package", Size: 22, Bold: true},
+		{Text: "Application #" + strconv.Itoa(app.ID), Size: 14},
+		{},
+		{Text: "Type: " + render.Humanize(app.ApplicationType)},
+		{Text: "Status: " + render.Humanize(app.Status)},
+		{Text: "Created: " + render.DateTime(app.CreatedAt)},
+	}
+	if broker, err := db.GetUserByID(database, app.BrokerID); err == nil {
+		cover = append(cover, pdf.Line{Text: "Broker: " + broker.FirstName + " " + broker.LastName + " <" + broker.Email + ">"})
+	}
+	if app.ConsentAt != nil {
+		cover = append(cover, pdf.Line{Text: "Borrower e-consent: signed by " + app.ConsentName + " on " + render.DateTime(*app.ConsentAt)})
+	}
+	cover = append(cover, pdf.Line{Text: "Generated: " + render.DateTime(time.Now())}, pdf.Line{}, pdf.Line{Text: "Contents", Size: 14, Bold: true})
+	for i, d := range docs {
+		if i == 0 || d.Category != docs[i-1].Category {
+			cover = append(cover, pdf.Line{Text: render.Humanize(d.Category), Bold: true})
+		}
+		uploaded := d.UploadedAt
+		if t, err := time.Parse(time.RFC3339Nano, uploaded); err == nil {
+			uploaded = render.DateTime(t.Local())
+		}
+		cover = append(cover, pdf.Line{Text: "    " + packageName(d) + "  (uploaded " + uploaded + ")"})
+	}
+	pw.Bookmark(0, "Cover page")
+	pw.AddTextPages(cover)
+
+	for i, d := range docs {
+		if i == 0 || d.Category != docs[i-1].Category {
+			pw.Bookmark(0, render.Humanize(d.Category))
+		}
+		name := packageName(d)
+		pw.Bookmark(1, name)
+		if err := addPackageDocument(pw, d); err != nil {
+			pw.AddTextPages([]pdf.Line{
+				{Text: name, Size: 14, Bold: true},
+				{Text: render.Humanize(d.Category)},
+				{},
+				{Text: err.Error()},
+				{Text: "Download the ZIP package to get the original file."},
+			})
+		}
+	}
+	return pw.Close()
+}
+
+// addPackageDocument appends one document's pages, or returns an error
+// explaining to the reader why it cannot.
+func addPackageDocument(pw *pdf.Writer, d db.Document) error {
+	if !d.Clean() {
+		return errors.New("This file has not passed the virus scan.")
+	}
+	f, err := os.Open(d.FilePath)
+	if err != nil {
+		return errors.New("This file is missing from storage.")
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return errors.New("This file is missing from storage.")
+	}
+
+	head := make([]byte, 512)
+	n, _ := f.ReadAt(head, 0)
+	switch contentType := http.DetectContentType(head[:n]); contentType {
+	case "application/pdf":
+		if _, err := pw.ImportPages(f, info.Size()); err != nil {
+			if errors.Is(err, pdf.ErrEncrypted) {
+				return errors.New("This PDF is password protected and cannot be merged.")
+			}
+			return errors.New("This PDF could not be read and cannot be merged.")
+		}
+	case "image/jpeg", "image/png", "image/gif":
+		if err := pw.AddImagePage(f, info.Size()); err != nil {
+			if errors.Is(err, pdf.ErrUnsupportedImage) {
+				return errors.New("This image could not be read or is too large to include.")
+			}
+			return err
+		}
+	default:
+		return errors.New("Files of type " + contentType + " cannot be shown in a PDF.")
+	}
+	return nil
+}
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/ratesheet"
+	"MortgageAgent/internal/server"
+)
+
+// rateSheetBytes bounds the size of an uploaded rate sheet.
+const rateSheetBytes = 5 << 20
+
+// recentRateImports is how many past imports the rates page lists.
+const recentRateImports = 20
+
+type RatesPageData struct {
+	ErrorMessage   string
+	SuccessMessage string
+	// Problems lists everything wrong with a rejected sheet.
+	Problems []string
+	Form     url.Values
+	Lenders  []choice
+	Imports  []models.RateImport
+}
+
+func renderRates(w http.ResponseWriter, r *http.Request, database *sql.DB, data RatesPageData) {
+	logger := logging.FromContext(r.Context())
+	lenders, err := db.GetLenders(database)
+	if err != nil {
+		logger.Error("Error fetching lenders", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if data.Imports, err = db.GetRateImports(database, recentRateImports); err != nil {
+		logger.Error("Error fetching rate imports", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if data.Form == nil {
+		data.Form = url.Values{}
+	}
+	if data.Form.Get("effective_from") == "" {
+		data.Form.Set("effective_from", time.Now().Format("2006-01-02"))
+	}
+	for _, l := range lenders {
+		id := strconv.Itoa(l.ID)
+		data.Lenders = append(data.Lenders, choice{Value: id, Label: l.Name, Selected: data.Form.Get("lender_id") == id})
+	}
+	renderPage(w, r, "rates", data)
+}
+
+// RatesPage shows the rate sheet upload form and recent imports.
+func RatesPage(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		var data RatesPageData
+		switch {
+		case r.URL.Query().Get("mapped") != "":
+			data.SuccessMessage = "Rate sheet columns saved."
+		case r.URL.Query().Get("discarded") != "":
+			data.SuccessMessage = "Import discarded; no rates were changed."
+		}
+		data.Form = url.Values{"lender_id": {r.URL.Query().Get("lender_id")}}
+		renderRates(w, r, database, data)
+	}
+}
+
+// UploadRateSheet reads a rate sheet for a lender and, if every row is
+// valid, stores it as a pending import to preview.
+func UploadRateSheet(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin/rates", http.StatusFound)
+			return
+		}
+		server.LimitUpload(w, r, rateSheetBytes)
+		if err := r.ParseMultipartForm(rateSheetBytes); err != nil {
+			renderRates(w, r, database, RatesPageData{ErrorMessage: "Choose a rate sheet of at most 5 MB."})
+			return
+		}
+		data := RatesPageData{Form: url.Values{
+			"lender_id":      {r.FormValue("lender_id")},
+			"effective_from": {r.FormValue("effective_from")},
+			"effective_to":   {r.FormValue("effective_to")},
+		}}
+		fail := func(msg string) {
+			data.ErrorMessage = msg
+			renderRates(w, r, database, data)
+		}
+
+		lenderID, _ := strconv.Atoi(r.FormValue("lender_id"))
+		mapping, err := db.GetRateSheetMapping(database, lenderID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error fetching rate sheet mapping", "err", err)
+			fail("Could not read the rate sheet. Please try again.")
+			return
+		}
+		if mapping == nil {
+			fail("Set up the lender's rate sheet columns before importing.")
+			return
+		}
+		from, err := time.ParseInLocation("2006-01-02", r.FormValue("effective_from"), time.Local)
+		if err != nil {
+			fail("Enter the date the rates take effect.")
+			return
+		}
+		var to *time.Time
+		if s := r.FormValue("effective_to"); s != "" {
+			t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+			if err != nil {
+				fail("Enter a valid date for the rates to end, or leave it blank.")
+				return
+			}
+			to = &t
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			fail("Choose a rate sheet to upload.")
+			return
+		}
+		defer file.Close()
+		if !ratesheet.Supported(header.Filename) {
+			fail("Rate sheets must be .csv or .xlsx files.")
+			return
+		}
+
+		rows, err := readRateSheet(database, file, header.Filename, *mapping, from, to)
+		var problems ratesheet.Errors
+		if errors.As(err, &problems) {
+			data.Problems = problems
+			fail("The rate sheet was not imported. Correct these problems and upload it again.")
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error reading rate sheet", "err", err)
+			fail("Could not read the rate sheet. Please try again.")
+			return
+		}
+
+		user := GetUserFromContext(r)
+		imp := models.RateImport{
+			LenderID: lenderID, Filename: header.Filename, Source: models.RateSourceUpload, CreatedBy: &user.ID, Rows: rows,
+		}
+		id, err := db.CreateRateImport(database, &imp)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error storing rate import", "err", err)
+			fail("Could not read the rate sheet. Please try again.")
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.RateImportCreate, ResourceType: audit.ResourceRateImport, ResourceID: strconv.Itoa(id),
+			Details: fmt.Sprintf("%s: %d rates", header.Filename, len(rows)),
+		})
+		http.Redirect(w, r, "/admin/rates/import?id="+strconv.Itoa(id), http.StatusSeeOther)
+	}
+}
+
+// readRateSheet reads a sheet and matches it to the lender's products.
+func readRateSheet(database *sql.DB, file io.Reader, filename string, m models.RateSheetMapping, from time.Time, to *time.Time) ([]models.RateImportRow, error) {
+	rows, err := ratesheet.Read(file, filename, m)
+	if err != nil {
+		return nil, err
+	}
+	lenders, err := db.GetLenders(database)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lenders {
+		if l.ID == m.LenderID {
+			return ratesheet.Resolve(rows, l.Products, from, to, time.Now())
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// importRow is a rate import row with its change from the previous rate.
+type importRow struct {
+	models.RateImportRow
+	Change string
+}
+
+type RateImportData struct {
+	ErrorMessage   string
+	SuccessMessage string
+	Import         *models.RateImport
+	Rows           []importRow
+	// Changed counts the rows that set a new rate.
+	Changed int
+	// Unlisted are the lender's products the sheet leaves unchanged.
+	Unlisted []models.LenderProduct
+}
+
+// rateChange describes how a rate moves, in percentage points.
+func rateChange(previous, rate float64) string {
+	switch {
+	case previous == 0:
+		return "New"
+	case previous == rate:
+		return "Unchanged"
+	}
+	return fmt.Sprintf("%+.2f pts", (rate-previous)*100)
+}
+
+func renderRateImport(w http.ResponseWriter, r *http.Request, database *sql.DB, id int, data RateImportData) {
+	logger := logging.FromContext(r.Context())
+	imp, err := db.GetRateImport(database, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		renderError(w, r, http.StatusNotFound, "Import not found")
+		return
+	}
+	if err != nil {
+		logger.Error("Error fetching rate import", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	data.Import = imp
+
+	listed := map[int]bool{}
+	for _, row := range imp.Rows {
+		listed[row.ProductID] = true
+		change := rateChange(row.PreviousRate, row.Rate)
+		if change != "Unchanged" {
+			data.Changed++
+		}
+		data.Rows = append(data.Rows, importRow{RateImportRow: row, Change: change})
+	}
+	lenders, err := db.GetLenders(database)
+	if err != nil {
+		logger.Error("Error fetching lenders", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	for _, l := range lenders {
+		if l.ID != imp.LenderID {
+			continue
+		}
+		for _, p := range l.Products {
+			if !listed[p.ID] {
+				data.Unlisted = append(data.Unlisted, p)
+			}
+		}
+	}
+	renderPage(w, r, "rate_import", data)
+}
+
+// RateImportPage previews a rate import against the current rates, or shows
+// what an applied one changed.
+func RateImportPage(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+		var data RateImportData
+		if r.URL.Query().Get("applied") != "" {
+			data.SuccessMessage = "Rates applied."
+		}
+		renderRateImport(w, r, database, id, data)
+	}
+}
+
+// ApplyRateImport puts a pending import's rates into effect.
+func ApplyRateImport(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin/rates", http.StatusFound)
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		if err := db.ApplyRateImport(database, id); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logging.FromContext(r.Context()).Error("Error applying rate import", "err", err)
+			}
+			renderRateImport(w, r, database, id, RateImportData{ErrorMessage: "Could not apply the import. It may already have been applied or discarded."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.RateImportApply, ResourceType: audit.ResourceRateImport, ResourceID: strconv.Itoa(id),
+		})
+		http.Redirect(w, r, "/admin/rates/import?applied=1&id="+strconv.Itoa(id), http.StatusSeeOther)
+	}
+}
+
+// DiscardRateImport abandons a pending import.
+func DiscardRateImport(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin/rates", http.StatusFound)
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		if err := db.DiscardRateImport(database, id); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logging.FromContext(r.Context()).Error("Error discarding rate import", "err", err)
+			}
+			renderRateImport(w, r, database, id, RateImportData{ErrorMessage: "Could not discard the import. It may already have been applied or discarded."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.RateImportDiscard, ResourceType: audit.ResourceRateImport, ResourceID: strconv.Itoa(id),
+		})
+		http.Redirect(w, r, "/admin/rates?discarded=1", http.StatusSeeOther)
+	}
+}
+
+type RateMappingData struct {
+	ErrorMessage string
+	LenderID     int
+	LenderName   string
+	Form         url.Values
+}
+
+// RateSheetMapping shows and saves the columns read from a lender's rate
+// sheets.
+func RateSheetMapping(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(r.FormValue("lender_id"))
+		lenders, err := db.GetLenders(database)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error fetching lenders", "err", err)
+			renderError(w, r, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		data := RateMappingData{LenderID: id}
+		for _, l := range lenders {
+			if l.ID == id {
+				data.LenderName = l.Name
+			}
+		}
+		if data.LenderName == "" {
+			renderError(w, r, http.StatusNotFound, "Lender not found")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			m, err := db.GetRateSheetMapping(database, id)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("Error fetching rate sheet mapping", "err", err)
+				renderError(w, r, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if m == nil {
+				m = &models.RateSheetMapping{ProductColumn: "Product", RateColumn: "Rate"}
+			}
+			data.Form = url.Values{
+				"sheet":                 {m.Sheet},
+				"product_column":        {m.ProductColumn},
+				"rate_column":           {m.RateColumn},
+				"effective_from_column": {m.EffectiveFromColumn},
+				"effective_to_column":   {m.EffectiveToColumn},
+			}
+			renderPage(w, r, "rate_mapping", data)
+
+		case http.MethodPost:
+			data.Form = r.PostForm
+			m := models.RateSheetMapping{
+				LenderID:            id,
+				Sheet:               strings.TrimSpace(r.FormValue("sheet")),
+				ProductColumn:       strings.TrimSpace(r.FormValue("product_column")),
+				RateColumn:          strings.TrimSpace(r.FormValue("rate_column")),
+				EffectiveFromColumn: strings.TrimSpace(r.FormValue("effective_from_column")),
+				EffectiveToColumn:   strings.TrimSpace(r.FormValue("effective_to_column")),
+			}
+			if m.ProductColumn == "" || m.RateColumn == "" {
+				data.ErrorMessage = "Name the product and rate columns."
+				renderPage(w, r, "rate_mapping", data)
+				return
+			}
+			if err := db.SaveRateSheetMapping(database, &m); err != nil {
+				logging.FromContext(r.Context()).Error("Error saving rate sheet mapping", "err", err)
+				data.ErrorMessage = "Could not save the columns. Please try again."
+				renderPage(w, r, "rate_mapping", data)
+				return
+			}
+			audit.Record(r, database, audit.Entry{
+				Action: audit.RateSheetMapping, ResourceType: audit.ResourceLender, ResourceID: strconv.Itoa(id),
+				Details: fmt.Sprintf("product %q, rate %q", m.ProductColumn, m.RateColumn),
+			})
+			http.Redirect(w, r, "/admin/rates?mapped=1&lender_id="+strconv.Itoa(id), http.StatusSeeOther)
+
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
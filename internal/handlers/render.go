@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"MortgageAgent/internal/render"
+)
+
+var renderer *render.Renderer
+
+// baseURL is the public address used in links sent by email.
+var baseURL = "http://localhost:8080"
+
+// SetRenderer installs the renderer used by every HTML handler. It must be
+// called before the server starts.
+func SetRenderer(r *render.Renderer) {
+	renderer = r
+}
+
+// SetBaseURL sets the public address used in emailed links, without a
+// trailing slash.
+func SetBaseURL(url string) {
+	baseURL = url
+}
+
+// renderPage renders the named template from internal/templates.
+func renderPage(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	renderer.Render(w, r, name, data)
+}
+
+// renderError renders the shared error page with the given status.
+func renderError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	renderer.Error(w, r, status, message)
+}
+
+// CSRFFailed answers requests rejected by the CSRF middleware.
+func CSRFFailed(w http.ResponseWriter, r *http.Request) {
+	renderError(w, r, http.StatusForbidden, "Your session has expired or the form was submitted from another site. Please go back, reload the page and try again.")
+}
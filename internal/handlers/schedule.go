@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/calc"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/pdf"
+	"MortgageAgent/internal/render"
+	"MortgageAgent/internal/storage"
+)
+
+// scheduleFormRows is the number of renewal and prepayment rows on the
+// schedule form.
+const scheduleFormRows = 3
+
+// scheduleEntry is one renewal (year and rate) or prepayment (year and
+// amount) row of the schedule form.
+type scheduleEntry struct {
+	Year  string
+	Value string
+}
+
+type ScheduleData struct {
+	Form        url.Values
+	Frequencies []calc.Frequency
+	Renewals    []scheduleEntry
+	Prepayments []scheduleEntry
+	// ApplicationID is set when the schedule was opened from one of the
+	// broker's draft applications, so it can be attached to it.
+	ApplicationID string
+
+	Plan    calc.Plan
+	Rows    []calc.Row
+	Summary calc.Summary
+	// ExportQuery is the form encoded for the CSV and PDF links.
+	ExportQuery  string
+	ErrorMessage string
+}
+
+// PaymentSchedule shows brokers an amortization schedule for any payment
+// frequency, with renewals and prepayments, as a table or exported with
+// format=csv or format=pdf. Opened with only an application_id, it starts
+// from the application's financial details.
+func PaymentSchedule(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		form := r.URL.Query()
+		data := ScheduleData{Form: form, Frequencies: calc.Frequencies}
+
+		if id := form.Get("application_id"); id != "" {
+			app := brokerApplication(w, r, database, id)
+			if app == nil {
+				return
+			}
+			if app.Status == models.StatusDraft {
+				data.ApplicationID = strconv.Itoa(app.ID)
+			}
+			if form.Get("principal") == "" {
+				fin, err := db.GetApplicationFinancials(database, app.ID)
+				if err != nil {
+					logging.FromContext(r.Context()).Error("Error loading financials", "err", err)
+					renderError(w, r, http.StatusInternalServerError, "Internal server error")
+					return
+				}
+				if fin != nil {
+					if a, _ := assess(*fin); a != nil {
+						form.Set("principal", strconv.FormatFloat(a.TotalLoan, 'f', -1, 64))
+						form.Set("contract_rate", percentValue(a.ContractRate))
+						form.Set("amortization_years", strconv.Itoa(a.AmortizationYears))
+					}
+				}
+			}
+		}
+		data.Renewals = formEntries(form, "renewal_year", "renewal_rate")
+		data.Prepayments = formEntries(form, "prepayment_year", "prepayment_amount")
+
+		if form.Get("principal") == "" {
+			renderPage(w, r, "schedule", data)
+			return
+		}
+		plan, rows, err := buildSchedule(form)
+		if err != nil {
+			data.ErrorMessage = err.Error()
+			renderPage(w, r, "schedule", data)
+			return
+		}
+
+		switch form.Get("format") {
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "payment-schedule.csv"}))
+			if err := writeScheduleCSV(w, rows); err != nil {
+				logging.FromContext(r.Context()).Error("Error writing schedule CSV", "err", err)
+			}
+		case "pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "payment-schedule.pdf"}))
+			if err := writeSchedulePDF(w, plan, rows); err != nil {
+				logging.FromContext(r.Context()).Error("Error writing schedule PDF", "err", err)
+			}
+		default:
+			data.Plan, data.Rows = plan, rows
+			data.Summary = calc.Summarize(rows, plan.Frequency.PeriodsPerYear())
+			export := url.Values{}
+			for k, v := range form {
+				if k != "format" {
+					export[k] = v
+				}
+			}
+			data.ExportQuery = export.Encode()
+			renderPage(w, r, "schedule", data)
+		}
+	}
+}
+
+// AttachSchedule saves a schedule as a PDF on one of the broker's draft
+// applications, where it is listed with the uploaded documents.
+func AttachSchedule(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/broker", http.StatusFound)
+			return
+		}
+		app := brokerApplication(w, r, database, r.FormValue("application_id"))
+		if app == nil {
+			return
+		}
+		if app.Status != models.StatusDraft {
+			renderApplicationForm(w, r, database, app, ApplicationFormData{ErrorMessage: "This application has already been submitted."})
+			return
+		}
+		plan, rows, err := buildSchedule(r.PostForm)
+		if err != nil {
+			renderError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		logger := logging.FromContext(r.Context())
+		var buf bytes.Buffer
+		if err := writeSchedulePDF(&buf, plan, rows); err != nil {
+			logger.Error("Error generating schedule PDF", "err", err)
+			renderError(w, r, http.StatusInternalServerError, "Could not generate the schedule")
+			return
+		}
+		name := "payment-schedule-" + time.Now().Format("20060102-150405") + ".pdf"
+		filePath, err := storage.SaveGenerated(app.ID, models.CategoryPaymentSchedule, name, &buf)
+		if err != nil {
+			logger.Error("Error saving schedule", "err", err)
+			renderError(w, r, http.StatusInternalServerError, "Could not save the schedule")
+			return
+		}
+		docID, err := db.AddGeneratedDocument(database, app.ID, models.CategoryPaymentSchedule, filePath)
+		if err != nil {
+			os.Remove(filePath)
+			logger.Error("Error recording schedule", "err", err)
+			renderError(w, r, http.StatusInternalServerError, "Could not save the schedule")
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.DocumentGenerate, ResourceType: audit.ResourceDocument, ResourceID: strconv.Itoa(docID),
+			Details: "payment schedule for application " + strconv.Itoa(app.ID),
+		})
+		http.Redirect(w, r, "/application-form?id="+strconv.Itoa(app.ID)+"&attached=1", http.StatusSeeOther)
+	}
+}
+
+// formEntries pairs up the repeated year and value fields of the
+// schedule form, padded to scheduleFormRows rows.
+func formEntries(form url.Values, yearField, valueField string) []scheduleEntry {
+	years, values := form[yearField], form[valueField]
+	entries := make([]scheduleEntry, max(scheduleFormRows, len(years), len(values)))
+	for i := range entries {
+		if i < len(years) {
+			entries[i].Year = years[i]
+		}
+		if i < len(values) {
+			entries[i].Value = values[i]
+		}
+	}
+	return entries
+}
+
+// buildSchedule reads the schedule form and amortizes it. Renewals take
+// effect from the first payment after the given year; prepayments are
+// made with the last payment of their year.
+func buildSchedule(form url.Values) (calc.Plan, []calc.Row, error) {
+	plan := calc.Plan{Frequency: calc.Frequency(form.Get("frequency"))}
+	if plan.Frequency == "" {
+		plan.Frequency = calc.Monthly
+	}
+	ppy := plan.Frequency.PeriodsPerYear()
+
+	var ok bool
+	if plan.Principal, ok = parseAmount(form.Get("principal")); !ok {
+		return plan, nil, errors.New("Mortgage amount must be a number.")
+	}
+	if plan.Rate, ok = parseAmount(form.Get("contract_rate")); !ok {
+		return plan, nil, errors.New("Interest rate must be a number.")
+	}
+	plan.Rate /= 100
+	if plan.ExtraPayment, ok = parseAmount(form.Get("extra_payment")); !ok {
+		return plan, nil, errors.New("Extra payment must be a number.")
+	}
+	years, err := strconv.Atoi(strings.TrimSpace(form.Get("amortization_years")))
+	if err != nil {
+		return plan, nil, errors.New("Amortization must be a whole number of years.")
+	}
+	plan.AmortizationYears = years
+	if s := form.Get("first_payment"); s != "" {
+		if plan.FirstPayment, err = time.Parse("2006-01-02", s); err != nil {
+			return plan, nil, errors.New("First payment must be a date.")
+		}
+	}
+
+	for _, e := range formEntries(form, "renewal_year", "renewal_rate") {
+		if strings.TrimSpace(e.Year) == "" && strings.TrimSpace(e.Value) == "" {
+			continue
+		}
+		year, err := strconv.Atoi(strings.TrimSpace(e.Year))
+		rate, ok := parseAmount(e.Value)
+		if err != nil || !ok || e.Value == "" {
+			return plan, nil, errors.New("Each renewal needs the year it follows and a rate.")
+		}
+		plan.Renewals = append(plan.Renewals, calc.Renewal{Payment: year*ppy + 1, Rate: rate / 100})
+	}
+	for _, e := range formEntries(form, "prepayment_year", "prepayment_amount") {
+		if strings.TrimSpace(e.Year) == "" && strings.TrimSpace(e.Value) == "" {
+			continue
+		}
+		year, err := strconv.Atoi(strings.TrimSpace(e.Year))
+		amount, ok := parseAmount(e.Value)
+		if err != nil || !ok {
+			return plan, nil, errors.New("Each prepayment needs a year and an amount.")
+		}
+		plan.Prepayments = append(plan.Prepayments, calc.Prepayment{Payment: year * ppy, Amount: amount})
+	}
+
+	rows, err := plan.Amortize()
+	if err != nil {
+		return plan, nil, errors.New(inputError(err))
+	}
+	return plan, rows, nil
+}
+
+// writeScheduleCSV writes one row per payment with plain numbers.
+func writeScheduleCSV(w io.Writer, rows []calc.Row) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"payment", "date", "rate_percent", "payment_amount", "interest", "principal", "prepayment", "balance"})
+	amount := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	for _, row := range rows {
+		date := ""
+		if !row.Date.IsZero() {
+			date = row.Date.Format("2006-01-02")
+		}
+		cw.Write([]string{
+			strconv.Itoa(row.Number), date, strconv.FormatFloat(row.Rate*100, 'f', -1, 64),
+			amount(row.Payment), amount(row.Interest), amount(row.Principal), amount(row.Prepayment), amount(row.Balance),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeSchedulePDF writes the plan and its totals, then a table of every
+// payment.
+func writeSchedulePDF(w io.Writer, plan calc.Plan, rows []calc.Row) error {
+	pw := pdf.NewWriter(w)
+	pw.Title = "Payment schedule"
+	summary := calc.Summarize(rows, plan.Frequency.PeriodsPerYear())
+
+	heading := []pdf.Line{
+		{Text: "Payment Schedule", Size: 18, Bold: true},
+		{Text: "Mortgage amount: " + render.Currency(plan.Principal)},
+		{Text: "Rate: " + render.Percent(plan.Rate) + ", compounded semi-annually"},
+		{Text: fmt.Sprintf("Amortization: %d years, %s payments", plan.AmortizationYears, strings.ToLower(plan.Frequency.Label()))},
+	}
+	if len(rows) > 0 {
+		heading = append(heading, pdf.Line{Text: "Regular payment: " + render.Currency(rows[0].Payment)})
+	}
+	if plan.ExtraPayment > 0 {
+		heading = append(heading, pdf.Line{Text: "Extra with each payment: " + render.Currency(plan.ExtraPayment)})
+	}
+	for _, rn := range plan.Renewals {
+		heading = append(heading, pdf.Line{Text: fmt.Sprintf("Renewal from payment %d at %s", rn.Payment, render.Percent(rn.Rate))})
+	}
+	for _, pp := range plan.Prepayments {
+		heading = append(heading, pdf.Line{Text: fmt.Sprintf("Prepayment of %s with payment %d", render.Currency(pp.Amount), pp.Payment)})
+	}
+	heading = append(heading,
+		pdf.Line{Text: fmt.Sprintf("Paid off in %d payments (%.1f years); total interest %s", summary.Payments, summary.Years, render.Currency(summary.Interest))},
+		pdf.Line{Text: "Generated " + render.DateTime(time.Now())},
+		pdf.Line{},
+	)
+
+	cols := []pdf.Column{
+		{Title: "#", Width: 30, Right: true},
+		{Title: "Date", Width: 70},
+		{Title: "Rate", Width: 44, Right: true},
+		{Title: "Payment", Width: 66, Right: true},
+		{Title: "Interest", Width: 66, Right: true},
+		{Title: "Principal", Width: 66, Right: true},
+		{Title: "Prepayment", Width: 66, Right: true},
+		{Title: "Balance", Width: 96, Right: true},
+	}
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		date := ""
+		if !row.Date.IsZero() {
+			date = render.Date(row.Date)
+		}
+		prepayment := ""
+		if row.Prepayment > 0 {
+			prepayment = render.Currency(row.Prepayment)
+		}
+		cells[i] = []string{
+			strconv.Itoa(row.Number), date, render.Percent(row.Rate), render.Currency(row.Payment),
+			render.Currency(row.Interest), render.Currency(row.Principal), prepayment, render.Currency(row.Balance),
+		}
+	}
+	pw.AddTable(heading, cols, cells)
+	return pw.Close()
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/auth"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+)
+
+// tokenExpiryDays are the lifetimes offered for personal access tokens; 0 means never.
+var tokenExpiryDays = []int{30, 90, 365, 0}
+
+type SettingsPageData struct {
+	User         *models.User
+	Scopes       []string
+	ExpiryDays   []int
+	Tokens       []models.APIToken
+	Clients      []models.OAuthClient
+	Now          time.Time
+	ErrorMessage string
+	// NewToken and NewClientID/NewClientSecret are shown once, right after creation.
+	NewToken        string
+	NewClientID     string
+	NewClientSecret string
+}
+
+// grantableScopes lists the scopes a user may give their tokens.
+func grantableScopes(user *models.User) []string {
+	if user.UserType == "admin" {
+		return auth.Scopes
+	}
+	return []string{auth.ScopeRead, auth.ScopeWrite}
+}
+
+func renderSettings(w http.ResponseWriter, r *http.Request, database *sql.DB, user *models.User, data SettingsPageData) {
+	tokens, err := db.GetPersonalAPITokens(database, user.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching API tokens", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Could not load your API tokens")
+		return
+	}
+	clients, err := db.GetOAuthClientsForUser(database, user.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching OAuth clients", "err", err)
+		renderError(w, r, http.StatusInternalServerError, "Could not load your service accounts")
+		return
+	}
+
+	data.User = user
+	data.Scopes = grantableScopes(user)
+	data.ExpiryDays = tokenExpiryDays
+	data.Tokens = tokens
+	data.Clients = clients
+	data.Now = time.Now()
+	renderPage(w, r, "settings", data)
+}
+
+// parseScopes reads the checked scopes, rejecting any the user may not grant.
+func parseScopes(r *http.Request, user *models.User) ([]string, bool) {
+	scopes := r.Form["scopes"]
+	if !auth.ValidScopes(scopes) {
+		return nil, false
+	}
+	allowed := grantableScopes(user)
+	for _, s := range scopes {
+		ok := false
+		for _, a := range allowed {
+			ok = ok || s == a
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+	return scopes, true
+}
+
+// SettingsPage shows the user's personal access tokens and service accounts.
+func SettingsPage(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		renderSettings(w, r, database, GetUserFromContext(r), SettingsPageData{})
+	}
+}
+
+// CreateTokenHandler creates a personal access token and shows it once.
+func CreateTokenHandler(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/settings", http.StatusFound)
+			return
+		}
+		user := GetUserFromContext(r)
+		r.ParseForm()
+
+		name := strings.TrimSpace(r.FormValue("name"))
+		scopes, ok := parseScopes(r, user)
+		days, err := strconv.Atoi(r.FormValue("expires_in_days"))
+		if name == "" || !ok || err != nil || days < 0 {
+			renderSettings(w, r, database, user, SettingsPageData{ErrorMessage: "Give the token a name and at least one scope."})
+			return
+		}
+
+		token, err := auth.IssueToken(database, user.ID, nil, name, scopes, time.Duration(days)*24*time.Hour)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error creating API token", "err", err)
+			renderSettings(w, r, database, user, SettingsPageData{ErrorMessage: "Could not create the token. Please try again."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.TokenCreate, ResourceType: audit.ResourceToken,
+			Details: name + " (" + strings.Join(scopes, " ") + ")",
+		})
+		renderSettings(w, r, database, user, SettingsPageData{NewToken: token})
+	}
+}
+
+// RevokeTokenHandler revokes one of the user's personal access tokens.
+func RevokeTokenHandler(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			user := GetUserFromContext(r)
+			id, _ := strconv.Atoi(r.FormValue("id"))
+			if err := db.RevokeAPIToken(database, user.ID, id); err != nil {
+				logging.FromContext(r.Context()).Error("Error revoking API token", "err", err)
+			} else {
+				audit.Record(r, database, audit.Entry{Action: audit.TokenRevoke, ResourceType: audit.ResourceToken, ResourceID: strconv.Itoa(id)})
+			}
+		}
+		http.Redirect(w, r, "/settings", http.StatusFound)
+	}
+}
+
+// CreateClientHandler registers a service account for the client-credentials
+// grant and shows its secret once.
+func CreateClientHandler(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/settings", http.StatusFound)
+			return
+		}
+		user := GetUserFromContext(r)
+		r.ParseForm()
+
+		name := strings.TrimSpace(r.FormValue("name"))
+		scopes, ok := parseScopes(r, user)
+		if name == "" || !ok {
+			renderSettings(w, r, database, user, SettingsPageData{ErrorMessage: "Give the service account a name and at least one scope."})
+			return
+		}
+
+		clientID, secret, err := auth.CreateClient(database, user.ID, name, scopes)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error creating OAuth client", "err", err)
+			renderSettings(w, r, database, user, SettingsPageData{ErrorMessage: "Could not create the service account. Please try again."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.ClientCreate, ResourceType: audit.ResourceClient, ResourceID: clientID,
+			Details: name + " (" + strings.Join(scopes, " ") + ")",
+		})
+		renderSettings(w, r, database, user, SettingsPageData{NewClientID: clientID, NewClientSecret: secret})
+	}
+}
+
+// RevokeClientHandler revokes a service account and every token issued to it.
+func RevokeClientHandler(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			user := GetUserFromContext(r)
+			id, _ := strconv.Atoi(r.FormValue("id"))
+			if err := db.RevokeOAuthClient(database, user.ID, id); err != nil {
+				logging.FromContext(r.Context()).Error("Error revoking OAuth client", "err", err)
+			} else {
+				audit.Record(r, database, audit.Entry{Action: audit.ClientRevoke, ResourceType: audit.ResourceClient, ResourceID: strconv.Itoa(id)})
+			}
+		}
+		http.Redirect(w, r, "/settings", http.StatusFound)
+	}
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/auth"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+)
+
+// maxShareDownloads caps the download limit an admin may set on a link.
+const maxShareDownloads = 100
+
+// minSharePassword is the shortest password a share link may be given.
+const minSharePassword = 8
+
+// ShareExpiry is one lifetime offered for new share links.
+type ShareExpiry struct {
+	Label string
+	Hours int
+}
+
+var shareExpiries = []ShareExpiry{
+	{"1 hour", 1},
+	{"1 day", 24},
+	{"3 days", 72},
+	{"7 days", 168},
+}
+
+// ShareLink is a share link as listed on the application page.
+type ShareLink struct {
+	models.DocumentShare
+	Status string
+	// URL is only set while the link can still be used.
+	URL string
+}
+
+func shareLinks(shares []models.DocumentShare, now time.Time) []ShareLink {
+	var links []ShareLink
+	for _, s := range shares {
+		link := ShareLink{DocumentShare: s, Status: s.Status(now)}
+		if s.Active(now) {
+			link.URL = shareURL(s)
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+func shareURL(s models.DocumentShare) string {
+	token := auth.SignShareToken(auth.ShareToken{ShareID: s.ID, DocumentID: s.DocumentID, ExpiresAt: s.ExpiresAt})
+	return baseURL + "/share?t=" + token
+}
+
+// ShareDocument creates an expiring link to one document of an application
+// assigned to the admin.
+func ShareDocument(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin-dashboard", http.StatusFound)
+			return
+		}
+		docID, err := strconv.Atoi(r.FormValue("document_id"))
+		if err != nil {
+			renderError(w, r, http.StatusBadRequest, "Invalid document ID")
+			return
+		}
+		doc, err := db.GetDocumentByID(database, docID)
+		if err != nil {
+			renderError(w, r, http.StatusNotFound, "Document not found")
+			return
+		}
+		app := assignedApplication(w, r, database, strconv.Itoa(doc.ApplicationID))
+		if app == nil {
+			return
+		}
+		if !doc.Clean() {
+			renderError(w, r, http.StatusConflict, "Only documents that have passed the virus scan can be shared.")
+			return
+		}
+
+		recipient := strings.TrimSpace(r.FormValue("recipient"))
+		password := r.FormValue("password")
+		hours, _ := strconv.Atoi(r.FormValue("expires_hours"))
+		validExpiry := false
+		for _, e := range shareExpiries {
+			validExpiry = validExpiry || e.Hours == hours
+		}
+		var maxDownloads *int
+		var data ViewApplicationData
+		if v := strings.TrimSpace(r.FormValue("max_downloads")); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxShareDownloads {
+				data.ErrorMessage = "Download limit must be between 1 and " + strconv.Itoa(maxShareDownloads) + ", or left empty."
+			}
+			maxDownloads = &n
+		}
+		switch {
+		case data.ErrorMessage != "":
+		case recipient == "":
+			data.ErrorMessage = "Enter who the link is for."
+		case !validExpiry:
+			data.ErrorMessage = "Choose when the link expires."
+		case password != "" && len(password) < minSharePassword:
+			data.ErrorMessage = "Share passwords must be at least " + strconv.Itoa(minSharePassword) + " characters."
+		}
+		if data.ErrorMessage != "" {
+			renderViewApplication(w, r, database, app, data)
+			return
+		}
+
+		// Signed tokens carry whole seconds
+		expiresAt := time.Now().Add(time.Duration(hours) * time.Hour).Truncate(time.Second)
+		id, err := db.CreateDocumentShare(database, doc.ID, GetUserFromContext(r).ID, recipient, password, maxDownloads, expiresAt)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error creating share link", "document_id", doc.ID, "err", err)
+			renderViewApplication(w, r, database, app, ViewApplicationData{ErrorMessage: "Could not create the share link. Please try again."})
+			return
+		}
+
+		details := "document " + strconv.Itoa(doc.ID) + " (" + doc.Category + ") for " + recipient + ", expires " + expiresAt.UTC().Format(time.RFC3339)
+		if maxDownloads != nil {
+			details += ", max " + strconv.Itoa(*maxDownloads) + " downloads"
+		}
+		if password != "" {
+			details += ", password protected"
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.ShareCreate, ResourceType: audit.ResourceShare, ResourceID: strconv.Itoa(id),
+			Details: details,
+		})
+		http.Redirect(w, r, "/view-application?id="+strconv.Itoa(app.ID)+"&shared=1", http.StatusSeeOther)
+	}
+}
+
+// RevokeShare stops a share link from working.
+func RevokeShare(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin-dashboard", http.StatusFound)
+			return
+		}
+		id, err := strconv.Atoi(r.FormValue("share_id"))
+		if err != nil {
+			renderError(w, r, http.StatusBadRequest, "Invalid share link")
+			return
+		}
+		share, err := db.GetDocumentShare(database, id)
+		if err != nil {
+			renderError(w, r, http.StatusNotFound, "Share link not found")
+			return
+		}
+		app := assignedApplication(w, r, database, strconv.Itoa(share.ApplicationID))
+		if app == nil {
+			return
+		}
+
+		if err := db.RevokeDocumentShare(database, share.ID); err != nil {
+			logging.FromContext(r.Context()).Error("Error revoking share link", "share_id", share.ID, "err", err)
+			renderViewApplication(w, r, database, app, ViewApplicationData{ErrorMessage: "Could not revoke the share link. Please try again."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.ShareRevoke, ResourceType: audit.ResourceShare, ResourceID: strconv.Itoa(share.ID),
+			Details: "document " + strconv.Itoa(share.DocumentID),
+		})
+		http.Redirect(w, r, "/view-application?id="+strconv.Itoa(app.ID)+"&revoked=1", http.StatusSeeOther)
+	}
+}
+
+type SharedDocumentData struct {
+	ErrorMessage string
+	Token        string
+}
+
+// SharedDocument serves a document to whoever holds a valid share link. The
+// link's signature, expiry, revocation and download limit are all checked,
+// and a password-protected link first asks for its password. Every attempt,
+// successful or not, is audited.
+func SharedDocument(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		logger := logging.FromContext(r.Context())
+
+		deny := func(shareID, reason string, status int, message string) {
+			audit.Record(r, database, audit.Entry{
+				Action: audit.ShareDenied, ResourceType: audit.ResourceShare, ResourceID: shareID, Details: reason,
+			})
+			renderError(w, r, status, message)
+		}
+		const unavailable = "This link is invalid, has expired or is no longer available. Ask the sender for a new one."
+
+		token := r.FormValue("t")
+		tok, err := auth.ParseShareToken(token)
+		if err != nil {
+			deny("", "invalid signature", http.StatusNotFound, unavailable)
+			return
+		}
+		shareID := strconv.Itoa(tok.ShareID)
+		share, err := db.GetDocumentShare(database, tok.ShareID)
+		if err != nil || share.DocumentID != tok.DocumentID || !share.ExpiresAt.Equal(tok.ExpiresAt) {
+			deny(shareID, "unknown share", http.StatusNotFound, unavailable)
+			return
+		}
+		logging.SetApplication(r.Context(), share.ApplicationID)
+		now := time.Now()
+		if status := share.Status(now); status != "active" {
+			deny(shareID, status, http.StatusGone, unavailable)
+			return
+		}
+
+		if share.HasPassword {
+			data := SharedDocumentData{Token: token}
+			if r.Method == http.MethodGet {
+				renderPage(w, r, "shared_document", data)
+				return
+			}
+			ok, err := db.CheckSharePassword(database, share.ID, r.FormValue("password"))
+			if err != nil {
+				logger.Error("Error checking share password", "share_id", share.ID, "err", err)
+				renderError(w, r, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if !ok {
+				audit.Record(r, database, audit.Entry{
+					Action: audit.ShareDenied, ResourceType: audit.ResourceShare, ResourceID: shareID, Details: "wrong password",
+				})
+				data.ErrorMessage = "Incorrect password."
+				if share.FailedAttempts+1 >= models.MaxShareFailures {
+					data.Token = ""
+					data.ErrorMessage = "Too many incorrect passwords. This link has been locked; ask the sender for a new one."
+				}
+				renderPage(w, r, "shared_document", data)
+				return
+			}
+		}
+
+		doc, err := db.GetDocumentByID(database, share.DocumentID)
+		if err != nil {
+			logger.Error("Error loading shared document", "share_id", share.ID, "err", err)
+			renderError(w, r, http.StatusNotFound, unavailable)
+			return
+		}
+		if !doc.Clean() {
+			logger.Warn("Shared document has not passed the virus scan", "document_id", doc.ID, "scan_status", doc.ScanStatus)
+			renderError(w, r, http.StatusNotFound, unavailable)
+			return
+		}
+		if _, err := os.Stat(doc.FilePath); err != nil {
+			logger.Error("Shared document missing from storage", "document_id", doc.ID, "err", err)
+			renderError(w, r, http.StatusNotFound, unavailable)
+			return
+		}
+
+		if err := db.ClaimShareDownload(database, share.ID, now); err != nil {
+			if !errors.Is(err, db.ErrShareUnavailable) {
+				logger.Error("Error counting share download", "share_id", share.ID, "err", err)
+				renderError(w, r, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			deny(shareID, "no longer available", http.StatusGone, unavailable)
+			return
+		}
+		if err := audit.Record(r, database, audit.Entry{
+			Action: audit.ShareDownload, ResourceType: audit.ResourceShare, ResourceID: shareID,
+			Details: "document " + strconv.Itoa(doc.ID) + " (" + doc.Category + ") for " + share.Recipient,
+		}); err != nil {
+			renderError(w, r, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		logger.Info("Serving shared document", "share_id", share.ID, "document_id", doc.ID)
+		sendDocument(w, r, doc, true)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/logging"
+	"MortgageAgent/internal/models"
+)
+
+type UsersPageData struct {
+	ErrorMessage   string
+	SuccessMessage string
+	Users          []models.User
+	Roles          []string
+	CurrentUserID  int
+}
+
+func renderUsers(w http.ResponseWriter, r *http.Request, database *sql.DB, data UsersPageData) {
+	users, err := db.GetAllUsers(database)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching users", "err", err)
+		data.ErrorMessage = "Error fetching users. Please try again later."
+	}
+	data.Users = users
+	data.Roles = models.UserTypes
+	data.CurrentUserID = GetUserFromContext(r).ID
+	renderPage(w, r, "users", data)
+}
+
+// UsersPage lists every account so admins can change roles.
+func UsersPage(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		renderUsers(w, r, database, UsersPageData{})
+	}
+}
+
+// SetUserRole changes another user's role. Admins cannot change their own,
+// so there is always someone left who can undo a mistake.
+func SetUserRole(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, "/admin/users", http.StatusFound)
+			return
+		}
+		admin := GetUserFromContext(r)
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		role := r.FormValue("role")
+
+		valid := false
+		for _, t := range models.UserTypes {
+			valid = valid || role == t
+		}
+		if !valid {
+			renderUsers(w, r, database, UsersPageData{ErrorMessage: "Choose a valid role."})
+			return
+		}
+		if id == admin.ID {
+			renderUsers(w, r, database, UsersPageData{ErrorMessage: "You cannot change your own role."})
+			return
+		}
+
+		user, err := db.GetUserByID(database, id)
+		if err != nil {
+			renderUsers(w, r, database, UsersPageData{ErrorMessage: "User not found."})
+			return
+		}
+		if user.UserType == role {
+			http.Redirect(w, r, "/admin/users", http.StatusFound)
+			return
+		}
+		if err := db.SetUserType(database, user.ID, role); err != nil {
+			logging.FromContext(r.Context()).Error("Error changing user role", "target_user_id", user.ID, "err", err)
+			renderUsers(w, r, database, UsersPageData{ErrorMessage: "Could not change the role. Please try again."})
+			return
+		}
+		audit.Record(r, database, audit.Entry{
+			Action: audit.UserRoleChange, ResourceType: audit.ResourceUser, ResourceID: strconv.Itoa(user.ID),
+			Details: user.Email + ": " + user.UserType + " -> " + role,
+		})
+		renderUsers(w, r, database, UsersPageData{SuccessMessage: user.Email + " is now " + role + "."})
+	}
+}
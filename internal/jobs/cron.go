@@ -0,0 +1,169 @@
+package jobs
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/db"
+)
+
+// Schedule is a five-field cron expression: minute, hour, day of month,
+// month and day of week (0 is Sunday), in local time. Each field is *, a
+// number, a range a-b or a comma-separated list of them, optionally with a
+// /step.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// Like cron, when both days are restricted either may match.
+	domAny, dowAny bool
+}
+
+// ParseSchedule parses a cron expression such as "30 6 * * 1-5".
+func ParseSchedule(spec string) (Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("cron %q: want 5 fields, got %d", spec, len(fields))
+	}
+	var s Schedule
+	var err error
+	bounds := []struct {
+		set      *uint64
+		min, max int
+	}{{&s.minute, 0, 59}, {&s.hour, 0, 23}, {&s.dom, 1, 31}, {&s.month, 1, 12}, {&s.dow, 0, 6}}
+	for i, b := range bounds {
+		if *b.set, err = parseField(fields[i], b.min, b.max); err != nil {
+			return Schedule{}, fmt.Errorf("cron %q: %w", spec, err)
+		}
+	}
+	s.domAny, s.dowAny = fields[2] == "*", fields[4] == "*"
+	return s, nil
+}
+
+func parseField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			loText, hiText, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(loText); err != nil {
+				return 0, fmt.Errorf("bad value in %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiText); err != nil {
+					return 0, fmt.Errorf("bad range in %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (s Schedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// Next returns the first minute after t that the schedule matches, or the
+// zero time if there is none within five years.
+func (s Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+type recurring struct {
+	name     string
+	schedule Schedule
+	kind     string
+}
+
+var schedules []recurring
+
+// Cron queues a job of the given kind, with no payload, whenever spec
+// matches. Call it at startup for each recurring job.
+func Cron(name, spec, kind string) error {
+	s, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	schedules = append(schedules, recurring{name, s, kind})
+	return nil
+}
+
+// EnqueueDue queues every recurring job that has come due since it last
+// ran, once however many runs were missed. A new schedule starts from now.
+// Runs are recorded in the database with the job they queue, so restarts
+// and other servers do not queue them twice and a failure loses neither.
+func EnqueueDue(database *sql.DB, now time.Time) error {
+	for _, r := range schedules {
+		last, ok, err := db.GetJobSchedule(database, r.name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if err := db.StartJobSchedule(database, r.name, now); err != nil {
+				return err
+			}
+			continue
+		}
+		var due time.Time
+		for next := r.schedule.Next(last.In(now.Location())); !next.IsZero() && !next.After(now); next = r.schedule.Next(next) {
+			due = next
+		}
+		if due.IsZero() {
+			continue
+		}
+		j, err := newJob(r.kind, struct{}{}, Options{UniqueKey: "cron:" + r.name}, now)
+		if err != nil {
+			return err
+		}
+		if _, err := db.AdvanceJobSchedule(database, r.name, last, due, j, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
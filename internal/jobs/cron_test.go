@@ -0,0 +1,124 @@
+package jobs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"MortgageAgent/internal/db"
+)
+
+func TestScheduleNext(t *testing.T) {
+	at := func(y int, m time.Month, d, h, min int) time.Time { return time.Date(y, m, d, h, min, 0, 0, time.UTC) }
+	// 2026-06-01 is a Monday
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", at(2026, 6, 1, 10, 7), at(2026, 6, 1, 10, 8)},
+		{"*/15 * * * *", at(2026, 6, 1, 10, 7), at(2026, 6, 1, 10, 15)},
+		{"*/15 * * * *", at(2026, 6, 1, 10, 45), at(2026, 6, 1, 11, 0)},
+		{"5/20 * * * *", at(2026, 6, 1, 10, 26), at(2026, 6, 1, 10, 45)},
+		{"0 6 * * *", at(2026, 6, 1, 6, 0), at(2026, 6, 2, 6, 0)},
+		{"0 9,17 * * *", at(2026, 6, 1, 9, 30), at(2026, 6, 1, 17, 0)},
+		{"0,30 9-10 * * *", at(2026, 6, 1, 10, 30), at(2026, 6, 2, 9, 0)},
+		{"0 8-18/4 * * *", at(2026, 6, 1, 12, 1), at(2026, 6, 1, 16, 0)},
+		{"0 8-18/4 * * *", at(2026, 6, 1, 16, 30), at(2026, 6, 2, 8, 0)},
+		{"30 6 * * 1-5", at(2026, 6, 5, 7, 0), at(2026, 6, 8, 6, 30)},
+		{"0 0 * * 0", at(2026, 6, 1, 0, 0), at(2026, 6, 7, 0, 0)},
+		{"0 0 1 * *", at(2026, 6, 1, 0, 0), at(2026, 7, 1, 0, 0)},
+		{"0 0 31 * *", at(2026, 6, 1, 0, 0), at(2026, 7, 31, 0, 0)},
+		{"0 0 1 1 *", at(2026, 6, 1, 0, 0), at(2027, 1, 1, 0, 0)},
+		{"0 0 29 2 *", at(2026, 3, 1, 0, 0), at(2028, 2, 29, 0, 0)},
+		// Either day matches when both are restricted: the 13th or a Friday
+		{"0 0 13 * 5", at(2026, 6, 1, 0, 0), at(2026, 6, 5, 0, 0)},
+		{"0 0 13 * 5", at(2026, 6, 12, 0, 0), at(2026, 6, 13, 0, 0)},
+		{"0 0 13 * 5", at(2026, 6, 13, 0, 0), at(2026, 6, 19, 0, 0)},
+		{"0 0 30 2 *", at(2026, 6, 1, 0, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q after %v = %v, want %v", tt.spec, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"", "* * * *", "* * * * * *",
+		"60 * * * *", "* 24 * * *", "* * 0 * *", "* * 32 * *", "* * * 0 *", "* * * 13 *", "* * * * 7",
+		"*/0 * * * *", "*/x * * * *", "5-1 * * * *", "a * * * *", "1-b * * * *", "1,,2 * * * *",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestEnqueueDue(t *testing.T) {
+	database, err := db.InitDB(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := db.MigrateDB(database); err != nil {
+		t.Fatal(err)
+	}
+	saved := schedules
+	t.Cleanup(func() { schedules = saved })
+	schedules = nil
+	if err := Cron("digests", "0 * * * *", "digests"); err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2026, 6, 1, 0, 0, 0, 0, time.Local)
+	queued := func() int {
+		var n int
+		if err := database.QueryRow("SELECT COUNT(*) FROM jobs WHERE kind = 'digests'").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	lastRun := func() time.Time {
+		last, _, err := db.GetJobSchedule(database, "digests")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return last
+	}
+	steps := []struct {
+		at   time.Duration
+		jobs int
+		last time.Duration
+	}{
+		{10*time.Hour + 30*time.Minute, 0, 10*time.Hour + 30*time.Minute}, // starts the schedule
+		{10*time.Hour + 45*time.Minute, 0, 10*time.Hour + 30*time.Minute},
+		{13*time.Hour + 10*time.Minute, 1, 13 * time.Hour}, // once for the three missed runs
+		{13*time.Hour + 20*time.Minute, 1, 13 * time.Hour},
+	}
+	for _, s := range steps {
+		if err := EnqueueDue(database, day.Add(s.at)); err != nil {
+			t.Fatal(err)
+		}
+		if n, last := queued(), lastRun(); n != s.jobs || !last.Equal(day.Add(s.last)) {
+			t.Errorf("at %v: %d jobs, last run %v; want %d, %v", s.at, n, last, s.jobs, day.Add(s.last))
+		}
+	}
+
+	// A run whose job cannot be queued is not recorded, so it is retried
+	if _, err := database.Exec("DROP TABLE jobs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnqueueDue(database, day.Add(14*time.Hour+5*time.Minute)); err == nil {
+		t.Error("EnqueueDue succeeded without a jobs table")
+	}
+	if last := lastRun(); !last.Equal(day.Add(13 * time.Hour)) {
+		t.Errorf("last run %v after the failure, want it unchanged", last)
+	}
+}
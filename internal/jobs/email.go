@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"MortgageAgent/internal/mail"
+)
+
+// KindEmail sends one plain-text email.
+const KindEmail = "email"
+
+// EmailPayload is the payload of a KindEmail job. It is stored in the
+// queue as it is, so email with links that grant access is queued as its
+// own kind of job instead.
+type EmailPayload struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Email queues an email to be sent by a worker, retrying if the SMTP server
+// is unavailable.
+func Email(database *sql.DB, to, subject, body string) error {
+	_, err := Enqueue(database, KindEmail, EmailPayload{To: to, Subject: subject, Body: body}, Options{})
+	return err
+}
+
+// SendEmail is the handler for KindEmail jobs.
+func SendEmail(_ context.Context, payload []byte) error {
+	var p EmailPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return Permanent(err)
+	}
+	return Deliver(p.To, p.Subject, p.Body)
+}
+
+// Deliver sends an email from a job. Email that cannot be sent because
+// SMTP is not configured goes to the dead letters.
+func Deliver(to, subject, body string) error {
+	err := mail.Send(to, subject, body)
+	if errors.Is(err, mail.ErrDisabled) {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,197 @@
+// Package jobs runs slow work, such as sending email, in the background
+// from a queue kept in the database, so it survives restarts and is retried
+// when it fails.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/models"
+)
+
+// DefaultMaxAttempts is how many times a job runs before it is dead,
+// unless it is enqueued with another limit.
+const DefaultMaxAttempts = 5
+
+// Timeout bounds a single run of a job. Jobs still marked running after
+// twice as long are assumed lost and queued again.
+const Timeout = 10 * time.Minute
+
+// Retention is how long jobs that finished successfully are kept. Their
+// payloads may hold email addresses and messages, so they are not kept for
+// good.
+const Retention = 7 * 24 * time.Hour
+
+// Backoff before the first retry; it doubles with each failure up to
+// maxBackoff.
+const (
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+)
+
+// Handler does one job. An error marks the attempt failed; wrap it with
+// Permanent if retrying cannot help.
+type Handler func(ctx context.Context, payload []byte) error
+
+var registry = struct {
+	sync.RWMutex
+	handlers map[string]Handler
+}{handlers: map[string]Handler{}}
+
+// Register sets the handler for a kind of job. Call it at startup, before
+// the workers start.
+func Register(kind string, h Handler) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.handlers[kind] = h
+}
+
+func handler(kind string) Handler {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.handlers[kind]
+}
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job goes straight to the dead letters instead
+// of being retried.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Options adjust how a job is queued. The zero value runs it as soon as a
+// worker is free, with DefaultMaxAttempts.
+type Options struct {
+	// RunAt delays the job until the given time.
+	RunAt time.Time
+	// UniqueKey stops the job being queued while another with the same
+	// key is queued or running.
+	UniqueKey   string
+	MaxAttempts int
+}
+
+// Enqueue queues a job of the given kind with payload encoded as JSON. It
+// returns the job's ID, or 0 if a job with the same unique key is pending.
+func Enqueue(database *sql.DB, kind string, payload interface{}, opts Options) (int, error) {
+	now := time.Now()
+	j, err := newJob(kind, payload, opts, now)
+	if err != nil {
+		return 0, err
+	}
+	return db.EnqueueJob(database, j, now)
+}
+
+// newJob builds the job Enqueue queues at now.
+func newJob(kind string, payload interface{}, opts Options, now time.Time) (*models.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	j := models.Job{Kind: kind, Payload: string(data), UniqueKey: opts.UniqueKey, MaxAttempts: opts.MaxAttempts, RunAt: opts.RunAt}
+	if j.MaxAttempts <= 0 {
+		j.MaxAttempts = DefaultMaxAttempts
+	}
+	if j.RunAt.IsZero() {
+		j.RunAt = now
+	}
+	return &j, nil
+}
+
+// Work runs due jobs one after another until none are left or ctx is done.
+// Run it from several workers for concurrency; each job is claimed by
+// exactly one.
+func Work(ctx context.Context, database *sql.DB) error {
+	for ctx.Err() == nil {
+		j, err := db.ClaimJob(database, time.Now())
+		if err != nil || j == nil {
+			return err
+		}
+		if err := run(ctx, database, j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run does a claimed job and records the outcome. Only a failure to record
+// it is returned.
+func run(ctx context.Context, database *sql.DB, j *models.Job) error {
+	logger := slog.With("job_id", j.ID, "kind", j.Kind, "attempt", j.Attempts)
+	start := time.Now()
+	err := call(ctx, j)
+	now := time.Now()
+
+	switch {
+	case err == nil:
+		logger.Info("Job done", "duration_ms", now.Sub(start).Milliseconds())
+		return db.CompleteJob(database, j.ID, now)
+	case ctx.Err() != nil:
+		logger.Info("Job interrupted by shutdown")
+		return db.ReleaseJob(database, j.ID)
+	case errors.As(err, new(permanentError)) || j.Attempts >= j.MaxAttempts:
+		logger.Error("Job failed for good", "err", err)
+		return db.BuryJob(database, j.ID, now, err.Error())
+	default:
+		retry := now.Add(backoff(j.Attempts))
+		logger.Warn("Job failed, will retry", "err", err, "retry_at", retry)
+		return db.RescheduleJob(database, j.ID, retry, err.Error())
+	}
+}
+
+// call runs the job's handler within Timeout, turning panics into errors.
+func call(ctx context.Context, j *models.Job) (err error) {
+	h := handler(j.Kind)
+	if h == nil {
+		return Permanent(fmt.Errorf("no handler for job kind %q", j.Kind))
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	return h(ctx, []byte(j.Payload))
+}
+
+// backoff is how long to wait before retrying after the given number of
+// attempts: exponential, capped, with up to 10% jitter so failures from one
+// outage do not all retry together.
+func backoff(attempts int) time.Duration {
+	d := maxBackoff
+	if attempts < 20 {
+		d = min(baseBackoff<<(attempts-1), maxBackoff)
+	}
+	return d + rand.N(d/10+1)
+}
+
+// Recover queues again the jobs whose worker stopped without finishing
+// them, such as when the server crashed.
+func Recover(database *sql.DB, now time.Time) error {
+	n, err := db.RequeueStaleJobs(database, now.Add(-2*Timeout))
+	if n > 0 {
+		slog.Warn("Requeued interrupted jobs", "count", n)
+	}
+	return err
+}
+
+// Prune deletes the jobs that finished successfully more than Retention
+// ago.
+func Prune(database *sql.DB, now time.Time) error {
+	_, err := db.DeleteFinishedJobs(database, now.Add(-Retention))
+	return err
+}
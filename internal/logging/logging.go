@@ -0,0 +1,28 @@
+// Package logging configures structured logging with log/slog. Every record
+// passes through a redacting handler so personal data never reaches the
+// logs, and each request gets a logger carrying its request ID.
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"os"
+)
+
+// New returns a logger writing to w: JSON in production, human-readable
+// text in dev mode. Its output is always redacted.
+func New(w io.Writer, dev bool) *slog.Logger {
+	var h slog.Handler
+	if dev {
+		h = slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug})
+	} else {
+		h = slog.NewJSONHandler(w, nil)
+	}
+	return slog.New(NewRedactHandler(h))
+}
+
+// Setup installs a New logger on stderr as the default, which also routes
+// the standard log package (used by net/http) through it.
+func Setup(dev bool) {
+	slog.SetDefault(New(os.Stderr, dev))
+}
@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	redacted     = "[redacted]"
+	redactedFile = "[file]"
+)
+
+// sensitiveKeys are attribute keys whose values are always dropped.
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"csrf_token":    true,
+	"email":         true,
+	"password":      true,
+	"secret":        true,
+	"sin":           true,
+	"token":         true,
+}
+
+// pathKeys are attribute keys holding file paths; the directory is kept for
+// debugging but the file name, which often contains the borrower's name, is
+// dropped.
+var pathKeys = map[string]bool{
+	"file":      true,
+	"file_path": true,
+	"filename":  true,
+	"path":      true,
+}
+
+// Patterns scrubbed from every message and string value, in order.
+var scrubbers = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// Query parameters and form fields carrying secrets
+	{regexp.MustCompile(`(?i)\b((?:token|secret|password|client_secret|csrf_token)=)[^&\s"']+`), "${1}" + redacted},
+	// Emails
+	{regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), "[email]"},
+	// API tokens, client credentials and share links, plus long hex or base64 secrets
+	// such as session IDs and password reset tokens
+	{regexp.MustCompile(`\bma[tcsil]_[A-Za-z0-9_\-]+|\b[A-Fa-f0-9]{32,}\b|\b[A-Za-z0-9_\-]{40,}\b`), "[token]"},
+	// Social Insurance Numbers: nine digits, optionally grouped 3-3-3
+	{regexp.MustCompile(`\b\d{3}[ -]?\d{3}[ -]?\d{3}\b`), "[sin]"},
+	// Stored uploads, whose names may contain spaces:
+	// uploads/<application>/<category>/<name>
+	{regexp.MustCompile(`(uploads[/\\]\d+[/\\][^/\\\s:"']+[/\\])[^/\\:"'\n]+`), "${1}" + redactedFile},
+	// Other file paths: keep the directories, drop the file name
+	{regexp.MustCompile(`((?:[\w.\-]+[/\\])+)[^/\\\s"']+\.[A-Za-z0-9]{1,5}\b`), "${1}" + redactedFile},
+}
+
+// Redact removes emails, tokens, SINs and file names from s.
+func Redact(s string) string {
+	for _, sc := range scrubbers {
+		s = sc.re.ReplaceAllString(s, sc.repl)
+	}
+	return s
+}
+
+// RedactPath keeps the directory of a file path and drops the file name.
+func RedactPath(p string) string {
+	if p == "" {
+		return p
+	}
+	return Redact(filepath.Join(filepath.Dir(p), redactedFile))
+}
+
+// RedactHandler scrubs the message and attributes of every record before
+// passing it to the wrapped handler.
+type RedactHandler struct {
+	next slog.Handler
+}
+
+// NewRedactHandler wraps next.
+func NewRedactHandler(next slog.Handler) *RedactHandler {
+	return &RedactHandler{next: next}
+}
+
+func (h *RedactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *RedactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		clean[i] = redactAttr(a)
+	}
+	return &RedactHandler{next: h.next.WithAttrs(clean)}
+}
+
+func (h *RedactHandler) WithGroup(name string) slog.Handler {
+	return &RedactHandler{next: h.next.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	key := strings.ToLower(a.Key)
+	if sensitiveKeys[key] {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if pathKeys[key] {
+			return slog.String(a.Key, RedactPath(a.Value.String()))
+		}
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindGroup:
+		group := a.Value.Group()
+		clean := make([]any, len(group))
+		for i, g := range group {
+			clean[i] = redactAttr(g)
+		}
+		return slog.Group(a.Key, clean...)
+	case slog.KindAny:
+		// Errors, structs and anything else are flattened to text so they
+		// can be scrubbed like strings.
+		s := fmt.Sprint(a.Value.Any())
+		if pathKeys[key] {
+			return slog.String(a.Key, RedactPath(s))
+		}
+		return slog.String(a.Key, Redact(s))
+	}
+	return a
+}
@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// person logs itself with the email it holds.
+type person struct{ email string }
+
+func (p person) LogValue() slog.Value { return slog.StringValue("person " + p.email) }
+
+func TestRedactHandler(t *testing.T) {
+	const (
+		email = "jane.doe+mortgage@example.com"
+		hex   = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+		name  = "Jane Doe paystub"
+	)
+	tests := []struct {
+		name string
+		log  func(*slog.Logger)
+		// secrets must not appear in the output; kept must
+		secrets []string
+		kept    []string
+	}{
+		{"email in the message", func(l *slog.Logger) { l.Info("Password reset for " + email) },
+			[]string{email, "jane.doe"}, []string{"Password reset for [email]"}},
+		{"email attribute", func(l *slog.Logger) { l.Info("Login", "email", email, "Email", email) },
+			[]string{email}, []string{`"email":"[redacted]"`, `"Email":"[redacted]"`}},
+		{"email in another attribute", func(l *slog.Logger) { l.Info("Invite", "to", "Jane <"+email+">") },
+			[]string{email}, []string{"Jane <[email]>"}},
+		{"secret attribute keys", func(l *slog.Logger) {
+			l.Info("Request", "password", "hunter2", "Authorization", "Bearer abc", "cookie", "session_id=x1", "csrf_token", "c5rf", "sin", 46454286, "secret", "s3", "token", "t0k")
+		}, []string{"hunter2", "Bearer abc", "session_id=x1", "c5rf", "46454286", `"s3"`, "t0k"}, nil},
+		{"token in a query string", func(l *slog.Logger) {
+			l.Info("GET /reset-password?token=abc123&x=1", "url", "/oauth/token?client_secret=sh!&grant_type=client_credentials")
+		}, []string{"abc123", "sh!"}, []string{"token=[redacted]&x=1", "client_secret=[redacted]&grant_type"}},
+		{"API tokens and share links", func(l *slog.Logger) {
+			l.Info("Auth", "header", "mat_Zx81kQpa_9", "client", "mac_4f1e-22", "share", "/share/mas_0aB1cD2eF3")
+		}, []string{"mat_Zx81kQpa_9", "mac_4f1e-22", "mas_0aB1cD2eF3"}, []string{"/share/[token]"}},
+		{"session IDs and reset tokens", func(l *slog.Logger) {
+			l.Info("Session "+hex, "reset", "Lk3_Yt7-aQ9zPq2WmX8vRb4NcJ6hGf1sDe5uKo0iTy")
+		}, []string{hex, "Lk3_Yt7-aQ9zPq2WmX8vRb4NcJ6hGf1sDe5uKo0iTy"}, nil},
+		{"SINs", func(l *slog.Logger) {
+			l.Info("SIN 046 454 286 on file", "note", "sin 046-454-286", "raw", "046454286")
+		}, []string{"046 454 286", "046-454-286", "046454286"}, []string{"SIN [sin] on file"}},
+		{"stored upload", func(l *slog.Logger) {
+			l.Info("Saved uploads/12/Proof_of_income/"+name+".pdf", "file_path", "uploads/12/Proof_of_income/"+name+".pdf")
+		}, []string{name}, []string{"uploads/12/Proof_of_income/[file]"}},
+		{"other paths", func(l *slog.Logger) {
+			l.Info("Rendering /tmp/render-81/jane_doe_t4.png", "path", "/var/data/jane_doe_noa.pdf", "filename", "jane_doe.pdf")
+		}, []string{"jane_doe_t4", "jane_doe_noa", "jane_doe.pdf"}, []string{"/tmp/render-81/[file]", "/var/data/[file]"}},
+		{"errors", func(l *slog.Logger) {
+			l.Error("Save failed", "err", errors.New("open uploads/3/ID/"+name+".pdf: permission denied for "+email))
+		}, []string{name, email}, []string{"permission denied for [email]"}},
+		{"values that log themselves", func(l *slog.Logger) { l.Info("Loaded", "who", person{email}) },
+			[]string{email}, []string{"person [email]"}},
+		{"structs", func(l *slog.Logger) {
+			l.Info("Loaded", "user", struct{ Email, SIN string }{email, "046 454 286"})
+		}, []string{email, "046 454 286"}, nil},
+		{"nested groups", func(l *slog.Logger) {
+			l.Info("Request", slog.Group("req",
+				slog.String("email", email),
+				slog.Group("form", slog.String("password", "hunter2"), slog.String("note", "call "+email)),
+				slog.String("path", "uploads/7/ID/"+name+".jpg")))
+		}, []string{email, "hunter2", name}, []string{`"note":"call [email]"`}},
+		{"attributes added with With", func(l *slog.Logger) {
+			l.With("email", email, slog.Group("user", slog.String("contact", email))).Info("Done")
+		}, []string{email}, nil},
+		{"attributes in a WithGroup group", func(l *slog.Logger) {
+			l.WithGroup("req").Info("Done", "token", "t0k", "note", "from "+email)
+		}, []string{"t0k", email}, []string{`"req":{`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(slog.New(NewRedactHandler(slog.NewJSONHandler(&buf, nil))))
+			out := buf.String()
+			for _, s := range tt.secrets {
+				if strings.Contains(out, s) {
+					t.Errorf("%q logged in %s", s, out)
+				}
+			}
+			for _, s := range tt.kept {
+				if !strings.Contains(out, s) {
+					t.Errorf("%q missing from %s", s, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactLeavesOrdinaryText(t *testing.T) {
+	for _, s := range []string{
+		"Job 12 failed after 3 attempts",
+		"GET /application-form?id=42 200 15ms",
+		"Rate 5.25% for 25 years, payment 2326.42",
+	} {
+		if got := Redact(s); got != s {
+			t.Errorf("Redact(%q) = %q", s, got)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// RequestIDHeader carries the request ID. An ID set by a trusted proxy is
+// reused so logs can be correlated across services.
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._\-]{1,64}$`)
+
+type contextKey struct{}
+
+// requestInfo holds the fields attached to a request's log records.
+// Handlers deeper in the chain fill in the user and application once they
+// know them, so it is shared by pointer and guarded by a mutex.
+type requestInfo struct {
+	mu            sync.Mutex
+	id            string
+	method        string
+	route         string
+	userID        int
+	applicationID int
+}
+
+func info(ctx context.Context) *requestInfo {
+	ri, _ := ctx.Value(contextKey{}).(*requestInfo)
+	return ri
+}
+
+// FromContext returns the default logger annotated with the request's ID,
+// route and, once known, user and application IDs.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	ri := info(ctx)
+	if ri == nil {
+		return logger
+	}
+	return logger.With(ri.attrs()...)
+}
+
+func (ri *requestInfo) attrs() []any {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	attrs := []any{"request_id", ri.id, "method", ri.method, "route", ri.route}
+	if ri.userID != 0 {
+		attrs = append(attrs, "user_id", ri.userID)
+	}
+	if ri.applicationID != 0 {
+		attrs = append(attrs, "application_id", ri.applicationID)
+	}
+	return attrs
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "".
+func RequestID(ctx context.Context) string {
+	if ri := info(ctx); ri != nil {
+		return ri.id
+	}
+	return ""
+}
+
+// SetUser records the authenticated user on the request's log records.
+func SetUser(ctx context.Context, userID int) {
+	if ri := info(ctx); ri != nil {
+		ri.mu.Lock()
+		ri.userID = userID
+		ri.mu.Unlock()
+	}
+}
+
+// SetApplication records the application a request acts on.
+func SetApplication(ctx context.Context, applicationID int) {
+	if ri := info(ctx); ri != nil {
+		ri.mu.Lock()
+		ri.applicationID = applicationID
+		ri.mu.Unlock()
+	}
+}
+
+// SetRoute replaces the route recorded by Middleware with a more specific
+// pattern, for sub-routers the outer mux cannot see into.
+func SetRoute(ctx context.Context, route string) {
+	if ri := info(ctx); ri != nil {
+		ri.mu.Lock()
+		ri.route = route
+		ri.mu.Unlock()
+	}
+}
+
+// Route returns the route pattern recorded for the request.
+func Route(ctx context.Context) string {
+	if ri := info(ctx); ri != nil {
+		ri.mu.Lock()
+		defer ri.mu.Unlock()
+		return ri.route
+	}
+	return ""
+}
+
+// Middleware assigns each request an ID, stores a per-request logger in its
+// context and logs one record per request with its status and latency.
+// route maps a request to the pattern it is served by; raw paths are never
+// logged since query strings and path segments can carry personal data.
+func Middleware(next http.Handler, route func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ri := &requestInfo{id: id, method: r.Method, route: route(r)}
+		r = r.WithContext(context.WithValue(r.Context(), contextKey{}, ri))
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(sw, r)
+
+		level := slog.LevelInfo
+		if sw.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		FromContext(r.Context()).Log(r.Context(), level, "request",
+			"status", sw.status,
+			"bytes", sw.bytes,
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+		)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusWriter records the status code and body size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush streamed responses.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,78 @@
+// Package mail sends plain-text notification emails over SMTP.
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/smtp"
+	"os"
+	"strings"
+
+	"MortgageAgent/internal/metrics"
+)
+
+// ErrDisabled is returned by Send when no SMTP server is configured.
+var ErrDisabled = errors.New("mail: SMTP is not configured")
+
+// Config holds the SMTP settings. Username and Password may be empty for
+// servers that accept unauthenticated mail.
+type Config struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	// Dev prints messages to stdout instead of failing when Host is empty.
+	Dev bool
+}
+
+var config Config
+
+// Configure sets the SMTP settings used by Send. Call it once at startup.
+func Configure(c Config) {
+	config = c
+}
+
+// Enabled reports whether Send delivers mail, or prints it in development,
+// rather than returning ErrDisabled.
+func Enabled() bool {
+	return config.Host != "" || config.Dev
+}
+
+// Send emails body to a single recipient.
+func Send(to, subject, body string) error {
+	c := config
+	if c.Host == "" {
+		if c.Dev {
+			fmt.Fprintf(os.Stdout, "---- email to %s: %s ----\n%s\n----\n", to, subject, body)
+			return nil
+		}
+		slog.Warn("Email not sent: SMTP is not configured", "subject", subject)
+		metrics.EmailFailed()
+		return ErrDisabled
+	}
+
+	// Reject header injection through the recipient or subject
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return errors.New("mail: invalid recipient or subject")
+	}
+
+	message := []byte("Subject: " + subject + "\r\n" +
+		"From: " + c.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		body + "\r\n")
+
+	var auth smtp.Auth
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+	if err := smtp.SendMail(c.Host+":"+c.Port, auth, c.From, []string{to}, message); err != nil {
+		slog.Error("Error sending email", "subject", subject, "err", err)
+		metrics.EmailFailed()
+		return err
+	}
+	return nil
+}
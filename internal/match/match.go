@@ -0,0 +1,125 @@
+// Package match ranks lender products for an application. Each product is
+// assessed at its own rate and ratio limits; products the borrower is not
+// eligible for are kept with every reason they were excluded.
+package match
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"MortgageAgent/internal/calc"
+	"MortgageAgent/internal/models"
+)
+
+// Borrower is what a lender needs to know about an application.
+type Borrower struct {
+	calc.Inputs
+	Province     string
+	PropertyType string
+	// CreditScore is 0 when unknown.
+	CreditScore int
+}
+
+// Result is one product assessed for the borrower.
+type Result struct {
+	Product models.LenderProduct
+	// Rank orders eligible products from 1; it is 0 for excluded ones.
+	Rank           int
+	Eligible       bool
+	Payment        float64
+	QualifyingRate float64
+	LTV            float64
+	GDS            float64
+	TDS            float64
+	// Reasons lists why the product was excluded.
+	Reasons []string
+}
+
+// Rank assesses every product at benchmarkRate and returns the eligible
+// ones first, cheapest rate first (then lowest payment, then name),
+// followed by the excluded ones with the fewest problems first.
+func Rank(products []models.LenderProduct, b Borrower, benchmarkRate float64) []Result {
+	results := make([]Result, 0, len(products))
+	for _, p := range products {
+		results = append(results, assess(p, b, benchmarkRate))
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		ri, rj := results[i], results[j]
+		switch {
+		case ri.Eligible != rj.Eligible:
+			return ri.Eligible
+		case !ri.Eligible && len(ri.Reasons) != len(rj.Reasons):
+			return len(ri.Reasons) < len(rj.Reasons)
+		case ri.Product.Rate != rj.Product.Rate:
+			return ri.Product.Rate < rj.Product.Rate
+		case ri.Payment != rj.Payment:
+			return ri.Payment < rj.Payment
+		}
+		return ri.Product.LenderName+ri.Product.Name < rj.Product.LenderName+rj.Product.Name
+	})
+	rank := 0
+	for i := range results {
+		if results[i].Eligible {
+			rank++
+			results[i].Rank = rank
+		}
+	}
+	return results
+}
+
+func assess(p models.LenderProduct, b Borrower, benchmarkRate float64) Result {
+	res := Result{Product: p}
+	in := b.Inputs
+	in.ContractRate = p.Rate
+	a, err := calc.AssessWithin(in, benchmarkRate, calc.Limits{GDS: p.MaxGDS, TDS: p.MaxTDS})
+	if err != nil {
+		res.Reasons = []string{"The application's financial details cannot be assessed."}
+		return res
+	}
+	res.Payment, res.QualifyingRate, res.LTV, res.GDS, res.TDS = a.Payment, a.QualifyingRate, a.LTV, a.GDS, a.TDS
+
+	// Compare at basis-point precision, as calc does for insurance tiers.
+	if math.Round(a.LTV*1e4) > math.Round(p.MaxLTV*1e4) {
+		res.Reasons = append(res.Reasons, fmt.Sprintf("Loan to value of %.2f%% is above the %.4g%% maximum.", a.LTV*100, p.MaxLTV*100))
+	}
+	if p.MinCreditScore > 0 {
+		switch {
+		case b.CreditScore == 0:
+			res.Reasons = append(res.Reasons, fmt.Sprintf("No credit score was entered; the minimum is %d.", p.MinCreditScore))
+		case b.CreditScore < p.MinCreditScore:
+			res.Reasons = append(res.Reasons, fmt.Sprintf("Credit score of %d is below the %d minimum.", b.CreditScore, p.MinCreditScore))
+		}
+	}
+	if len(p.PropertyTypes) > 0 && !slices.Contains(p.PropertyTypes, b.PropertyType) {
+		if b.PropertyType == "" {
+			res.Reasons = append(res.Reasons, "No property type was entered; only "+label(p.PropertyTypes)+" properties are eligible.")
+		} else {
+			res.Reasons = append(res.Reasons, "Only "+label(p.PropertyTypes)+" properties are eligible, not "+label([]string{b.PropertyType})+".")
+		}
+	}
+	if len(p.Provinces) > 0 && !slices.Contains(p.Provinces, b.Province) {
+		if b.Province == "" {
+			res.Reasons = append(res.Reasons, "No province was entered; only offered in "+strings.Join(p.Provinces, ", ")+".")
+		} else {
+			res.Reasons = append(res.Reasons, "Not offered in "+models.ProvinceNames[b.Province]+".")
+		}
+	}
+	res.Reasons = append(res.Reasons, a.Problems...)
+	res.Eligible = len(res.Reasons) == 0
+	return res
+}
+
+// label lists property types for a sentence, such as "detached or condo".
+func label(types []string) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = strings.ReplaceAll(t, "_", "-")
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
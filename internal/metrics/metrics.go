@@ -0,0 +1,153 @@
+// Package metrics defines the Prometheus metrics the application exports
+// at /metrics.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "mortgageagent"
+
+// Registry holds every application metric plus the Go runtime and process
+// collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	uploadBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "document_upload_bytes",
+		Help:      "Size of uploaded documents by category.",
+		// 10 KB to roughly 160 MB
+		Buckets: prometheus.ExponentialBuckets(10<<10, 4, 8),
+	}, []string{"category"})
+
+	uploadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "document_upload_duration_seconds",
+		Help:      "Time spent writing uploaded documents to storage by category.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 4, 8),
+	}, []string{"category"})
+
+	uploadFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "document_upload_failures_total",
+		Help:      "Uploads that could not be stored, by category.",
+	}, []string{"category"})
+
+	submissions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "application_submissions_total",
+		Help:      "Applications submitted for review.",
+	})
+
+	statusTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "application_status_transitions_total",
+		Help:      "Application status changes by previous and new status.",
+	}, []string{"from", "to"})
+
+	failedLogins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failed_logins_total",
+		Help:      "Rejected credentials by channel (web, api or oauth).",
+	}, []string{"channel"})
+
+	emailFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "email_send_failures_total",
+		Help:      "Emails the SMTP server did not accept.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		uploadBytes, uploadDuration, uploadFailures,
+		submissions, statusTransitions,
+		failedLogins, emailFailures,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format. When
+// token is set, scrapers must send it as a bearer token.
+func Handler(token string) http.Handler {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+	if token == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ObserveRequest records a served HTTP request. Unknown methods share one
+// label so clients cannot create unbounded series.
+func ObserveRequest(route, method string, status int, d time.Duration) {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		method = "OTHER"
+	}
+	httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(route, method).Observe(d.Seconds())
+}
+
+// ObserveUpload records a stored document, or a failed attempt when err is set.
+func ObserveUpload(category string, bytes int64, d time.Duration, err error) {
+	if err != nil {
+		uploadFailures.WithLabelValues(category).Inc()
+		return
+	}
+	uploadBytes.WithLabelValues(category).Observe(float64(bytes))
+	uploadDuration.WithLabelValues(category).Observe(d.Seconds())
+}
+
+// ApplicationSubmitted records a submission and its status transition.
+func ApplicationSubmitted(from, to string) {
+	submissions.Inc()
+	StatusChanged(from, to)
+}
+
+// StatusChanged records an application moving between statuses.
+func StatusChanged(from, to string) {
+	if from != to {
+		statusTransitions.WithLabelValues(from, to).Inc()
+	}
+}
+
+// LoginFailed records rejected credentials on channel.
+func LoginFailed(channel string) {
+	failedLogins.WithLabelValues(channel).Inc()
+}
+
+// EmailFailed records an email that could not be sent.
+func EmailFailed() {
+	emailFailures.Inc()
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"log/slog"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var queueDepthDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "admin_queue_depth"),
+	"Applications assigned to each admin that are awaiting or under review.",
+	[]string{"admin_id"}, nil,
+)
+
+// queueCollector reads the review queues from the database at scrape time
+// so the gauge can never drift from the assignments.
+type queueCollector struct {
+	depths func() (map[int]int, error)
+}
+
+// RegisterQueueDepth exports the per-admin queue depth returned by depths.
+func RegisterQueueDepth(depths func() (map[int]int, error)) {
+	Registry.MustRegister(queueCollector{depths: depths})
+}
+
+func (c queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+}
+
+func (c queueCollector) Collect(ch chan<- prometheus.Metric) {
+	depths, err := c.depths()
+	if err != nil {
+		slog.Error("Error reading admin queue depths", "err", err)
+		ch <- prometheus.NewInvalidMetric(queueDepthDesc, err)
+		return
+	}
+	for adminID, n := range depths {
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(n), strconv.Itoa(adminID))
+	}
+}
@@ -2,24 +2,105 @@ package models
 
 import "time"
 
+// Application statuses. A broker's application starts as a draft and becomes
+// submitted once its documents are uploaded and it is assigned to an admin.
+const (
+	StatusDraft     = "draft"
+	StatusSubmitted = "submitted"
+	StatusInReview  = "in_review"
+	StatusApproved  = "approved"
+	StatusDeclined  = "declined"
+)
+
+// Application types.
+const (
+	TypeSelf        = "self"
+	TypeSomeoneElse = "someone_else"
+)
+
+// DocumentCategories are the documents every application must include before
+// it can be submitted. They double as the upload form's field names.
+var DocumentCategories = []string{
+	"Proof_of_income",
+	"Identification",
+	"Basic_financial_information",
+	"Down_payment_confirmation",
+	"Property_details",
+}
+
+// DocumentDescriptions explains what each document category should contain.
+var DocumentDescriptions = map[string]string{
+	"Proof_of_income":             "Pay stubs, tax forms",
+	"Identification":              "Government-issued ID",
+	"Basic_financial_information": "Bank statements, investments",
+	"Down_payment_confirmation":   "Sale agreement, savings documents",
+	"Property_details":            "Purchase and sale agreement, MLS listing",
+}
+
+// ApplicationStatuses lists every status in workflow order.
+var ApplicationStatuses = []string{StatusDraft, StatusSubmitted, StatusInReview, StatusApproved, StatusDeclined}
+
 type Application struct {
 	ID              int
 	BrokerID        int
 	ApplicationType string
 	AssignedAdminID *int
+	Status          string
 	CreatedAt       time.Time
+	// BorrowerID is set once an invited borrower accepts. ConsentAt,
+	// ConsentName and ConsentIP record their e-consent.
+	BorrowerID  *int
+	ConsentAt   *time.Time
+	ConsentName string
+	ConsentIP   string
+}
+
+// NeedsConsent reports whether the application has a borrower who has not
+// yet given e-consent. Such applications cannot be submitted.
+func (a *Application) NeedsConsent() bool {
+	return a.BorrowerID != nil && a.ConsentAt == nil
+}
+
+// CategoryPaymentSchedule holds the amortization schedules brokers attach
+// to an application. It is not part of the checklist.
+const CategoryPaymentSchedule = "Payment_schedule"
+
+// Virus scan states of a document. Uploads are pending until the scanner
+// finds them clean, and only clean documents can be opened. Infected files,
+// and those too large for the scanner to check, are deleted, leaving the
+// record.
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+	ScanTooLarge = "too_large"
+)
+
+// ScanRejected reports whether the virus scan rejected a document with the
+// given status, so its file was deleted and has to be uploaded again.
+func ScanRejected(status string) bool {
+	return status == ScanInfected || status == ScanTooLarge
 }
 
 type DocumentInfo struct {
-	Category string
-	FilePath string
+	ID         int
+	Category   string
+	FilePath   string
+	UploadedAt string
+	Generated  bool
+	ScanStatus string
+	// Extraction holds the figures read from an income document, if any.
+	Extraction *DocumentExtraction
 }
 
 // ApplicationWithDocuments holds application data along with its associated documents.
 type ApplicationWithDocuments struct {
 	ID              int
 	BrokerID        int
+	BrokerName      string
 	ApplicationType string
+	AssignedAdminID *int
+	Status          string
 	CreatedAt       time.Time
 	Documents       []DocumentInfo
 }
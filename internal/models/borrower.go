@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// BorrowerInvite lets the person an application is for create a borrower
+// account scoped to that application. Only the hash of its token is stored.
+type BorrowerInvite struct {
+	ID            int
+	ApplicationID int
+	Email         string
+	InvitedBy     int
+	ExpiresAt     time.Time
+	AcceptedAt    *time.Time
+	RevokedAt     *time.Time
+	CreatedAt     time.Time
+}
+
+// Usable reports whether the invite can still be accepted at now.
+func (i *BorrowerInvite) Usable(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
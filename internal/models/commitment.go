@@ -0,0 +1,83 @@
+package models
+
+import "time"
+
+// Rate hold and commitment condition statuses.
+const (
+	HoldHeld     = "held"
+	HoldExpiring = "expiring"
+	HoldExpired  = "expired"
+	HoldReleased = "released"
+
+	ConditionDue       = "due"
+	ConditionOverdue   = "overdue"
+	ConditionSatisfied = "satisfied"
+)
+
+// RateHold is a rate a lender has locked for an application's borrower.
+// Dates are days in local time.
+type RateHold struct {
+	ID            int
+	ApplicationID int
+	LenderID      int
+	LenderName    string
+	// ProductID is nil when the hold is not for a catalogue product.
+	ProductID   *int
+	ProductName string
+	Rate        float64
+	HeldOn      time.Time
+	ExpiresOn   time.Time
+	// RemindedAt is set once the broker and admin were told it is expiring.
+	RemindedAt *time.Time
+	ReleasedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// Status describes the hold on today: expiring when it ends within
+// warnDays.
+func (h RateHold) Status(today time.Time, warnDays int) string {
+	switch {
+	case h.ReleasedAt != nil:
+		return HoldReleased
+	case h.ExpiresOn.Before(today):
+		return HoldExpired
+	case !h.ExpiresOn.After(today.AddDate(0, 0, warnDays)):
+		return HoldExpiring
+	}
+	return HoldHeld
+}
+
+// Commitment is a lender's commitment letter for an application and the
+// conditions it must meet before funding.
+type Commitment struct {
+	ID            int
+	ApplicationID int
+	LenderID      int
+	LenderName    string
+	IssuedOn      time.Time
+	// ExpiresOn is the last day the commitment can be accepted.
+	ExpiresOn  time.Time
+	CreatedAt  time.Time
+	Conditions []CommitmentCondition
+}
+
+// CommitmentCondition is one condition of a commitment and the day it must
+// be satisfied by.
+type CommitmentCondition struct {
+	ID           int
+	CommitmentID int
+	Description  string
+	DueOn        time.Time
+	SatisfiedAt  *time.Time
+}
+
+// Status describes the condition on today.
+func (c CommitmentCondition) Status(today time.Time) string {
+	switch {
+	case c.SatisfiedAt != nil:
+		return ConditionSatisfied
+	case c.DueOn.Before(today):
+		return ConditionOverdue
+	}
+	return ConditionDue
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Approval condition statuses. A condition is outstanding until the broker
+// responds, when it is submitted for the admin to clear or return with a
+// note.
+const (
+	ConditionOutstanding = "outstanding"
+	ConditionSubmitted   = "submitted"
+	ConditionCleared     = "cleared"
+)
+
+// CategoryCondition holds documents uploaded for a condition that is not
+// linked to a document category.
+const CategoryCondition = "Condition"
+
+// Condition is something an admin requires before an application can be
+// approved.
+type Condition struct {
+	ID            int
+	ApplicationID int
+	Description   string
+	// Category is the document category that satisfies the condition, or
+	// empty if any upload or reply will do.
+	Category string
+	Status   string
+	// Response and DocumentID are the broker's latest reply and upload.
+	Response   string
+	DocumentID *int
+	// ReviewNote is why the admin returned the last response.
+	ReviewNote  string
+	CreatedAt   time.Time
+	RespondedAt *time.Time
+	ClearedAt   *time.Time
+}
+
+// OpenCondition is a condition awaiting the broker, with the application
+// it belongs to.
+type OpenCondition struct {
+	Condition
+	ApplicationType string
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Digest frequencies. Users get a daily digest until they choose otherwise.
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+	DigestOff    = "off"
+)
+
+// DigestFrequencies lists the choices in the order they are offered.
+var DigestFrequencies = []string{DigestDaily, DigestWeekly, DigestOff}
+
+// DigestApplication is an application listed in a digest.
+type DigestApplication struct {
+	ID              int
+	ApplicationType string
+	Status          string
+	BrokerName      string
+}
+
+// DigestCondition is a commitment condition listed in a digest because its
+// due date has passed.
+type DigestCondition struct {
+	ApplicationID int
+	LenderName    string
+	Description   string
+	DueOn         time.Time
+}
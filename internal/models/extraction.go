@@ -0,0 +1,125 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// Income document types recognised by text extraction.
+const (
+	DocPayStub = "pay_stub"
+	DocT4      = "t4"
+	DocNOA     = "noa"
+	// DocUnknown is a document whose type could not be told from its text.
+	DocUnknown = "unknown"
+)
+
+// DocTypeLabels names each document type for display.
+var DocTypeLabels = map[string]string{
+	DocPayStub: "Pay stub",
+	DocT4:      "T4 slip",
+	DocNOA:     "Notice of Assessment",
+	DocUnknown: "Unrecognised document",
+}
+
+// Extraction statuses. A failed extraction has no fields; the admin can
+// still enter them.
+const (
+	ExtractionDone   = "done"
+	ExtractionFailed = "failed"
+)
+
+// Fields extracted from income documents.
+const (
+	FieldEmployer  = "employer"
+	FieldGrossPay  = "gross_pay"
+	FieldPayPeriod = "pay_period"
+	FieldYTDGross  = "ytd_gross"
+	FieldTaxYear   = "tax_year"
+)
+
+// ExtractionFields lists the fields of each document type in display order.
+var ExtractionFields = map[string][]string{
+	DocPayStub: {FieldEmployer, FieldGrossPay, FieldPayPeriod, FieldYTDGross},
+	DocT4:      {FieldEmployer, FieldGrossPay, FieldPayPeriod, FieldTaxYear},
+	DocNOA:     {FieldGrossPay, FieldPayPeriod, FieldTaxYear},
+	DocUnknown: {FieldEmployer, FieldGrossPay, FieldPayPeriod, FieldYTDGross, FieldTaxYear},
+}
+
+// FieldLabels names each field for display.
+var FieldLabels = map[string]string{
+	FieldEmployer:  "Employer",
+	FieldGrossPay:  "Gross pay",
+	FieldPayPeriod: "Pay period",
+	FieldYTDGross:  "Year-to-date gross",
+	FieldTaxYear:   "Tax year",
+}
+
+// LowConfidence is the confidence below which an extracted value is
+// flagged for the admin to check.
+const LowConfidence = 0.6
+
+// DocumentExtraction is what text extraction found in one income document.
+type DocumentExtraction struct {
+	DocumentID    int
+	ApplicationID int
+	DocType       string
+	Status        string
+	// Error says why a failed extraction failed.
+	Error string
+	// Engine names the extractor used, such as "tesseract".
+	Engine      string
+	ExtractedAt time.Time
+	Fields      []ExtractedField
+}
+
+// Label names the document type for display.
+func (e *DocumentExtraction) Label() string {
+	return DocTypeLabels[e.DocType]
+}
+
+// Confirmed reports whether an admin has confirmed every field.
+func (e *DocumentExtraction) Confirmed() bool {
+	for _, f := range e.Fields {
+		if f.ConfirmedAt == nil {
+			return false
+		}
+	}
+	return len(e.Fields) > 0
+}
+
+// ExtractedField is one value read from a document. Value starts as
+// ExtractedValue and becomes whatever the admin confirmed.
+type ExtractedField struct {
+	Name           string
+	Value          string
+	ExtractedValue string
+	// Confidence is between 0 and 1; it is 0 for a field that was not
+	// found.
+	Confidence  float64
+	ConfirmedBy *int
+	ConfirmedAt *time.Time
+}
+
+// Label names the field for display.
+func (f ExtractedField) Label() string {
+	if l, ok := FieldLabels[f.Name]; ok {
+		return l
+	}
+	return f.Name
+}
+
+// ConfidencePercent is Confidence as a whole percentage.
+func (f ExtractedField) ConfidencePercent() int {
+	return int(math.Round(f.Confidence * 100))
+}
+
+// Low reports whether the extracted value should be checked by hand.
+func (f ExtractedField) Low() bool {
+	return f.Confidence < LowConfidence
+}
+
+// Corrected reports whether the admin changed the extracted value.
+func (f ExtractedField) Corrected() bool {
+	return f.ConfirmedAt != nil && f.Value != f.ExtractedValue
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// ApplicationFinancials are the purchase details and borrower finances an
+// application is qualified on. Amounts are in dollars; PropertyTax is
+// annual and the other costs monthly. ContractRate is a fraction, so 4.5%
+// is 0.045.
+type ApplicationFinancials struct {
+	ApplicationID     int
+	AnnualIncome      float64
+	MonthlyDebts      float64
+	PurchasePrice     float64
+	DownPayment       float64
+	PropertyTax       float64
+	Heating           float64
+	CondoFees         float64
+	ContractRate      float64
+	AmortizationYears int
+	// Province, PropertyType and CreditScore are used to match lender
+	// products; they are empty or 0 until entered.
+	Province     string
+	PropertyType string
+	CreditScore  int
+	UpdatedAt    time.Time
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Background job statuses. A job that fails is queued again with a later
+// RunAt until it runs out of attempts, when it is dead until an admin
+// retries it.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobDead    = "dead"
+)
+
+// JobStatuses lists every status, for the jobs page.
+var JobStatuses = []string{JobQueued, JobRunning, JobDone, JobDead}
+
+// Job is a unit of background work. Payload is JSON whose shape depends on
+// Kind. While a job is queued or running no other job with the same
+// UniqueKey can be enqueued.
+type Job struct {
+	ID          int
+	Kind        string
+	Payload     string
+	Status      string
+	UniqueKey   string
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time
+	LockedAt    *time.Time
+	LastError   string
+	CreatedAt   time.Time
+	FinishedAt  *time.Time
+}
@@ -0,0 +1,114 @@
+package models
+
+import "time"
+
+// Product rate types.
+const (
+	RateFixed    = "fixed"
+	RateVariable = "variable"
+)
+
+// RateTypes lists every rate type.
+var RateTypes = []string{RateFixed, RateVariable}
+
+// Provinces lists the provinces and territories by postal abbreviation.
+var Provinces = []string{"AB", "BC", "MB", "NB", "NL", "NS", "NT", "NU", "ON", "PE", "QC", "SK", "YT"}
+
+// ProvinceNames maps each abbreviation in Provinces to its name.
+var ProvinceNames = map[string]string{
+	"AB": "Alberta", "BC": "British Columbia", "MB": "Manitoba", "NB": "New Brunswick",
+	"NL": "Newfoundland and Labrador", "NS": "Nova Scotia", "NT": "Northwest Territories",
+	"NU": "Nunavut", "ON": "Ontario", "PE": "Prince Edward Island", "QC": "Quebec",
+	"SK": "Saskatchewan", "YT": "Yukon",
+}
+
+// PropertyTypes lists the kinds of property a mortgage can be for.
+var PropertyTypes = []string{"detached", "semi_detached", "townhouse", "condo", "multi_unit"}
+
+type Lender struct {
+	ID        int
+	Name      string
+	Active    bool
+	CreatedAt time.Time
+	Products  []LenderProduct
+}
+
+// LenderProduct is a mortgage a lender offers and the borrowers it accepts.
+// Rates and ratios are fractions. Empty PropertyTypes or Provinces accept
+// any. Rate is the rate in effect on the day the product was loaded for,
+// or 0 when it has none.
+type LenderProduct struct {
+	ID             int
+	LenderID       int
+	LenderName     string
+	Name           string
+	Rate           float64
+	TermMonths     int
+	RateType       string
+	MaxLTV         float64
+	MinCreditScore int
+	MaxGDS         float64
+	MaxTDS         float64
+	PropertyTypes  []string
+	Provinces      []string
+	// PrepaymentPrivileges describes the lump sums and payment increases
+	// allowed without penalty.
+	PrepaymentPrivileges string
+	Active               bool
+	UpdatedAt            time.Time
+}
+
+// Rate sheet sources.
+const (
+	RateSourceUpload    = "upload"
+	RateSourceDirectory = "directory"
+)
+
+// Rate import statuses.
+const (
+	RateImportPending   = "pending"
+	RateImportApplied   = "applied"
+	RateImportDiscarded = "discarded"
+)
+
+// RateSheetMapping names the columns of a lender's rate sheets by their
+// header. The effective date columns are optional.
+type RateSheetMapping struct {
+	LenderID int
+	// Sheet is the XLSX worksheet to read; the first when empty.
+	Sheet               string
+	ProductColumn       string
+	RateColumn          string
+	EffectiveFromColumn string
+	EffectiveToColumn   string
+}
+
+// RateImport is a rate sheet read for a lender, previewed before it is
+// applied.
+type RateImport struct {
+	ID         int
+	LenderID   int
+	LenderName string
+	Filename   string
+	Source     string
+	Status     string
+	CreatedBy  *int
+	CreatedAt  time.Time
+	AppliedAt  *time.Time
+	Rows       []RateImportRow
+}
+
+// RateImportRow is one product's new rate. PreviousRate is the rate it
+// replaces on EffectiveFrom: the one in effect when the import was applied,
+// or the current one if it was not. It is 0 when there was none.
+type RateImportRow struct {
+	Line          int
+	ProductID     int
+	ProductName   string
+	Rate          float64
+	EffectiveFrom time.Time
+	// EffectiveTo is the last day the rate applies, or nil when it applies
+	// until replaced.
+	EffectiveTo  *time.Time
+	PreviousRate float64
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// CategoryMessage holds the files attached to messages.
+const CategoryMessage = "Message_attachment"
+
+// Message is one entry in an application's thread. Internal messages are
+// notes between admins that the broker never sees.
+type Message struct {
+	ID            int
+	ApplicationID int
+	AuthorID      int
+	AuthorName    string
+	AuthorType    string
+	Body          string
+	Internal      bool
+	// DocumentID is the attached file, if any, and Attachment its name.
+	DocumentID *int
+	Attachment string
+	CreatedAt  time.Time
+	// Mentions names the users mentioned in Body.
+	Mentions []string
+}
@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// Notification kinds. Users choose, per kind, how they hear about them.
+const (
+	NotifyAssigned          = "application_assigned"
+	NotifyStatusChanged     = "status_changed"
+	NotifyCondition         = "condition"
+	NotifyConditionAnswered = "condition_answered"
+	NotifyMessage           = "message"
+	NotifyRateHold          = "rate_hold"
+	NotifyUploadRejected    = "upload_rejected"
+)
+
+// NotificationKind describes a kind of notification, who receives it and
+// whether it is emailed until the user says otherwise.
+type NotificationKind struct {
+	Kind  string
+	Label string
+	// UserTypes are the kinds of user it is sent to.
+	UserTypes []string
+	Email     bool
+}
+
+// NotificationKinds lists every kind in the order preferences are shown.
+var NotificationKinds = []NotificationKind{
+	{NotifyAssigned, "Applications assigned to me", []string{"admin"}, true},
+	{NotifyStatusChanged, "Application status changes", []string{"broker"}, true},
+	{NotifyCondition, "Conditions added or returned", []string{"broker"}, true},
+	{NotifyConditionAnswered, "Conditions answered", []string{"admin"}, false},
+	{NotifyMessage, "Messages and mentions", []string{"admin", "broker"}, true},
+	{NotifyRateHold, "Rate holds about to expire", []string{"admin", "broker"}, true},
+	{NotifyUploadRejected, "Uploads rejected by the virus scan", []string{"admin", "broker"}, true},
+}
+
+// Notification tells a user something happened, usually on one of their
+// applications. Link is the page it is about, relative to the site.
+type Notification struct {
+	ID            int
+	UserID        int
+	Kind          string
+	ApplicationID int
+	Title         string
+	Body          string
+	Link          string
+	ReadAt        *time.Time
+	CreatedAt     time.Time
+}
+
+// NotificationPreference is how a user hears about one kind of
+// notification: in the app, by email straight away, and in the digest.
+type NotificationPreference struct {
+	Kind   string
+	InApp  bool
+	Email  bool
+	Digest bool
+}
+
+// DefaultNotificationPreference is the preference for kind of a user who
+// has not changed it.
+func DefaultNotificationPreference(kind string) NotificationPreference {
+	p := NotificationPreference{Kind: kind, InApp: true}
+	for _, k := range NotificationKinds {
+		if k.Kind == kind {
+			p.Email = k.Email
+		}
+	}
+	return p
+}
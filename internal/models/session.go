@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Session is a browser session. Anonymous visitors get a session too, so
+// that the login and signup forms carry a CSRF token; UserID is set once
+// they log in.
+type Session struct {
+	IDHash    string
+	UserID    *int
+	CSRFToken string
+	ExpiresAt time.Time
+}
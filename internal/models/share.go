@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// MaxShareFailures is how many wrong passwords lock a share link for good.
+const MaxShareFailures = 10
+
+// DocumentShare lets someone without an account download one document
+// until it expires, is revoked or runs out of downloads.
+type DocumentShare struct {
+	ID            int
+	DocumentID    int
+	ApplicationID int
+	Category      string
+	CreatedBy     int
+	Recipient     string
+	HasPassword   bool
+	// MaxDownloads is nil when the link may be used any number of times.
+	MaxDownloads   *int
+	Downloads      int
+	FailedAttempts int
+	ExpiresAt      time.Time
+	RevokedAt      *time.Time
+	CreatedAt      time.Time
+}
+
+// Status describes why the share can or cannot be used at now.
+func (s *DocumentShare) Status(now time.Time) string {
+	switch {
+	case s.RevokedAt != nil:
+		return "revoked"
+	case !now.Before(s.ExpiresAt):
+		return "expired"
+	case s.MaxDownloads != nil && s.Downloads >= *s.MaxDownloads:
+		return "used up"
+	case s.FailedAttempts >= MaxShareFailures:
+		return "locked"
+	}
+	return "active"
+}
+
+// Active reports whether the share can still be used at now.
+func (s *DocumentShare) Active(now time.Time) bool {
+	return s.Status(now) == "active"
+}
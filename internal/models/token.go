@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// APIToken is a hashed bearer token. Personal access tokens are created by a
+// user on the settings page; tokens with an OAuthClientID were issued by the
+// client-credentials endpoint.
+type APIToken struct {
+	ID            int
+	UserID        int
+	OAuthClientID *int
+	Name          string
+	Prefix        string
+	Scopes        []string
+	ExpiresAt     *time.Time
+	LastUsedAt    *time.Time
+	RevokedAt     *time.Time
+	CreatedAt     time.Time
+}
+
+// Active reports whether the token can still be used.
+func (t *APIToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
+
+// OAuthClient is a service account that exchanges its client ID and secret
+// for short-lived tokens. It acts as the user who created it, limited to Scopes.
+type OAuthClient struct {
+	ID        int
+	UserID    int
+	Name      string
+	ClientID  string
+	Scopes    []string
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
@@ -10,3 +10,7 @@ type User struct {
 	PostalCode   string
 	UserType     string
 }
+
+// UserTypes lists the roles a user account can have. Auditors can only read
+// the audit log; borrowers can only see the applications they were invited to.
+var UserTypes = []string{"broker", "admin", "auditor", "borrower"}
@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"database/sql"
+	"fmt"
+
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/render"
+)
+
+// Assigned tells an admin that app has been assigned to them, and updates
+// their dashboard and the broker's.
+func Assigned(database *sql.DB, app *models.Application, adminID int) error {
+	Refresh(adminID, app.BrokerID)
+	broker, err := db.GetUserByID(database, app.BrokerID)
+	if err != nil {
+		return err
+	}
+	return Send(database, models.Notification{
+		UserID: adminID, Kind: models.NotifyAssigned, ApplicationID: app.ID,
+		Title: fmt.Sprintf("Application #%d assigned to you", app.ID),
+		Body: fmt.Sprintf("%s %s's %s application #%d is waiting for your review.",
+			broker.FirstName, broker.LastName, render.Humanize(app.ApplicationType), app.ID),
+		Link: ApplicationLink("admin", app.ID),
+	})
+}
+
+// StatusChanged tells the broker that app has moved to status, and updates
+// both sides' dashboards.
+func StatusChanged(database *sql.DB, app *models.Application, status string) error {
+	refreshApplication(app)
+	return Send(database, models.Notification{
+		UserID: app.BrokerID, Kind: models.NotifyStatusChanged, ApplicationID: app.ID,
+		Title: fmt.Sprintf("Application #%d is now %s", app.ID, render.Humanize(status)),
+		Body:  fmt.Sprintf("Application #%d moved from %s to %s.", app.ID, render.Humanize(app.Status), render.Humanize(status)),
+		Link:  ApplicationLink("broker", app.ID),
+	})
+}
+
+// ConditionAdded tells the broker about a new condition on app.
+func ConditionAdded(database *sql.DB, app *models.Application, description string) error {
+	refreshApplication(app)
+	return Send(database, models.Notification{
+		UserID: app.BrokerID, Kind: models.NotifyCondition, ApplicationID: app.ID,
+		Title: fmt.Sprintf("New condition on application #%d", app.ID),
+		Body:  fmt.Sprintf("Application #%d needs the following before it can be approved: %s", app.ID, description),
+		Link:  ApplicationLink("broker", app.ID) + "#conditions",
+	})
+}
+
+// ConditionReturned tells the broker their answer to a condition was sent
+// back, and why.
+func ConditionReturned(database *sql.DB, app *models.Application, note string) error {
+	refreshApplication(app)
+	return Send(database, models.Notification{
+		UserID: app.BrokerID, Kind: models.NotifyCondition, ApplicationID: app.ID,
+		Title: fmt.Sprintf("Condition returned on application #%d", app.ID),
+		Body:  fmt.Sprintf("Your answer to a condition on application #%d was returned: %s", app.ID, note),
+		Link:  ApplicationLink("broker", app.ID) + "#conditions",
+	})
+}
+
+// ConditionAnswered tells the assigned admin that the broker answered a
+// condition on app.
+func ConditionAnswered(database *sql.DB, app *models.Application, description string) error {
+	refreshApplication(app)
+	if app.AssignedAdminID == nil {
+		return nil
+	}
+	return Send(database, models.Notification{
+		UserID: *app.AssignedAdminID, Kind: models.NotifyConditionAnswered, ApplicationID: app.ID,
+		Title: fmt.Sprintf("Condition answered on application #%d", app.ID),
+		Body:  fmt.Sprintf("The broker answered \"%s\" on application #%d. It is ready to clear.", description, app.ID),
+		Link:  ApplicationLink("admin", app.ID) + "#conditions",
+	})
+}
+
+// UploadRejected tells uploader that the file they uploaded to app as
+// category was deleted because the virus scan found signature in it.
+// Borrowers, who have no inbox, are emailed.
+func UploadRejected(database *sql.DB, app *models.Application, uploader *models.User, category, filename, signature string) error {
+	return uploadRejected(database, app, uploader,
+		fmt.Sprintf("The virus scan found %s in %s, uploaded as %s for application #%d, so it has been deleted. Please upload a clean copy.",
+			signature, filename, render.Humanize(category), app.ID))
+}
+
+// UploadTooLarge tells uploader that the file they uploaded to app as
+// category was deleted because it is too large for the virus scanner.
+func UploadTooLarge(database *sql.DB, app *models.Application, uploader *models.User, category, filename string) error {
+	return uploadRejected(database, app, uploader,
+		fmt.Sprintf("%s, uploaded as %s for application #%d, is too large for the virus scan, so it has been deleted. Please upload a smaller copy, such as one scanned at a lower resolution.",
+			filename, render.Humanize(category), app.ID))
+}
+
+func uploadRejected(database *sql.DB, app *models.Application, uploader *models.User, body string) error {
+	refreshApplication(app)
+	n := models.Notification{
+		UserID: uploader.ID, Kind: models.NotifyUploadRejected, ApplicationID: app.ID,
+		Title: fmt.Sprintf("Upload rejected on application #%d", app.ID),
+		Body:  body,
+		Link:  ApplicationLink(uploader.UserType, app.ID),
+	}
+	if uploader.UserType == "borrower" {
+		email(database, n)
+		return nil
+	}
+	return Send(database, n)
+}
+
+// UploadScanned updates the dashboards of app's broker and admin once an
+// upload passes its virus scan and can be opened.
+func UploadScanned(app *models.Application) {
+	refreshApplication(app)
+}
+
+// refreshApplication updates the dashboards of app's broker and admin.
+func refreshApplication(app *models.Application) {
+	if app.AssignedAdminID != nil {
+		Refresh(*app.AssignedAdminID)
+	}
+	Refresh(app.BrokerID)
+}
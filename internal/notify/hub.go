@@ -0,0 +1,90 @@
+package notify
+
+import "sync"
+
+// Live event names sent to subscribers.
+const (
+	// EventNotification carries a new notification and the unread count.
+	EventNotification = "notification"
+	// EventUnread carries just the unread count.
+	EventUnread = "unread"
+	// EventDashboard tells the user's open dashboard it is out of date.
+	EventDashboard = "dashboard"
+)
+
+// Event is a message for a user's open pages. Data is sent as JSON.
+type Event struct {
+	Name string
+	Data any
+}
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before further events to it are dropped.
+const subscriberBuffer = 16
+
+var hub = struct {
+	sync.Mutex
+	subs   map[int]map[chan Event]struct{}
+	closed bool
+}{subs: map[int]map[chan Event]struct{}{}}
+
+// Subscribe returns a channel of the user's live events and a function to
+// stop receiving them. The channel is closed by Close.
+func Subscribe(userID int) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	hub.Lock()
+	defer hub.Unlock()
+	if hub.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if hub.subs[userID] == nil {
+		hub.subs[userID] = map[chan Event]struct{}{}
+	}
+	hub.subs[userID][ch] = struct{}{}
+	return ch, func() {
+		hub.Lock()
+		defer hub.Unlock()
+		if _, ok := hub.subs[userID][ch]; ok {
+			delete(hub.subs[userID], ch)
+			if len(hub.subs[userID]) == 0 {
+				delete(hub.subs, userID)
+			}
+			close(ch)
+		}
+	}
+}
+
+// Publish sends e to every open page of the user without waiting; pages
+// too far behind miss it.
+func Publish(userID int, e Event) {
+	hub.Lock()
+	defer hub.Unlock()
+	for ch := range hub.subs[userID] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Refresh tells the users' open dashboards that something on them changed.
+func Refresh(userIDs ...int) {
+	for _, id := range userIDs {
+		Publish(id, Event{Name: EventDashboard, Data: struct{}{}})
+	}
+}
+
+// Close ends every subscription so that streams finish before the server
+// shuts down. Later subscriptions are closed straight away.
+func Close() {
+	hub.Lock()
+	defer hub.Unlock()
+	hub.closed = true
+	for _, chans := range hub.subs {
+		for ch := range chans {
+			close(ch)
+		}
+	}
+	hub.subs = map[int]map[chan Event]struct{}{}
+}
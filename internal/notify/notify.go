@@ -0,0 +1,93 @@
+// Package notify tells users what happened on their applications: in the
+// app, where open pages are updated live, and by email, as each user
+// prefers.
+package notify
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/jobs"
+	"MortgageAgent/internal/models"
+)
+
+var baseURL string
+
+// Configure sets the site address that emailed links start with. Call it
+// once at startup.
+func Configure(siteURL string) {
+	baseURL = siteURL
+}
+
+// Payload is a notification as sent to open pages.
+type Payload struct {
+	ID        int       `json:"id"`
+	Kind      string    `json:"kind"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Link      string    `json:"link"`
+	CreatedAt time.Time `json:"created_at"`
+	Unread    int       `json:"unread"`
+}
+
+// Send delivers n to its user as they prefer for its kind: stored in their
+// inbox and pushed to their open pages, kept for their digest, and emailed.
+// Only a failure to store it is returned; email failures are logged.
+func Send(database *sql.DB, n models.Notification) error {
+	pref, err := db.GetNotificationPreference(database, n.UserID, n.Kind)
+	if err != nil {
+		return err
+	}
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+
+	if pref.InApp || pref.Digest {
+		if n.ID, err = db.CreateNotification(database, &n, pref.InApp, pref.Digest); err != nil {
+			return err
+		}
+	}
+	if pref.InApp {
+		unread, err := db.CountUnreadNotifications(database, n.UserID)
+		if err != nil {
+			return err
+		}
+		Publish(n.UserID, Event{Name: EventNotification, Data: Payload{
+			ID: n.ID, Kind: n.Kind, Title: n.Title, Body: n.Body, Link: n.Link, CreatedAt: n.CreatedAt, Unread: unread,
+		}})
+	}
+	if pref.Email {
+		email(database, n)
+	}
+	return nil
+}
+
+func email(database *sql.DB, n models.Notification) {
+	user, err := db.GetUserByID(database, n.UserID)
+	if err != nil {
+		slog.Error("Error loading notification recipient", "user_id", n.UserID, "err", err)
+		return
+	}
+	body := n.Body + "\n"
+	if n.Link != "" {
+		body += "\n" + baseURL + n.Link + "\n"
+	}
+	if err := jobs.Email(database, user.Email, n.Title, body); err != nil {
+		slog.Error("Error queueing notification email", "user_id", n.UserID, "kind", n.Kind, "err", err)
+	}
+}
+
+// ApplicationLink is the page where a user of the given type works on an
+// application.
+func ApplicationLink(userType string, applicationID int) string {
+	switch userType {
+	case "broker":
+		return fmt.Sprintf("/application-form?id=%d", applicationID)
+	case "borrower":
+		return "/borrower"
+	}
+	return fmt.Sprintf("/view-application?id=%d", applicationID)
+}
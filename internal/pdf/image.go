@@ -0,0 +1,109 @@
+package pdf
+
+import (
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+// maxImagePixels bounds images that have to be decoded, so a small file
+// cannot expand into gigabytes of memory.
+const maxImagePixels = 40 << 20
+
+// ErrUnsupportedImage is returned for images in a format that cannot be
+// placed on a page.
+var ErrUnsupportedImage = errors.New("pdf: unsupported image")
+
+// AddImagePage adds a page with the JPEG, PNG or GIF image in ra scaled to
+// fit. JPEG data is copied as is; other formats are decoded and compressed.
+func (w *Writer) AddImagePage(ra io.ReaderAt, size int64) error {
+	cfg, format, err := image.DecodeConfig(io.NewSectionReader(ra, 0, size))
+	if err != nil {
+		return ErrUnsupportedImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxImagePixels {
+		return fmt.Errorf("%w: %dx%d pixels", ErrUnsupportedImage, cfg.Width, cfg.Height)
+	}
+
+	img := w.alloc()
+	d := Dict{
+		"Type":             Name("XObject"),
+		"Subtype":          Name("Image"),
+		"Width":            cfg.Width,
+		"Height":           cfg.Height,
+		"BitsPerComponent": 8,
+	}
+	if format == "jpeg" {
+		d["Filter"] = Name("DCTDecode")
+		switch cfg.ColorModel {
+		case color.GrayModel:
+			d["ColorSpace"] = Name("DeviceGray")
+		case color.CMYKModel:
+			// Adobe CMYK JPEGs store inverted values.
+			d["ColorSpace"] = Name("DeviceCMYK")
+			d["Decode"] = Array{1, 0, 1, 0, 1, 0, 1, 0}
+		default:
+			d["ColorSpace"] = Name("DeviceRGB")
+		}
+		if err := w.writeStream(img, d, io.NewSectionReader(ra, 0, size), size, nil); err != nil {
+			return err
+		}
+	} else if err := w.writeDecodedImage(img, d, ra, size); err != nil {
+		return err
+	}
+
+	// Scale to fit inside the margins, keeping the aspect ratio.
+	boxW, boxH := float64(pageWidth-2*margin), float64(pageHeight-2*margin)
+	scale := min(boxW/float64(cfg.Width), boxH/float64(cfg.Height))
+	drawW, drawH := float64(cfg.Width)*scale, float64(cfg.Height)*scale
+	x, y := (pageWidth-drawW)/2, (pageHeight-drawH)/2
+	content := fmt.Sprintf("q %.2f 0 0 %.2f %.2f %.2f cm /Im1 Do Q\n", drawW, drawH, x, y)
+	w.addPage([]byte(content), Dict{"XObject": Dict{"Im1": img}})
+	return nil
+}
+
+// writeDecodedImage writes the image as Flate-compressed RGB, flattening
+// any transparency onto white. The compressed length is only known once the
+// data is written, so it is stored in a separate object.
+func (w *Writer) writeDecodedImage(ref objRef, d Dict, ra io.ReaderAt, size int64) error {
+	src, _, err := image.Decode(io.NewSectionReader(ra, 0, size))
+	if err != nil {
+		return ErrUnsupportedImage
+	}
+	length := w.alloc()
+	d["ColorSpace"] = Name("DeviceRGB")
+	d["Filter"] = Name("FlateDecode")
+	d["Length"] = length
+
+	w.begin(ref)
+	w.writeValue(d, nil)
+	io.WriteString(w.out, "\nstream\n")
+	start := w.out.n
+	zw := zlib.NewWriter(w.out)
+	b := src.Bounds()
+	row := make([]byte, 0, 3*b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row = row[:0]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := src.At(x, y).RGBA()
+			// Composite over white: c + (1 - a) * white.
+			white := 0xffff - a
+			row = append(row, byte((r+white)>>8), byte((g+white)>>8), byte((bl+white)>>8))
+		}
+		zw.Write(row)
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	n := w.out.n - start
+	io.WriteString(w.out, "\nendstream")
+	w.end()
+	w.writeObject(length, n, nil)
+	return w.out.err
+}
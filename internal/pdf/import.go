@@ -0,0 +1,88 @@
+package pdf
+
+import (
+	"io"
+)
+
+// ImportPages appends every page of the PDF in ra and returns how many were
+// added. The file's page tree is read before anything is written, so an
+// unreadable or encrypted file returns an error and leaves the output
+// untouched. Objects that fail to load later are written as null.
+func (w *Writer) ImportPages(ra io.ReaderAt, size int64) (int, error) {
+	r, err := newReader(ra, size)
+	if err != nil {
+		return 0, err
+	}
+	pages, err := r.pages()
+	if err != nil {
+		return 0, err
+	}
+
+	// Source objects are copied the first time something refers to them.
+	mapped := map[int]objRef{}
+	var queue []int
+	remap := func(ref Ref) objRef {
+		if dst, ok := mapped[ref.Num]; ok {
+			return dst
+		}
+		dst := w.alloc()
+		mapped[ref.Num] = dst
+		queue = append(queue, ref.Num)
+		return dst
+	}
+	// Links between pages, such as annotation destinations, point at the
+	// copies, which are written here rather than through the queue.
+	for _, p := range pages {
+		mapped[p.num] = w.alloc()
+	}
+
+	for _, p := range pages {
+		d := Dict{}
+		for k, v := range p.dict {
+			d[k] = v
+		}
+		d["Parent"] = w.pagesRef
+		if _, ok := d["MediaBox"]; !ok {
+			d["MediaBox"] = Array{0, 0, pageWidth, pageHeight}
+		}
+		if _, ok := d["Resources"]; !ok {
+			d["Resources"] = Dict{}
+		}
+		ref := mapped[p.num]
+		w.writeObject(ref, d, remap)
+		w.pages = append(w.pages, ref)
+
+		for len(queue) > 0 {
+			num := queue[0]
+			queue = queue[1:]
+			w.copyObject(r, mapped[num], num, remap)
+		}
+		if w.out.err != nil {
+			return 0, w.out.err
+		}
+	}
+	return len(pages), nil
+}
+
+func (w *Writer) copyObject(r *reader, dst objRef, num int, remap func(Ref) objRef) {
+	v, err := r.object(num)
+	if err != nil {
+		w.writeObject(dst, nil, nil)
+		return
+	}
+	s, ok := v.(*Stream)
+	if !ok {
+		w.writeObject(dst, v, remap)
+		return
+	}
+	data, err := r.raw(s)
+	if err != nil {
+		w.writeObject(dst, nil, nil)
+		return
+	}
+	d := Dict{}
+	for k, v := range s.Dict {
+		d[k] = v
+	}
+	w.writeStream(dst, d, data, data.Size(), remap)
+}
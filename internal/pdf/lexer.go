@@ -0,0 +1,412 @@
+package pdf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Object types produced by the parser. Integers are int64, reals float64,
+// booleans bool and null nil.
+type (
+	// Name is a PDF name, kept in its escaped source form.
+	Name string
+	// String holds the decoded bytes of a literal or hex string.
+	String []byte
+	// Array is a PDF array.
+	Array []any
+	// Dict is a PDF dictionary.
+	Dict map[Name]any
+	// Ref is an indirect reference in the source file.
+	Ref struct{ Num, Gen int }
+	// Stream is a stream object; its data is read from the source on demand.
+	Stream struct {
+		Dict   Dict
+		offset int64
+	}
+)
+
+// maxDepth bounds nesting so hostile files cannot exhaust the stack.
+const maxDepth = 64
+
+var errSyntax = errors.New("pdf: syntax error")
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokInt
+	tokReal
+	tokName
+	tokString
+	tokKeyword
+	tokDelim
+)
+
+type token struct {
+	kind tokKind
+	s    string
+	i    int64
+	f    float64
+	b    []byte
+}
+
+// parser reads tokens and objects from a buffered source, tracking the
+// absolute offset of the next unread byte.
+type parser struct {
+	r      *bufio.Reader
+	pos    int64
+	pushed []token
+}
+
+func newParser(r io.Reader, pos int64) *parser {
+	return &parser{r: bufio.NewReader(r), pos: pos}
+}
+
+func (p *parser) readByte() (byte, error) {
+	c, err := p.r.ReadByte()
+	if err == nil {
+		p.pos++
+	}
+	return c, err
+}
+
+func (p *parser) unreadByte() {
+	if p.r.UnreadByte() == nil {
+		p.pos--
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (p *parser) unread(t token) {
+	p.pushed = append(p.pushed, t)
+}
+
+func (p *parser) next() (token, error) {
+	if n := len(p.pushed); n > 0 {
+		t := p.pushed[n-1]
+		p.pushed = p.pushed[:n-1]
+		return t, nil
+	}
+
+	c, err := p.readByte()
+	for {
+		if err == io.EOF {
+			return token{kind: tokEOF}, nil
+		}
+		if err != nil {
+			return token{}, err
+		}
+		if c == '%' {
+			for err == nil && c != '\n' && c != '\r' {
+				c, err = p.readByte()
+			}
+			continue
+		}
+		if !isSpace(c) {
+			break
+		}
+		c, err = p.readByte()
+	}
+
+	switch c {
+	case '/':
+		return token{kind: tokName, s: p.regular()}, nil
+	case '(':
+		b, err := p.literalString()
+		return token{kind: tokString, b: b}, err
+	case '<':
+		c, err := p.readByte()
+		if err != nil {
+			return token{}, err
+		}
+		if c == '<' {
+			return token{kind: tokDelim, s: "<<"}, nil
+		}
+		p.unreadByte()
+		b, err := p.hexString()
+		return token{kind: tokString, b: b}, err
+	case '>':
+		if c, err := p.readByte(); err != nil || c != '>' {
+			return token{}, errSyntax
+		}
+		return token{kind: tokDelim, s: ">>"}, nil
+	case '[', ']', '{', '}':
+		return token{kind: tokDelim, s: string(c)}, nil
+	case ')':
+		return token{}, errSyntax
+	}
+
+	p.unreadByte()
+	s := p.regular()
+	if s == "" {
+		return token{}, errSyntax
+	}
+	if c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9') {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return token{kind: tokInt, i: i, s: s}, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return token{kind: tokReal, f: f, s: s}, nil
+		}
+		// Some writers emit malformed numbers such as "--1"; treat them as 0.
+		return token{kind: tokReal, s: s}, nil
+	}
+	return token{kind: tokKeyword, s: s}, nil
+}
+
+// regular reads a run of regular characters.
+func (p *parser) regular() string {
+	var buf []byte
+	for {
+		c, err := p.readByte()
+		if err != nil {
+			break
+		}
+		if isSpace(c) || isDelim(c) {
+			p.unreadByte()
+			break
+		}
+		buf = append(buf, c)
+	}
+	return string(buf)
+}
+
+func (p *parser) literalString() ([]byte, error) {
+	var buf []byte
+	depth := 1
+	for {
+		c, err := p.readByte()
+		if err != nil {
+			return nil, errSyntax
+		}
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return buf, nil
+			}
+		case '\r':
+			// End-of-line markers inside strings read as a single newline.
+			if c, err := p.readByte(); err == nil && c != '\n' {
+				p.unreadByte()
+			}
+			c = '\n'
+		case '\\':
+			c, err = p.readByte()
+			if err != nil {
+				return nil, errSyntax
+			}
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if c, err := p.readByte(); err == nil && c != '\n' {
+					p.unreadByte()
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2; i++ {
+						d, err := p.readByte()
+						if err != nil {
+							break
+						}
+						if d < '0' || d > '7' {
+							p.unreadByte()
+							break
+						}
+						v = v*8 + int(d-'0')
+					}
+					c = byte(v)
+				}
+			}
+		}
+		buf = append(buf, c)
+	}
+}
+
+func (p *parser) hexString() ([]byte, error) {
+	var buf []byte
+	var hi byte
+	odd := false
+	for {
+		c, err := p.readByte()
+		if err != nil {
+			return nil, errSyntax
+		}
+		if c == '>' {
+			break
+		}
+		if isSpace(c) {
+			continue
+		}
+		v, ok := unhex(c)
+		if !ok {
+			return nil, errSyntax
+		}
+		if odd {
+			buf = append(buf, hi<<4|v)
+		} else {
+			hi = v
+		}
+		odd = !odd
+	}
+	if odd {
+		buf = append(buf, hi<<4)
+	}
+	return buf, nil
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// value parses the next object, which may be a reference.
+func (p *parser) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("pdf: objects nested too deeply")
+	}
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch t.kind {
+	case tokEOF:
+		return nil, io.ErrUnexpectedEOF
+	case tokInt:
+		t2, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if t2.kind == tokInt {
+			t3, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			if t3.kind == tokKeyword && t3.s == "R" {
+				return Ref{Num: int(t.i), Gen: int(t2.i)}, nil
+			}
+			p.unread(t3)
+		}
+		p.unread(t2)
+		return t.i, nil
+	case tokReal:
+		return t.f, nil
+	case tokName:
+		return Name(t.s), nil
+	case tokString:
+		return String(t.b), nil
+	case tokKeyword:
+		switch t.s {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return nil, fmt.Errorf("pdf: unexpected keyword %q", t.s)
+	}
+
+	switch t.s {
+	case "[":
+		arr := Array{}
+		for {
+			t, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			if t.kind == tokDelim && t.s == "]" {
+				return arr, nil
+			}
+			if t.kind == tokEOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			p.unread(t)
+			v, err := p.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+	case "<<":
+		d := Dict{}
+		for {
+			t, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			if t.kind == tokDelim && t.s == ">>" {
+				return d, nil
+			}
+			if t.kind != tokName {
+				return nil, errSyntax
+			}
+			v, err := p.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			d[Name(t.s)] = v
+		}
+	}
+	return nil, errSyntax
+}
+
+// expectKeyword consumes the next token, which must be the keyword kw.
+func (p *parser) expectKeyword(kw string) error {
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	if t.kind != tokKeyword || t.s != kw {
+		return fmt.Errorf("pdf: expected %q", kw)
+	}
+	return nil
+}
+
+// streamStart consumes the end-of-line after the stream keyword and returns
+// the offset of the first data byte.
+func (p *parser) streamStart() int64 {
+	c, err := p.readByte()
+	if err == nil && c == '\r' {
+		c, err = p.readByte()
+	}
+	if err == nil && c != '\n' {
+		p.unreadByte()
+	}
+	return p.pos
+}
@@ -0,0 +1,549 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+func deflate(t testing.TB, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	zw.Close()
+	return b.Bytes()
+}
+
+// pngUp applies the PNG "Up" predictor to rows of cols bytes, as writers
+// do to xref streams.
+func pngUp(data []byte, cols int) []byte {
+	var out []byte
+	prev := make([]byte, cols)
+	for len(data) >= cols {
+		row := data[:cols]
+		data = data[cols:]
+		out = append(out, 2)
+		for i, b := range row {
+			out = append(out, b-prev[i])
+		}
+		prev = row
+	}
+	return out
+}
+
+// objStmPDF returns a one-page PDF in the form most current software
+// writes: the catalog, page tree and page are in a compressed object
+// stream, indexed by a compressed xref stream with a PNG predictor, and the
+// page contents are compressed.
+func objStmPDF(t testing.TB, content []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+	offsets := map[int]int{}
+	stream := func(num int, dict string, data []byte) {
+		offsets[num] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n<<%s/Length %d>>\nstream\n", num, dict, len(data))
+		b.Write(data)
+		b.WriteString("\nendstream\nendobj\n")
+	}
+
+	stream(4, "/Filter/FlateDecode", deflate(t, content))
+
+	objs := []string{
+		"<</Type/Catalog/Pages 2 0 R>>",
+		"<</Type/Pages/Kids[3 0 R]/Count 1/MediaBox[0 0 612 792]>>",
+		"<</Type/Page/Parent 2 0 R/Contents 4 0 R/Resources<<>>>>",
+	}
+	var header, body strings.Builder
+	for i, o := range objs {
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(o + " ")
+	}
+	stream(5, fmt.Sprintf("/Type/ObjStm/N 3/First %d/Filter/FlateDecode", header.Len()),
+		deflate(t, []byte(header.String()+body.String())))
+
+	// Rows of type (1 byte), offset or stream (4) and generation or index (2)
+	xrefOffset := b.Len()
+	offsets[6] = xrefOffset
+	var rows []byte
+	row := func(typ byte, field2, field3 int) {
+		rows = append(rows, typ, byte(field2>>24), byte(field2>>16), byte(field2>>8), byte(field2), byte(field3>>8), byte(field3))
+	}
+	row(0, 0, 65535)
+	for i := range objs {
+		row(2, 5, i)
+	}
+	for num := 4; num <= 6; num++ {
+		row(1, offsets[num], 0)
+	}
+	stream(6, "/Type/XRef/Size 7/W[1 4 2]/Root 1 0 R/Filter/FlateDecode/DecodeParms<</Predictor 12/Columns 7>>",
+		deflate(t, pngUp(rows, 7)))
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+	return b.Bytes()
+}
+
+// textPDF writes a PDF of text pages with a bookmark on the first.
+func textPDF(t testing.TB, lines int) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	w.Title = "Test file"
+	w.Bookmark(0, "Start")
+	var text []Line
+	for i := 0; i < lines; i++ {
+		text = append(text, Line{Text: fmt.Sprintf("Line %d (with parentheses) \\ and a backslash", i)})
+	}
+	w.AddTextPages(text)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func open(t testing.TB, data []byte) *reader {
+	t.Helper()
+	r, err := newReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// contents returns the decoded content stream of a page.
+func contents(t testing.TB, r *reader, p page) []byte {
+	t.Helper()
+	v, err := r.resolve(p.dict["Contents"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := v.(*Stream)
+	if !ok {
+		t.Fatalf("page %d contents are %T", p.num, v)
+	}
+	data, err := r.decode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestWriteRead(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     int
+		wantPages int
+	}{
+		{"empty document", 0, 1},
+		{"one page", 10, 1},
+		{"several pages", 200, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := textPDF(t, tt.lines)
+			r := open(t, data)
+			pages, err := r.pages()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pages) != tt.wantPages {
+				t.Fatalf("read %d pages, want %d", len(pages), tt.wantPages)
+			}
+			for _, p := range pages {
+				if _, ok := p.dict["MediaBox"].(Array); !ok {
+					t.Errorf("page %d has no media box", p.num)
+				}
+			}
+			if tt.lines > 0 {
+				first := contents(t, r, pages[0])
+				if !bytes.Contains(first, []byte(escapeText("Line 0 (with parentheses) \\ and a backslash"))) {
+					t.Errorf("first page does not contain the first line:\n%s", first)
+				}
+			}
+
+			info, err := r.dict(r.trailer["Info"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := info["Title"], textString("Test file"); !bytes.Equal(got.(String), want) {
+				t.Errorf("title = %q, want %q", got, want)
+			}
+			root, err := r.dict(r.trailer["Root"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			outlines, err := r.dict(root["Outlines"])
+			if err != nil {
+				t.Fatalf("outline: %v", err)
+			}
+			if first, err := r.dict(outlines["First"]); err != nil || string(first["Title"].(String)) != string(textString("Start")) {
+				t.Errorf("first bookmark = %v, %v", first, err)
+			}
+		})
+	}
+}
+
+func TestObjectAndXrefStreams(t *testing.T) {
+	content := []byte("BT /F1 12 Tf 72 720 Td (Compressed page) Tj ET")
+	r := open(t, objStmPDF(t, content))
+
+	if e := r.xref[2]; !e.inStream || e.stream != 5 || e.index != 1 {
+		t.Errorf("xref entry for object 2 = %+v, want index 1 of stream 5", e)
+	}
+	pages, err := r.pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("read %d pages, want 1", len(pages))
+	}
+	// MediaBox is inherited from the page tree
+	if box, ok := pages[0].dict["MediaBox"].(Array); !ok || len(box) != 4 {
+		t.Errorf("media box = %v", pages[0].dict["MediaBox"])
+	}
+	if got := contents(t, r, pages[0]); !bytes.Equal(got, content) {
+		t.Errorf("contents = %q, want %q", got, content)
+	}
+}
+
+func TestImportPages(t *testing.T) {
+	content := []byte("BT /F1 12 Tf 72 720 Td (Imported) Tj ET")
+	sources := []struct {
+		name  string
+		data  []byte
+		pages int
+	}{
+		{"written by this package", textPDF(t, 200), 5},
+		{"object and xref streams", objStmPDF(t, content), 1},
+	}
+
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	w.AddTextPages([]Line{{Text: "Cover"}})
+	total := 1
+	for _, src := range sources {
+		n, err := w.ImportPages(bytes.NewReader(src.data), int64(len(src.data)))
+		if err != nil {
+			t.Fatalf("%s: %v", src.name, err)
+		}
+		if n != src.pages {
+			t.Errorf("%s: imported %d pages, want %d", src.name, n, src.pages)
+		}
+		total += n
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := open(t, out.Bytes())
+	pages, err := r.pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != total {
+		t.Fatalf("merged file has %d pages, want %d", len(pages), total)
+	}
+	// Streams are copied still compressed and must decode as before
+	if got := contents(t, r, pages[len(pages)-1]); !bytes.Equal(got, content) {
+		t.Errorf("imported contents = %q, want %q", got, content)
+	}
+	for _, p := range pages {
+		if _, err := r.dict(p.dict["Parent"]); err != nil {
+			t.Errorf("page %d: parent: %v", p.num, err)
+		}
+	}
+}
+
+func TestImportFailureLeavesOutput(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	w.AddTextPages([]Line{{Text: "Only page"}})
+	bad := []byte("%PDF-1.4\nnot really a pdf\n")
+	if _, err := w.ImportPages(bytes.NewReader(bad), int64(len(bad))); err == nil {
+		t.Fatal("imported a file that is not a PDF")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	pages, err := open(t, out.Bytes()).pages()
+	if err != nil || len(pages) != 1 {
+		t.Fatalf("got %d pages, %v; want 1", len(pages), err)
+	}
+}
+
+// An incremental update appends objects and an xref section pointing back
+// at the original with /Prev; the newer definitions win.
+func TestIncrementalUpdate(t *testing.T) {
+	data := textPDF(t, 1)
+	r := open(t, data)
+	prev, err := r.startXref()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := r.trailer["Info"].(Ref)
+	size := r.trailer["Size"].(int64)
+
+	var b bytes.Buffer
+	b.Write(data)
+	offset := b.Len()
+	fmt.Fprintf(&b, "%d 0 obj\n<</Title (Updated)>>\nendobj\n", info.Num)
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n%d 1\n%010d 00000 n \ntrailer\n<</Size %d/Root %d 0 R/Info %d 0 R/Prev %d>>\nstartxref\n%d\n%%%%EOF\n",
+		info.Num, offset, size, r.trailer["Root"].(Ref).Num, info.Num, prev, xref)
+
+	r = open(t, b.Bytes())
+	d, err := r.dict(r.trailer["Info"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(d["Title"].(String)); got != "Updated" {
+		t.Errorf("title = %q, want the updated one", got)
+	}
+	if _, err := r.pages(); err != nil {
+		t.Errorf("pages from the original section: %v", err)
+	}
+}
+
+func TestAddImagePage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(1, 1, color.RGBA{R: 200, A: 255})
+	var src bytes.Buffer
+	if err := png.Encode(&src, img); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	if err := w.AddImagePage(bytes.NewReader(src.Bytes()), int64(src.Len())); err != nil {
+		t.Fatal(err)
+	}
+	notImage := []byte("hello")
+	if err := w.AddImagePage(bytes.NewReader(notImage), int64(len(notImage))); !errors.Is(err, ErrUnsupportedImage) {
+		t.Errorf("err = %v, want ErrUnsupportedImage", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := open(t, out.Bytes())
+	pages, err := r.pages()
+	if err != nil || len(pages) != 1 {
+		t.Fatalf("got %d pages, %v; want 1", len(pages), err)
+	}
+	res, err := r.dict(pages[0].dict["Resources"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	xobjects, err := r.dict(res["XObject"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := r.resolve(xobjects["Im1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := v.(*Stream)
+	if !ok {
+		t.Fatalf("image is %T", v)
+	}
+	data, err := r.decode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 3*2*3 {
+		t.Errorf("decoded %d bytes of pixels, want %d", len(data), 3*2*3)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	valid := textPDF(t, 1)
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, nil},
+		{"not a pdf", []byte("hello, world"), nil},
+		{"truncated", valid[:len(valid)/2], nil},
+		{"bad startxref", []byte("%PDF-1.4\nstartxref\n999999\n%%EOF\n"), nil},
+		{"xref loop", []byte("%PDF-1.4\nxref\n0 1\n0000000000 65535 f \ntrailer\n<</Size 1/Prev 9>>\nstartxref\n9\n%%EOF\n"), nil},
+		{"encrypted", bytes.Replace(valid, []byte("trailer\n<<"), []byte("trailer\n<</Encrypt 1 0 R"), 1), ErrEncrypted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newReader(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err == nil {
+				_, err = r.pages()
+			}
+			if err == nil {
+				t.Fatal("read without error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// An object stream listed as stored in an object stream, here itself, must
+// fail rather than recurse until the stack overflows.
+func TestObjectStreamLoop(t *testing.T) {
+	r := &reader{xref: map[int]xrefEntry{
+		5: {inStream: true, stream: 6},
+		6: {inStream: true, stream: 5},
+		7: {inStream: true, stream: 7},
+	}, objStms: map[int]*objectStream{}}
+	for _, num := range []int{5, 7} {
+		if _, err := r.object(num); err == nil {
+			t.Errorf("object %d: loaded from a looping object stream", num)
+		}
+	}
+}
+
+func TestParserValues(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"42", "42"},
+		{"-3.5", "-3.5"},
+		{"true", "true"},
+		{"null", "<nil>"},
+		{"/Name#20With#20Spaces", "Name#20With#20Spaces"},
+		{"(a \\(nested\\) string)", "a (nested) string"},
+		{"(line\\\nwrap)", "linewrap"},
+		{"(\\101\\102)", "AB"},
+		{"<48 65 6C6C 6F>", "Hello"},
+		{"<414>", "A@"},
+		{"[1 2 0 R /X]", "[1 {2 0} X]"},
+		{"<</A 1/B [true]>>", "map[A:1 B:[true]]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			v, err := newParser(strings.NewReader(tt.in), 0).value(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := fmt.Sprint(v)
+			if s, ok := v.(String); ok {
+				got = string(s)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	deep := strings.Repeat("[", maxDepth+10) + strings.Repeat("]", maxDepth+10)
+	if _, err := newParser(strings.NewReader(deep), 0).value(0); err == nil {
+		t.Error("parsed arrays nested past maxDepth")
+	}
+}
+
+func TestUnpredictPNG(t *testing.T) {
+	rows := []byte{1, 2, 3, 4, 5, 6, 9, 9, 9}
+	tests := []struct {
+		name   string
+		filter byte
+		encode func(cur, prev []byte) []byte
+	}{
+		{"none", 0, func(cur, prev []byte) []byte { return cur }},
+		{"sub", 1, func(cur, prev []byte) []byte {
+			out := make([]byte, len(cur))
+			for i := range cur {
+				var left byte
+				if i > 0 {
+					left = cur[i-1]
+				}
+				out[i] = cur[i] - left
+			}
+			return out
+		}},
+		{"up", 2, func(cur, prev []byte) []byte {
+			out := make([]byte, len(cur))
+			for i := range cur {
+				out[i] = cur[i] - prev[i]
+			}
+			return out
+		}},
+		{"average", 3, func(cur, prev []byte) []byte {
+			out := make([]byte, len(cur))
+			for i := range cur {
+				var left byte
+				if i > 0 {
+					left = cur[i-1]
+				}
+				out[i] = cur[i] - byte((int(left)+int(prev[i]))/2)
+			}
+			return out
+		}},
+		{"paeth", 4, func(cur, prev []byte) []byte {
+			out := make([]byte, len(cur))
+			for i := range cur {
+				var left, upLeft byte
+				if i > 0 {
+					left, upLeft = cur[i-1], prev[i-1]
+				}
+				out[i] = cur[i] - paeth(left, prev[i], upLeft)
+			}
+			return out
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var enc []byte
+			prev := make([]byte, 3)
+			for i := 0; i < len(rows); i += 3 {
+				enc = append(enc, tt.filter)
+				enc = append(enc, tt.encode(rows[i:i+3], prev)...)
+				prev = rows[i : i+3]
+			}
+			got, err := unpredictPNG(enc, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, rows) {
+				t.Errorf("got %v, want %v", got, rows)
+			}
+		})
+	}
+	if _, err := unpredictPNG([]byte{7, 0, 0, 0}, 3); err == nil {
+		t.Error("accepted an unknown predictor")
+	}
+}
+
+// FuzzReader checks that no input, however malformed, makes reading or
+// importing a PDF panic or hang.
+func FuzzReader(f *testing.F) {
+	f.Add(textPDF(f, 60))
+	f.Add(objStmPDF(f, []byte("BT (x) Tj ET")))
+	f.Add([]byte("%PDF-1.4\nxref\n0 1\n0000000000 65535 f \ntrailer\n<</Size 1/Root 1 0 R>>\nstartxref\n9\n%%EOF\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ra := bytes.NewReader(data)
+		r, err := newReader(ra, int64(len(data)))
+		if err != nil {
+			return
+		}
+		r.pages()
+		for num := range r.xref {
+			if v, err := r.object(num); err == nil {
+				if s, ok := v.(*Stream); ok {
+					r.decode(s)
+				}
+			}
+		}
+		w := NewWriter(io.Discard)
+		w.ImportPages(ra, int64(len(data)))
+		w.Close()
+	})
+}
@@ -0,0 +1,600 @@
+// Package pdf writes PDF files one object at a time, so large documents can
+// be streamed to a client. It can add text and image pages and copy the
+// pages of existing PDFs, which are read with random access rather than
+// loaded into memory.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrEncrypted is returned for password-protected or encrypted PDFs.
+var ErrEncrypted = errors.New("pdf: file is encrypted")
+
+// maxDecoded caps how much an xref or object stream may inflate to.
+const maxDecoded = 64 << 20
+
+// maxPages bounds the page tree walk of a single file.
+const maxPages = 10000
+
+type xrefEntry struct {
+	// inStream is set for objects stored in an object stream.
+	inStream bool
+	offset   int64
+	stream   int
+	index    int
+}
+
+type objectStream struct {
+	data    []byte
+	first   int64
+	offsets []int64
+}
+
+// reader resolves objects of an existing PDF.
+type reader struct {
+	ra      io.ReaderAt
+	size    int64
+	xref    map[int]xrefEntry
+	trailer Dict
+	objStms map[int]*objectStream
+}
+
+func newReader(ra io.ReaderAt, size int64) (*reader, error) {
+	r := &reader{ra: ra, size: size, xref: map[int]xrefEntry{}, objStms: map[int]*objectStream{}}
+	start, err := r.startXref()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.loadXref(start, map[int64]bool{}); err != nil {
+		return nil, err
+	}
+	if r.trailer == nil {
+		return nil, errors.New("pdf: missing trailer")
+	}
+	if _, ok := r.trailer["Encrypt"]; ok {
+		return nil, ErrEncrypted
+	}
+	return r, nil
+}
+
+func (r *reader) parserAt(offset int64) *parser {
+	return newParser(io.NewSectionReader(r.ra, offset, r.size-offset), offset)
+}
+
+// startXref finds the offset named by the last startxref keyword.
+func (r *reader) startXref() (int64, error) {
+	n := int64(2048)
+	if n > r.size {
+		n = r.size
+	}
+	tail := make([]byte, n)
+	if _, err := r.ra.ReadAt(tail, r.size-n); err != nil && err != io.EOF {
+		return 0, err
+	}
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i < 0 {
+		return 0, errors.New("pdf: startxref not found")
+	}
+	p := newParser(bytes.NewReader(tail[i+len("startxref"):]), 0)
+	t, err := p.next()
+	if err != nil || t.kind != tokInt || t.i <= 0 || t.i >= r.size {
+		return 0, errors.New("pdf: bad startxref")
+	}
+	return t.i, nil
+}
+
+// loadXref reads the cross-reference section at offset and those before
+// it. Entries already seen come from a newer section and win.
+func (r *reader) loadXref(offset int64, seen map[int64]bool) error {
+	if seen[offset] || offset <= 0 || offset >= r.size {
+		return errors.New("pdf: bad xref offset")
+	}
+	seen[offset] = true
+
+	p := r.parserAt(offset)
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	var trailer Dict
+	if t.kind == tokKeyword && t.s == "xref" {
+		if trailer, err = r.xrefTable(p); err != nil {
+			return err
+		}
+		if v, ok := trailer["XRefStm"].(int64); ok {
+			if err := r.loadXref(v, seen); err != nil {
+				return err
+			}
+		}
+	} else {
+		p.unread(t)
+		if trailer, err = r.xrefStream(p); err != nil {
+			return err
+		}
+	}
+	if r.trailer == nil {
+		r.trailer = trailer
+	}
+	if prev, ok := trailer["Prev"].(int64); ok {
+		return r.loadXref(prev, seen)
+	}
+	return nil
+}
+
+func (r *reader) xrefTable(p *parser) (Dict, error) {
+	for {
+		t, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == tokKeyword && t.s == "trailer" {
+			break
+		}
+		c, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind != tokInt || c.kind != tokInt || c.i < 0 || c.i > maxDecoded {
+			return nil, errors.New("pdf: bad xref table")
+		}
+		for i := int64(0); i < c.i; i++ {
+			off, err1 := p.next()
+			gen, err2 := p.next()
+			typ, err3 := p.next()
+			if err := errors.Join(err1, err2, err3); err != nil {
+				return nil, err
+			}
+			if off.kind != tokInt || gen.kind != tokInt || typ.kind != tokKeyword {
+				return nil, errors.New("pdf: bad xref entry")
+			}
+			num := int(t.i + i)
+			if _, ok := r.xref[num]; !ok && typ.s == "n" {
+				r.xref[num] = xrefEntry{offset: off.i}
+			} else if !ok {
+				// A free entry hides any older definition of the object.
+				r.xref[num] = xrefEntry{offset: -1}
+			}
+		}
+	}
+	v, err := p.value(0)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := v.(Dict)
+	if !ok {
+		return nil, errors.New("pdf: bad trailer")
+	}
+	return d, nil
+}
+
+func (r *reader) xrefStream(p *parser) (Dict, error) {
+	_, s, err := r.indirect(p)
+	if err != nil {
+		return nil, err
+	}
+	stm, ok := s.(*Stream)
+	if !ok {
+		return nil, errors.New("pdf: xref is not a stream")
+	}
+	data, err := r.decode(stm)
+	if err != nil {
+		return nil, err
+	}
+
+	w, ok := stm.Dict["W"].(Array)
+	if !ok || len(w) != 3 {
+		return nil, errors.New("pdf: bad xref stream widths")
+	}
+	var widths [3]int
+	rowLen := 0
+	for i, v := range w {
+		n, ok := v.(int64)
+		if !ok || n < 0 || n > 8 {
+			return nil, errors.New("pdf: bad xref stream widths")
+		}
+		widths[i] = int(n)
+		rowLen += int(n)
+	}
+	if rowLen == 0 {
+		return nil, errors.New("pdf: bad xref stream widths")
+	}
+	index, _ := stm.Dict["Index"].(Array)
+	if index == nil {
+		size, _ := stm.Dict["Size"].(int64)
+		index = Array{int64(0), size}
+	}
+
+	field := func(row []byte, i int, def int64) int64 {
+		if widths[i] == 0 {
+			return def
+		}
+		start := 0
+		for j := 0; j < i; j++ {
+			start += widths[j]
+		}
+		var v int64
+		for _, b := range row[start : start+widths[i]] {
+			v = v<<8 | int64(b)
+		}
+		return v
+	}
+	for i := 0; i+1 < len(index); i += 2 {
+		first, ok1 := index[i].(int64)
+		count, ok2 := index[i+1].(int64)
+		if !ok1 || !ok2 || count < 0 {
+			return nil, errors.New("pdf: bad xref stream index")
+		}
+		for j := int64(0); j < count; j++ {
+			if len(data) < rowLen {
+				return stm.Dict, nil
+			}
+			row := data[:rowLen]
+			data = data[rowLen:]
+			num := int(first + j)
+			if _, ok := r.xref[num]; ok {
+				continue
+			}
+			switch field(row, 0, 1) {
+			case 0:
+				r.xref[num] = xrefEntry{offset: -1}
+			case 1:
+				r.xref[num] = xrefEntry{offset: field(row, 1, 0)}
+			case 2:
+				r.xref[num] = xrefEntry{inStream: true, stream: int(field(row, 1, 0)), index: int(field(row, 2, 0))}
+			}
+		}
+	}
+	return stm.Dict, nil
+}
+
+// indirect parses "num gen obj value" and, for streams, the stream header.
+func (r *reader) indirect(p *parser) (int, any, error) {
+	num, err1 := p.next()
+	gen, err2 := p.next()
+	if err := errors.Join(err1, err2); err != nil {
+		return 0, nil, err
+	}
+	if num.kind != tokInt || gen.kind != tokInt {
+		return 0, nil, errors.New("pdf: bad object header")
+	}
+	if err := p.expectKeyword("obj"); err != nil {
+		return 0, nil, err
+	}
+	v, err := p.value(0)
+	if err != nil {
+		return 0, nil, err
+	}
+	d, ok := v.(Dict)
+	if !ok {
+		return int(num.i), v, nil
+	}
+	t, err := p.next()
+	if err != nil {
+		return 0, nil, err
+	}
+	if t.kind == tokKeyword && t.s == "stream" {
+		return int(num.i), &Stream{Dict: d, offset: p.streamStart()}, nil
+	}
+	return int(num.i), d, nil
+}
+
+// object loads object num, returning nil for missing objects.
+func (r *reader) object(num int) (any, error) {
+	e, ok := r.xref[num]
+	if !ok || (!e.inStream && e.offset < 0) {
+		return nil, nil
+	}
+	if e.inStream {
+		return r.streamObject(e.stream, e.index)
+	}
+	if e.offset >= r.size {
+		return nil, fmt.Errorf("pdf: object %d out of range", num)
+	}
+	got, v, err := r.indirect(r.parserAt(e.offset))
+	if err != nil {
+		return nil, fmt.Errorf("pdf: object %d: %w", num, err)
+	}
+	if got != num {
+		return nil, fmt.Errorf("pdf: object %d not at its xref offset", num)
+	}
+	return v, nil
+}
+
+func (r *reader) streamObject(stmNum, index int) (any, error) {
+	stm, ok := r.objStms[stmNum]
+	if !ok {
+		// Object streams cannot themselves be compressed; one that claims
+		// to be would recurse forever
+		if r.xref[stmNum].inStream {
+			return nil, fmt.Errorf("pdf: object stream %d is inside an object stream", stmNum)
+		}
+		v, err := r.object(stmNum)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := v.(*Stream)
+		if !ok {
+			return nil, fmt.Errorf("pdf: object stream %d is not a stream", stmNum)
+		}
+		data, err := r.decode(s)
+		if err != nil {
+			return nil, err
+		}
+		n, _ := s.Dict["N"].(int64)
+		first, _ := s.Dict["First"].(int64)
+		if n < 0 || first < 0 || first > int64(len(data)) {
+			return nil, fmt.Errorf("pdf: bad object stream %d", stmNum)
+		}
+		stm = &objectStream{data: data, first: first}
+		p := newParser(bytes.NewReader(data[:first]), 0)
+		for i := int64(0); i < n; i++ {
+			_, err1 := p.next()
+			off, err2 := p.next()
+			if errors.Join(err1, err2) != nil || off.kind != tokInt {
+				break
+			}
+			stm.offsets = append(stm.offsets, off.i)
+		}
+		r.objStms[stmNum] = stm
+	}
+	if index < 0 || index >= len(stm.offsets) {
+		return nil, fmt.Errorf("pdf: object missing from stream %d", stmNum)
+	}
+	start := stm.first + stm.offsets[index]
+	if start < 0 || start > int64(len(stm.data)) {
+		return nil, fmt.Errorf("pdf: bad object stream %d", stmNum)
+	}
+	return newParser(bytes.NewReader(stm.data[start:]), 0).value(0)
+}
+
+// resolve follows references until it reaches a direct object.
+func (r *reader) resolve(v any) (any, error) {
+	for i := 0; i < 32; i++ {
+		ref, ok := v.(Ref)
+		if !ok {
+			return v, nil
+		}
+		var err error
+		if v, err = r.object(ref.Num); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("pdf: reference loop")
+}
+
+func (r *reader) dict(v any) (Dict, error) {
+	v, err := r.resolve(v)
+	if err != nil {
+		return nil, err
+	}
+	switch d := v.(type) {
+	case Dict:
+		return d, nil
+	case *Stream:
+		return d.Dict, nil
+	}
+	return nil, errors.New("pdf: expected a dictionary")
+}
+
+// streamLength returns the length of the stream's raw data. When /Length is
+// missing or wrong, the data ends at the endstream keyword.
+func (r *reader) streamLength(s *Stream) (int64, error) {
+	if v, err := r.resolve(s.Dict["Length"]); err == nil {
+		if n, ok := v.(int64); ok && n >= 0 && s.offset+n <= r.size {
+			buf := make([]byte, 32)
+			m, _ := r.ra.ReadAt(buf, s.offset+n)
+			if bytes.HasPrefix(bytes.TrimLeft(buf[:m], "\x00\t\n\f\r "), []byte("endstream")) {
+				return n, nil
+			}
+		}
+	}
+
+	const chunk = 64 << 10
+	buf := make([]byte, chunk+len("endstream"))
+	for off := s.offset; off < r.size; off += chunk {
+		m, err := r.ra.ReadAt(buf, off)
+		if i := bytes.Index(buf[:m], []byte("endstream")); i >= 0 {
+			end := off + int64(i)
+			// The end-of-line before endstream is not part of the data.
+			if b := buf[:i]; bytes.HasSuffix(b, []byte("\r\n")) {
+				end -= 2
+			} else if bytes.HasSuffix(b, []byte("\n")) || bytes.HasSuffix(b, []byte("\r")) {
+				end--
+			}
+			return max(end-s.offset, 0), nil
+		}
+		if err != nil {
+			break
+		}
+	}
+	return 0, errors.New("pdf: unterminated stream")
+}
+
+// raw returns the stream's undecoded data.
+func (r *reader) raw(s *Stream) (*io.SectionReader, error) {
+	n, err := r.streamLength(s)
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(r.ra, s.offset, n), nil
+}
+
+// decode returns the stream's data with its filters applied. Only
+// FlateDecode is supported, which covers xref and object streams.
+func (r *reader) decode(s *Stream) ([]byte, error) {
+	sr, err := r.raw(s)
+	if err != nil {
+		return nil, err
+	}
+	var in io.Reader = sr
+	filter, err := r.resolve(s.Dict["Filter"])
+	if err != nil {
+		return nil, err
+	}
+	if a, ok := filter.(Array); ok && len(a) == 1 {
+		filter = a[0]
+	}
+	switch filter {
+	case nil:
+	case Name("FlateDecode"), Name("Fl"):
+		zr, err := zlib.NewReader(sr)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		in = zr
+	default:
+		return nil, fmt.Errorf("pdf: unsupported filter %v", filter)
+	}
+	data, err := io.ReadAll(io.LimitReader(in, maxDecoded+1))
+	if err != nil && len(data) == 0 {
+		return nil, err
+	}
+	if len(data) > maxDecoded {
+		return nil, errors.New("pdf: stream too large")
+	}
+
+	parms, _ := r.dict(s.Dict["DecodeParms"])
+	if a, ok := s.Dict["DecodeParms"].(Array); ok && len(a) == 1 {
+		parms, _ = r.dict(a[0])
+	}
+	if pred, _ := parms["Predictor"].(int64); pred >= 10 {
+		cols, _ := parms["Columns"].(int64)
+		return unpredictPNG(data, int(max(cols, 1)))
+	} else if pred > 1 {
+		return nil, fmt.Errorf("pdf: unsupported predictor %d", pred)
+	}
+	return data, nil
+}
+
+// unpredictPNG reverses PNG row filters for one byte per column.
+func unpredictPNG(data []byte, cols int) ([]byte, error) {
+	rowLen := cols + 1
+	out := make([]byte, 0, len(data)/rowLen*cols)
+	prev := make([]byte, cols)
+	for len(data) >= rowLen {
+		filter, row := data[0], data[1:rowLen]
+		data = data[rowLen:]
+		cur := make([]byte, cols)
+		for i := range row {
+			var left, upLeft byte
+			if i > 0 {
+				left, upLeft = cur[i-1], prev[i-1]
+			}
+			up := prev[i]
+			switch filter {
+			case 0:
+				cur[i] = row[i]
+			case 1:
+				cur[i] = row[i] + left
+			case 2:
+				cur[i] = row[i] + up
+			case 3:
+				cur[i] = row[i] + byte((int(left)+int(up))/2)
+			case 4:
+				cur[i] = row[i] + paeth(left, up, upLeft)
+			default:
+				return nil, errors.New("pdf: bad png predictor")
+			}
+		}
+		out = append(out, cur...)
+		prev = cur
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// page is a leaf of the source page tree with its inherited attributes.
+type page struct {
+	num  int
+	dict Dict
+}
+
+// inheritable page attributes, see PDF 32000-1 table 30.
+var inheritable = []Name{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// pages lists the source pages in order.
+func (r *reader) pages() ([]page, error) {
+	root, err := r.dict(r.trailer["Root"])
+	if err != nil {
+		return nil, fmt.Errorf("pdf: catalog: %w", err)
+	}
+	var out []page
+	seen := map[int]bool{}
+	var walk func(v any, inherited Dict, depth int) error
+	walk = func(v any, inherited Dict, depth int) error {
+		ref, ok := v.(Ref)
+		if !ok || seen[ref.Num] || depth > maxDepth || len(out) >= maxPages {
+			return errors.New("pdf: bad page tree")
+		}
+		seen[ref.Num] = true
+		node, err := r.dict(ref)
+		if err != nil {
+			return err
+		}
+		attrs := Dict{}
+		for k, v := range inherited {
+			attrs[k] = v
+		}
+		for _, k := range inheritable {
+			if v, ok := node[k]; ok {
+				attrs[k] = v
+			}
+		}
+		kids, err := r.resolve(node["Kids"])
+		if err != nil {
+			return err
+		}
+		if node["Type"] == Name("Page") || kids == nil {
+			page := page{num: ref.Num, dict: Dict{}}
+			for k, v := range node {
+				page.dict[k] = v
+			}
+			for k, v := range attrs {
+				page.dict[k] = v
+			}
+			out = append(out, page)
+			return nil
+		}
+		list, ok := kids.(Array)
+		if !ok {
+			return errors.New("pdf: bad page tree")
+		}
+		for _, kid := range list {
+			if err := walk(kid, attrs, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root["Pages"], nil, 0); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, errors.New("pdf: no pages")
+	}
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package pdf
+
+import "fmt"
+
+// Column is one column of a table.
+type Column struct {
+	Title string
+	// Width is in points.
+	Width float64
+	// Right aligns the column, for numbers.
+	Right bool
+}
+
+// AddTable lays out heading lines, then rows under a header that is
+// repeated on every page. Cells are not wrapped, so columns must be wide
+// enough for their contents.
+func (w *Writer) AddTable(heading []Line, cols []Column, rows [][]string) {
+	const size, lead = 9, 9 * 1.6
+
+	var tableWidth float64
+	titles := make([]string, len(cols))
+	for i, c := range cols {
+		tableWidth += c.Width
+		titles[i] = c.Title
+	}
+
+	p := w.startText()
+	row := func(cells []string, font string) {
+		x := float64(margin)
+		for i, c := range cols {
+			if i < len(cells) && cells[i] != "" {
+				tx := x
+				if c.Right {
+					tx = x + c.Width - 6 - textWidth(cells[i], size)
+				}
+				p.show(font, size, tx, cells[i])
+			}
+			x += c.Width
+		}
+	}
+	header := func() {
+		p.advance(lead)
+		row(titles, "F2")
+		fmt.Fprintf(&p.content, "0.5 w %d %.2f m %.2f %.2f l S\n", margin, p.y-4, margin+tableWidth, p.y-4)
+		p.y -= 4
+	}
+
+	for _, l := range heading {
+		p.line(l)
+	}
+	// Keep the header with at least one row.
+	if p.y-2*lead-4 < margin {
+		p.flush()
+	}
+	header()
+	for _, cells := range rows {
+		if p.y-lead < margin {
+			p.flush()
+			header()
+		}
+		p.y -= lead
+		row(cells, "F1")
+	}
+	p.flush()
+}
+
+// textWidth estimates the width of s in Helvetica at size points. Digits
+// and the punctuation used in amounts are exact; anything else is taken
+// as an average glyph.
+func textWidth(s string, size float64) float64 {
+	var units int
+	for _, r := range s {
+		switch r {
+		case ',', '.', ' ', '/':
+			units += 278
+		case '-':
+			units += 333
+		case '%':
+			units += 889
+		default:
+			units += 556
+		}
+	}
+	return float64(units) * size / 1000
+}
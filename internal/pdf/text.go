@@ -0,0 +1,146 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Line is one line of text on a text page.
+type Line struct {
+	Text string
+	// Size is the font size in points; 0 means 11.
+	Size float64
+	Bold bool
+}
+
+// AddTextPages lays lines out top to bottom in Helvetica, wrapping long
+// lines and starting new pages as needed. An empty line adds spacing.
+func (w *Writer) AddTextPages(lines []Line) {
+	p := w.startText()
+	for _, l := range lines {
+		p.line(l)
+	}
+	if p.content.Len() > 0 || len(lines) == 0 {
+		p.flush()
+	}
+}
+
+// textPage is the page being laid out by AddTextPages or AddTable.
+type textPage struct {
+	w       *Writer
+	content bytes.Buffer
+	// y is the baseline of the last line written.
+	y float64
+}
+
+func (w *Writer) startText() *textPage {
+	w.loadFonts()
+	return &textPage{w: w, y: pageHeight - margin}
+}
+
+// flush adds the page and starts the next one.
+func (p *textPage) flush() {
+	p.w.addPage(p.content.Bytes(), Dict{"Font": p.w.fonts})
+	p.content.Reset()
+	p.y = pageHeight - margin
+}
+
+// advance moves down by height, starting a new page if it does not fit.
+func (p *textPage) advance(height float64) {
+	p.y -= height
+	if p.y < margin {
+		p.flush()
+		p.y -= height
+	}
+}
+
+// show writes text with its baseline at x and the current y.
+func (p *textPage) show(font string, size, x float64, text string) {
+	fmt.Fprintf(&p.content, "BT /%s %g Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, p.y, escapeText(text))
+}
+
+// line writes l, wrapped to the page width.
+func (p *textPage) line(l Line) {
+	size := l.Size
+	if size == 0 {
+		size = 11
+	}
+	font := "F1"
+	if l.Bold {
+		font = "F2"
+	}
+	for _, text := range wrap(l.Text, size) {
+		p.advance(size * 1.4)
+		if text != "" {
+			p.show(font, size, margin, text)
+		}
+	}
+}
+
+// loadFonts writes Helvetica (F1) and Helvetica-Bold (F2) the first time
+// text is added.
+func (w *Writer) loadFonts() {
+	if w.fonts != nil {
+		return
+	}
+	regular, bold := w.alloc(), w.alloc()
+	font := func(base string) Dict {
+		return Dict{"Type": Name("Font"), "Subtype": Name("Type1"), "BaseFont": Name(base), "Encoding": Name("WinAnsiEncoding")}
+	}
+	w.writeObject(regular, font("Helvetica"), nil)
+	w.writeObject(bold, font("Helvetica-Bold"), nil)
+	w.fonts = Dict{"F1": regular, "F2": bold}
+}
+
+// wrap splits text into lines that fit the page width, estimating the
+// average Helvetica glyph at half the font size.
+func wrap(text string, size float64) []string {
+	limit := int((pageWidth - 2*margin) / (size * 0.5))
+	var lines []string
+	var cur []string
+	curLen := 0
+	for _, word := range strings.Fields(text) {
+		for len(word) > limit {
+			if len(cur) > 0 {
+				lines = append(lines, strings.Join(cur, " "))
+				cur, curLen = nil, 0
+			}
+			lines = append(lines, word[:limit])
+			word = word[limit:]
+		}
+		if curLen > 0 && curLen+1+len(word) > limit {
+			lines = append(lines, strings.Join(cur, " "))
+			cur, curLen = nil, 0
+		}
+		if curLen > 0 {
+			curLen++
+		}
+		cur = append(cur, word)
+		curLen += len(word)
+	}
+	if len(cur) > 0 || len(lines) == 0 {
+		lines = append(lines, strings.Join(cur, " "))
+	}
+	return lines
+}
+
+// escapeText encodes s for a literal string shown in a WinAnsi font.
+// Characters outside Latin-1 become "?".
+func escapeText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
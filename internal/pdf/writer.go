@@ -0,0 +1,292 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf16"
+)
+
+// US Letter, in points.
+const (
+	pageWidth  = 612
+	pageHeight = 792
+	margin     = 54
+)
+
+// objRef refers to an object in the file being written.
+type objRef int
+
+// countingWriter tracks the output offset and keeps the first write error.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+type outlineItem struct {
+	title string
+	level int
+	page  int
+}
+
+// Writer streams a new PDF. Pages are written as they are added; Close
+// writes the page tree, bookmarks and cross-reference table.
+type Writer struct {
+	// Title is stored in the document information dictionary.
+	Title string
+
+	out      *countingWriter
+	offsets  []int64
+	pagesRef objRef
+	pages    []objRef
+	outline  []outlineItem
+	fonts    Dict
+}
+
+// NewWriter starts a PDF on w.
+func NewWriter(w io.Writer) *Writer {
+	pw := &Writer{out: &countingWriter{w: bufio.NewWriterSize(w, 64<<10)}, offsets: []int64{0}}
+	io.WriteString(pw.out, "%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	pw.pagesRef = pw.alloc()
+	return pw
+}
+
+func (w *Writer) alloc() objRef {
+	w.offsets = append(w.offsets, -1)
+	return objRef(len(w.offsets) - 1)
+}
+
+func (w *Writer) begin(ref objRef) {
+	w.offsets[ref] = w.out.n
+	fmt.Fprintf(w.out, "%d 0 obj\n", ref)
+}
+
+func (w *Writer) end() {
+	io.WriteString(w.out, "\nendobj\n")
+}
+
+// writeObject writes a complete non-stream object.
+func (w *Writer) writeObject(ref objRef, v any, remap func(Ref) objRef) {
+	w.begin(ref)
+	w.writeValue(v, remap)
+	w.end()
+}
+
+// writeStream writes a stream object whose data is copied from data.
+func (w *Writer) writeStream(ref objRef, d Dict, data io.Reader, length int64, remap func(Ref) objRef) error {
+	d["Length"] = length
+	w.begin(ref)
+	w.writeValue(d, remap)
+	io.WriteString(w.out, "\nstream\n")
+	n, err := io.Copy(w.out, data)
+	if err == nil && n != length {
+		err = io.ErrUnexpectedEOF
+	}
+	io.WriteString(w.out, "\nendstream")
+	w.end()
+	return err
+}
+
+func (w *Writer) writeValue(v any, remap func(Ref) objRef) {
+	out := w.out
+	switch v := v.(type) {
+	case nil:
+		io.WriteString(out, "null")
+	case bool:
+		io.WriteString(out, strconv.FormatBool(v))
+	case int:
+		io.WriteString(out, strconv.Itoa(v))
+	case int64:
+		io.WriteString(out, strconv.FormatInt(v, 10))
+	case float64:
+		io.WriteString(out, strconv.FormatFloat(v, 'f', -1, 64))
+	case Name:
+		io.WriteString(out, "/"+string(v))
+	case String:
+		io.WriteString(out, "<"+hex.EncodeToString(v)+">")
+	case objRef:
+		fmt.Fprintf(out, "%d 0 R", v)
+	case Ref:
+		fmt.Fprintf(out, "%d 0 R", remap(v))
+	case Array:
+		io.WriteString(out, "[")
+		for i, e := range v {
+			if i > 0 {
+				io.WriteString(out, " ")
+			}
+			w.writeValue(e, remap)
+		}
+		io.WriteString(out, "]")
+	case Dict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		io.WriteString(out, "<<")
+		for _, k := range keys {
+			io.WriteString(out, "/"+k+" ")
+			w.writeValue(v[Name(k)], remap)
+			io.WriteString(out, " ")
+		}
+		io.WriteString(out, ">>")
+	default:
+		io.WriteString(out, "null")
+	}
+}
+
+// Bookmark adds an outline entry pointing at the next page added. Level 0
+// entries are top level; level 1 entries nest under the previous level 0.
+func (w *Writer) Bookmark(level int, title string) {
+	w.outline = append(w.outline, outlineItem{title: title, level: level, page: len(w.pages)})
+}
+
+// addPage writes a page with the given contents and resources.
+func (w *Writer) addPage(content []byte, resources Dict) {
+	contentRef := w.alloc()
+	w.writeStream(contentRef, Dict{}, bytes.NewReader(content), int64(len(content)), nil)
+	page := w.alloc()
+	w.writeObject(page, Dict{
+		"Type":      Name("Page"),
+		"Parent":    w.pagesRef,
+		"MediaBox":  Array{0, 0, pageWidth, pageHeight},
+		"Resources": resources,
+		"Contents":  contentRef,
+	}, nil)
+	w.pages = append(w.pages, page)
+}
+
+// Close finishes the document and flushes it to the underlying writer.
+func (w *Writer) Close() error {
+	if len(w.pages) == 0 {
+		w.addPage(nil, Dict{})
+	}
+	kids := make(Array, len(w.pages))
+	for i, p := range w.pages {
+		kids[i] = p
+	}
+	w.writeObject(w.pagesRef, Dict{"Type": Name("Pages"), "Kids": kids, "Count": len(w.pages)}, nil)
+
+	catalog := Dict{"Type": Name("Catalog"), "Pages": w.pagesRef}
+	if outlines := w.writeOutline(); outlines != 0 {
+		catalog["Outlines"] = outlines
+		catalog["PageMode"] = Name("UseOutlines")
+	}
+	root := w.alloc()
+	w.writeObject(root, catalog, nil)
+	info := w.alloc()
+	w.writeObject(info, Dict{
+		"Title":        textString(w.Title),
+		"Producer":     textString("MortgageAgent"),
+		"CreationDate": String(time.Now().UTC().Format("D:20060102150405Z")),
+	}, nil)
+
+	xref := w.out.n
+	fmt.Fprintf(w.out, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets))
+	for _, off := range w.offsets[1:] {
+		if off < 0 {
+			io.WriteString(w.out, "0000000000 00000 f \n")
+			continue
+		}
+		fmt.Fprintf(w.out, "%010d 00000 n \n", off)
+	}
+	io.WriteString(w.out, "trailer\n")
+	w.writeValue(Dict{"Size": len(w.offsets), "Root": root, "Info": info}, nil)
+	fmt.Fprintf(w.out, "\nstartxref\n%d\n%%%%EOF\n", xref)
+
+	if w.out.err != nil {
+		return w.out.err
+	}
+	return w.out.w.Flush()
+}
+
+// writeOutline writes the bookmark tree and returns its root, or 0 if
+// there are no bookmarks.
+func (w *Writer) writeOutline() objRef {
+	type node struct {
+		ref      objRef
+		item     outlineItem
+		children []*node
+	}
+	var top []*node
+	for _, it := range w.outline {
+		if it.page >= len(w.pages) {
+			continue
+		}
+		n := &node{item: it}
+		if it.level > 0 && len(top) > 0 {
+			parent := top[len(top)-1]
+			parent.children = append(parent.children, n)
+		} else {
+			top = append(top, n)
+		}
+	}
+	if len(top) == 0 {
+		return 0
+	}
+
+	root := w.alloc()
+	var assign func([]*node)
+	assign = func(nodes []*node) {
+		for _, n := range nodes {
+			n.ref = w.alloc()
+			assign(n.children)
+		}
+	}
+	assign(top)
+
+	var write func(parent objRef, nodes []*node) int
+	write = func(parent objRef, nodes []*node) int {
+		count := 0
+		for i, n := range nodes {
+			d := Dict{
+				"Title":  textString(n.item.title),
+				"Parent": parent,
+				"Dest":   Array{w.pages[n.item.page], Name("Fit")},
+			}
+			if i > 0 {
+				d["Prev"] = nodes[i-1].ref
+			}
+			if i < len(nodes)-1 {
+				d["Next"] = nodes[i+1].ref
+			}
+			if len(n.children) > 0 {
+				d["First"] = n.children[0].ref
+				d["Last"] = n.children[len(n.children)-1].ref
+				d["Count"] = write(n.ref, n.children)
+				count += d["Count"].(int)
+			}
+			w.writeObject(n.ref, d, nil)
+			count++
+		}
+		return count
+	}
+	count := write(root, top)
+	w.writeObject(root, Dict{"Type": Name("Outlines"), "First": top[0].ref, "Last": top[len(top)-1].ref, "Count": count}, nil)
+	return root
+}
+
+// textString encodes s as a UTF-16 text string, which any viewer displays.
+func textString(s string) String {
+	b := []byte{0xfe, 0xff}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return String(b)
+}
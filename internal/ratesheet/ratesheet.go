@@ -0,0 +1,294 @@
+// Package ratesheet reads lender rate sheets from CSV and XLSX files. Each
+// lender's columns are found by the header names in its
+// models.RateSheetMapping; rates are percentages such as "4.79" or "4.79%".
+// Dates are ISO, such as 2026-07-01, or name the month, such as 1 Jul 2026,
+// since 07/01/2026 reads as July in the US and January in Canada. Date cells
+// in XLSX files are read as dates whatever their display format.
+package ratesheet
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"MortgageAgent/internal/models"
+)
+
+// MaxRows bounds how many products one sheet may list.
+const MaxRows = 5000
+
+// ErrUnsupported is returned for files that are neither CSV nor XLSX.
+var ErrUnsupported = errors.New("ratesheet: only .csv and .xlsx files can be imported")
+
+// Supported reports whether filename names a CSV or XLSX file.
+func Supported(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".xlsx":
+		return true
+	}
+	return false
+}
+
+// Errors lists every problem found in a sheet, one per line.
+type Errors []string
+
+func (e Errors) Error() string {
+	return strings.Join(e, "\n")
+}
+
+// Row is one product's rate as read from a sheet. From is zero and To nil
+// when the sheet does not date the rate.
+type Row struct {
+	Line    int
+	Product string
+	Rate    float64
+	From    time.Time
+	To      *time.Time
+}
+
+// Read parses a rate sheet, choosing the format by filename. Problems with
+// individual rows are returned together as Errors.
+func Read(r io.Reader, filename string, m models.RateSheetMapping) ([]Row, error) {
+	// raw holds the unformatted XLSX values, so date cells can be read by
+	// their serial number
+	var records, raw [][]string
+	var err error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		records, err = readCSV(r)
+	case ".xlsx":
+		records, raw, err = readXLSX(r, m.Sheet)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, Errors{"The sheet is empty."}
+	}
+
+	header := map[string]int{}
+	for i, name := range records[0] {
+		header[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	column := func(name string) (int, bool) {
+		i, ok := header[strings.ToLower(strings.TrimSpace(name))]
+		return i, ok
+	}
+	var problems Errors
+	required := func(name string) int {
+		i, ok := column(name)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("The header row has no %q column.", name))
+		}
+		return i
+	}
+	optional := func(name string) int {
+		if name == "" {
+			return -1
+		}
+		return required(name)
+	}
+	productCol, rateCol := required(m.ProductColumn), required(m.RateColumn)
+	fromCol, toCol := optional(m.EffectiveFromColumn), optional(m.EffectiveToColumn)
+	if problems != nil {
+		return nil, problems
+	}
+
+	var rows []Row
+	seen := map[string]int{}
+	for i, record := range records[1:] {
+		line := i + 2
+		cell := func(col int) string {
+			if col < 0 || col >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[col])
+		}
+		date := func(col int) (time.Time, error) {
+			if line-1 < len(raw) && col >= 0 && col < len(raw[line-1]) {
+				if serial, err := strconv.ParseFloat(raw[line-1][col], 64); err == nil {
+					return excelDate(serial)
+				}
+			}
+			return parseDate(cell(col))
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		if len(rows) == MaxRows {
+			problems = append(problems, fmt.Sprintf("Sheets may list at most %d products.", MaxRows))
+			break
+		}
+		row := Row{Line: line, Product: cell(productCol)}
+		if row.Product == "" {
+			problems = append(problems, fmt.Sprintf("Line %d: the product is missing.", line))
+			continue
+		}
+		key := strings.ToLower(row.Product)
+		if first, ok := seen[key]; ok {
+			problems = append(problems, fmt.Sprintf("Line %d: %s is already listed on line %d.", line, row.Product, first))
+			continue
+		}
+		seen[key] = line
+		if row.Rate, err = parseRate(cell(rateCol)); err != nil {
+			problems = append(problems, fmt.Sprintf("Line %d: %s.", line, err))
+			continue
+		}
+		if s := cell(fromCol); s != "" {
+			if row.From, err = date(fromCol); err != nil {
+				problems = append(problems, fmt.Sprintf("Line %d: the effective-from date %q is not a date such as 2026-07-01 or 1 Jul 2026.", line, s))
+				continue
+			}
+		}
+		if s := cell(toCol); s != "" {
+			to, err := date(toCol)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("Line %d: the effective-to date %q is not a date such as 2026-07-01 or 1 Jul 2026.", line, s))
+				continue
+			}
+			row.To = &to
+		}
+		rows = append(rows, row)
+	}
+	if problems != nil {
+		return nil, problems
+	}
+	if len(rows) == 0 {
+		return nil, Errors{"The sheet lists no products."}
+	}
+	return rows, nil
+}
+
+func readCSV(r io.Reader) ([][]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, Errors{"The file is not valid CSV: " + err.Error()}
+	}
+	// Excel writes a byte order mark at the start of UTF-8 CSV files.
+	if len(records) > 0 && len(records[0]) > 0 {
+		records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+	}
+	return records, nil
+}
+
+// readXLSX returns the sheet's cells as displayed and as stored.
+func readXLSX(r io.Reader, sheet string) (records, raw [][]string, err error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, nil, Errors{"The file is not a readable XLSX workbook."}
+	}
+	defer f.Close()
+	if sheet == "" {
+		sheet = f.GetSheetName(0)
+	}
+	records, err = f.GetRows(sheet)
+	if err != nil {
+		return nil, nil, Errors{fmt.Sprintf("The workbook has no %q sheet.", sheet)}
+	}
+	raw, err = f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	return records, raw, nil
+}
+
+// parseRate reads a percentage and returns it as a fraction.
+func parseRate(s string) (float64, error) {
+	if s == "" {
+		return 0, errors.New("the rate is missing")
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "%")), 64)
+	if err != nil || v <= 0 || v >= 100 {
+		return 0, fmt.Errorf("the rate %q is not a percentage above 0 and below 100", s)
+	}
+	return v / 100, nil
+}
+
+// dateLayouts are the date formats accepted in sheets. Only ISO dates are
+// all numbers; the rest name the month, as day/month and month/day orders
+// cannot be told apart.
+var dateLayouts = []string{
+	"2006-01-02", "2006/01/02",
+	"2 Jan 2006", "2 January 2006", "2-Jan-2006", "2-Jan-06",
+	"Jan 2, 2006", "January 2, 2006", "Jan 2 2006", "January 2 2006",
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("ratesheet: %q is not a date", s)
+}
+
+// excelDate converts a date cell's serial number to the day it shows.
+func excelDate(serial float64) (time.Time, error) {
+	t, err := excelize.ExcelDateToTime(serial, false)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local), nil
+}
+
+// Resolve matches rows to the lender's products by name, ignoring case, and
+// dates them with from and to unless the sheet did. Rates may not start
+// before today so that past quotes stay reproducible.
+func Resolve(rows []Row, products []models.LenderProduct, from time.Time, to *time.Time, today time.Time) ([]models.RateImportRow, error) {
+	byName := map[string]models.LenderProduct{}
+	for _, p := range products {
+		byName[strings.ToLower(p.Name)] = p
+	}
+	today = day(today)
+
+	var out []models.RateImportRow
+	var problems Errors
+	for _, row := range rows {
+		p, ok := byName[strings.ToLower(row.Product)]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("Line %d: the lender has no product named %s.", row.Line, row.Product))
+			continue
+		}
+		r := models.RateImportRow{
+			Line: row.Line, ProductID: p.ID, ProductName: p.Name, Rate: row.Rate,
+			EffectiveFrom: day(from), EffectiveTo: to,
+		}
+		if !row.From.IsZero() {
+			r.EffectiveFrom = day(row.From)
+		}
+		if row.To != nil {
+			r.EffectiveTo = row.To
+		}
+		switch {
+		case r.EffectiveFrom.Before(today):
+			problems = append(problems, fmt.Sprintf("Line %d: rates cannot take effect before today.", row.Line))
+			continue
+		case r.EffectiveTo != nil && r.EffectiveTo.Before(r.EffectiveFrom):
+			problems = append(problems, fmt.Sprintf("Line %d: the rate ends before it takes effect.", row.Line))
+			continue
+		}
+		out = append(out, r)
+	}
+	if problems != nil {
+		return nil, problems
+	}
+	return out, nil
+}
+
+// day truncates t to midnight in its location.
+func day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
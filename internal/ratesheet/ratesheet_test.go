@@ -0,0 +1,219 @@
+package ratesheet
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"MortgageAgent/internal/models"
+)
+
+var mapping = models.RateSheetMapping{
+	ProductColumn: "Product", RateColumn: "Rate", EffectiveFromColumn: "Effective", EffectiveToColumn: "Until",
+}
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+func datePtr(y int, m time.Month, d int) *time.Time {
+	t := date(y, m, d)
+	return &t
+}
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []Row
+		problem string
+	}{
+		{
+			name: "rates and dates",
+			csv: "\ufeffProduct,Rate,Effective,Until\n" +
+				"5 year fixed,4.79%,2026-07-01,\n" +
+				",,,\n" +
+				"3 year fixed, 5.1 ,1 Jul 2026,2026/09/30\n" +
+				"Variable,6,\"Jul 15, 2026\",31-Dec-26\n",
+			want: []Row{
+				{Line: 2, Product: "5 year fixed", Rate: 0.0479, From: date(2026, 7, 1)},
+				{Line: 4, Product: "3 year fixed", Rate: 0.051, From: date(2026, 7, 1), To: datePtr(2026, 9, 30)},
+				{Line: 5, Product: "Variable", Rate: 0.06, From: date(2026, 7, 15), To: datePtr(2026, 12, 31)},
+			},
+		},
+		{
+			name: "headers in any case and order, dates optional",
+			csv:  "until,RATE,product,effective\n,4.5,5 year fixed,\n",
+			want: []Row{{Line: 2, Product: "5 year fixed", Rate: 0.045}},
+		},
+		{
+			name:    "day and month that could be either way round",
+			csv:     "Product,Rate,Effective,Until\n5 year fixed,4.79,07/01/2026,\n",
+			problem: `Line 2: the effective-from date "07/01/2026" is not a date`,
+		},
+		{
+			name:    "two-digit year with numbers only",
+			csv:     "Product,Rate,Effective,Until\n5 year fixed,4.79,2026-07-01,1/2/27\n",
+			problem: `Line 2: the effective-to date "1/2/27" is not a date`,
+		},
+		{
+			name:    "missing column",
+			csv:     "Product,Effective,Until\n5 year fixed,2026-07-01,\n",
+			problem: `The header row has no "Rate" column.`,
+		},
+		{
+			name:    "rate out of range",
+			csv:     "Product,Rate,Effective,Until\n5 year fixed,479,,\n",
+			problem: `Line 2: the rate "479" is not a percentage above 0 and below 100.`,
+		},
+		{
+			name:    "product listed twice",
+			csv:     "Product,Rate,Effective,Until\n5 year fixed,4.79,,\n5 YEAR FIXED,4.89,,\n",
+			problem: "Line 3: 5 YEAR FIXED is already listed on line 2.",
+		},
+		{
+			name:    "no products",
+			csv:     "Product,Rate,Effective,Until\n,,,\n",
+			problem: "The sheet lists no products.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := Read(strings.NewReader(tt.csv), "rates.csv", mapping)
+			checkRead(t, rows, err, tt.want, tt.problem)
+		})
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	tests := []struct {
+		name    string
+		cells   [][]interface{}
+		want    []Row
+		problem string
+	}{
+		{
+			// Date cells shown as m/d/yy by default are read by value
+			name: "date cells",
+			cells: [][]interface{}{
+				{"Product", "Rate", "Effective", "Until"},
+				{"5 year fixed", 4.79, date(2026, 7, 1), date(2026, 12, 31)},
+				{"Variable", "6%", "2026-08-03"},
+			},
+			want: []Row{
+				{Line: 2, Product: "5 year fixed", Rate: 0.0479, From: date(2026, 7, 1), To: datePtr(2026, 12, 31)},
+				{Line: 3, Product: "Variable", Rate: 0.06, From: date(2026, 8, 3)},
+			},
+		},
+		{
+			name: "ambiguous text date",
+			cells: [][]interface{}{
+				{"Product", "Rate", "Effective", "Until"},
+				{"5 year fixed", 4.79, "03/04/2026"},
+			},
+			problem: `Line 2: the effective-from date "03/04/2026" is not a date`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := excelize.NewFile()
+			for i, row := range tt.cells {
+				cell, _ := excelize.CoordinatesToCellName(1, i+1)
+				if err := f.SetSheetRow("Sheet1", cell, &row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var buf bytes.Buffer
+			if err := f.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			rows, err := Read(&buf, "rates.xlsx", mapping)
+			checkRead(t, rows, err, tt.want, tt.problem)
+		})
+	}
+}
+
+func checkRead(t *testing.T, rows []Row, err error, want []Row, problem string) {
+	t.Helper()
+	if problem != "" {
+		var problems Errors
+		if !errors.As(err, &problems) || !strings.Contains(err.Error(), problem) {
+			t.Errorf("error %v, want %q", err, problem)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("rows %+v, want %+v", rows, want)
+	}
+	for i := range rows {
+		got, w := rows[i], want[i]
+		if got.Line != w.Line || got.Product != w.Product || got.Rate != w.Rate || !got.From.Equal(w.From) ||
+			(got.To == nil) != (w.To == nil) || got.To != nil && !got.To.Equal(*w.To) {
+			t.Errorf("row %d: %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	today := time.Date(2026, 6, 15, 14, 30, 0, 0, time.Local)
+	products := []models.LenderProduct{{ID: 7, Name: "5 Year Fixed"}, {ID: 9, Name: "Variable"}}
+	type dates struct {
+		from time.Time
+		to   *time.Time
+	}
+	tests := []struct {
+		name    string
+		row     Row
+		from    time.Time
+		to      *time.Time
+		want    dates
+		problem string
+	}{
+		{"undated row takes the import's dates", Row{Product: "5 year fixed"},
+			date(2026, 7, 1), datePtr(2026, 9, 30), dates{date(2026, 7, 1), datePtr(2026, 9, 30)}, ""},
+		{"starting today", Row{Product: "Variable"},
+			today, nil, dates{date(2026, 6, 15), nil}, ""},
+		{"sheet dates win", Row{Product: "variable", From: date(2026, 8, 1), To: datePtr(2026, 8, 31)},
+			date(2026, 7, 1), datePtr(2026, 9, 30), dates{date(2026, 8, 1), datePtr(2026, 8, 31)}, ""},
+		{"sheet start keeps the import's end", Row{Product: "Variable", From: date(2026, 8, 1)},
+			today, datePtr(2026, 9, 30), dates{date(2026, 8, 1), datePtr(2026, 9, 30)}, ""},
+		{"one-day rate", Row{Product: "Variable", From: date(2026, 8, 1), To: datePtr(2026, 8, 1)},
+			today, nil, dates{date(2026, 8, 1), datePtr(2026, 8, 1)}, ""},
+		{"in the past", Row{Product: "Variable", From: date(2026, 6, 14)},
+			today, nil, dates{}, "rates cannot take effect before today"},
+		{"ends before it starts", Row{Product: "Variable", From: date(2026, 8, 1), To: datePtr(2026, 7, 31)},
+			today, nil, dates{}, "the rate ends before it takes effect"},
+		{"unknown product", Row{Product: "10 year fixed"},
+			today, nil, dates{}, "the lender has no product named 10 year fixed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.row.Line, tt.row.Rate = 2, 0.0479
+			got, err := Resolve([]Row{tt.row}, products, tt.from, tt.to, today)
+			if tt.problem != "" {
+				if err == nil || !strings.Contains(err.Error(), "Line 2: "+tt.problem) {
+					t.Errorf("error %v, want %q", err, tt.problem)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := got[0]
+			if r.Line != 2 || r.Rate != 0.0479 || r.ProductID != products[0].ID && r.ProductID != products[1].ID {
+				t.Errorf("row %+v", r)
+			}
+			if !r.EffectiveFrom.Equal(tt.want.from) || !reflect.DeepEqual(r.EffectiveTo, tt.want.to) {
+				t.Errorf("effective %v to %v, want %v to %v", r.EffectiveFrom, r.EffectiveTo, tt.want.from, tt.want.to)
+			}
+		})
+	}
+}
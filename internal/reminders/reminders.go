@@ -0,0 +1,87 @@
+// Package reminders notifies brokers and admins about deadlines on their
+// applications. Each reminder is sent once.
+package reminders
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/notify"
+	"MortgageAgent/internal/render"
+)
+
+// RateHolds notifies the broker and assigned admin of every application
+// with a rate hold expiring within warnDays of now, and returns how many
+// holds were reminded about. A hold is marked reminded once anyone has been
+// notified, so a failure for one recipient never repeats the reminder to
+// the other; a hold nobody could be notified about is retried on the next
+// run.
+func RateHolds(database *sql.DB, warnDays int, now time.Time) (int, error) {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	holds, err := db.GetHoldsToRemind(database, today, today.AddDate(0, 0, warnDays))
+	if err != nil {
+		return 0, err
+	}
+
+	type recipient struct {
+		userID   int
+		userType string
+	}
+	sent := 0
+	for _, h := range holds {
+		app, err := db.GetApplicationByID(database, fmt.Sprint(h.ApplicationID))
+		if err != nil || app == nil {
+			return sent, fmt.Errorf("loading application %d: %w", h.ApplicationID, err)
+		}
+		recipients := []recipient{{app.BrokerID, "broker"}}
+		if app.AssignedAdminID != nil {
+			recipients = append(recipients, recipient{*app.AssignedAdminID, "admin"})
+		}
+
+		notified := 0
+		for _, to := range recipients {
+			err := notify.Send(database, models.Notification{
+				UserID: to.userID, Kind: models.NotifyRateHold, ApplicationID: app.ID,
+				Title: fmt.Sprintf("Rate hold on application #%d expires %s", app.ID, render.Date(h.ExpiresOn)),
+				Body:  holdMessage(h, today),
+				Link:  notify.ApplicationLink(to.userType, app.ID) + "#commitments",
+			})
+			if err != nil {
+				slog.Error("Error sending rate hold reminder", "hold_id", h.ID, "user_id", to.userID, "err", err)
+				continue
+			}
+			notified++
+		}
+		if notified == 0 {
+			continue
+		}
+		if err := db.MarkHoldReminded(database, h.ID, now); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func holdMessage(h models.RateHold, today time.Time) string {
+	product := h.LenderName
+	if h.ProductName != "" {
+		product += " " + h.ProductName
+	}
+	days := int(h.ExpiresOn.Sub(today).Hours()/24 + 0.5)
+	when := fmt.Sprintf("in %d days", days)
+	switch days {
+	case 0:
+		when = "today"
+	case 1:
+		when = "tomorrow"
+	}
+	return fmt.Sprintf("The %s rate of %s held for application #%d expires %s, on %s. "+
+		"Complete the file or arrange an extension before then.",
+		product, render.Percent(h.Rate), h.ApplicationID, when, render.Date(h.ExpiresOn))
+}
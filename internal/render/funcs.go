@@ -0,0 +1,113 @@
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/auth"
+)
+
+// Funcs are the helpers available to every template.
+var Funcs = template.FuncMap{
+	"currency":    Currency,
+	"date":        Date,
+	"datetime":    DateTime,
+	"statusBadge": StatusBadge,
+	"humanize":    Humanize,
+	"percent":     Percent,
+	// Bound to the request at render time; see requestFuncs.
+	"csrfToken": func() string { return "" },
+	"csrfField": func() template.HTML { return "" },
+}
+
+// requestFuncs returns the helpers that depend on the request being served.
+// csrfField renders the hidden input every POST form must include.
+func requestFuncs(r *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": func() string { return auth.CSRFToken(r) },
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + auth.CSRFField + `" value="` +
+				template.HTMLEscapeString(auth.CSRFToken(r)) + `">`)
+		},
+	}
+}
+
+// Currency formats an amount in dollars as "$1,234.56".
+func Currency(v interface{}) string {
+	var amount float64
+	switch n := v.(type) {
+	case float64:
+		amount = n
+	case float32:
+		amount = float64(n)
+	case int:
+		amount = float64(n)
+	case int64:
+		amount = float64(n)
+	default:
+		return fmt.Sprint(v)
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	s := fmt.Sprintf("%.2f", amount)
+	whole, cents := s[:len(s)-3], s[len(s)-3:]
+
+	var b strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	return sign + "$" + b.String() + cents
+}
+
+// Percent formats a fraction such as 0.3215 as "32.15%".
+func Percent(v float64) string {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return "—"
+	}
+	return fmt.Sprintf("%.2f%%", v*100)
+}
+
+// Date formats t as "Jan 2, 2006".
+func Date(t time.Time) string {
+	if t.IsZero() {
+		return "—"
+	}
+	return t.Format("Jan 2, 2006")
+}
+
+// DateTime formats t as "Jan 2, 2006 3:04 PM".
+func DateTime(t time.Time) string {
+	if t.IsZero() {
+		return "—"
+	}
+	return t.Format("Jan 2, 2006 3:04 PM")
+}
+
+// Humanize turns identifiers such as "Proof_of_income" or "in_review" into
+// "Proof of income" and "In review".
+func Humanize(s string) string {
+	s = strings.ReplaceAll(s, "_", " ")
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// StatusBadge renders a status as a coloured badge; the colour comes from the
+// badge-<status> class in components.css.
+func StatusBadge(status string) template.HTML {
+	class := template.HTMLEscapeString(status)
+	label := template.HTMLEscapeString(Humanize(status))
+	return template.HTML(`<span class="badge badge-` + class + `">` + label + `</span>`)
+}
@@ -0,0 +1,162 @@
+// Package render parses the HTML templates once at startup and renders pages
+// inside the shared base layout.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"MortgageAgent/internal/logging"
+)
+
+const (
+	layoutGlob  = "layouts/*.html"
+	partialGlob = "partials/*.html"
+	// errorPage is rendered when a page fails to execute.
+	errorPage = "error"
+)
+
+// Renderer holds one parsed template set per page. Every set contains the
+// layouts and partials, so pages only define the blocks they override.
+type Renderer struct {
+	fsys fs.FS
+	dev  bool
+
+	mu    sync.RWMutex
+	pages map[string]*template.Template
+}
+
+// New parses every page in fsys. In dev mode pages are re-parsed from fsys on
+// each render so template edits show up without a restart.
+func New(fsys fs.FS, dev bool) (*Renderer, error) {
+	rd := &Renderer{fsys: fsys, dev: dev}
+	if err := rd.load(); err != nil {
+		return nil, err
+	}
+	return rd, nil
+}
+
+func (rd *Renderer) load() error {
+	names, err := fs.Glob(rd.fsys, "*.html")
+	if err != nil {
+		return err
+	}
+
+	pages := make(map[string]*template.Template, len(names))
+	for _, file := range names {
+		name := strings.TrimSuffix(file, ".html")
+		tmpl, err := rd.parse(file)
+		if err != nil {
+			return err
+		}
+		pages[name] = tmpl
+	}
+
+	rd.mu.Lock()
+	rd.pages = pages
+	rd.mu.Unlock()
+	return nil
+}
+
+func (rd *Renderer) parse(file string) (*template.Template, error) {
+	tmpl := template.New(path.Base(file)).Funcs(Funcs)
+	for _, glob := range []string{layoutGlob, partialGlob} {
+		matches, err := fs.Glob(rd.fsys, glob)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		if tmpl, err = tmpl.ParseFS(rd.fsys, matches...); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", glob, err)
+		}
+	}
+	tmpl, err := tmpl.ParseFS(rd.fsys, file)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	return tmpl, nil
+}
+
+func (rd *Renderer) lookup(name string) (*template.Template, error) {
+	if rd.dev {
+		return rd.parse(name + ".html")
+	}
+	rd.mu.RLock()
+	defer rd.mu.RUnlock()
+	tmpl, ok := rd.pages[name]
+	if !ok {
+		return nil, fmt.Errorf("template %q not found", name)
+	}
+	return tmpl, nil
+}
+
+// Render executes the named page with a 200 status.
+func (rd *Renderer) Render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	rd.RenderStatus(w, r, http.StatusOK, name, data)
+}
+
+// RenderStatus executes the named page into a buffer and only writes it once
+// execution has succeeded, so a failing template never produces half a page.
+// Failures are logged and answered with the error page.
+func (rd *Renderer) RenderStatus(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}) {
+	buf, err := rd.execute(r, name, data)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error rendering template", "template", name, "err", err)
+		rd.Error(w, r, http.StatusInternalServerError, "Something went wrong while loading this page.")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// ErrorData is passed to the error page.
+type ErrorData struct {
+	Status  int
+	Title   string
+	Message string
+}
+
+// Error renders the error page. If the error page itself cannot be rendered
+// it falls back to a plain-text response.
+func (rd *Renderer) Error(w http.ResponseWriter, r *http.Request, status int, message string) {
+	data := ErrorData{Status: status, Title: http.StatusText(status), Message: message}
+	buf, err := rd.execute(r, errorPage, data)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error rendering error page", "err", err)
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// execute runs a clone of the named page with the request-bound funcs. The
+// cached sets are never executed themselves, since html/template cannot
+// clone a template after it has run.
+func (rd *Renderer) execute(r *http.Request, name string, data interface{}) (*bytes.Buffer, error) {
+	page, err := rd.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := page.Clone()
+	if err != nil {
+		return nil, err
+	}
+	tmpl.Funcs(requestFuncs(r))
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "base", data); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
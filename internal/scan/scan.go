@@ -0,0 +1,161 @@
+// Package scan checks uploaded documents for malware in the background.
+// Uploads are quarantined, and cannot be opened, until their scan passes;
+// infected files, and those too large for clamd to scan, are deleted and
+// whoever uploaded them is told. Income documents that pass are then queued
+// for extraction.
+package scan
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/clamav"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/extract"
+	"MortgageAgent/internal/jobs"
+	"MortgageAgent/internal/models"
+	"MortgageAgent/internal/notify"
+)
+
+// Kind is the kind of job that scans one document.
+const Kind = "document_scan"
+
+type payload struct {
+	DocumentID int `json:"document_id"`
+}
+
+// Enqueue queues a scan of the document.
+func Enqueue(database *sql.DB, documentID int) error {
+	_, err := jobs.Enqueue(database, Kind, payload{DocumentID: documentID},
+		jobs.Options{UniqueKey: "scan:document:" + strconv.Itoa(documentID)})
+	return err
+}
+
+// QueuePending queues a scan of every document still waiting for one, such
+// as those stored before scanning was set up or whose scan job died, and
+// returns how many there were.
+func QueuePending(database *sql.DB) (int, error) {
+	ids, err := db.GetPendingDocuments(database)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := Enqueue(database, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// Document is the handler for Kind jobs. A scan that cannot reach clamd is
+// retried; with clamd not configured it goes to the dead letters, and the
+// document stays quarantined until it is retried. A file over clamd's
+// stream size limit is rejected like an infected one, as it would never
+// pass.
+func Document(database *sql.DB) jobs.Handler {
+	return func(ctx context.Context, data []byte) error {
+		var p payload
+		if err := json.Unmarshal(data, &p); err != nil {
+			return jobs.Permanent(err)
+		}
+		doc, err := db.GetDocumentByID(database, p.DocumentID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if doc.ScanStatus != models.ScanPending {
+			return nil
+		}
+
+		f, err := os.Open(doc.FilePath)
+		if err != nil {
+			return jobs.Permanent(err)
+		}
+		defer f.Close()
+		scanned, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		result, err := clamav.Scan(ctx, f)
+		if errors.Is(err, clamav.ErrDisabled) {
+			return jobs.Permanent(err)
+		}
+		tooLarge := errors.Is(err, clamav.ErrTooLarge)
+		if err != nil && !tooLarge {
+			return err
+		}
+		// A newer upload replaced the file while it was being scanned; that
+		// upload's own scan decides for every record of it
+		if current, err := os.Stat(doc.FilePath); err != nil || !os.SameFile(scanned, current) {
+			return nil
+		}
+
+		app, err := db.GetApplicationByID(database, strconv.Itoa(doc.ApplicationID))
+		if err != nil {
+			return err
+		}
+		if tooLarge {
+			return reject(database, app, doc, models.ScanTooLarge, "too large to scan")
+		}
+		if !result.Infected {
+			if err := db.SetDocumentScan(database, doc.FilePath, doc.ID, models.ScanClean, "", time.Now()); err != nil {
+				return err
+			}
+			notify.UploadScanned(app)
+			if extract.Supports(doc.Category) {
+				if err := extract.Enqueue(database, doc.ID); err != nil {
+					slog.Error("Error queueing extraction", "document_id", doc.ID, "err", err)
+				}
+			}
+			return nil
+		}
+		return reject(database, app, doc, models.ScanInfected, result.Signature)
+	}
+}
+
+// reject gives doc the scan status, with result the signature found or why
+// it was not scanned, deletes its file and tells the uploader.
+func reject(database *sql.DB, app *models.Application, doc *db.Document, status, result string) error {
+	logger := slog.With("document_id", doc.ID, "application_id", doc.ApplicationID, "result", result)
+	if err := db.SetDocumentScan(database, doc.FilePath, doc.ID, status, result, time.Now()); err != nil {
+		return err
+	}
+	logger.Warn("Upload rejected by the virus scan")
+	if err := os.Remove(doc.FilePath); err != nil && !os.IsNotExist(err) {
+		logger.Error("Error deleting rejected upload", "err", err)
+	}
+	audit.RecordSystem(database, audit.Entry{
+		ActorEmail: "virus-scan", Action: audit.DocumentRejected, ResourceType: audit.ResourceDocument,
+		ResourceID: strconv.Itoa(doc.ID), Details: "application " + strconv.Itoa(doc.ApplicationID) + ", " + doc.Category + ": " + result,
+	})
+
+	uploaderID := doc.UploadedBy
+	if uploaderID == 0 {
+		uploaderID = app.BrokerID
+	}
+	uploader, err := db.GetUserByID(database, uploaderID)
+	if err != nil {
+		logger.Error("Error loading uploader of rejected file", "err", err)
+		return nil
+	}
+	filename := filepath.Base(doc.FilePath)
+	if status == models.ScanTooLarge {
+		err = notify.UploadTooLarge(database, app, uploader, doc.Category, filename)
+	} else {
+		err = notify.UploadRejected(database, app, uploader, doc.Category, filename, result)
+	}
+	if err != nil {
+		logger.Error("Error notifying uploader of rejected file", "err", err)
+	}
+	return nil
+}
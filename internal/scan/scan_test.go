@@ -0,0 +1,238 @@
+package scan
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"MortgageAgent/internal/audit"
+	"MortgageAgent/internal/clamav"
+	"MortgageAgent/internal/clamav/clamavtest"
+	"MortgageAgent/internal/db"
+	"MortgageAgent/internal/extract"
+	"MortgageAgent/internal/jobs"
+	"MortgageAgent/internal/models"
+)
+
+type fixture struct {
+	db         *sql.DB
+	brokerID   int
+	borrowerID int
+	appID      int
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	database, err := db.InitDB(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := db.MigrateDB(database); err != nil {
+		t.Fatal(err)
+	}
+	f := &fixture{db: database}
+	f.brokerID = f.exec(t, `INSERT INTO users (first_name, last_name, email, password_hash, user_type)
+        VALUES ('Bo', 'Broker', 'bo@example.com', '', 'broker')`)
+	f.borrowerID = f.exec(t, `INSERT INTO users (first_name, last_name, email, password_hash, user_type)
+        VALUES ('Bea', 'Borrower', 'bea@example.com', '', 'borrower')`)
+	f.appID = f.exec(t, `INSERT INTO applications (broker_id, application_type, status) VALUES (?, 'self', 'draft')`, f.brokerID)
+	return f
+}
+
+func (f *fixture) exec(t *testing.T, query string, args ...interface{}) int {
+	t.Helper()
+	res, err := f.db.Exec(query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id)
+}
+
+// upload stores content as a pending document uploaded by uploaderID.
+func (f *fixture) upload(t *testing.T, category, content string, uploaderID int) *db.Document {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "upload.pdf")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	id := f.exec(t, `INSERT INTO documents (application_id, category, file_path, scan_status, uploaded_by) VALUES (?, ?, ?, ?, ?)`,
+		f.appID, category, path, models.ScanPending, uploaderID)
+	return f.document(t, id)
+}
+
+func (f *fixture) document(t *testing.T, id int) *db.Document {
+	t.Helper()
+	doc, err := db.GetDocumentByID(f.db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func (f *fixture) run(doc *db.Document) error {
+	data, _ := json.Marshal(payload{DocumentID: doc.ID})
+	return Document(f.db)(context.Background(), data)
+}
+
+// queued returns the payloads of the queued jobs of kind.
+func (f *fixture) queued(t *testing.T, kind string) []string {
+	t.Helper()
+	all, err := db.GetJobs(f.db, models.JobQueued, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payloads []string
+	for _, j := range all {
+		if j.Kind == kind {
+			payloads = append(payloads, j.Payload)
+		}
+	}
+	return payloads
+}
+
+// useClamd points scans at a fake clamd for the rest of the test.
+func useClamd(t *testing.T) *clamavtest.Server {
+	srv := clamavtest.NewServer()
+	t.Cleanup(srv.Close)
+	clamav.Configure(clamav.Config{Address: srv.Address})
+	t.Cleanup(func() { clamav.Configure(clamav.Config{}) })
+	return srv
+}
+
+func TestDocumentClean(t *testing.T) {
+	f := newFixture(t)
+	srv := useClamd(t)
+	doc := f.upload(t, "Proof_of_income", "%PDF-1.4 pay stub", f.brokerID)
+
+	if err := f.run(doc); err != nil {
+		t.Fatal(err)
+	}
+	got := f.document(t, doc.ID)
+	if got.ScanStatus != models.ScanClean || !got.Clean() {
+		t.Errorf("scan status %q, want it released as clean", got.ScanStatus)
+	}
+	if _, err := os.Stat(doc.FilePath); err != nil {
+		t.Errorf("clean file: %v", err)
+	}
+	if len(f.queued(t, extract.Kind)) != 1 {
+		t.Error("extraction not queued for a clean income document")
+	}
+
+	// A document that was already scanned is not scanned again
+	if err := f.run(doc); err != nil || srv.Scans() != 1 {
+		t.Errorf("second run: %v after %d scans, want 1", err, srv.Scans())
+	}
+}
+
+func TestDocumentRejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		maxLength  int64
+		borrower   bool
+		wantStatus string
+		wantResult string
+		wantBody   string
+	}{
+		{"infected", "preamble " + clamavtest.EICAR, 0, false, models.ScanInfected, clamavtest.Signature, "found " + clamavtest.Signature},
+		{"infected borrower upload", clamavtest.EICAR, 0, true, models.ScanInfected, clamavtest.Signature, "found " + clamavtest.Signature},
+		{"too large to scan", strings.Repeat("x", 1024), 100, false, models.ScanTooLarge, "too large to scan", "too large for the virus scan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			srv := useClamd(t)
+			srv.StreamMaxLength = tt.maxLength
+			uploader := f.brokerID
+			if tt.borrower {
+				uploader = f.borrowerID
+			}
+			doc := f.upload(t, "Proof_of_income", tt.content, uploader)
+
+			if err := f.run(doc); err != nil {
+				t.Fatal(err)
+			}
+			got := f.document(t, doc.ID)
+			if got.ScanStatus != tt.wantStatus || got.ScanResult != tt.wantResult || got.Clean() {
+				t.Errorf("scan %q (%q), want %q (%q)", got.ScanStatus, got.ScanResult, tt.wantStatus, tt.wantResult)
+			}
+			if _, err := os.Stat(doc.FilePath); !os.IsNotExist(err) {
+				t.Errorf("rejected file still stored: %v", err)
+			}
+			if len(f.queued(t, extract.Kind)) != 0 {
+				t.Error("extraction queued for a rejected document")
+			}
+
+			// Brokers get a notification, borrowers an email
+			var body string
+			if tt.borrower {
+				emails := f.queued(t, jobs.KindEmail)
+				if len(emails) != 1 {
+					t.Fatalf("%d emails queued, want 1", len(emails))
+				}
+				var p jobs.EmailPayload
+				json.Unmarshal([]byte(emails[0]), &p)
+				if p.To != "bea@example.com" {
+					t.Errorf("emailed %s", p.To)
+				}
+				body = p.Body
+			} else {
+				notes, err := db.GetNotifications(f.db, f.brokerID, 10)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(notes) != 1 || notes[0].Kind != models.NotifyUploadRejected {
+					t.Fatalf("broker notifications %+v, want one upload rejection", notes)
+				}
+				body = notes[0].Body
+			}
+			if !strings.Contains(body, tt.wantBody) || !strings.Contains(body, "upload.pdf") {
+				t.Errorf("uploader told %q, want it to name the file and say %q", body, tt.wantBody)
+			}
+
+			events, _, err := db.SearchAuditEvents(f.db, db.AuditFilter{Action: audit.DocumentRejected})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0].ResourceID != strconv.Itoa(doc.ID) {
+				t.Errorf("audit events %+v, want the rejection of document %d", events, doc.ID)
+			}
+		})
+	}
+}
+
+// Scans that may pass next time keep the document quarantined and are
+// retried.
+func TestDocumentRetried(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*clamavtest.Server)
+	}{
+		{"clamd error", func(srv *clamavtest.Server) { srv.Reply = "Can't allocate memory ERROR" }},
+		{"clamd down", func(srv *clamavtest.Server) { srv.Close() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			tt.setup(useClamd(t))
+			doc := f.upload(t, "Proof_of_income", clamavtest.EICAR, f.brokerID)
+
+			if err := f.run(doc); err == nil {
+				t.Fatal("scan succeeded")
+			}
+			if got := f.document(t, doc.ID); got.ScanStatus != models.ScanPending {
+				t.Errorf("scan status %q, want pending", got.ScanStatus)
+			}
+			if _, err := os.Stat(doc.FilePath); err != nil {
+				t.Errorf("quarantined file: %v", err)
+			}
+		})
+	}
+}
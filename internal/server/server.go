@@ -0,0 +1,137 @@
+// Package server runs the HTTP server with the timeouts, TLS settings and
+// security headers the application is deployed with.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"MortgageAgent/internal/config"
+)
+
+// readHeaderTimeout stops clients holding connections open by sending
+// headers slowly; it is not worth configuring separately.
+const readHeaderTimeout = 10 * time.Second
+
+// minTransferRate is the slowest connection, in bytes a second, that
+// LimitUpload and AllowDownload give time to send a whole file: about
+// 0.5 Mbit/s.
+const minTransferRate = 64 << 10
+
+// transferDeadline is when a transfer of size bytes started now should
+// have finished at minTransferRate, with a minute to spare.
+func transferDeadline(size int64) time.Time {
+	return time.Now().Add(time.Minute + time.Duration(size/minTransferRate)*time.Second)
+}
+
+// LimitUpload caps the body of r at limit bytes and moves the connection's
+// read and write deadlines so that a body of that size, or of its
+// Content-Length if smaller, can arrive at minTransferRate and still be
+// answered. Upload handlers call it before reading the body; every other
+// request keeps READ_TIMEOUT and WRITE_TIMEOUT.
+func LimitUpload(w http.ResponseWriter, r *http.Request, limit int64) {
+	size := limit
+	if r.ContentLength > 0 && r.ContentLength < limit {
+		size = r.ContentLength
+	}
+	deadline := transferDeadline(size)
+	// Writers without deadlines, such as test recorders, have none to move
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(deadline)
+	rc.SetWriteDeadline(deadline)
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+}
+
+// AllowDownload moves the connection's write deadline so that a response of
+// size bytes can be sent at minTransferRate. Download handlers call it
+// before writing the file; other responses keep WRITE_TIMEOUT.
+func AllowDownload(w http.ResponseWriter, size int64) {
+	// Writers without deadlines, such as test recorders, have none to move
+	http.NewResponseController(w).SetWriteDeadline(transferDeadline(size))
+}
+
+// Server is the application's HTTP(S) server plus, when TLS is enabled, an
+// optional plain-HTTP server that redirects to it.
+type Server struct {
+	cfg      config.Config
+	main     *http.Server
+	redirect *http.Server
+}
+
+// New wraps handler with the security headers and configures the servers
+// described by cfg.
+func New(cfg config.Config, handler http.Handler) *Server {
+	s := &Server{cfg: cfg}
+	s.main = &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           SecurityHeaders(handler, cfg.TLS()),
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	if cfg.TLS() {
+		s.main.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if cfg.RedirectAddr != "" {
+			s.redirect = &http.Server{
+				Addr:              cfg.RedirectAddr,
+				Handler:           redirectToHTTPS(cfg.Addr),
+				ReadTimeout:       readHeaderTimeout,
+				ReadHeaderTimeout: readHeaderTimeout,
+				WriteTimeout:      readHeaderTimeout,
+				IdleTimeout:       cfg.IdleTimeout,
+			}
+		}
+	}
+	return s
+}
+
+// ListenAndServe serves until the server fails or Shutdown is called, in
+// which case it returns http.ErrServerClosed.
+func (s *Server) ListenAndServe() error {
+	if s.redirect != nil {
+		go func() {
+			slog.Info("Redirecting HTTP to HTTPS", "addr", s.redirect.Addr)
+			if err := s.redirect.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("HTTP redirect server failed", "err", err)
+			}
+		}()
+	}
+
+	if s.cfg.TLS() {
+		slog.Info("Server running", "addr", s.cfg.Addr, "tls", true)
+		return s.main.ListenAndServeTLS(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+	}
+	slog.Info("Server running", "addr", s.cfg.Addr, "tls", false)
+	return s.main.ListenAndServe()
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests,
+// such as uploads, to finish until ctx ends.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.redirect != nil {
+		s.redirect.Shutdown(ctx)
+	}
+	return s.main.Shutdown(ctx)
+}
+
+// redirectToHTTPS sends every request to the same host and path on the
+// HTTPS listener at httpsAddr.
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowBody sends n bytes a few at a time, taking longer than the server's
+// read timeout.
+type slowBody struct {
+	n     int
+	delay time.Duration
+}
+
+func (b *slowBody) Read(p []byte) (int, error) {
+	if b.n == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(b.delay)
+	n := min(len(p), b.n, 16)
+	copy(p, strings.Repeat("x", n))
+	b.n -= n
+	return n, nil
+}
+
+func TestLimitUpload(t *testing.T) {
+	tests := []struct {
+		name   string
+		upload bool
+		limit  int64
+		want   int
+	}{
+		{"upload outlasts the read timeout", true, 1 << 20, http.StatusOK},
+		{"other requests keep the read timeout", false, 0, http.StatusBadRequest},
+		{"upload over the limit", true, 64, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.upload {
+					LimitUpload(w, r, tt.limit)
+				}
+				if _, err := io.ReadAll(r.Body); err != nil {
+					status := http.StatusBadRequest
+					var tooLarge *http.MaxBytesError
+					if errors.As(err, &tooLarge) {
+						status = http.StatusRequestEntityTooLarge
+					}
+					w.WriteHeader(status)
+					return
+				}
+			}))
+			srv.Config.ReadTimeout = 200 * time.Millisecond
+			srv.Config.WriteTimeout = 200 * time.Millisecond
+			srv.Start()
+			defer srv.Close()
+
+			req, err := http.NewRequest(http.MethodPost, srv.URL, &slowBody{n: 160, delay: 50 * time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.ContentLength = 160
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				// The server gave up on the body and closed the connection
+				if tt.want == http.StatusOK {
+					t.Fatal(err)
+				}
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowDownload(t *testing.T) {
+	for _, allow := range []bool{true, false} {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if allow {
+				AllowDownload(w, 160)
+			}
+			// Write the file a few bytes at a time, taking longer than the
+			// server's write timeout
+			for i := 0; i < 10; i++ {
+				time.Sleep(50 * time.Millisecond)
+				w.Write([]byte(strings.Repeat("x", 16)))
+				http.NewResponseController(w).Flush()
+			}
+		}))
+		srv.Config.WriteTimeout = 200 * time.Millisecond
+		srv.Start()
+
+		var n int
+		resp, err := srv.Client().Get(srv.URL)
+		if err == nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			n = len(body)
+		}
+		srv.Close()
+		if complete := n == 160; complete != allow {
+			t.Errorf("AllowDownload %v: received %d of 160 bytes", allow, n)
+		}
+	}
+}
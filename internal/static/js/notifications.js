@@ -0,0 +1,92 @@
+// Listens for the user's notifications and dashboard updates on the live
+// event stream, keeping the bell's unread count current, showing new
+// notifications as they arrive and refreshing the page's live regions.
+document.addEventListener('DOMContentLoaded', function() {
+    if (!window.EventSource) {
+        return;
+    }
+    const counts = document.querySelectorAll('[data-notification-count]');
+    const list = document.querySelector('[data-notification-list]');
+    const source = new EventSource('/notifications/stream');
+
+    function setUnread(n) {
+        counts.forEach((badge) => {
+            badge.textContent = n;
+            badge.hidden = n === 0;
+        });
+    }
+
+    function toast(notification) {
+        let box = document.querySelector('.notification-toasts');
+        if (!box) {
+            box = document.createElement('div');
+            box.className = 'notification-toasts';
+            document.body.appendChild(box);
+        }
+        const link = document.createElement('a');
+        link.className = 'notification-toast';
+        link.href = '/notifications/open?id=' + encodeURIComponent(notification.id);
+        const title = document.createElement('strong');
+        title.textContent = notification.title;
+        link.appendChild(title);
+        link.appendChild(document.createTextNode(notification.body));
+        box.appendChild(link);
+        setTimeout(() => link.remove(), 8000);
+    }
+
+    function prepend(notification) {
+        const item = document.createElement('li');
+        item.className = 'notification notification-unread';
+        const link = document.createElement('a');
+        link.href = '/notifications/open?id=' + encodeURIComponent(notification.id);
+        link.textContent = notification.title;
+        const body = document.createElement('p');
+        body.textContent = notification.body;
+        item.appendChild(link);
+        item.appendChild(body);
+        list.prepend(item);
+        const empty = document.querySelector('[data-notification-empty]');
+        if (empty) {
+            empty.remove();
+        }
+    }
+
+    // Dashboard events often come in bursts, so refresh once they settle
+    let refreshTimer = null;
+    function refresh() {
+        const regions = document.querySelectorAll('[data-live-region]');
+        if (regions.length === 0) {
+            return;
+        }
+        fetch(window.location.href, {credentials: 'same-origin'})
+            .then((response) => response.ok ? response.text() : null)
+            .then((html) => {
+                if (!html) {
+                    return;
+                }
+                const page = new DOMParser().parseFromString(html, 'text/html');
+                regions.forEach((region) => {
+                    const fresh = page.getElementById(region.id);
+                    if (fresh) {
+                        region.replaceChildren(...fresh.childNodes);
+                    }
+                });
+            })
+            .catch(() => {});
+    }
+
+    source.addEventListener('unread', (e) => setUnread(JSON.parse(e.data).unread));
+    source.addEventListener('notification', (e) => {
+        const notification = JSON.parse(e.data);
+        setUnread(notification.unread);
+        if (list) {
+            prepend(notification);
+        } else {
+            toast(notification);
+        }
+    });
+    source.addEventListener('dashboard', () => {
+        clearTimeout(refreshTimer);
+        refreshTimer = setTimeout(refresh, 1000);
+    });
+});
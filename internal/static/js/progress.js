@@ -0,0 +1,35 @@
+// Keeps the application form's checklist and borrower status current while
+// the borrower uploads documents and signs the e-consent.
+document.addEventListener('DOMContentLoaded', function() {
+    const box = document.querySelector('#application-progress');
+    if (!box || box.dataset.poll !== 'true') {
+        return;
+    }
+    const url = '/application-progress?id=' + encodeURIComponent(box.dataset.applicationId);
+
+    function update(progress) {
+        for (const [category, count] of Object.entries(progress.documents)) {
+            const item = box.querySelector('.checklist-item[data-category="' + category + '"]');
+            if (!item) {
+                continue;
+            }
+            item.classList.toggle('is-done', count > 0);
+            item.querySelector('.checklist-state').textContent = count > 0 ? 'Uploaded (' + count + ')' : 'Outstanding';
+        }
+        box.querySelector('#borrower-state').textContent = progress.borrower;
+        box.querySelector('#consent-state').textContent = progress.consent;
+    }
+
+    function poll() {
+        if (document.hidden) {
+            return;
+        }
+        fetch(url, {credentials: 'same-origin', headers: {'Accept': 'application/json'}})
+            .then((response) => response.ok ? response.json() : null)
+            .then((progress) => progress && update(progress))
+            .catch(() => {});
+    }
+
+    setInterval(poll, 10000);
+    document.addEventListener('visibilitychange', poll);
+});
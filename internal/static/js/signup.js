@@ -32,6 +32,13 @@ document.addEventListener('DOMContentLoaded', function() {
         openEyeIconConfirm.style.display = 'none';
         closedEyeIconConfirm.style.display = 'block';
     });
+
+    // Bound here rather than with onsubmit so the CSP can forbid inline handlers
+    document.querySelector('#signup-form').addEventListener('submit', (event) => {
+        if (!validatePasswords()) {
+            event.preventDefault();
+        }
+    });
 });
 
 function validatePasswords() {
@@ -0,0 +1,151 @@
+// Package storage saves uploaded documents to disk.
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"MortgageAgent/internal/metrics"
+)
+
+// BaseDir is the directory uploads are stored under.
+const BaseDir = "uploads"
+
+// Uploads in progress are written to hidden files named with tempPrefix.
+const (
+	tempPrefix  = ".upload-"
+	tempPattern = tempPrefix + "*"
+)
+
+// ErrInvalidFilename is returned for uploads without a usable file name.
+var ErrInvalidFilename = errors.New("invalid file name")
+
+// SaveUpload copies an uploaded file to uploads/<applicationID>/<category>/
+// and returns the path it was written to.
+func SaveUpload(applicationID int, category string, file multipart.File, header *multipart.FileHeader) (string, error) {
+	return saveUpload(applicationID, category, false, file, header)
+}
+
+// SaveAttachment is SaveUpload for files attached to messages. Each is kept
+// in a directory of its own under the category, so a later file of the
+// same name, from anyone, never replaces it.
+func SaveAttachment(applicationID int, category string, file multipart.File, header *multipart.FileHeader) (string, error) {
+	return saveUpload(applicationID, category, true, file, header)
+}
+
+func saveUpload(applicationID int, category string, unique bool, file multipart.File, header *multipart.FileHeader) (filePath string, err error) {
+	start := time.Now()
+	var written int64
+	defer func() { metrics.ObserveUpload(category, written, time.Since(start), err) }()
+
+	// Only keep the final element of the client-supplied name so it cannot
+	// escape the upload directory.
+	name := filepath.Base(strings.ReplaceAll(header.Filename, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		return "", ErrInvalidFilename
+	}
+	filePath, written, err = save(applicationID, category, name, unique, file)
+	return filePath, err
+}
+
+// SaveGenerated writes a document produced by the system, such as a
+// payment schedule, to uploads/<applicationID>/<category>/<name> and
+// returns its path.
+func SaveGenerated(applicationID int, category, name string, content io.Reader) (string, error) {
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return "", ErrInvalidFilename
+	}
+	filePath, _, err := save(applicationID, category, name, false, content)
+	return filePath, err
+}
+
+// save copies content into place under BaseDir, in a new directory of its
+// own if unique is set.
+func save(applicationID int, category, name string, unique bool, content io.Reader) (filePath string, written int64, err error) {
+	uploadDir := filepath.Join(BaseDir, strconv.Itoa(applicationID), category)
+	if err := os.MkdirAll(uploadDir, 0750); err != nil {
+		return "", 0, err
+	}
+	if unique {
+		if uploadDir, err = os.MkdirTemp(uploadDir, ""); err != nil {
+			return "", 0, err
+		}
+		defer func() {
+			if err != nil {
+				os.Remove(uploadDir)
+			}
+		}()
+	}
+
+	// Write to a temporary file and rename it into place once complete, so
+	// an upload interrupted by a crash or shutdown never leaves a partial
+	// file under the real name.
+	tmp, err := os.CreateTemp(uploadDir, tempPattern)
+	if err != nil {
+		return "", 0, err
+	}
+	if written, err = io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", written, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", written, err
+	}
+
+	filePath = filepath.Join(uploadDir, name)
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		os.Remove(tmp.Name())
+		return "", written, err
+	}
+	return filePath, written, nil
+}
+
+// CheckWritable verifies that new files can be created under BaseDir.
+func CheckWritable() error {
+	if err := os.MkdirAll(BaseDir, 0750); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(BaseDir, tempPattern)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// RemoveStaleTemp deletes temporary upload files older than maxAge, left
+// behind if the process was killed mid-upload, and returns how many it
+// removed.
+func RemoveStaleTemp(maxAge time.Duration) (int, error) {
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	err := filepath.WalkDir(BaseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasPrefix(d.Name(), tempPrefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err == nil {
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"bytes"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// upload returns a form file named name holding content.
+func upload(t *testing.T, name, content string) (multipart.File, *multipart.FileHeader) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte(content))
+	mw.Close()
+	form, err := multipart.NewReader(&body, mw.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	header := form.File["file"][0]
+	file, err := header.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file, header
+}
+
+// inTempDir runs the test from an empty directory, as uploads are saved
+// relative to the working directory.
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestSaveUploadReplaces(t *testing.T) {
+	inTempDir(t)
+	file, header := upload(t, "stub.pdf", "first")
+	first, err := SaveUpload(7, "Proof_of_income", file, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, header = upload(t, "stub.pdf", "second")
+	second, err := SaveUpload(7, "Proof_of_income", file, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(BaseDir, "7", "Proof_of_income", "stub.pdf"); first != want || second != want {
+		t.Errorf("saved to %s and %s, want %s", first, second, want)
+	}
+}
+
+func TestSaveAttachmentUnique(t *testing.T) {
+	inTempDir(t)
+	var paths []string
+	for _, content := range []string{"internal note", "broker message"} {
+		file, header := upload(t, "notes.pdf", content)
+		p, err := SaveAttachment(7, "Message_attachment", file, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Base(p) != "notes.pdf" || !strings.HasPrefix(p, filepath.Join(BaseDir, "7", "Message_attachment")+string(filepath.Separator)) {
+			t.Errorf("saved to %s", p)
+		}
+		paths = append(paths, p)
+	}
+	if paths[0] == paths[1] {
+		t.Fatalf("both attachments saved to %s", paths[0])
+	}
+	got, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "internal note" {
+		t.Errorf("first attachment holds %q, want it kept", got)
+	}
+}
+
+func TestSaveUploadInvalidName(t *testing.T) {
+	inTempDir(t)
+	for _, name := range []string{"..", "/", `..\`} {
+		file, header := upload(t, name, "x")
+		if _, err := SaveAttachment(7, "Message_attachment", file, header); err != ErrInvalidFilename {
+			t.Errorf("%q: err = %v, want ErrInvalidFilename", name, err)
+		}
+	}
+}
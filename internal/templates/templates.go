@@ -0,0 +1,11 @@
+// Package templates embeds the HTML templates so the binary does not depend
+// on the working directory it is started from.
+package templates
+
+import "embed"
+
+// FS holds every page, layout and partial template, and the plain-text
+// email templates.
+//
+//go:embed *.html layouts/*.html partials/*.html email/*.txt
+var FS embed.FS